@@ -4,21 +4,34 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/enjoys-in/secureflow/internal/api"
 	"github.com/enjoys-in/secureflow/internal/config"
 	"github.com/enjoys-in/secureflow/internal/constants"
+	"github.com/enjoys-in/secureflow/internal/convert"
 	"github.com/enjoys-in/secureflow/internal/db"
 	"github.com/enjoys-in/secureflow/internal/fga"
 	"github.com/enjoys-in/secureflow/internal/firewall"
+	"github.com/enjoys-in/secureflow/internal/fqdn"
+	"github.com/enjoys-in/secureflow/internal/geoip"
+	"github.com/enjoys-in/secureflow/internal/honeypot"
+	"github.com/enjoys-in/secureflow/internal/jail"
+	"github.com/enjoys-in/secureflow/internal/knock"
+	"github.com/enjoys-in/secureflow/internal/portscan"
 	"github.com/enjoys-in/secureflow/internal/realtime"
 	"github.com/enjoys-in/secureflow/internal/repository"
+	"github.com/enjoys-in/secureflow/internal/scheduler"
 	"github.com/enjoys-in/secureflow/internal/security"
+	"github.com/enjoys-in/secureflow/internal/templates"
+	"github.com/enjoys-in/secureflow/internal/threatfeed"
 	"github.com/enjoys-in/secureflow/internal/websocket"
 	"github.com/enjoys-in/secureflow/pkg/logger"
+	"github.com/enjoys-in/secureflow/pkg/utils"
 )
 
 func main() {
@@ -59,6 +72,26 @@ func main() {
 	invRepo := repository.NewInvitationRepository(conn)
 	portRepo := repository.NewImmutablePortRepository(conn)
 	blockedIPRepo := repository.NewBlockedIPRepository(conn)
+	revisionRepo := repository.NewSecurityGroupRevisionRepository(conn)
+	addrObjRepo := repository.NewAddressObjectRepository(conn)
+	svcObjRepo := repository.NewServiceObjectRepository(conn)
+	serverRepo := repository.NewServerRepository(conn)
+	natRuleRepo := repository.NewNATRuleRepository(conn)
+	scheduleRepo := repository.NewScheduleRepository(conn)
+	jitPolicyRepo := repository.NewJITPolicyRepository(conn)
+	jitGrantRepo := repository.NewJITGrantRepository(conn)
+	knockGateRepo := repository.NewKnockGateRepository(conn)
+	fqdnRepo := repository.NewFQDNResolutionRepository(conn)
+	threatFeedRepo := repository.NewThreatFeedRepository(conn)
+	jailRepo := repository.NewJailRepository(conn)
+	honeypotRepo := repository.NewHoneypotRepository(conn)
+
+	// Register this host so applied security groups can be tracked against it
+	hostname, _ := os.Hostname()
+	localServer, err := serverRepo.EnsureLocal(context.Background(), hostname, utils.PrimaryIPv4())
+	if err != nil {
+		appLogger.Fatal("Failed to register local server", "error", err)
+	}
 
 	// Seed default immutable ports
 	if err := repository.SeedDefaultPorts(context.Background(), portRepo, constants.DefaultImmutablePorts, constants.ServicePortNames); err != nil {
@@ -88,30 +121,223 @@ func main() {
 		appLogger.Fatal("Failed to init firewall manager", "error", err)
 	}
 
+	// Rules referencing a security group match the IPs of servers it is applied
+	// to; address and service objects are expanded from their stored contents,
+	// hostnames from DNS, country codes from the GeoIP database and threat
+	// feeds from their stored entries
+	fqdnResolver := fqdn.NewResolver(cfg.DNSServer, fqdnRepo, fwManager, appLogger)
+	var geoDB *geoip.DB
+	if cfg.GeoIPDatabase != "" {
+		if geoDB, err = geoip.Open(cfg.GeoIPDatabase, fwManager, appLogger); err != nil {
+			appLogger.Error("Failed to load GeoIP database (country rules disabled)", "error", err)
+		}
+	}
+	fwManager.SetAddressResolver(func(kind, id string) ([]string, error) {
+		switch kind {
+		case firewall.RefSecurityGroup:
+			return sgRepo.ListMemberAddresses(context.Background(), id)
+		case firewall.RefAddressObject:
+			obj, err := addrObjRepo.FindByID(context.Background(), id)
+			if err != nil {
+				return nil, err
+			}
+			return obj.Addresses, nil
+		case firewall.RefFQDN:
+			return fqdnResolver.Addresses(id)
+		case firewall.RefCountry:
+			if geoDB == nil {
+				return nil, constants.ErrGeoIPUnavailable
+			}
+			return geoDB.Addresses(id)
+		case firewall.RefThreatFeed:
+			return blockedIPRepo.ListFeedIPs(context.Background(), id, "blocked")
+		case firewall.RefJail:
+			return blockedIPRepo.ListJailIPs(context.Background(), id, "blocked")
+		case firewall.RefDetector:
+			return blockedIPRepo.ListDetectorIPs(context.Background(), id, "blocked")
+		default:
+			return nil, fmt.Errorf("unknown reference kind %q", kind)
+		}
+	})
+	fwManager.SetServiceResolver(func(id string) (*firewall.Service, error) {
+		obj, err := svcObjRepo.FindByID(context.Background(), id)
+		if err != nil {
+			return nil, err
+		}
+		return &firewall.Service{Protocol: obj.Protocol, Ports: convert.PortRanges(obj.Ports)}, nil
+	})
+
 	// Ensure immutable ports are open on startup
 	if err := fwManager.EnsureImmutablePorts(); err != nil {
 		appLogger.Fatal("Failed to ensure immutable ports", "error", err)
 	}
 	appLogger.Info("Immutable ports enforced", "count", len(allPorts))
 
+	// Setup live traffic monitoring before rules are restored, so restored
+	// connection-limited rules also report their hits.
+	if err := fwManager.SetupTrafficMonitoring(realtime.NFLOGGroup); err != nil {
+		appLogger.Error("Failed to setup NFLOG rules (live traffic may not work)", "error", err)
+	}
+
+	// Re-install security groups that were active on this host before restart
+	appliedGroups, err := sgRepo.ListAppliedByServer(context.Background(), localServer.ID)
+	if err != nil {
+		appLogger.Fatal("Failed to load applied security groups", "error", err)
+	}
+	for _, sg := range appliedGroups {
+		dbRules, err := ruleRepo.FindBySecurityGroup(context.Background(), sg.ID)
+		if err != nil {
+			appLogger.Error("Failed to load security group rules", "group_id", sg.ID, "error", err)
+			continue
+		}
+		// Rules of a scheduled application stay parked until the scheduler
+		// reports the schedule active below.
+		fwManager.SetGroupSchedule(sg.ID, sg.ScheduleID)
+		if err := fwManager.ApplyGroup(sg.ID, convert.Rules(dbRules)); err != nil {
+			appLogger.Error("Failed to re-apply security group", "group_id", sg.ID, "error", err)
+		}
+	}
+	appLogger.Info("Applied security groups restored", "count", len(appliedGroups))
+
+	// Re-install this host's NAT rules
+	natRules, err := natRuleRepo.FindByServer(context.Background(), localServer.ID)
+	if err != nil {
+		appLogger.Fatal("Failed to load NAT rules", "error", err)
+	}
+	for _, r := range natRules {
+		rule := firewall.NATRule{
+			ID:         r.ID,
+			Type:       r.Type,
+			Interface:  r.Interface,
+			Protocol:   r.Protocol,
+			SourceCIDR: r.SourceCIDR,
+			DestCIDR:   r.DestCIDR,
+			Port:       r.Port,
+			PortEnd:    r.PortRangeEnd,
+			ToAddress:  r.ToAddress,
+			ToPort:     r.ToPort,
+		}
+		if err := fwManager.AddNATRule(rule); err != nil {
+			appLogger.Error("Failed to restore NAT rule", "rule_id", r.ID, "error", err)
+		}
+	}
+	if len(natRules) > 0 {
+		appLogger.Info("NAT rules restored", "count", len(natRules))
+	}
+
 	// Initialize WebSocket hub
 	hub := websocket.NewHub(appLogger)
 	go hub.Run()
 
-	// Setup live traffic monitoring (NFLOG → WebSocket)
-	if err := fwManager.SetupTrafficMonitoring(realtime.NFLOGGroup); err != nil {
-		appLogger.Error("Failed to setup NFLOG rules (live traffic may not work)", "error", err)
+	// Re-install the blocking rules of enabled threat feeds from their stored
+	// entries; fresh copies are fetched once the feeds come due below
+	threatFeeds := threatfeed.NewFetcher(threatFeedRepo, blockedIPRepo, auditRepo, fwManager, hub, appLogger)
+	if err := threatFeeds.Restore(context.Background()); err != nil {
+		appLogger.Error("Failed to restore threat feeds", "error", err)
+	}
+
+	// Install the rules of enabled jails with their current bans; the logs
+	// are tailed from their ends once the watcher runs below
+	jailWatcher := jail.NewWatcher(jailRepo, blockedIPRepo, auditRepo, fwManager, hub, appLogger)
+	if err := jailWatcher.Reload(context.Background()); err != nil {
+		appLogger.Error("Failed to load jails", "error", err)
+	}
+
+	// Close the ports of just-in-time policies; grants are inserted ahead of
+	// these rules as they are approved
+	jitPolicies, err := jitPolicyRepo.FindAll(context.Background(), nil, constants.MaxPageLimit, 0)
+	if err != nil {
+		appLogger.Error("Failed to load just-in-time policies", "error", err)
+	}
+	for _, p := range jitPolicies {
+		if err := fwManager.AddRule(convert.JITPolicyRule(p)); err != nil {
+			appLogger.Error("Failed to install just-in-time policy rule", "policy_id", p.ID, "error", err)
+		}
 	}
 
+	// Load security group templates (built-in + TEMPLATES_DIR)
+	templateLib, err := templates.Load(cfg.TemplatesDir, appLogger)
+	if err != nil {
+		appLogger.Fatal("Failed to load security group templates", "error", err)
+	}
+
+	// Live traffic monitoring (NFLOG → WebSocket)
 	trafficMonitor := realtime.NewNFLOGMonitor(appLogger)
 	trafficBridge := realtime.NewBridge(trafficMonitor, hub, appLogger)
+	if geoDB != nil {
+		trafficBridge.SetCountryLookup(geoDB.Country)
+	}
 	trafficCtx, trafficCancel := context.WithCancel(context.Background())
+
+	// Port knocking: watch the same traffic stream for knock sequences
+	knockDetector := knock.NewDetector(knockGateRepo, ruleRepo, auditRepo, fwManager, hub, appLogger)
+	if err := knockDetector.Reload(context.Background()); err != nil {
+		appLogger.Error("Failed to load knock gates", "error", err)
+	}
+	trafficBridge.Observe(knockDetector.Observe)
+	go knockDetector.Run(trafficCtx)
+
+	// Port-scan detection on the same stream, blocking offenders if enabled
+	if cfg.ScanDetection {
+		scanCfg := portscan.Config{
+			Window:          time.Duration(cfg.ScanWindowSeconds) * time.Second,
+			VerticalPorts:   cfg.ScanVerticalPorts,
+			HorizontalHosts: cfg.ScanHorizontalHosts,
+			SYNFloodPackets: cfg.ScanSYNFloodPackets,
+			AutoBlock:       cfg.ScanAutoBlock,
+			BlockFor:        time.Duration(cfg.ScanBlockSeconds) * time.Second,
+		}
+		for _, c := range cfg.ScanIgnoreCIDRs {
+			_, ipNet, _ := net.ParseCIDR(c)
+			scanCfg.Ignore = append(scanCfg.Ignore, ipNet)
+		}
+		scanDetector := portscan.NewDetector(scanCfg, blockedIPRepo, auditRepo, fwManager, hub, appLogger)
+		trafficBridge.Observe(scanDetector.Observe)
+		go scanDetector.Run(trafficCtx)
+	}
+
+	// Honeypots: bind listener-mode decoys and watch the stream for the rest
+	honeypots := honeypot.NewWatcher(honeypotRepo, blockedIPRepo, auditRepo, fwManager, hub, appLogger)
+	if err := honeypots.Reload(context.Background()); err != nil {
+		appLogger.Error("Failed to load honeypots", "error", err)
+	}
+	trafficBridge.Observe(honeypots.Observe)
+	go honeypots.Run(trafficCtx)
+
 	go func() {
 		if err := trafficBridge.Run(trafficCtx); err != nil && trafficCtx.Err() == nil {
 			appLogger.Error("Traffic monitor error", "error", err)
 		}
 	}()
 
+	// Scheduled rules: install those whose windows are open now, then follow
+	// the schedules as windows open and close
+	ruleScheduler := scheduler.New(scheduleRepo, auditRepo, fwManager, hub, appLogger)
+	if err := ruleScheduler.Sync(context.Background()); err != nil {
+		appLogger.Error("Failed to evaluate schedules", "error", err)
+	}
+	schedulerCtx, schedulerCancel := context.WithCancel(context.Background())
+	go ruleScheduler.Run(schedulerCtx)
+
+	// Temporary rules, including just-in-time access, are removed once their
+	// expires_at passes
+	ruleExpirer := scheduler.NewExpirer(ruleRepo, sgRepo, revisionRepo, jitGrantRepo, auditRepo, fwManager, hub, appLogger)
+	go ruleExpirer.Run(schedulerCtx)
+
+	// Hostnames in rules are re-resolved as their DNS records expire
+	go fqdnResolver.Run(schedulerCtx)
+
+	// Country rules follow updates to the GeoIP database file
+	if geoDB != nil {
+		go geoDB.Run(schedulerCtx)
+	}
+
+	// Threat feeds are fetched again as their refresh intervals pass
+	go threatFeeds.Run(schedulerCtx)
+
+	// Jails tail their logs and lift bans as they expire
+	go jailWatcher.Run(schedulerCtx)
+
 	// Setup and start API server
 	server := api.NewServer(api.ServerDeps{
 		Config:            cfg,
@@ -128,6 +354,26 @@ func main() {
 		InvitationRepo:    invRepo,
 		ImmutablePortRepo: portRepo,
 		BlockedIPRepo:     blockedIPRepo,
+		RevisionRepo:      revisionRepo,
+		AddressObjectRepo: addrObjRepo,
+		ServiceObjectRepo: svcObjRepo,
+		NATRuleRepo:       natRuleRepo,
+		ScheduleRepo:      scheduleRepo,
+		JITPolicyRepo:     jitPolicyRepo,
+		JITGrantRepo:      jitGrantRepo,
+		KnockGateRepo:     knockGateRepo,
+		FQDNRepo:          fqdnRepo,
+		ThreatFeedRepo:    threatFeedRepo,
+		JailRepo:          jailRepo,
+		HoneypotRepo:      honeypotRepo,
+		Scheduler:         ruleScheduler,
+		KnockDetector:     knockDetector,
+		ThreatFeeds:       threatFeeds,
+		Jails:             jailWatcher,
+		Honeypots:         honeypots,
+		GeoIP:             geoDB,
+		Templates:         templateLib,
+		LocalServerID:     localServer.ID,
 	})
 
 	// Graceful shutdown
@@ -150,7 +396,8 @@ func main() {
 
 	<-ctx.Done()
 	appLogger.Info("Shutting down gracefully...")
-	trafficCancel() // stop traffic monitor
+	trafficCancel()   // stop traffic monitor
+	schedulerCancel() // stop schedule evaluation and rule expiry
 	hub.Shutdown()
 	if err := server.Shutdown(); err != nil {
 		appLogger.Error("Server shutdown error", "error", err)
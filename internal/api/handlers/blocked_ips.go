@@ -171,6 +171,7 @@ func (h *BlockedIPHandler) UnblockIPs(c *fiber.Ctx) error {
 			Resource: "blocked_ips:" + req.ID,
 			IP:       c.IP(),
 		})
+		h.refreshListSets(userID)
 
 		return c.JSON(fiber.Map{"message": "IP unblocked"})
 	}
@@ -192,6 +193,7 @@ func (h *BlockedIPHandler) UnblockIPs(c *fiber.Ctx) error {
 		Details:  fmt.Sprintf("Unblocked %d IPs: %s", unblocked, strings.Join(req.IPs, ", ")),
 		IP:       c.IP(),
 	})
+	h.refreshListSets(userID)
 
 	return c.JSON(fiber.Map{
 		"message":   fmt.Sprintf("%d IP(s) unblocked", unblocked),
@@ -214,10 +216,24 @@ func (h *BlockedIPHandler) ReblockIP(c *fiber.Ctx) error {
 		Resource: "blocked_ips:" + id,
 		IP:       c.IP(),
 	})
+	h.refreshListSets(userID)
 
 	return c.JSON(fiber.Map{"message": "IP re-blocked"})
 }
 
+// refreshListSets re-syncs the kernel sets of threat feeds, jails and
+// detectors, since an entry that was unblocked or re-blocked may have come
+// from one.
+func (h *BlockedIPHandler) refreshListSets(userID string) {
+	for _, kind := range []string{fwPkg.RefThreatFeed, fwPkg.RefJail, fwPkg.RefDetector} {
+		for _, id := range h.fw.References(kind) {
+			if err := h.fw.RefreshReference(kind, id); err != nil {
+				h.hub.EmitError("Failed to refresh blocklist set: "+err.Error(), userID)
+			}
+		}
+	}
+}
+
 // isValidIPOrCIDR validates an IP address or CIDR range.
 func isValidIPOrCIDR(s string) bool {
 	s = strings.TrimSpace(s)
@@ -1,14 +1,17 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/google/uuid"
 
 	"github.com/enjoys-in/secureflow/internal/constants"
+	"github.com/enjoys-in/secureflow/internal/convert"
 	"github.com/enjoys-in/secureflow/internal/db"
 	fwPkg "github.com/enjoys-in/secureflow/internal/firewall"
 	"github.com/enjoys-in/secureflow/internal/repository"
@@ -17,28 +20,92 @@ import (
 
 // FirewallHandler handles firewall rule CRUD operations.
 type FirewallHandler struct {
+	sgRepo    repository.SecurityGroupRepository
 	ruleRepo  repository.FirewallRuleRepository
+	revRepo   repository.SecurityGroupRevisionRepository
 	auditRepo repository.AuditLogRepository
 	fw        *fwPkg.Manager
 	hub       *websocket.Hub
 }
 
 // NewFirewallHandler creates a new firewall handler.
-func NewFirewallHandler(ruleRepo repository.FirewallRuleRepository, auditRepo repository.AuditLogRepository, fw *fwPkg.Manager, hub *websocket.Hub) *FirewallHandler {
-	return &FirewallHandler{ruleRepo: ruleRepo, auditRepo: auditRepo, fw: fw, hub: hub}
+func NewFirewallHandler(sgRepo repository.SecurityGroupRepository, ruleRepo repository.FirewallRuleRepository, revRepo repository.SecurityGroupRevisionRepository, auditRepo repository.AuditLogRepository, fw *fwPkg.Manager, hub *websocket.Hub) *FirewallHandler {
+	return &FirewallHandler{sgRepo: sgRepo, ruleRepo: ruleRepo, revRepo: revRepo, auditRepo: auditRepo, fw: fw, hub: hub}
 }
 
 // AddRuleRequest is the request body for adding a firewall rule.
 type AddRuleRequest struct {
-	SecurityGroupID string `json:"security_group_id"`
-	Direction       string `json:"direction"`
-	Protocol        string `json:"protocol"`
-	Port            int    `json:"port"`
-	PortRangeEnd    int    `json:"port_range_end,omitempty"`
-	SourceCIDR      string `json:"source_cidr"`
-	DestCIDR        string `json:"dest_cidr,omitempty"`
-	Action          string `json:"action"`
-	Description     string `json:"description,omitempty"`
+	SecurityGroupID string           `json:"security_group_id"`
+	Direction       string           `json:"direction"`
+	Protocol        string           `json:"protocol"`
+	Port            int              `json:"port"`
+	PortRangeEnd    int              `json:"port_range_end,omitempty"`
+	Ports           []db.ServicePort `json:"ports,omitempty"` // several ports/ranges instead of port
+	SourceCIDR      string           `json:"source_cidr"`
+	DestCIDR        string           `json:"dest_cidr,omitempty"`
+	SourceGroupID   string           `json:"source_group_id,omitempty"`
+	DestGroupID     string           `json:"dest_group_id,omitempty"`
+	SourceAddressID string           `json:"source_address_id,omitempty"`
+	DestAddressID   string           `json:"dest_address_id,omitempty"`
+	SourceFQDN      string           `json:"source_fqdn,omitempty"`
+	DestFQDN        string           `json:"dest_fqdn,omitempty"`
+	SourceCountries []string         `json:"source_countries,omitempty"`
+	DestCountries   []string         `json:"dest_countries,omitempty"`
+	ServiceID       string           `json:"service_id,omitempty"` // replaces protocol/port
+	Action          string           `json:"action"`
+	RateLimit       *db.RateLimit    `json:"rate_limit,omitempty"`    // act only above this rate (DROP/REJECT)
+	ConnLimit       *db.ConnLimit    `json:"conn_limit,omitempty"`    // act only on sources over this many connections (DROP/REJECT)
+	SynProxy        bool             `json:"synproxy,omitempty"`      // SYN flood protection (inbound TCP ACCEPT)
+	InInterface     string           `json:"in_interface,omitempty"`  // inbound only, e.g. "eth1" or "eth*"
+	OutInterface    string           `json:"out_interface,omitempty"` // outbound only
+	SourcePort      int              `json:"source_port,omitempty"`   // tcp/udp source port, e.g. 53 or 123
+	SourcePortEnd   int              `json:"source_port_end,omitempty"`
+	ICMPType        *int             `json:"icmp_type,omitempty"` // icmp only, e.g. 8 for echo-request
+	ICMPCode        *int             `json:"icmp_code,omitempty"`
+	OwnerUser       string           `json:"owner_user,omitempty"`  // outbound only, e.g. "backup" or "1001"
+	OwnerGroup      string           `json:"owner_group,omitempty"` // outbound only
+	Cgroup          string           `json:"cgroup,omitempty"`      // outbound only, e.g. "nginx.service"
+	ScheduleID      string           `json:"schedule_id,omitempty"` // installed only while the schedule is active
+	ExpiresAt       *time.Time       `json:"expires_at,omitempty"`  // removed automatically at this time
+	Description     string           `json:"description,omitempty"`
+}
+
+// UpdateRuleRequest is the request body for modifying a firewall rule.
+// Omitted fields keep their current value.
+type UpdateRuleRequest struct {
+	Direction    *string           `json:"direction,omitempty"`
+	Protocol     *string           `json:"protocol,omitempty"`
+	Port         *int              `json:"port,omitempty"`
+	PortRangeEnd *int              `json:"port_range_end,omitempty"`
+	Ports        *[]db.ServicePort `json:"ports,omitempty"` // replaces port/port_range_end; [] clears the list
+	SourceCIDR   *string           `json:"source_cidr,omitempty"`
+	DestCIDR     *string           `json:"dest_cidr,omitempty"`
+	SourceGroup  *string           `json:"source_group_id,omitempty"` // "" clears the reference
+	DestGroup    *string           `json:"dest_group_id,omitempty"`   // "" clears the reference
+	SourceAddr   *string           `json:"source_address_id,omitempty"`
+	DestAddr     *string           `json:"dest_address_id,omitempty"`
+	SourceFQDN   *string           `json:"source_fqdn,omitempty"` // "" clears the hostname
+	DestFQDN     *string           `json:"dest_fqdn,omitempty"`
+	SourceGeo    *[]string         `json:"source_countries,omitempty"` // [] clears the list
+	DestGeo      *[]string         `json:"dest_countries,omitempty"`
+	Service      *string           `json:"service_id,omitempty"`
+	Action       *string           `json:"action,omitempty"`
+	RateLimit    *db.RateLimit     `json:"rate_limit,omitempty"` // a rate of 0 removes the limit
+	ConnLimit    *db.ConnLimit     `json:"conn_limit,omitempty"` // a max of 0 removes the limit
+	SynProxy     *bool             `json:"synproxy,omitempty"`
+	InInterface  *string           `json:"in_interface,omitempty"` // "" matches any interface
+	OutInterface *string           `json:"out_interface,omitempty"`
+	SourcePort   *int              `json:"source_port,omitempty"` // 0 matches any source port
+	SourceEnd    *int              `json:"source_port_end,omitempty"`
+	ICMPType     *int              `json:"icmp_type,omitempty"`    // a negative value clears the type (and code)
+	ICMPCode     *int              `json:"icmp_code,omitempty"`    // a negative value clears the code
+	OwnerUser    *string           `json:"owner_user,omitempty"`   // "" clears the match
+	OwnerGroup   *string           `json:"owner_group,omitempty"`  // "" clears the match
+	Cgroup       *string           `json:"cgroup,omitempty"`       // "" clears the match
+	ScheduleID   *string           `json:"schedule_id,omitempty"`  // "" makes the rule permanent
+	ExpiresAt    *time.Time        `json:"expires_at,omitempty"`   // moves the expiry; must be in the future
+	ClearExpiry  bool              `json:"clear_expiry,omitempty"` // removes the expiry
+	Description  *string           `json:"description,omitempty"`
 }
 
 // ListRules returns all firewall rules from the backend.
@@ -57,29 +124,20 @@ func (h *FirewallHandler) AddRule(c *fiber.Ctx) error {
 		return constants.ErrInvalidRequestBody
 	}
 
-	rule := fwPkg.Rule{
-		ID:         uuid.New().String(),
-		Direction:  strings.ToLower(req.Direction),
-		Protocol:   strings.ToLower(req.Protocol),
-		Port:       req.Port,
-		PortEnd:    req.PortRangeEnd,
-		SourceCIDR: req.SourceCIDR,
-		DestCIDR:   req.DestCIDR,
-		Action:     strings.ToUpper(req.Action),
-	}
+	rule := newRuleFromRequest(req)
 
 	if err := fwPkg.ValidateRule(rule); err != nil {
 		return constants.ErrInvalidRequestBody.WithMessage(err.Error())
 	}
+	if err := fwPkg.CheckHostInterfaces(rule.InInterface, rule.OutInterface); err != nil {
+		return constants.ErrInvalidRequestBody.WithMessage(err.Error())
+	}
 
-	if h.fw.IsPortImmutable(req.Port) && strings.ToUpper(req.Action) != constants.ActionAccept {
+	if coversImmutablePort(h.fw, req.Port, req.Ports) && strings.ToUpper(req.Action) != constants.ActionAccept {
 		return constants.ErrImmutablePort
 	}
-
-	if err := h.fw.AddRule(rule); err != nil {
-		userID, _ := c.Locals("user_id").(string)
-		h.hub.EmitError(err.Error(), userID)
-		return constants.ErrFirewallFailure.Wrap(err)
+	if err := validateExpiry(req.ExpiresAt); err != nil {
+		return err
 	}
 
 	userID, _ := c.Locals("user_id").(string)
@@ -89,22 +147,69 @@ func (h *FirewallHandler) AddRule(c *fiber.Ctx) error {
 		Protocol:        rule.Protocol,
 		Port:            rule.Port,
 		PortRangeEnd:    rule.PortEnd,
+		Ports:           req.Ports,
 		SourceCIDR:      req.SourceCIDR,
 		DestCIDR:        req.DestCIDR,
+		SourceGroupID:   req.SourceGroupID,
+		DestGroupID:     req.DestGroupID,
+		SourceAddressID: req.SourceAddressID,
+		DestAddressID:   req.DestAddressID,
+		SourceFQDN:      rule.SourceFQDN,
+		DestFQDN:        rule.DestFQDN,
+		SourceCountries: rule.SourceCountries,
+		DestCountries:   rule.DestCountries,
+		ServiceID:       req.ServiceID,
 		Action:          rule.Action,
+		RateLimit:       req.RateLimit,
+		ConnLimit:       req.ConnLimit,
+		SynProxy:        req.SynProxy,
+		InInterface:     req.InInterface,
+		OutInterface:    req.OutInterface,
+		SourcePort:      req.SourcePort,
+		SourcePortEnd:   req.SourcePortEnd,
+		ICMPType:        req.ICMPType,
+		ICMPCode:        req.ICMPCode,
+		OwnerUser:       req.OwnerUser,
+		OwnerGroup:      req.OwnerGroup,
+		Cgroup:          req.Cgroup,
+		ScheduleID:      req.ScheduleID,
+		ExpiresAt:       req.ExpiresAt,
 		Description:     req.Description,
 		IsImmutable:     false,
 		CreatedBy:       userID,
 	}
-	if err := h.ruleRepo.Create(c.Context(), dbRule); err != nil {
-		return constants.ErrDatabaseFailure.WithMessage("rule applied but failed to persist to database")
+	// A rule added to a group here records a revision like one added through
+	// the group's own endpoint.
+	if err := commitGroupChange(c.Context(), h.sgRepo, h.ruleRepo, h.revRepo, userID, groupChange{
+		save: func(ctx context.Context) (string, string, error) {
+			if err := h.ruleRepo.Create(ctx, dbRule); err != nil {
+				if errors.Is(err, repository.ErrReferenceCycle) {
+					return "", "", constants.ErrReferenceCycle.Wrap(err)
+				}
+				return "", "", constants.ErrDatabaseFailure.WithMessage("failed to persist rule to database")
+			}
+			return dbRule.SecurityGroupID, fmt.Sprintf("Added rule: port=%d protocol=%s action=%s", rule.Port, rule.Protocol, rule.Action), nil
+		},
+		apply: func() error {
+			// Tag the kernel rule with the DB ID so later updates and deletes can find it.
+			rule.ID = dbRule.ID
+			rule.GroupID = dbRule.SecurityGroupID
+			if err := h.fw.AddRule(rule); err != nil {
+				h.hub.EmitError(err.Error(), userID)
+				return constants.ErrFirewallFailure.Wrap(err)
+			}
+			return nil
+		},
+		undo: func() { _ = h.fw.DeleteRule(dbRule.ID) },
+	}); err != nil {
+		return err
 	}
 
 	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
 		UserID:   userID,
 		Action:   constants.AuditActionAddRule,
 		Resource: "firewall_rule:" + dbRule.ID,
-		Details:  fmt.Sprintf("Added rule: port=%d protocol=%s action=%s", rule.Port, rule.Protocol, rule.Action),
+		Details:  fmt.Sprintf("Added rule: port=%d protocol=%s action=%s", rule.Port, rule.Protocol, rule.Action) + expiryNote(dbRule.ExpiresAt),
 		IP:       c.IP(),
 	})
 
@@ -139,6 +244,29 @@ func (h *FirewallHandler) ListAllRulesWithDetails(c *fiber.Ctx) error {
 	})
 }
 
+// UpdateRule modifies a firewall rule in place.
+func (h *FirewallHandler) UpdateRule(c *fiber.Ctx) error {
+	var req UpdateRuleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return constants.ErrInvalidRequestBody
+	}
+
+	dbRule, err := h.ruleRepo.FindByID(c.Context(), c.Params("id"))
+	if err != nil {
+		return constants.ErrRuleNotFound
+	}
+
+	updated, err := updateRule(c, h.sgRepo, h.ruleRepo, h.revRepo, h.auditRepo, h.fw, h.hub, dbRule, req)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "rule updated",
+		"rule":    updated,
+	})
+}
+
 // DeleteRule removes a firewall rule.
 func (h *FirewallHandler) DeleteRule(c *fiber.Ctx) error {
 	ruleID := c.Params("id")
@@ -152,19 +280,15 @@ func (h *FirewallHandler) DeleteRule(c *fiber.Ctx) error {
 		return constants.ErrImmutableRule
 	}
 
-	if h.fw.IsPortImmutable(dbRule.Port) {
+	if coversImmutablePort(h.fw, dbRule.Port, dbRule.Ports) {
 		return constants.ErrImmutablePort
 	}
 
-	if err := h.fw.DeleteRule(ruleID); err != nil {
-		return constants.ErrFirewallFailure.Wrap(err)
-	}
-
-	if err := h.ruleRepo.DeleteNonImmutable(c.Context(), ruleID); err != nil {
-		return constants.ErrDatabaseFailure.WithMessage("rule removed from firewall but failed to remove from database")
+	userID, _ := c.Locals("user_id").(string)
+	if err := deleteRule(c.Context(), h.sgRepo, h.ruleRepo, h.revRepo, h.fw, userID, dbRule); err != nil {
+		return err
 	}
 
-	userID, _ := c.Locals("user_id").(string)
 	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
 		UserID:   userID,
 		Action:   constants.AuditActionDeleteRule,
@@ -176,3 +300,479 @@ func (h *FirewallHandler) DeleteRule(c *fiber.Ctx) error {
 
 	return c.JSON(fiber.Map{"message": "rule deleted"})
 }
+
+// deleteRule removes a rule from the database and, if it is installed, from
+// the kernel. Deleting a group rule records a revision in the same
+// transaction. It is shared by the standalone and security-group endpoints.
+func deleteRule(
+	ctx context.Context,
+	sgRepo repository.SecurityGroupRepository,
+	ruleRepo repository.FirewallRuleRepository,
+	revRepo repository.SecurityGroupRevisionRepository,
+	fw *fwPkg.Manager,
+	userID string,
+	r *db.FirewallRule,
+) error {
+	live := fw.HasRule(r.ID)
+	return commitGroupChange(ctx, sgRepo, ruleRepo, revRepo, userID, groupChange{
+		save: func(ctx context.Context) (string, string, error) {
+			if err := ruleRepo.DeleteNonImmutable(ctx, r.ID); err != nil {
+				return "", "", constants.ErrDatabaseFailure.Wrap(err)
+			}
+			return r.SecurityGroupID, fmt.Sprintf("Deleted rule: port=%d protocol=%s action=%s", r.Port, r.Protocol, r.Action), nil
+		},
+		apply: func() error {
+			if !live {
+				return nil
+			}
+			if err := fw.DeleteRule(r.ID); err != nil {
+				return constants.ErrFirewallFailure.Wrap(err)
+			}
+			return nil
+		},
+		undo: func() {
+			if live {
+				_ = fw.AddRule(convert.Rule(*r))
+			}
+		},
+	})
+}
+
+// updateRule merges req onto an existing rule, persists the change, swaps
+// the kernel rule if it is installed and records a before/after audit entry.
+// Changing a group rule records a revision in the same transaction. It is
+// shared by the standalone and security-group rule endpoints.
+func updateRule(
+	c *fiber.Ctx,
+	sgRepo repository.SecurityGroupRepository,
+	ruleRepo repository.FirewallRuleRepository,
+	revRepo repository.SecurityGroupRevisionRepository,
+	auditRepo repository.AuditLogRepository,
+	fw *fwPkg.Manager,
+	hub *websocket.Hub,
+	before *db.FirewallRule,
+	req UpdateRuleRequest,
+) (*db.FirewallRule, error) {
+	if before.IsImmutable {
+		return nil, constants.ErrImmutableRule
+	}
+
+	after := *before
+	if req.Direction != nil {
+		after.Direction = strings.ToLower(*req.Direction)
+	}
+	if req.Protocol != nil {
+		after.Protocol = strings.ToLower(*req.Protocol)
+	}
+	if req.Port != nil {
+		after.Port = *req.Port
+	}
+	if req.PortRangeEnd != nil {
+		after.PortRangeEnd = *req.PortRangeEnd
+	}
+	if req.Ports != nil {
+		after.Ports = *req.Ports
+		if len(after.Ports) > 0 {
+			after.Port, after.PortRangeEnd = 0, 0
+		}
+	}
+	if req.SourceCIDR != nil {
+		after.SourceCIDR = *req.SourceCIDR
+	}
+	if req.DestCIDR != nil {
+		after.DestCIDR = *req.DestCIDR
+	}
+	if req.SourceGroup != nil {
+		after.SourceGroupID = *req.SourceGroup
+	}
+	if req.DestGroup != nil {
+		after.DestGroupID = *req.DestGroup
+	}
+	if req.SourceAddr != nil {
+		after.SourceAddressID = *req.SourceAddr
+	}
+	if req.DestAddr != nil {
+		after.DestAddressID = *req.DestAddr
+	}
+	if req.SourceFQDN != nil {
+		after.SourceFQDN = fwPkg.NormalizeFQDN(*req.SourceFQDN)
+	}
+	if req.DestFQDN != nil {
+		after.DestFQDN = fwPkg.NormalizeFQDN(*req.DestFQDN)
+	}
+	if req.SourceGeo != nil {
+		after.SourceCountries = fwPkg.NormalizeCountries(*req.SourceGeo)
+	}
+	if req.DestGeo != nil {
+		after.DestCountries = fwPkg.NormalizeCountries(*req.DestGeo)
+	}
+	if req.Service != nil {
+		after.ServiceID = *req.Service
+	}
+	if req.Action != nil {
+		after.Action = strings.ToUpper(*req.Action)
+	}
+	if req.RateLimit != nil {
+		after.RateLimit = req.RateLimit
+		if req.RateLimit.Rate == 0 {
+			after.RateLimit = nil
+		}
+	}
+	if req.ConnLimit != nil {
+		after.ConnLimit = req.ConnLimit
+		if req.ConnLimit.Max == 0 {
+			after.ConnLimit = nil
+		}
+	}
+	if req.SynProxy != nil {
+		after.SynProxy = *req.SynProxy
+	}
+	if req.InInterface != nil {
+		after.InInterface = *req.InInterface
+	}
+	if req.OutInterface != nil {
+		after.OutInterface = *req.OutInterface
+	}
+	if req.SourcePort != nil {
+		after.SourcePort = *req.SourcePort
+		after.SourcePortEnd = 0
+	}
+	if req.SourceEnd != nil {
+		after.SourcePortEnd = *req.SourceEnd
+	}
+	if req.ICMPType != nil {
+		after.ICMPType, after.ICMPCode = optionalInt(*req.ICMPType), nil
+	}
+	if req.ICMPCode != nil {
+		after.ICMPCode = optionalInt(*req.ICMPCode)
+	}
+	if req.OwnerUser != nil {
+		after.OwnerUser = *req.OwnerUser
+	}
+	if req.OwnerGroup != nil {
+		after.OwnerGroup = *req.OwnerGroup
+	}
+	if req.Cgroup != nil {
+		after.Cgroup = *req.Cgroup
+	}
+	if req.ScheduleID != nil {
+		after.ScheduleID = *req.ScheduleID
+	}
+	if req.ClearExpiry {
+		if req.ExpiresAt != nil {
+			return nil, constants.ErrInvalidRequestBody.WithMessage("expires_at and clear_expiry are mutually exclusive")
+		}
+		after.ExpiresAt = nil
+	}
+	if req.ExpiresAt != nil {
+		if err := validateExpiry(req.ExpiresAt); err != nil {
+			return nil, err
+		}
+		after.ExpiresAt = req.ExpiresAt
+	}
+	if req.Description != nil {
+		after.Description = *req.Description
+	}
+
+	rule := convert.Rule(after)
+	if err := fwPkg.ValidateRule(rule); err != nil {
+		return nil, constants.ErrInvalidRequestBody.WithMessage(err.Error())
+	}
+	// Only names the request sets are checked against the host, so an edit
+	// is not refused because an interface it leaves alone is down.
+	var ifaces []string
+	if req.InInterface != nil {
+		ifaces = append(ifaces, *req.InInterface)
+	}
+	if req.OutInterface != nil {
+		ifaces = append(ifaces, *req.OutInterface)
+	}
+	if err := fwPkg.CheckHostInterfaces(ifaces...); err != nil {
+		return nil, constants.ErrInvalidRequestBody.WithMessage(err.Error())
+	}
+
+	if coversImmutablePort(fw, after.Port, after.Ports) && after.Action != constants.ActionAccept {
+		return nil, constants.ErrImmutablePort
+	}
+
+	if after.SecurityGroupID != "" {
+		if err := ruleRepo.CheckReferenceCycle(c.Context(), after.SecurityGroupID, after.SourceGroupID, after.DestGroupID); err != nil {
+			if errors.Is(err, repository.ErrReferenceCycle) {
+				return nil, constants.ErrReferenceCycle.Wrap(err)
+			}
+			return nil, constants.ErrDatabaseFailure.Wrap(err)
+		}
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+
+	updates := map[string]interface{}{
+		"direction":         after.Direction,
+		"protocol":          after.Protocol,
+		"port":              after.Port,
+		"port_range_end":    after.PortRangeEnd,
+		"ports":             after.Ports,
+		"source_cidr":       after.SourceCIDR,
+		"dest_cidr":         after.DestCIDR,
+		"source_group_id":   nullableUUID(after.SourceGroupID),
+		"dest_group_id":     nullableUUID(after.DestGroupID),
+		"source_address_id": nullableUUID(after.SourceAddressID),
+		"dest_address_id":   nullableUUID(after.DestAddressID),
+		"source_fqdn":       after.SourceFQDN,
+		"dest_fqdn":         after.DestFQDN,
+		"source_countries":  after.SourceCountries,
+		"dest_countries":    after.DestCountries,
+		"service_id":        nullableUUID(after.ServiceID),
+		"action":            after.Action,
+		"rate_limit":        after.RateLimit,
+		"conn_limit":        after.ConnLimit,
+		"synproxy":          after.SynProxy,
+		"in_interface":      after.InInterface,
+		"out_interface":     after.OutInterface,
+		"source_port":       after.SourcePort,
+		"source_port_end":   after.SourcePortEnd,
+		"icmp_type":         after.ICMPType,
+		"icmp_code":         after.ICMPCode,
+		"owner_user":        after.OwnerUser,
+		"owner_group":       after.OwnerGroup,
+		"cgroup":            after.Cgroup,
+		"schedule_id":       nullableUUID(after.ScheduleID),
+		"expires_at":        after.ExpiresAt,
+		"description":       after.Description,
+	}
+	// Only rules that are live in the kernel need swapping; group rules that
+	// have not been applied yet are just persisted.
+	live := fw.HasRule(before.ID)
+	var saved *db.FirewallRule
+	if err := commitGroupChange(c.Context(), sgRepo, ruleRepo, revRepo, userID, groupChange{
+		save: func(ctx context.Context) (string, string, error) {
+			var err error
+			if saved, err = ruleRepo.FindByIDAndUpdate(ctx, before.ID, updates); err != nil {
+				return "", "", constants.ErrDatabaseFailure.WithMessage("failed to update rule in database")
+			}
+			return saved.SecurityGroupID, "Updated rule: " + ruleDiff(before, saved), nil
+		},
+		apply: func() error {
+			if !live {
+				return nil
+			}
+			if err := fw.ReplaceRule(rule); err != nil {
+				hub.EmitError(err.Error(), userID)
+				return constants.ErrFirewallFailure.Wrap(err)
+			}
+			return nil
+		},
+		undo: func() {
+			if live {
+				// Put the kernel back in line with the unchanged DB row.
+				_ = fw.ReplaceRule(convert.Rule(*before))
+			}
+		},
+	}); err != nil {
+		return nil, err
+	}
+
+	_ = auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   constants.AuditActionUpdateRule,
+		Resource: "firewall_rule:" + saved.ID,
+		Details:  "Updated rule: " + ruleDiff(before, saved),
+		IP:       c.IP(),
+	})
+
+	hub.EmitRuleChange("updated", saved.ID, userID, saved.Port)
+
+	return saved, nil
+}
+
+// fromFirewallRateLimit converts a syscall-layer rate limit; nil stays nil.
+func fromFirewallRateLimit(rl *fwPkg.RateLimit) *db.RateLimit {
+	if rl == nil {
+		return nil
+	}
+	return &db.RateLimit{
+		Rate:      rl.Rate,
+		Unit:      rl.Unit,
+		Burst:     rl.Burst,
+		PerSource: rl.PerSource,
+		Mode:      rl.Mode,
+	}
+}
+
+// fromFirewallConnLimit converts a syscall-layer connection limit; nil stays
+// nil.
+func fromFirewallConnLimit(cl *fwPkg.ConnLimit) *db.ConnLimit {
+	if cl == nil {
+		return nil
+	}
+	return &db.ConnLimit{Max: cl.Max, Mask: cl.Mask}
+}
+
+// newRuleFromRequest builds a syscall-layer rule from an add request. Rules
+// that take their ports from a service object default to protocol "all";
+// the manager substitutes the service's protocol when it installs them.
+func newRuleFromRequest(req AddRuleRequest) fwPkg.Rule {
+	rule := fwPkg.Rule{
+		Direction:       strings.ToLower(req.Direction),
+		Protocol:        strings.ToLower(req.Protocol),
+		Port:            req.Port,
+		PortEnd:         req.PortRangeEnd,
+		SourceCIDR:      req.SourceCIDR,
+		DestCIDR:        req.DestCIDR,
+		SourceGroupID:   req.SourceGroupID,
+		DestGroupID:     req.DestGroupID,
+		SourceAddressID: req.SourceAddressID,
+		DestAddressID:   req.DestAddressID,
+		SourceFQDN:      fwPkg.NormalizeFQDN(req.SourceFQDN),
+		DestFQDN:        fwPkg.NormalizeFQDN(req.DestFQDN),
+		SourceCountries: fwPkg.NormalizeCountries(req.SourceCountries),
+		DestCountries:   fwPkg.NormalizeCountries(req.DestCountries),
+		ServiceID:       req.ServiceID,
+		Action:          strings.ToUpper(req.Action),
+		RateLimit:       convert.RateLimit(req.RateLimit),
+		ConnLimit:       convert.ConnLimit(req.ConnLimit),
+		Ports:           convert.PortRanges(req.Ports),
+		SynProxy:        req.SynProxy,
+		InInterface:     req.InInterface,
+		OutInterface:    req.OutInterface,
+		SourcePort:      req.SourcePort,
+		SourcePortEnd:   req.SourcePortEnd,
+		ICMPType:        req.ICMPType,
+		ICMPCode:        req.ICMPCode,
+		OwnerUser:       req.OwnerUser,
+		OwnerGroup:      req.OwnerGroup,
+		Cgroup:          req.Cgroup,
+		ScheduleID:      req.ScheduleID,
+	}
+	if rule.ServiceID != "" && rule.Protocol == "" {
+		rule.Protocol = "all"
+	}
+	return rule
+}
+
+// validateExpiry rejects an expiry that is not in the future; nil means the
+// rule never expires.
+func validateExpiry(t *time.Time) error {
+	if t != nil && !t.After(time.Now()) {
+		return constants.ErrInvalidRequestBody.WithMessage("expires_at must be in the future")
+	}
+	return nil
+}
+
+// expiryString renders an expiry for audit details; "" means never.
+func expiryString(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// expiryNote renders an expiry as a suffix for audit details.
+func expiryNote(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return " expires=" + expiryString(t)
+}
+
+// nullableUUID maps an empty ID to NULL for nullable UUID columns.
+func nullableUUID(id string) interface{} {
+	if id == "" {
+		return nil
+	}
+	return id
+}
+
+// coversImmutablePort reports whether a rule's port, or any port in its port
+// list, is immutable.
+func coversImmutablePort(fw *fwPkg.Manager, port int, ports []db.ServicePort) bool {
+	if fw.IsPortImmutable(port) {
+		return true
+	}
+	_, ok := fw.ImmutablePortIn(convert.PortRanges(ports))
+	return ok
+}
+
+// optionalInt maps a negative request value to nil, clearing the field.
+func optionalInt(v int) *int {
+	if v < 0 {
+		return nil
+	}
+	return &v
+}
+
+// portRangeString renders a port or range, e.g. "53" or "1024-65535"; 0 is
+// "any".
+func portRangeString(port, end int) string {
+	switch {
+	case port == 0:
+		return "any"
+	case end > port:
+		return fmt.Sprintf("%d-%d", port, end)
+	default:
+		return strconv.Itoa(port)
+	}
+}
+
+// icmpString renders an ICMP type/code match, e.g. "8", "3/4" or "any".
+func icmpString(icmpType, icmpCode *int) string {
+	if icmpType == nil {
+		return "any"
+	}
+	s := strconv.Itoa(*icmpType)
+	if icmpCode != nil {
+		s += "/" + strconv.Itoa(*icmpCode)
+	}
+	return s
+}
+
+// ruleDiff renders the fields that changed between two versions of a rule,
+// e.g. "port: 80 -> 8080, source_cidr: 0.0.0.0/0 -> 10.0.0.0/8".
+func ruleDiff(before, after *db.FirewallRule) string {
+	changes := ruleChanges(before, after)
+	if len(changes) == 0 {
+		return "no changes"
+	}
+	return strings.Join(changes, ", ")
+}
+
+// ruleChanges lists each differing field as "field: old -> new".
+func ruleChanges(before, after *db.FirewallRule) []string {
+	var changes []string
+	add := func(field string, from, to interface{}) {
+		if from != to {
+			changes = append(changes, fmt.Sprintf("%s: %v -> %v", field, from, to))
+		}
+	}
+	add("direction", before.Direction, after.Direction)
+	add("protocol", before.Protocol, after.Protocol)
+	add("port", before.Port, after.Port)
+	add("port_range_end", before.PortRangeEnd, after.PortRangeEnd)
+	add("ports", formatServicePorts(before.Ports), formatServicePorts(after.Ports))
+	add("source_cidr", before.SourceCIDR, after.SourceCIDR)
+	add("dest_cidr", before.DestCIDR, after.DestCIDR)
+	add("source_group_id", before.SourceGroupID, after.SourceGroupID)
+	add("dest_group_id", before.DestGroupID, after.DestGroupID)
+	add("source_address_id", before.SourceAddressID, after.SourceAddressID)
+	add("dest_address_id", before.DestAddressID, after.DestAddressID)
+	add("source_fqdn", before.SourceFQDN, after.SourceFQDN)
+	add("dest_fqdn", before.DestFQDN, after.DestFQDN)
+	add("source_countries", strings.Join(before.SourceCountries, ","), strings.Join(after.SourceCountries, ","))
+	add("dest_countries", strings.Join(before.DestCountries, ","), strings.Join(after.DestCountries, ","))
+	add("service_id", before.ServiceID, after.ServiceID)
+	add("action", before.Action, after.Action)
+	add("rate_limit", convert.RateLimit(before.RateLimit).String(), convert.RateLimit(after.RateLimit).String())
+	add("conn_limit", convert.ConnLimit(before.ConnLimit).String(), convert.ConnLimit(after.ConnLimit).String())
+	add("synproxy", before.SynProxy, after.SynProxy)
+	add("in_interface", before.InInterface, after.InInterface)
+	add("out_interface", before.OutInterface, after.OutInterface)
+	add("source_port", portRangeString(before.SourcePort, before.SourcePortEnd), portRangeString(after.SourcePort, after.SourcePortEnd))
+	add("icmp", icmpString(before.ICMPType, before.ICMPCode), icmpString(after.ICMPType, after.ICMPCode))
+	add("owner_user", before.OwnerUser, after.OwnerUser)
+	add("owner_group", before.OwnerGroup, after.OwnerGroup)
+	add("cgroup", before.Cgroup, after.Cgroup)
+	add("schedule_id", before.ScheduleID, after.ScheduleID)
+	add("expires_at", expiryString(before.ExpiresAt), expiryString(after.ExpiresAt))
+	add("description", before.Description, after.Description)
+	return changes
+}
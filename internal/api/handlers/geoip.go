@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/enjoys-in/secureflow/internal/constants"
+	"github.com/enjoys-in/secureflow/internal/geoip"
+)
+
+// GeoIPHandler reports on the GeoIP database behind country rules.
+type GeoIPHandler struct {
+	db *geoip.DB // nil when no database is configured
+}
+
+// NewGeoIPHandler creates a new GeoIP handler.
+func NewGeoIPHandler(db *geoip.DB) *GeoIPHandler {
+	return &GeoIPHandler{db: db}
+}
+
+// GetStatus returns whether a database is loaded and which one.
+func (h *GeoIPHandler) GetStatus(c *fiber.Ctx) error {
+	if h.db == nil {
+		return c.JSON(fiber.Map{"loaded": false})
+	}
+	return c.JSON(fiber.Map{"loaded": true, "database": h.db.Info()})
+}
+
+// Lookup returns the country of an address.
+func (h *GeoIPHandler) Lookup(c *fiber.Ctx) error {
+	if h.db == nil {
+		return constants.ErrGeoIPUnavailable
+	}
+	ip := c.Params("ip")
+	if net.ParseIP(ip) == nil {
+		return constants.ErrInvalidCIDR.WithMessage("invalid IP address: " + ip)
+	}
+	return c.JSON(fiber.Map{"ip": ip, "country": h.db.Country(ip)})
+}
@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/enjoys-in/secureflow/internal/constants"
+	"github.com/enjoys-in/secureflow/internal/db"
+	fwPkg "github.com/enjoys-in/secureflow/internal/firewall"
+	"github.com/enjoys-in/secureflow/internal/honeypot"
+	"github.com/enjoys-in/secureflow/internal/repository"
+	"github.com/enjoys-in/secureflow/internal/websocket"
+)
+
+// HoneypotHandler handles decoy ports.
+type HoneypotHandler struct {
+	repo      repository.HoneypotRepository
+	auditRepo repository.AuditLogRepository
+	watcher   *honeypot.Watcher
+	fw        *fwPkg.Manager
+	hub       *websocket.Hub
+}
+
+// NewHoneypotHandler creates a new honeypot handler.
+func NewHoneypotHandler(repo repository.HoneypotRepository, auditRepo repository.AuditLogRepository, watcher *honeypot.Watcher, fw *fwPkg.Manager, hub *websocket.Hub) *HoneypotHandler {
+	return &HoneypotHandler{repo: repo, auditRepo: auditRepo, watcher: watcher, fw: fw, hub: hub}
+}
+
+// HoneypotRequest is the request body for creating or updating a honeypot.
+type HoneypotRequest struct {
+	Name         string `json:"name"`
+	Protocol     string `json:"protocol,omitempty"` // defaults to tcp
+	Port         int    `json:"port"`
+	Mode         string `json:"mode,omitempty"` // defaults to listener
+	BlockSeconds int    `json:"block_seconds,omitempty"`
+	Enabled      *bool  `json:"enabled,omitempty"` // defaults to true
+}
+
+// honeypotView is a honeypot with its runtime state; State is nil while
+// disabled.
+type honeypotView struct {
+	db.Honeypot
+	State *honeypot.Status `json:"state"`
+}
+
+func (h *HoneypotHandler) view(hp db.Honeypot) honeypotView {
+	v := honeypotView{Honeypot: hp}
+	if st, ok := h.watcher.Status(hp.ID); ok {
+		v.State = &st
+	}
+	return v
+}
+
+// ListHoneypots returns all honeypots with their counters.
+func (h *HoneypotHandler) ListHoneypots(c *fiber.Ctx) error {
+	honeypots, err := h.repo.FindAll(c.Context(), nil, constants.MaxPageLimit, 0)
+	if err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+	views := make([]honeypotView, 0, len(honeypots))
+	for _, hp := range honeypots {
+		views = append(views, h.view(hp))
+	}
+	return c.JSON(fiber.Map{"honeypots": views})
+}
+
+// GetHoneypot returns a single honeypot with its state.
+func (h *HoneypotHandler) GetHoneypot(c *fiber.Ctx) error {
+	hp, err := h.repo.FindByID(c.Context(), c.Params("id"))
+	if err != nil {
+		return constants.ErrHoneypotNotFound
+	}
+	return c.JSON(fiber.Map{"honeypot": h.view(*hp)})
+}
+
+// CreateHoneypot stores a decoy port and starts watching it.
+func (h *HoneypotHandler) CreateHoneypot(c *fiber.Ctx) error {
+	var req HoneypotRequest
+	if err := c.BodyParser(&req); err != nil {
+		return constants.ErrInvalidRequestBody
+	}
+	if err := validateHoneypot(&req); err != nil {
+		return err
+	}
+	if err := h.checkDecoyPort(c, "", req.Protocol, req.Port); err != nil {
+		return err
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+	hp := &db.Honeypot{
+		Name:         req.Name,
+		Protocol:     req.Protocol,
+		Port:         req.Port,
+		Mode:         req.Mode,
+		BlockSeconds: req.BlockSeconds,
+		Enabled:      *req.Enabled,
+		CreatedBy:    userID,
+	}
+	if err := h.repo.Create(c.Context(), hp); err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   constants.AuditActionCreateHoneypot,
+		Resource: "honeypot:" + hp.ID,
+		Details:  "Created honeypot " + formatHoneypot(hp),
+		IP:       c.IP(),
+	})
+	h.reload(c, userID)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":  "honeypot created",
+		"honeypot": h.view(*hp),
+	})
+}
+
+// UpdateHoneypot changes a honeypot. Current blocks keep their expiry.
+func (h *HoneypotHandler) UpdateHoneypot(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var req HoneypotRequest
+	if err := c.BodyParser(&req); err != nil {
+		return constants.ErrInvalidRequestBody
+	}
+	if err := validateHoneypot(&req); err != nil {
+		return err
+	}
+
+	before, err := h.repo.FindByID(c.Context(), id)
+	if err != nil {
+		return constants.ErrHoneypotNotFound
+	}
+	if err := h.checkDecoyPort(c, id, req.Protocol, req.Port); err != nil {
+		return err
+	}
+	hp, err := h.repo.FindByIDAndUpdate(c.Context(), id, map[string]interface{}{
+		"name":          req.Name,
+		"protocol":      req.Protocol,
+		"port":          req.Port,
+		"mode":          req.Mode,
+		"block_seconds": req.BlockSeconds,
+		"enabled":       *req.Enabled,
+	})
+	if err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   constants.AuditActionUpdateHoneypot,
+		Resource: "honeypot:" + id,
+		Details:  fmt.Sprintf("Updated honeypot %s -> %s", formatHoneypot(before), formatHoneypot(hp)),
+		IP:       c.IP(),
+	})
+	h.reload(c, userID)
+
+	return c.JSON(fiber.Map{"message": "honeypot updated", "honeypot": h.view(*hp)})
+}
+
+// DeleteHoneypot closes a decoy port. Sources it blocked stay blocked until
+// their blocks expire.
+func (h *HoneypotHandler) DeleteHoneypot(c *fiber.Ctx) error {
+	id := c.Params("id")
+	hp, err := h.repo.FindByID(c.Context(), id)
+	if err != nil {
+		return constants.ErrHoneypotNotFound
+	}
+	if err := h.repo.DeleteOne(c.Context(), id); err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   constants.AuditActionDeleteHoneypot,
+		Resource: "honeypot:" + id,
+		Details:  "Deleted honeypot " + formatHoneypot(hp),
+		IP:       c.IP(),
+	})
+	h.reload(c, userID)
+
+	return c.JSON(fiber.Map{"message": "honeypot deleted"})
+}
+
+// reload makes the watcher pick up honeypot changes.
+func (h *HoneypotHandler) reload(c *fiber.Ctx, userID string) {
+	if err := h.watcher.Reload(c.Context()); err != nil {
+		h.hub.EmitError("Failed to reload honeypots: "+err.Error(), userID)
+	}
+}
+
+// checkDecoyPort rejects a decoy port that is immutable, already a decoy, or
+// has a real listener as reported by the system ports endpoint. id is the
+// honeypot being updated, if any; its own listener does not count.
+func (h *HoneypotHandler) checkDecoyPort(c *fiber.Ctx, id, protocol string, port int) error {
+	if h.fw.IsPortImmutable(port) {
+		return constants.ErrHoneypotPortInUse.WithMessage(fmt.Sprintf("port %d is immutable", port))
+	}
+	if other, err := h.repo.FindOne(c.Context(), map[string]interface{}{"protocol": protocol, "port": port}); err == nil && other.ID != id {
+		return constants.ErrHoneypotPortInUse.WithMessage(fmt.Sprintf("%s/%d is already honeypot %s", protocol, port, other.Name))
+	}
+	if h.watcher.Holds(protocol, port) {
+		return nil
+	}
+
+	ports, err := listeningPorts()
+	if err != nil {
+		return constants.ErrInternal.WithMessage("cannot list listening ports to check the decoy port: " + err.Error())
+	}
+	for _, p := range ports {
+		if p.Port == port && p.Protocol == protocol {
+			owner := p.Process
+			if owner == "" {
+				owner = "another process"
+			}
+			return constants.ErrHoneypotPortInUse.WithMessage(fmt.Sprintf("%s/%d is in use by %s", protocol, port, owner))
+		}
+	}
+	return nil
+}
+
+// validateHoneypot checks and normalises a honeypot request.
+func validateHoneypot(req *HoneypotRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return constants.ErrNameRequired
+	}
+	req.Protocol = strings.ToLower(strings.TrimSpace(req.Protocol))
+	if req.Protocol == "" {
+		req.Protocol = constants.ProtocolTCP
+	}
+	if req.Protocol != constants.ProtocolTCP && req.Protocol != constants.ProtocolUDP {
+		return constants.ErrInvalidProtocol.WithMessage("protocol must be tcp or udp")
+	}
+	if req.Port < 1 || req.Port > 65535 {
+		return constants.ErrInvalidPort.WithMessage("port must be between 1 and 65535")
+	}
+	req.Mode = strings.ToLower(strings.TrimSpace(req.Mode))
+	if req.Mode == "" {
+		req.Mode = constants.HoneypotModeListener
+	}
+	if req.Mode != constants.HoneypotModeListener && req.Mode != constants.HoneypotModeNFLOG {
+		return constants.ErrInvalidRequestBody.WithMessage("mode must be listener or nflog")
+	}
+	if req.BlockSeconds == 0 {
+		req.BlockSeconds = constants.HoneypotDefaultBlockSeconds
+	}
+	if req.BlockSeconds < constants.HoneypotMinBlockSeconds || req.BlockSeconds > constants.HoneypotMaxBlockSeconds {
+		return constants.ErrInvalidRequestBody.WithMessage(fmt.Sprintf("block_seconds must be between %d and %d", constants.HoneypotMinBlockSeconds, constants.HoneypotMaxBlockSeconds))
+	}
+	if req.Enabled == nil {
+		enabled := true
+		req.Enabled = &enabled
+	}
+	return nil
+}
+
+// formatHoneypot renders a honeypot for audit details, e.g.
+// "telnet: tcp/23 (listener), block 86400s".
+func formatHoneypot(hp *db.Honeypot) string {
+	s := fmt.Sprintf("%s: %s/%d (%s), block %ds", hp.Name, hp.Protocol, hp.Port, hp.Mode, hp.BlockSeconds)
+	if !hp.Enabled {
+		s += ", disabled"
+	}
+	return s
+}
@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/enjoys-in/secureflow/internal/constants"
+	"github.com/enjoys-in/secureflow/internal/db"
+	"github.com/enjoys-in/secureflow/internal/jail"
+	"github.com/enjoys-in/secureflow/internal/repository"
+	"github.com/enjoys-in/secureflow/internal/websocket"
+)
+
+// JailHandler handles fail2ban-style jails.
+type JailHandler struct {
+	jailRepo  repository.JailRepository
+	auditRepo repository.AuditLogRepository
+	watcher   *jail.Watcher
+	hub       *websocket.Hub
+}
+
+// NewJailHandler creates a new jail handler.
+func NewJailHandler(jailRepo repository.JailRepository, auditRepo repository.AuditLogRepository, watcher *jail.Watcher, hub *websocket.Hub) *JailHandler {
+	return &JailHandler{jailRepo: jailRepo, auditRepo: auditRepo, watcher: watcher, hub: hub}
+}
+
+// JailRequest is the request body for creating or updating a jail. Preset
+// fills in the filters of a common service when Filters is empty.
+type JailRequest struct {
+	Name        string   `json:"name"`
+	LogPath     string   `json:"log_path"`
+	LogFormat   string   `json:"log_format,omitempty"` // defaults to plain
+	Preset      string   `json:"preset,omitempty"`
+	Filters     []string `json:"filters,omitempty"`
+	IgnoreCIDRs []string `json:"ignore_cidrs,omitempty"`
+	MaxFailures int      `json:"max_failures,omitempty"`
+	FindSeconds int      `json:"find_seconds,omitempty"`
+	BanSeconds  int      `json:"ban_seconds,omitempty"`
+	Action      string   `json:"action,omitempty"`  // defaults to DROP
+	Enabled     *bool    `json:"enabled,omitempty"` // defaults to true
+}
+
+// jailView is a jail with its runtime state; State is nil while disabled.
+type jailView struct {
+	db.Jail
+	State *jail.Status `json:"state"`
+}
+
+func (h *JailHandler) view(j db.Jail) jailView {
+	v := jailView{Jail: j}
+	if st, ok := h.watcher.Status(j.ID); ok {
+		v.State = &st
+	}
+	return v
+}
+
+// ListJails returns all jails with their counters and tracked sources.
+func (h *JailHandler) ListJails(c *fiber.Ctx) error {
+	jails, err := h.jailRepo.FindAll(c.Context(), nil, constants.MaxPageLimit, 0)
+	if err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+	views := make([]jailView, 0, len(jails))
+	for _, j := range jails {
+		views = append(views, h.view(j))
+	}
+	return c.JSON(fiber.Map{"jails": views})
+}
+
+// GetJail returns a single jail with its state.
+func (h *JailHandler) GetJail(c *fiber.Ctx) error {
+	j, err := h.jailRepo.FindByID(c.Context(), c.Params("id"))
+	if err != nil {
+		return constants.ErrJailNotFound
+	}
+	return c.JSON(fiber.Map{"jail": h.view(*j)})
+}
+
+// ListJailPresets returns the built-in filter presets.
+func (h *JailHandler) ListJailPresets(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"presets": jail.Presets})
+}
+
+// CreateJail stores a jail and starts watching its log.
+func (h *JailHandler) CreateJail(c *fiber.Ctx) error {
+	var req JailRequest
+	if err := c.BodyParser(&req); err != nil {
+		return constants.ErrInvalidRequestBody
+	}
+	if err := validateJail(&req); err != nil {
+		return err
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+	j := &db.Jail{
+		Name:        req.Name,
+		LogPath:     req.LogPath,
+		LogFormat:   req.LogFormat,
+		Filters:     req.Filters,
+		IgnoreCIDRs: req.IgnoreCIDRs,
+		MaxFailures: req.MaxFailures,
+		FindSeconds: req.FindSeconds,
+		BanSeconds:  req.BanSeconds,
+		Action:      req.Action,
+		Enabled:     *req.Enabled,
+		CreatedBy:   userID,
+	}
+	if err := h.jailRepo.Create(c.Context(), j); err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   constants.AuditActionCreateJail,
+		Resource: "jail:" + j.ID,
+		Details:  "Created jail " + formatJail(j),
+		IP:       c.IP(),
+	})
+	h.reload(c, userID)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "jail created",
+		"jail":    h.view(*j),
+	})
+}
+
+// UpdateJail changes a jail. Current bans keep their expiry.
+func (h *JailHandler) UpdateJail(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var req JailRequest
+	if err := c.BodyParser(&req); err != nil {
+		return constants.ErrInvalidRequestBody
+	}
+	if err := validateJail(&req); err != nil {
+		return err
+	}
+
+	before, err := h.jailRepo.FindByID(c.Context(), id)
+	if err != nil {
+		return constants.ErrJailNotFound
+	}
+	j, err := h.jailRepo.FindByIDAndUpdate(c.Context(), id, map[string]interface{}{
+		"name":         req.Name,
+		"log_path":     req.LogPath,
+		"log_format":   req.LogFormat,
+		"filters":      req.Filters,
+		"ignore_cidrs": req.IgnoreCIDRs,
+		"max_failures": req.MaxFailures,
+		"find_seconds": req.FindSeconds,
+		"ban_seconds":  req.BanSeconds,
+		"action":       req.Action,
+		"enabled":      *req.Enabled,
+	})
+	if err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   constants.AuditActionUpdateJail,
+		Resource: "jail:" + id,
+		Details:  fmt.Sprintf("Updated jail %s -> %s", formatJail(before), formatJail(j)),
+		IP:       c.IP(),
+	})
+	h.reload(c, userID)
+
+	return c.JSON(fiber.Map{"message": "jail updated", "jail": h.view(*j)})
+}
+
+// DeleteJail stops a jail and lifts its bans.
+func (h *JailHandler) DeleteJail(c *fiber.Ctx) error {
+	id := c.Params("id")
+	j, err := h.jailRepo.FindByID(c.Context(), id)
+	if err != nil {
+		return constants.ErrJailNotFound
+	}
+	if err := h.watcher.Uninstall(id); err != nil {
+		return constants.ErrFirewallFailure.Wrap(err)
+	}
+	if err := h.jailRepo.DeleteOne(c.Context(), id); err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   constants.AuditActionDeleteJail,
+		Resource: "jail:" + id,
+		Details:  "Deleted jail " + formatJail(j),
+		IP:       c.IP(),
+	})
+	h.reload(c, userID)
+
+	return c.JSON(fiber.Map{"message": "jail deleted"})
+}
+
+// reload makes the watcher pick up jail changes.
+func (h *JailHandler) reload(c *fiber.Ctx, userID string) {
+	if err := h.watcher.Reload(c.Context()); err != nil {
+		h.hub.EmitError("Failed to reload jails: "+err.Error(), userID)
+	}
+}
+
+// validateJail checks and normalises a jail request.
+func validateJail(req *JailRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return constants.ErrNameRequired
+	}
+	req.LogPath = strings.TrimSpace(req.LogPath)
+	if !filepath.IsAbs(req.LogPath) {
+		return constants.ErrInvalidRequestBody.WithMessage("log_path must be an absolute file path")
+	}
+	req.LogFormat = strings.ToLower(strings.TrimSpace(req.LogFormat))
+	if req.LogFormat == "" {
+		req.LogFormat = constants.JailLogFormatPlain
+	}
+	if req.LogFormat != constants.JailLogFormatPlain && req.LogFormat != constants.JailLogFormatJournal {
+		return constants.ErrInvalidRequestBody.WithMessage("log_format must be plain or journal")
+	}
+
+	if len(req.Filters) == 0 && req.Preset != "" {
+		preset, ok := jail.Presets[req.Preset]
+		if !ok {
+			names := make([]string, 0, len(jail.Presets))
+			for name := range jail.Presets {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return constants.ErrInvalidRequestBody.WithMessage("preset must be one of: " + strings.Join(names, ", "))
+		}
+		req.Filters = append([]string(nil), preset...)
+	}
+	if len(req.Filters) == 0 || len(req.Filters) > constants.JailMaxFilters {
+		return constants.ErrInvalidRequestBody.WithMessage(fmt.Sprintf("between 1 and %d filters (or a preset) are required", constants.JailMaxFilters))
+	}
+	if _, err := jail.Compile(req.Filters); err != nil {
+		return constants.ErrInvalidRequestBody.WithMessage(err.Error())
+	}
+	for i := range req.IgnoreCIDRs {
+		req.IgnoreCIDRs[i] = strings.TrimSpace(req.IgnoreCIDRs[i])
+	}
+	if _, err := jail.ParseIgnore(req.IgnoreCIDRs); err != nil {
+		return constants.ErrInvalidCIDR.WithMessage(err.Error())
+	}
+
+	if req.MaxFailures == 0 {
+		req.MaxFailures = constants.JailDefaultMaxFailures
+	}
+	if req.MaxFailures < 1 {
+		return constants.ErrInvalidRequestBody.WithMessage("max_failures must be at least 1")
+	}
+	if req.FindSeconds == 0 {
+		req.FindSeconds = constants.JailDefaultFindSeconds
+	}
+	if req.FindSeconds < 1 || req.FindSeconds > constants.JailMaxFindSeconds {
+		return constants.ErrInvalidRequestBody.WithMessage(fmt.Sprintf("find_seconds must be between 1 and %d", constants.JailMaxFindSeconds))
+	}
+	if req.BanSeconds == 0 {
+		req.BanSeconds = constants.JailDefaultBanSeconds
+	}
+	if req.BanSeconds < constants.JailSweepSeconds || req.BanSeconds > constants.JailMaxBanSeconds {
+		return constants.ErrInvalidRequestBody.WithMessage(fmt.Sprintf("ban_seconds must be between %d and %d", constants.JailSweepSeconds, constants.JailMaxBanSeconds))
+	}
+
+	req.Action = strings.ToUpper(strings.TrimSpace(req.Action))
+	if req.Action == "" {
+		req.Action = constants.ActionDrop
+	}
+	if req.Action != constants.ActionDrop && req.Action != constants.ActionReject {
+		return constants.ErrInvalidAction.WithMessage("action must be DROP or REJECT")
+	}
+
+	if req.Enabled == nil {
+		enabled := true
+		req.Enabled = &enabled
+	}
+	return nil
+}
+
+// formatJail renders a jail for audit details, e.g.
+// "sshd: /var/log/auth.log (plain), 4 filters, 5 failures in 600s, ban 3600s, DROP".
+func formatJail(j *db.Jail) string {
+	s := fmt.Sprintf("%s: %s (%s), %d filters, %d failures in %ds, ban %ds, %s",
+		j.Name, j.LogPath, j.LogFormat, len(j.Filters), j.MaxFailures, j.FindSeconds, j.BanSeconds, j.Action)
+	if len(j.IgnoreCIDRs) > 0 {
+		s += ", ignoring " + strings.Join(j.IgnoreCIDRs, ", ")
+	}
+	if !j.Enabled {
+		s += ", disabled"
+	}
+	return s
+}
@@ -0,0 +1,571 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/enjoys-in/secureflow/internal/constants"
+	"github.com/enjoys-in/secureflow/internal/convert"
+	"github.com/enjoys-in/secureflow/internal/db"
+	fwPkg "github.com/enjoys-in/secureflow/internal/firewall"
+	"github.com/enjoys-in/secureflow/internal/repository"
+	"github.com/enjoys-in/secureflow/internal/security"
+	"github.com/enjoys-in/secureflow/internal/websocket"
+)
+
+// JITHandler handles just-in-time access: users open a policy's port to
+// their own address for a limited time, optionally after an admin approves.
+type JITHandler struct {
+	policyRepo repository.JITPolicyRepository
+	grantRepo  repository.JITGrantRepository
+	ruleRepo   repository.FirewallRuleRepository
+	auditRepo  repository.AuditLogRepository
+	auth       *security.AuthService
+	fw         *fwPkg.Manager
+	hub        *websocket.Hub
+}
+
+// NewJITHandler creates a new just-in-time access handler.
+func NewJITHandler(
+	policyRepo repository.JITPolicyRepository,
+	grantRepo repository.JITGrantRepository,
+	ruleRepo repository.FirewallRuleRepository,
+	auditRepo repository.AuditLogRepository,
+	auth *security.AuthService,
+	fw *fwPkg.Manager,
+	hub *websocket.Hub,
+) *JITHandler {
+	return &JITHandler{
+		policyRepo: policyRepo,
+		grantRepo:  grantRepo,
+		ruleRepo:   ruleRepo,
+		auditRepo:  auditRepo,
+		auth:       auth,
+		fw:         fw,
+		hub:        hub,
+	}
+}
+
+// JITPolicyRequest is the request body for creating or updating a policy.
+type JITPolicyRequest struct {
+	Port             int            `json:"port"`
+	Protocol         string         `json:"protocol,omitempty"` // defaults to tcp
+	Description      string         `json:"description,omitempty"`
+	MaxMinutes       map[string]int `json:"max_minutes"` // e.g. {"admin": 240, "editor": 60}
+	RequiresApproval bool           `json:"requires_approval"`
+}
+
+// JITAccessRequest is the request body for requesting access.
+type JITAccessRequest struct {
+	Port          int    `json:"port"`
+	Protocol      string `json:"protocol,omitempty"` // defaults to tcp
+	Minutes       int    `json:"minutes"`
+	Justification string `json:"justification"`
+}
+
+// ListPolicies returns every port open to just-in-time access.
+func (h *JITHandler) ListPolicies(c *fiber.Ctx) error {
+	policies, err := h.policyRepo.FindAll(c.Context(), nil, constants.MaxPageLimit, 0)
+	if err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+	return c.JSON(fiber.Map{"policies": policies})
+}
+
+// CreatePolicy makes a port available for just-in-time access. The policy
+// closes the port with a DROP rule that its grants are placed ahead of.
+func (h *JITHandler) CreatePolicy(c *fiber.Ctx) error {
+	var req JITPolicyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return constants.ErrInvalidRequestBody
+	}
+	if err := validateJITPolicy(&req); err != nil {
+		return err
+	}
+	if h.fw.IsPortImmutable(req.Port) {
+		return constants.ErrInvalidRequestBody.WithMessage("port is immutable and always open")
+	}
+
+	if existing, _ := h.policyRepo.FindByPort(c.Context(), req.Port, req.Protocol); existing != nil {
+		return constants.ErrConflict.WithMessage("a policy for this port already exists")
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+	policy := &db.JITPolicy{
+		Port:             req.Port,
+		Protocol:         req.Protocol,
+		Description:      req.Description,
+		MaxMinutes:       req.MaxMinutes,
+		RequiresApproval: req.RequiresApproval,
+		CreatedBy:        userID,
+	}
+	if err := h.policyRepo.Create(c.Context(), policy); err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+	if err := h.fw.AddRule(convert.JITPolicyRule(*policy)); err != nil {
+		_ = h.policyRepo.DeleteOne(c.Context(), policy.ID)
+		h.hub.EmitError(err.Error(), userID)
+		return constants.ErrFirewallFailure.Wrap(err)
+	}
+
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   constants.AuditActionCreateJITPolicy,
+		Resource: "jit_policy:" + policy.ID,
+		Details:  "Created just-in-time access policy: " + formatJITPolicy(policy),
+		IP:       c.IP(),
+	})
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "policy created",
+		"policy":  policy,
+	})
+}
+
+// UpdatePolicy replaces a policy's limits. Access already granted keeps the
+// duration it was granted with.
+func (h *JITHandler) UpdatePolicy(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var req JITPolicyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return constants.ErrInvalidRequestBody
+	}
+	if err := validateJITPolicy(&req); err != nil {
+		return err
+	}
+
+	before, err := h.policyRepo.FindByID(c.Context(), id)
+	if err != nil {
+		return constants.ErrJITPolicyNotFound
+	}
+	if before.Port != req.Port || before.Protocol != req.Protocol {
+		return constants.ErrInvalidRequestBody.WithMessage("port and protocol of a policy cannot be changed")
+	}
+
+	policy, err := h.policyRepo.FindByIDAndUpdate(c.Context(), id, map[string]interface{}{
+		"description":       req.Description,
+		"max_minutes":       req.MaxMinutes,
+		"requires_approval": req.RequiresApproval,
+	})
+	if err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   constants.AuditActionUpdateJITPolicy,
+		Resource: "jit_policy:" + id,
+		Details:  fmt.Sprintf("Updated just-in-time access policy: %s -> %s", formatJITPolicy(before), formatJITPolicy(policy)),
+		IP:       c.IP(),
+	})
+
+	return c.JSON(fiber.Map{"message": "policy updated", "policy": policy})
+}
+
+// DeletePolicy stops new requests for a port and removes the policy's DROP
+// rule. Active grants run until they expire or are revoked.
+func (h *JITHandler) DeletePolicy(c *fiber.Ctx) error {
+	id := c.Params("id")
+	policy, err := h.policyRepo.FindByID(c.Context(), id)
+	if err != nil {
+		return constants.ErrJITPolicyNotFound
+	}
+	if h.fw.HasRule(id) {
+		if err := h.fw.DeleteRule(id); err != nil {
+			return constants.ErrFirewallFailure.Wrap(err)
+		}
+	}
+	if err := h.policyRepo.DeleteOne(c.Context(), id); err != nil {
+		_ = h.fw.AddRule(convert.JITPolicyRule(*policy))
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   constants.AuditActionDeleteJITPolicy,
+		Resource: "jit_policy:" + id,
+		Details:  "Deleted just-in-time access policy: " + formatJITPolicy(policy),
+		IP:       c.IP(),
+	})
+
+	return c.JSON(fiber.Map{"message": "policy deleted"})
+}
+
+// ListRequests returns access requests, newest first. Admins see everyone's;
+// other users see their own. ?status= filters by state.
+func (h *JITHandler) ListRequests(c *fiber.Ctx) error {
+	userID, _ := c.Locals("user_id").(string)
+
+	filter := map[string]interface{}{}
+	if status := c.Query("status"); status != "" {
+		filter["status"] = status
+	}
+	isAdmin, err := h.isAdmin(c.Context(), userID)
+	if err != nil {
+		return constants.ErrPermissionCheck.Wrap(err)
+	}
+	if !isAdmin {
+		filter["user_id"] = userID
+	}
+
+	grants, err := h.grantRepo.FindAll(c.Context(), filter, constants.MaxPageLimit, 0)
+	if err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+	return c.JSON(fiber.Map{"requests": grants})
+}
+
+// RequestAccess asks for the caller's current address to reach a port for a
+// number of minutes. The duration is bounded by the longest the policy
+// allows any of the caller's roles. Without an approval requirement access
+// is granted immediately; otherwise the request waits for an admin.
+func (h *JITHandler) RequestAccess(c *fiber.Ctx) error {
+	var req JITAccessRequest
+	if err := c.BodyParser(&req); err != nil {
+		return constants.ErrInvalidRequestBody
+	}
+	req.Protocol = strings.ToLower(strings.TrimSpace(req.Protocol))
+	if req.Protocol == "" {
+		req.Protocol = constants.ProtocolTCP
+	}
+	req.Justification = strings.TrimSpace(req.Justification)
+	if req.Justification == "" {
+		return constants.ErrMissingRequiredFields.WithMessage("justification is required")
+	}
+	if len(req.Justification) > constants.JITMaxJustificationLength {
+		return constants.ErrInvalidRequestBody.WithMessage(fmt.Sprintf("justification must be at most %d characters", constants.JITMaxJustificationLength))
+	}
+	if req.Minutes <= 0 {
+		return constants.ErrInvalidRequestBody.WithMessage("minutes must be positive")
+	}
+
+	ip := net.ParseIP(c.IP())
+	if ip == nil || ip.To4() == nil {
+		return constants.ErrInvalidRequestBody.WithMessage("just-in-time access requires an IPv4 client address")
+	}
+
+	policy, err := h.policyRepo.FindByPort(c.Context(), req.Port, req.Protocol)
+	if err != nil {
+		return constants.ErrJITPolicyNotFound
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+	limit, err := h.maxMinutes(c.Context(), userID, policy)
+	if err != nil {
+		return constants.ErrPermissionCheck.Wrap(err)
+	}
+	if limit <= 0 {
+		return constants.ErrForbidden.WithMessage("your role may not request access to this port")
+	}
+	if req.Minutes > limit {
+		return constants.ErrForbidden.WithMessage(fmt.Sprintf("your role may request at most %d minutes for this port", limit))
+	}
+
+	for _, status := range []string{constants.JITStatusPending, constants.JITStatusActive} {
+		if _, err := h.grantRepo.FindOne(c.Context(), map[string]interface{}{
+			"user_id":   userID,
+			"policy_id": policy.ID,
+			"source_ip": ip.String(),
+			"status":    status,
+		}); err == nil {
+			return constants.ErrConflict.WithMessage("you already have a " + status + " request for this port from this address")
+		}
+	}
+
+	grant := &db.JITGrant{
+		PolicyID:      policy.ID,
+		UserID:        userID,
+		SourceIP:      ip.String(),
+		Port:          policy.Port,
+		Protocol:      policy.Protocol,
+		Minutes:       req.Minutes,
+		Justification: req.Justification,
+		Status:        constants.JITStatusPending,
+	}
+	if err := h.grantRepo.Create(c.Context(), grant); err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   constants.AuditActionRequestJITAccess,
+		Resource: "jit_grant:" + grant.ID,
+		Details:  fmt.Sprintf("Requested %s access to %s for %dm: %s", grant.SourceIP, formatJITPort(grant.Port, grant.Protocol), grant.Minutes, grant.Justification),
+		IP:       c.IP(),
+	})
+
+	if policy.RequiresApproval {
+		h.hub.EmitRuleChange("jit_requested", grant.ID, userID, grant.Port)
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"message": "access requested; waiting for approval",
+			"request": grant,
+		})
+	}
+
+	grant, err = h.activate(c, grant, userID)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "access granted",
+		"request": grant,
+	})
+}
+
+// ApproveRequest grants a pending request. Access runs for the requested
+// duration from the moment of approval.
+func (h *JITHandler) ApproveRequest(c *fiber.Ctx) error {
+	grant, err := h.grantRepo.FindByID(c.Context(), c.Params("id"))
+	if err != nil {
+		return constants.ErrJITGrantNotFound
+	}
+	if grant.Status != constants.JITStatusPending {
+		return constants.ErrJITGrantState.WithMessage("only pending requests can be approved")
+	}
+	userID, _ := c.Locals("user_id").(string)
+	if grant.UserID == userID {
+		return constants.ErrForbidden.WithMessage("you cannot approve your own request")
+	}
+
+	grant, err = h.activate(c, grant, userID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(fiber.Map{"message": "access granted", "request": grant})
+}
+
+// DenyRequest rejects a pending request.
+func (h *JITHandler) DenyRequest(c *fiber.Ctx) error {
+	id := c.Params("id")
+	userID, _ := c.Locals("user_id").(string)
+
+	grant, err := h.grantRepo.FindAndUpdate(c.Context(),
+		map[string]interface{}{"id": id, "status": constants.JITStatusPending},
+		map[string]interface{}{"status": constants.JITStatusDenied, "decided_by": userID},
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			if _, ferr := h.grantRepo.FindByID(c.Context(), id); ferr != nil {
+				return constants.ErrJITGrantNotFound
+			}
+			return constants.ErrJITGrantState.WithMessage("only pending requests can be denied")
+		}
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   constants.AuditActionDenyJITAccess,
+		Resource: "jit_grant:" + grant.ID,
+		Details:  fmt.Sprintf("Denied %s access to %s for %dm: %s", grant.SourceIP, formatJITPort(grant.Port, grant.Protocol), grant.Minutes, grant.Justification),
+		IP:       c.IP(),
+	})
+	h.hub.EmitRuleChange("jit_denied", grant.ID, grant.UserID, grant.Port)
+
+	return c.JSON(fiber.Map{"message": "request denied", "request": grant})
+}
+
+// RevokeRequest ends access early, or withdraws a pending request. Requesters
+// may revoke their own; admins may revoke anyone's.
+func (h *JITHandler) RevokeRequest(c *fiber.Ctx) error {
+	grant, err := h.grantRepo.FindByID(c.Context(), c.Params("id"))
+	if err != nil {
+		return constants.ErrJITGrantNotFound
+	}
+	userID, _ := c.Locals("user_id").(string)
+	if grant.UserID != userID {
+		isAdmin, err := h.isAdmin(c.Context(), userID)
+		if err != nil {
+			return constants.ErrPermissionCheck.Wrap(err)
+		}
+		if !isAdmin {
+			return constants.ErrForbidden
+		}
+	}
+	if grant.Status != constants.JITStatusPending && grant.Status != constants.JITStatusActive {
+		return constants.ErrJITGrantState.WithMessage("only pending or active requests can be revoked")
+	}
+
+	// Close the port before recording the revocation, so a failure leaves the
+	// grant active and visibly so.
+	if grant.RuleID != "" {
+		if h.fw.HasRule(grant.RuleID) {
+			if err := h.fw.DeleteRule(grant.RuleID); err != nil {
+				h.hub.EmitError(err.Error(), userID)
+				return constants.ErrFirewallFailure.Wrap(err)
+			}
+		}
+		if err := h.ruleRepo.DeleteNonImmutable(c.Context(), grant.RuleID); err != nil {
+			return constants.ErrDatabaseFailure.Wrap(err)
+		}
+	}
+
+	revoked, err := h.grantRepo.FindAndUpdate(c.Context(),
+		map[string]interface{}{"id": grant.ID, "status": grant.Status},
+		map[string]interface{}{"status": constants.JITStatusRevoked},
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return constants.ErrJITGrantState.WithMessage("request changed state while being revoked")
+		}
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   constants.AuditActionRevokeJITAccess,
+		Resource: "jit_grant:" + grant.ID,
+		Details:  fmt.Sprintf("Revoked %s access to %s (was %s): %s", grant.SourceIP, formatJITPort(grant.Port, grant.Protocol), grant.Status, grant.Justification),
+		IP:       c.IP(),
+	})
+	if grant.RuleID != "" {
+		h.hub.EmitRuleChange("jit_revoked", grant.RuleID, grant.UserID, grant.Port)
+	}
+
+	return c.JSON(fiber.Map{"message": "access revoked", "request": revoked})
+}
+
+// activate installs the temporary ACCEPT rule for a pending grant and marks
+// it active. The rule takes priority, so it is matched before the policy's
+// DROP and any other DROP for the port. It carries the grant's expiry, so
+// the rule expiry worker removes it on time. approverID is the requester for auto-approved grants.
+func (h *JITHandler) activate(c *fiber.Ctx, grant *db.JITGrant, approverID string) (*db.JITGrant, error) {
+	expiresAt := time.Now().Add(time.Duration(grant.Minutes) * time.Minute)
+	dbRule := &db.FirewallRule{
+		Direction:   constants.DirectionInbound,
+		Protocol:    grant.Protocol,
+		Port:        grant.Port,
+		SourceCIDR:  grant.SourceIP + "/32",
+		Action:      constants.ActionAccept,
+		ExpiresAt:   &expiresAt,
+		Description: "JIT access: " + grant.Justification,
+		CreatedBy:   grant.UserID,
+	}
+	rule := convert.Rule(*dbRule)
+	rule.Priority = true
+	if err := fwPkg.ValidateRule(rule); err != nil {
+		return nil, constants.ErrInvalidRequestBody.WithMessage(err.Error())
+	}
+	if err := h.ruleRepo.Create(c.Context(), dbRule); err != nil {
+		return nil, constants.ErrDatabaseFailure.WithMessage("failed to persist rule to database")
+	}
+
+	rule.ID = dbRule.ID
+	if err := h.fw.AddRule(rule); err != nil {
+		_ = h.ruleRepo.DeleteOne(c.Context(), dbRule.ID)
+		h.hub.EmitError(err.Error(), approverID)
+		return nil, constants.ErrFirewallFailure.Wrap(err)
+	}
+
+	active, err := h.grantRepo.FindAndUpdate(c.Context(),
+		map[string]interface{}{"id": grant.ID, "status": constants.JITStatusPending},
+		map[string]interface{}{
+			"status":     constants.JITStatusActive,
+			"rule_id":    dbRule.ID,
+			"decided_by": approverID,
+			"expires_at": expiresAt,
+		},
+	)
+	if err != nil {
+		_ = h.fw.DeleteRule(dbRule.ID)
+		_ = h.ruleRepo.DeleteOne(c.Context(), dbRule.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, constants.ErrJITGrantState.WithMessage("request was decided concurrently")
+		}
+		return nil, constants.ErrDatabaseFailure.Wrap(err)
+	}
+
+	how := "auto-approved"
+	if approverID != grant.UserID {
+		how = "approved"
+	}
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   approverID,
+		Action:   constants.AuditActionGrantJITAccess,
+		Resource: "jit_grant:" + grant.ID,
+		Details: fmt.Sprintf("Granted %s access to %s for %dm (%s, rule %s, expires=%s): %s",
+			grant.SourceIP, formatJITPort(grant.Port, grant.Protocol), grant.Minutes, how,
+			dbRule.ID, expiryString(&expiresAt), grant.Justification),
+		IP: c.IP(),
+	})
+	h.hub.EmitRuleChange("jit_granted", dbRule.ID, grant.UserID, grant.Port)
+
+	return active, nil
+}
+
+// maxMinutes returns the longest grant the policy allows any of the user's
+// roles; 0 means none of them may request access.
+func (h *JITHandler) maxMinutes(ctx context.Context, userID string, policy *db.JITPolicy) (int, error) {
+	limit := 0
+	for _, role := range []string{constants.RoleAdmin, constants.RoleEditor, constants.RoleViewer} {
+		m := policy.MaxMinutes[role]
+		if m <= limit {
+			continue
+		}
+		ok, err := h.auth.CheckPermission(ctx, userID, role, constants.FGAObjectSystem)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			limit = m
+		}
+	}
+	return limit, nil
+}
+
+// isAdmin reports whether the user may administer the firewall.
+func (h *JITHandler) isAdmin(ctx context.Context, userID string) (bool, error) {
+	return h.auth.CheckPermission(ctx, userID, constants.RelationCanAdmin, constants.FGAObjectFirewall)
+}
+
+// validateJITPolicy checks and normalises a policy request.
+func validateJITPolicy(req *JITPolicyRequest) error {
+	req.Protocol = strings.ToLower(strings.TrimSpace(req.Protocol))
+	if req.Protocol == "" {
+		req.Protocol = constants.ProtocolTCP
+	}
+	if req.Protocol != constants.ProtocolTCP && req.Protocol != constants.ProtocolUDP {
+		return constants.ErrInvalidProtocol.WithMessage("protocol must be tcp or udp")
+	}
+	if req.Port < 1 || req.Port > 65535 {
+		return constants.ErrInvalidPort.WithMessage("port must be between 1 and 65535")
+	}
+	if len(req.MaxMinutes) == 0 {
+		return constants.ErrMissingRequiredFields.WithMessage("max_minutes must allow at least one role")
+	}
+	for role, m := range req.MaxMinutes {
+		if !constants.ValidRoles[role] {
+			return constants.ErrInvalidRole.WithMessage(fmt.Sprintf("unknown role %q in max_minutes", role))
+		}
+		if m < 0 || m > 7*24*60 {
+			return constants.ErrInvalidRequestBody.WithMessage(fmt.Sprintf("max_minutes for %s must be between 0 and %d", role, 7*24*60))
+		}
+	}
+	return nil
+}
+
+// formatJITPolicy renders a policy for audit details, e.g.
+// "tcp/22 max={admin:240 editor:60} approval=true".
+func formatJITPolicy(p *db.JITPolicy) string {
+	var limits []string
+	for _, role := range []string{constants.RoleAdmin, constants.RoleEditor, constants.RoleViewer} {
+		if m, ok := p.MaxMinutes[role]; ok {
+			limits = append(limits, fmt.Sprintf("%s:%d", role, m))
+		}
+	}
+	return fmt.Sprintf("%s max={%s} approval=%t", formatJITPort(p.Port, p.Protocol), strings.Join(limits, " "), p.RequiresApproval)
+}
+
+// formatJITPort renders a port as e.g. "tcp/22".
+func formatJITPort(port int, protocol string) string {
+	return fmt.Sprintf("%s/%d", protocol, port)
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/enjoys-in/secureflow/internal/constants"
+	"github.com/enjoys-in/secureflow/internal/db"
+	fwPkg "github.com/enjoys-in/secureflow/internal/firewall"
+	"github.com/enjoys-in/secureflow/internal/knock"
+	"github.com/enjoys-in/secureflow/internal/repository"
+	"github.com/enjoys-in/secureflow/internal/websocket"
+)
+
+// KnockHandler handles port knocking gates.
+type KnockHandler struct {
+	gateRepo  repository.KnockGateRepository
+	auditRepo repository.AuditLogRepository
+	detector  *knock.Detector
+	fw        *fwPkg.Manager
+	hub       *websocket.Hub
+}
+
+// NewKnockHandler creates a new knock gate handler.
+func NewKnockHandler(gateRepo repository.KnockGateRepository, auditRepo repository.AuditLogRepository, detector *knock.Detector, fw *fwPkg.Manager, hub *websocket.Hub) *KnockHandler {
+	return &KnockHandler{gateRepo: gateRepo, auditRepo: auditRepo, detector: detector, fw: fw, hub: hub}
+}
+
+// KnockGateRequest is the request body for creating or updating a gate. On
+// update an empty sequence keeps the current one.
+type KnockGateRequest struct {
+	Name          string       `json:"name"`
+	Description   string       `json:"description,omitempty"`
+	Port          int          `json:"port"`
+	Protocol      string       `json:"protocol,omitempty"` // defaults to tcp
+	Sequence      []knock.Step `json:"sequence"`
+	WindowSeconds int          `json:"window_seconds,omitempty"`
+	OpenSeconds   int          `json:"open_seconds,omitempty"`
+}
+
+// ListKnockGates returns all gates. Sequences are never returned.
+func (h *KnockHandler) ListKnockGates(c *fiber.Ctx) error {
+	gates, err := h.gateRepo.FindAll(c.Context(), nil, constants.MaxPageLimit, 0)
+	if err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+	return c.JSON(fiber.Map{"gates": gates})
+}
+
+// GetKnockGate returns a single gate.
+func (h *KnockHandler) GetKnockGate(c *fiber.Ctx) error {
+	gate, err := h.gateRepo.FindByID(c.Context(), c.Params("id"))
+	if err != nil {
+		return constants.ErrKnockGateNotFound
+	}
+	return c.JSON(fiber.Map{"gate": gate})
+}
+
+// CreateKnockGate stores a gate with its sequence hashed, closes its port and
+// starts watching for it.
+func (h *KnockHandler) CreateKnockGate(c *fiber.Ctx) error {
+	var req KnockGateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return constants.ErrInvalidRequestBody
+	}
+	if err := h.validateKnockGate(&req, true); err != nil {
+		return err
+	}
+
+	salt, err := knock.NewSalt()
+	if err != nil {
+		return constants.ErrInternal.Wrap(err)
+	}
+	userID, _ := c.Locals("user_id").(string)
+	gate := &db.KnockGate{
+		Name:           req.Name,
+		Description:    req.Description,
+		Port:           req.Port,
+		Protocol:       req.Protocol,
+		SequenceHash:   knock.Hash(salt, req.Sequence),
+		SequenceSalt:   salt,
+		SequenceLength: len(req.Sequence),
+		WindowSeconds:  req.WindowSeconds,
+		OpenSeconds:    req.OpenSeconds,
+		CreatedBy:      userID,
+	}
+	if err := h.gateRepo.Create(c.Context(), gate); err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+	if err := h.detector.Install(gate); err != nil {
+		_ = h.gateRepo.DeleteOne(c.Context(), gate.ID)
+		h.hub.EmitError(err.Error(), userID)
+		return constants.ErrFirewallFailure.Wrap(err)
+	}
+
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   constants.AuditActionCreateKnockGate,
+		Resource: "knock_gate:" + gate.ID,
+		Details:  "Created knock gate " + formatKnockGate(gate),
+		IP:       c.IP(),
+	})
+	h.reload(c, userID)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "knock gate created",
+		"gate":    gate,
+	})
+}
+
+// UpdateKnockGate changes a gate. Sources already let through keep their
+// access until it expires.
+func (h *KnockHandler) UpdateKnockGate(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var req KnockGateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return constants.ErrInvalidRequestBody
+	}
+	if err := h.validateKnockGate(&req, false); err != nil {
+		return err
+	}
+
+	before, err := h.gateRepo.FindByID(c.Context(), id)
+	if err != nil {
+		return constants.ErrKnockGateNotFound
+	}
+
+	updates := map[string]interface{}{
+		"name":           req.Name,
+		"description":    req.Description,
+		"port":           req.Port,
+		"protocol":       req.Protocol,
+		"window_seconds": req.WindowSeconds,
+		"open_seconds":   req.OpenSeconds,
+	}
+	sequenceNote := ""
+	if len(req.Sequence) > 0 {
+		salt, err := knock.NewSalt()
+		if err != nil {
+			return constants.ErrInternal.Wrap(err)
+		}
+		updates["sequence_hash"] = knock.Hash(salt, req.Sequence)
+		updates["sequence_salt"] = salt
+		updates["sequence_length"] = len(req.Sequence)
+		sequenceNote = " (sequence changed)"
+	}
+
+	// Move the gate's DROP before saving, so a failure leaves both as they
+	// were.
+	userID, _ := c.Locals("user_id").(string)
+	next := *before
+	next.Port, next.Protocol = req.Port, req.Protocol
+	if err := h.detector.Install(&next); err != nil {
+		h.hub.EmitError(err.Error(), userID)
+		return constants.ErrFirewallFailure.Wrap(err)
+	}
+
+	gate, err := h.gateRepo.FindByIDAndUpdate(c.Context(), id, updates)
+	if err != nil {
+		_ = h.detector.Install(before)
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   constants.AuditActionUpdateKnockGate,
+		Resource: "knock_gate:" + id,
+		Details:  fmt.Sprintf("Updated knock gate %s -> %s%s", formatKnockGate(before), formatKnockGate(gate), sequenceNote),
+		IP:       c.IP(),
+	})
+	h.reload(c, userID)
+
+	return c.JSON(fiber.Map{"message": "knock gate updated", "gate": gate})
+}
+
+// DeleteKnockGate stops watching for a gate's sequence and reopens its port.
+// Sources already let through keep their access until it expires.
+func (h *KnockHandler) DeleteKnockGate(c *fiber.Ctx) error {
+	id := c.Params("id")
+	gate, err := h.gateRepo.FindByID(c.Context(), id)
+	if err != nil {
+		return constants.ErrKnockGateNotFound
+	}
+	if err := h.detector.Uninstall(id); err != nil {
+		return constants.ErrFirewallFailure.Wrap(err)
+	}
+	if err := h.gateRepo.DeleteOne(c.Context(), id); err != nil {
+		_ = h.detector.Install(gate)
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   constants.AuditActionDeleteKnockGate,
+		Resource: "knock_gate:" + id,
+		Details:  "Deleted knock gate " + formatKnockGate(gate),
+		IP:       c.IP(),
+	})
+	h.reload(c, userID)
+
+	return c.JSON(fiber.Map{"message": "knock gate deleted"})
+}
+
+// reload makes the detector pick up gate changes.
+func (h *KnockHandler) reload(c *fiber.Ctx, userID string) {
+	if err := h.detector.Reload(c.Context()); err != nil {
+		h.hub.EmitError("Failed to reload knock gates: "+err.Error(), userID)
+	}
+}
+
+// validateKnockGate checks and normalises a gate request. The sequence is
+// required on create and optional on update.
+func (h *KnockHandler) validateKnockGate(req *KnockGateRequest, create bool) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return constants.ErrNameRequired
+	}
+	req.Protocol = strings.ToLower(strings.TrimSpace(req.Protocol))
+	if req.Protocol == "" {
+		req.Protocol = constants.ProtocolTCP
+	}
+	if req.Protocol != constants.ProtocolTCP && req.Protocol != constants.ProtocolUDP {
+		return constants.ErrInvalidProtocol.WithMessage("protocol must be tcp or udp")
+	}
+	if req.Port < 1 || req.Port > 65535 {
+		return constants.ErrInvalidPort.WithMessage("port must be between 1 and 65535")
+	}
+	if h.fw.IsPortImmutable(req.Port) {
+		return constants.ErrInvalidRequestBody.WithMessage("port is immutable and always open")
+	}
+
+	if req.WindowSeconds == 0 {
+		req.WindowSeconds = constants.KnockDefaultWindowSeconds
+	}
+	if req.WindowSeconds < 1 || req.WindowSeconds > constants.KnockMaxWindowSeconds {
+		return constants.ErrInvalidRequestBody.WithMessage(fmt.Sprintf("window_seconds must be between 1 and %d", constants.KnockMaxWindowSeconds))
+	}
+	if req.OpenSeconds == 0 {
+		req.OpenSeconds = constants.KnockDefaultOpenSeconds
+	}
+	if req.OpenSeconds < constants.RuleExpiryCheckSeconds || req.OpenSeconds > constants.KnockMaxOpenSeconds {
+		return constants.ErrInvalidRequestBody.WithMessage(fmt.Sprintf("open_seconds must be between %d and %d", constants.RuleExpiryCheckSeconds, constants.KnockMaxOpenSeconds))
+	}
+
+	if !create && len(req.Sequence) == 0 {
+		return nil
+	}
+	if err := knock.Validate(req.Sequence); err != nil {
+		return constants.ErrInvalidRequestBody.WithMessage(err.Error())
+	}
+	return nil
+}
+
+// formatKnockGate renders a gate for audit details without its sequence,
+// e.g. "ssh: tcp/22, 3 knocks within 10s, open 300s".
+func formatKnockGate(g *db.KnockGate) string {
+	return fmt.Sprintf("%s: %s/%d, %d knocks within %ds, open %ds",
+		g.Name, g.Protocol, g.Port, g.SequenceLength, g.WindowSeconds, g.OpenSeconds)
+}
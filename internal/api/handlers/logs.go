@@ -6,17 +6,19 @@ import (
 	"github.com/gofiber/fiber/v2"
 
 	"github.com/enjoys-in/secureflow/internal/constants"
+	fwPkg "github.com/enjoys-in/secureflow/internal/firewall"
 	"github.com/enjoys-in/secureflow/internal/repository"
 )
 
-// LogsHandler handles audit logs.
+// LogsHandler handles audit logs and FQDN resolution history.
 type LogsHandler struct {
 	auditRepo repository.AuditLogRepository
+	fqdnRepo  repository.FQDNResolutionRepository
 }
 
 // NewLogsHandler creates a new logs handler.
-func NewLogsHandler(auditRepo repository.AuditLogRepository) *LogsHandler {
-	return &LogsHandler{auditRepo: auditRepo}
+func NewLogsHandler(auditRepo repository.AuditLogRepository, fqdnRepo repository.FQDNResolutionRepository) *LogsHandler {
+	return &LogsHandler{auditRepo: auditRepo, fqdnRepo: fqdnRepo}
 }
 
 // ListAuditLogs returns paginated audit logs.
@@ -39,3 +41,30 @@ func (h *LogsHandler) ListAuditLogs(c *fiber.Ctx) error {
 		"offset":     offset,
 	})
 }
+
+// ListFQDNResolutions returns the paginated history of what rule hostnames
+// resolved to, newest first, optionally for one ?hostname=.
+func (h *LogsHandler) ListFQDNResolutions(c *fiber.Ctx) error {
+	limit, _ := strconv.Atoi(c.Query("limit", strconv.Itoa(constants.DefaultPageLimit)))
+	offset, _ := strconv.Atoi(c.Query("offset", "0"))
+
+	if limit > constants.MaxPageLimit {
+		limit = constants.MaxPageLimit
+	}
+
+	var filter map[string]interface{}
+	if hostname := fwPkg.NormalizeFQDN(c.Query("hostname")); hostname != "" {
+		filter = map[string]interface{}{"hostname": hostname}
+	}
+
+	history, err := h.fqdnRepo.FindAll(c.Context(), filter, limit, offset)
+	if err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+
+	return c.JSON(fiber.Map{
+		"resolutions": history,
+		"limit":       limit,
+		"offset":      offset,
+	})
+}
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/enjoys-in/secureflow/internal/constants"
+	"github.com/enjoys-in/secureflow/internal/db"
+	fwPkg "github.com/enjoys-in/secureflow/internal/firewall"
+	"github.com/enjoys-in/secureflow/internal/repository"
+	"github.com/enjoys-in/secureflow/internal/websocket"
+)
+
+// NATHandler handles DNAT port forwards and SNAT/masquerade rules on the
+// local server.
+type NATHandler struct {
+	natRepo   repository.NATRuleRepository
+	auditRepo repository.AuditLogRepository
+	fw        *fwPkg.Manager
+	hub       *websocket.Hub
+	serverID  string
+}
+
+// NewNATHandler creates a new NAT handler for the server serverID.
+func NewNATHandler(natRepo repository.NATRuleRepository, auditRepo repository.AuditLogRepository, fw *fwPkg.Manager, hub *websocket.Hub, serverID string) *NATHandler {
+	return &NATHandler{natRepo: natRepo, auditRepo: auditRepo, fw: fw, hub: hub, serverID: serverID}
+}
+
+// NATRuleRequest is the request body for creating a NAT rule.
+type NATRuleRequest struct {
+	Type         string `json:"type"`
+	Interface    string `json:"interface,omitempty"`
+	Protocol     string `json:"protocol"`
+	SourceCIDR   string `json:"source_cidr,omitempty"`
+	DestCIDR     string `json:"dest_cidr,omitempty"`
+	Port         int    `json:"port,omitempty"`
+	PortRangeEnd int    `json:"port_range_end,omitempty"`
+	ToAddress    string `json:"to_address,omitempty"`
+	ToPort       int    `json:"to_port,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+// UpdateNATRuleRequest is the request body for partially updating a NAT rule.
+type UpdateNATRuleRequest struct {
+	Type         *string `json:"type,omitempty"`
+	Interface    *string `json:"interface,omitempty"`
+	Protocol     *string `json:"protocol,omitempty"`
+	SourceCIDR   *string `json:"source_cidr,omitempty"`
+	DestCIDR     *string `json:"dest_cidr,omitempty"`
+	Port         *int    `json:"port,omitempty"`
+	PortRangeEnd *int    `json:"port_range_end,omitempty"`
+	ToAddress    *string `json:"to_address,omitempty"`
+	ToPort       *int    `json:"to_port,omitempty"`
+	Description  *string `json:"description,omitempty"`
+}
+
+// ListNATRules returns the NAT rules of this server.
+func (h *NATHandler) ListNATRules(c *fiber.Ctx) error {
+	rules, err := h.natRepo.FindByServer(c.Context(), h.serverID)
+	if err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+	return c.JSON(fiber.Map{"nat_rules": rules})
+}
+
+// GetNATRule returns a single NAT rule.
+func (h *NATHandler) GetNATRule(c *fiber.Ctx) error {
+	rule, err := h.natRepo.FindByID(c.Context(), c.Params("id"))
+	if err != nil {
+		return constants.ErrNATRuleNotFound
+	}
+	return c.JSON(fiber.Map{"nat_rule": rule})
+}
+
+// CreateNATRule persists and installs a new NAT rule.
+func (h *NATHandler) CreateNATRule(c *fiber.Ctx) error {
+	var req NATRuleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return constants.ErrInvalidRequestBody
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+	dbRule := &db.NATRule{
+		ServerID:     h.serverID,
+		Type:         req.Type,
+		Interface:    req.Interface,
+		Protocol:     req.Protocol,
+		SourceCIDR:   req.SourceCIDR,
+		DestCIDR:     req.DestCIDR,
+		Port:         req.Port,
+		PortRangeEnd: req.PortRangeEnd,
+		ToAddress:    req.ToAddress,
+		ToPort:       req.ToPort,
+		Description:  req.Description,
+		CreatedBy:    userID,
+	}
+	if err := fwPkg.ValidateNATRule(toFirewallNATRule(dbRule)); err != nil {
+		return constants.ErrInvalidRequestBody.WithMessage(err.Error())
+	}
+	if err := fwPkg.CheckHostInterfaces(dbRule.Interface); err != nil {
+		return constants.ErrInvalidRequestBody.WithMessage(err.Error())
+	}
+
+	if err := h.natRepo.Create(c.Context(), dbRule); err != nil {
+		return constants.ErrDatabaseFailure.WithMessage("failed to persist nat rule to database")
+	}
+
+	// Tag the kernel rule with the DB ID so later updates and deletes can find it.
+	if err := h.fw.AddNATRule(toFirewallNATRule(dbRule)); err != nil {
+		_ = h.natRepo.DeleteOne(c.Context(), dbRule.ID)
+		h.hub.EmitError(err.Error(), userID)
+		return constants.ErrFirewallFailure.Wrap(err)
+	}
+
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   constants.AuditActionAddNATRule,
+		Resource: "nat_rule:" + dbRule.ID,
+		Details:  describeNATRule(dbRule),
+		IP:       c.IP(),
+	})
+
+	h.hub.EmitRuleChange("nat_rule_added", dbRule.ID, userID, dbRule.Port)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":  "nat rule created",
+		"nat_rule": dbRule,
+	})
+}
+
+// UpdateNATRule merges the request onto a NAT rule, swaps the kernel rule
+// in place and persists the change.
+func (h *NATHandler) UpdateNATRule(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var req UpdateNATRuleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return constants.ErrInvalidRequestBody
+	}
+
+	before, err := h.natRepo.FindByID(c.Context(), id)
+	if err != nil {
+		return constants.ErrNATRuleNotFound
+	}
+
+	after := *before
+	updates := map[string]interface{}{}
+	setString := func(col string, v *string, dst *string) {
+		if v != nil {
+			*dst = *v
+			updates[col] = *v
+		}
+	}
+	setInt := func(col string, v *int, dst *int) {
+		if v != nil {
+			*dst = *v
+			updates[col] = *v
+		}
+	}
+	setString("type", req.Type, &after.Type)
+	setString("interface", req.Interface, &after.Interface)
+	setString("protocol", req.Protocol, &after.Protocol)
+	setString("source_cidr", req.SourceCIDR, &after.SourceCIDR)
+	setString("dest_cidr", req.DestCIDR, &after.DestCIDR)
+	setInt("port", req.Port, &after.Port)
+	setInt("port_range_end", req.PortRangeEnd, &after.PortRangeEnd)
+	setString("to_address", req.ToAddress, &after.ToAddress)
+	setInt("to_port", req.ToPort, &after.ToPort)
+	setString("description", req.Description, &after.Description)
+	if len(updates) == 0 {
+		return constants.ErrInvalidRequestBody.WithMessage("no fields to update")
+	}
+
+	rule := toFirewallNATRule(&after)
+	if err := fwPkg.ValidateNATRule(rule); err != nil {
+		return constants.ErrInvalidRequestBody.WithMessage(err.Error())
+	}
+	if err := fwPkg.CheckHostInterfaces(rule.Interface); err != nil {
+		return constants.ErrInvalidRequestBody.WithMessage(err.Error())
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+	if err := h.fw.ReplaceNATRule(rule); err != nil {
+		h.hub.EmitError(err.Error(), userID)
+		return constants.ErrFirewallFailure.Wrap(err)
+	}
+
+	updated, err := h.natRepo.FindByIDAndUpdate(c.Context(), id, updates)
+	if err != nil {
+		return constants.ErrDatabaseFailure.WithMessage("nat rule replaced in firewall but failed to update database")
+	}
+
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   constants.AuditActionUpdateNATRule,
+		Resource: "nat_rule:" + id,
+		Details:  fmt.Sprintf("%s -> %s", describeNATRule(before), describeNATRule(updated)),
+		IP:       c.IP(),
+	})
+
+	h.hub.EmitRuleChange("nat_rule_updated", id, userID, updated.Port)
+
+	return c.JSON(fiber.Map{"message": "nat rule updated", "nat_rule": updated})
+}
+
+// DeleteNATRule removes a NAT rule from the kernel and the database.
+func (h *NATHandler) DeleteNATRule(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	dbRule, err := h.natRepo.FindByID(c.Context(), id)
+	if err != nil {
+		return constants.ErrNATRuleNotFound
+	}
+
+	if err := h.fw.DeleteNATRule(id); err != nil {
+		return constants.ErrFirewallFailure.Wrap(err)
+	}
+
+	if err := h.natRepo.DeleteOne(c.Context(), id); err != nil {
+		return constants.ErrDatabaseFailure.WithMessage("nat rule removed from firewall but failed to remove from database")
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   constants.AuditActionDeleteNATRule,
+		Resource: "nat_rule:" + id,
+		Details:  describeNATRule(dbRule),
+		IP:       c.IP(),
+	})
+
+	h.hub.EmitRuleChange("nat_rule_deleted", id, userID, dbRule.Port)
+
+	return c.JSON(fiber.Map{"message": "nat rule deleted"})
+}
+
+// toFirewallNATRule converts a stored NAT rule to its syscall-layer form.
+func toFirewallNATRule(r *db.NATRule) fwPkg.NATRule {
+	return fwPkg.NATRule{
+		ID:         r.ID,
+		Type:       r.Type,
+		Interface:  r.Interface,
+		Protocol:   r.Protocol,
+		SourceCIDR: r.SourceCIDR,
+		DestCIDR:   r.DestCIDR,
+		Port:       r.Port,
+		PortEnd:    r.PortRangeEnd,
+		ToAddress:  r.ToAddress,
+		ToPort:     r.ToPort,
+	}
+}
+
+// describeNATRule renders a NAT rule for audit details, e.g.
+// "dnat tcp/8080 via eth0 -> 10.0.0.5:80".
+func describeNATRule(r *db.NATRule) string {
+	s := r.Type + " " + r.Protocol
+	if r.Port > 0 {
+		s += fmt.Sprintf("/%d", r.Port)
+		if r.PortRangeEnd > 0 {
+			s += fmt.Sprintf("-%d", r.PortRangeEnd)
+		}
+	}
+	if r.Interface != "" {
+		s += " via " + r.Interface
+	}
+	if r.ToAddress != "" {
+		s += " -> " + r.ToAddress
+		if r.ToPort > 0 {
+			s += fmt.Sprintf(":%d", r.ToPort)
+		}
+	}
+	return s
+}
@@ -0,0 +1,370 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/enjoys-in/secureflow/internal/constants"
+	"github.com/enjoys-in/secureflow/internal/convert"
+	"github.com/enjoys-in/secureflow/internal/db"
+	fwPkg "github.com/enjoys-in/secureflow/internal/firewall"
+	"github.com/enjoys-in/secureflow/internal/repository"
+	"github.com/enjoys-in/secureflow/internal/websocket"
+)
+
+// ObjectHandler handles named address and service objects that rules can
+// reference instead of repeating literal CIDRs and ports.
+type ObjectHandler struct {
+	addrRepo  repository.AddressObjectRepository
+	svcRepo   repository.ServiceObjectRepository
+	auditRepo repository.AuditLogRepository
+	fw        *fwPkg.Manager
+	hub       *websocket.Hub
+}
+
+// NewObjectHandler creates a new object handler.
+func NewObjectHandler(addrRepo repository.AddressObjectRepository, svcRepo repository.ServiceObjectRepository, auditRepo repository.AuditLogRepository, fw *fwPkg.Manager, hub *websocket.Hub) *ObjectHandler {
+	return &ObjectHandler{addrRepo: addrRepo, svcRepo: svcRepo, auditRepo: auditRepo, fw: fw, hub: hub}
+}
+
+// AddressObjectRequest is the request body for creating or updating an address object.
+type AddressObjectRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Addresses   []string `json:"addresses"`
+}
+
+// ServiceObjectRequest is the request body for creating or updating a service object.
+type ServiceObjectRequest struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Protocol    string           `json:"protocol"`
+	Ports       []db.ServicePort `json:"ports"`
+}
+
+// ---------- Address objects ----------
+
+// ListAddressObjects returns all address objects.
+func (h *ObjectHandler) ListAddressObjects(c *fiber.Ctx) error {
+	objs, err := h.addrRepo.FindAll(c.Context(), nil, constants.MaxPageLimit, 0)
+	if err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+	return c.JSON(fiber.Map{"address_objects": objs})
+}
+
+// GetAddressObject returns a single address object.
+func (h *ObjectHandler) GetAddressObject(c *fiber.Ctx) error {
+	obj, err := h.addrRepo.FindByID(c.Context(), c.Params("id"))
+	if err != nil {
+		return constants.ErrAddressObjectNotFound
+	}
+	return c.JSON(fiber.Map{"address_object": obj})
+}
+
+// CreateAddressObject creates a new address object.
+func (h *ObjectHandler) CreateAddressObject(c *fiber.Ctx) error {
+	var req AddressObjectRequest
+	if err := c.BodyParser(&req); err != nil {
+		return constants.ErrInvalidRequestBody
+	}
+	if err := validateAddressObject(&req); err != nil {
+		return err
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+	obj := &db.AddressObject{
+		Name:        req.Name,
+		Description: req.Description,
+		Addresses:   req.Addresses,
+		CreatedBy:   userID,
+	}
+	if err := h.addrRepo.Create(c.Context(), obj); err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   constants.AuditActionCreateAddressObject,
+		Resource: "address_object:" + obj.ID,
+		Details:  fmt.Sprintf("Created address object %s with %d addresses", obj.Name, len(obj.Addresses)),
+		IP:       c.IP(),
+	})
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":        "address object created",
+		"address_object": obj,
+	})
+}
+
+// UpdateAddressObject replaces an address object's contents. Kernel sets
+// compiled from it are re-synced, so every rule using it follows the edit.
+func (h *ObjectHandler) UpdateAddressObject(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var req AddressObjectRequest
+	if err := c.BodyParser(&req); err != nil {
+		return constants.ErrInvalidRequestBody
+	}
+	if err := validateAddressObject(&req); err != nil {
+		return err
+	}
+
+	before, err := h.addrRepo.FindByID(c.Context(), id)
+	if err != nil {
+		return constants.ErrAddressObjectNotFound
+	}
+
+	obj, err := h.addrRepo.FindByIDAndUpdate(c.Context(), id, map[string]interface{}{
+		"name":        req.Name,
+		"description": req.Description,
+		"addresses":   req.Addresses,
+	})
+	if err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+	if err := h.fw.RefreshReference(fwPkg.RefAddressObject, id); err != nil {
+		// Put the old addresses back so DB and kernel agree again.
+		_, _ = h.addrRepo.FindByIDAndUpdate(c.Context(), id, map[string]interface{}{
+			"name":        before.Name,
+			"description": before.Description,
+			"addresses":   before.Addresses,
+		})
+		_ = h.fw.RefreshReference(fwPkg.RefAddressObject, id)
+		h.hub.EmitError("Failed to refresh address object: "+err.Error(), userID)
+		return constants.ErrFirewallFailure.Wrap(err)
+	}
+
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   constants.AuditActionUpdateAddressObject,
+		Resource: "address_object:" + id,
+		Details:  fmt.Sprintf("Updated address object %s: %d addresses", obj.Name, len(obj.Addresses)),
+		IP:       c.IP(),
+	})
+
+	h.hub.EmitRuleChange("address_object_updated", id, userID, 0)
+
+	return c.JSON(fiber.Map{"message": "address object updated", "address_object": obj})
+}
+
+// DeleteAddressObject deletes an address object no rule references.
+func (h *ObjectHandler) DeleteAddressObject(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	n, err := h.addrRepo.CountReferences(c.Context(), id)
+	if err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+	if n > 0 {
+		return constants.ErrObjectReferenced.WithMessage(fmt.Sprintf("address object is referenced by %d rule(s)", n))
+	}
+
+	if err := h.addrRepo.DeleteOne(c.Context(), id); err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   constants.AuditActionDeleteAddressObject,
+		Resource: "address_object:" + id,
+		IP:       c.IP(),
+	})
+
+	return c.JSON(fiber.Map{"message": "address object deleted"})
+}
+
+// ---------- Service objects ----------
+
+// ListServiceObjects returns all service objects.
+func (h *ObjectHandler) ListServiceObjects(c *fiber.Ctx) error {
+	objs, err := h.svcRepo.FindAll(c.Context(), nil, constants.MaxPageLimit, 0)
+	if err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+	return c.JSON(fiber.Map{"service_objects": objs})
+}
+
+// GetServiceObject returns a single service object.
+func (h *ObjectHandler) GetServiceObject(c *fiber.Ctx) error {
+	obj, err := h.svcRepo.FindByID(c.Context(), c.Params("id"))
+	if err != nil {
+		return constants.ErrServiceObjectNotFound
+	}
+	return c.JSON(fiber.Map{"service_object": obj})
+}
+
+// CreateServiceObject creates a new service object.
+func (h *ObjectHandler) CreateServiceObject(c *fiber.Ctx) error {
+	var req ServiceObjectRequest
+	if err := c.BodyParser(&req); err != nil {
+		return constants.ErrInvalidRequestBody
+	}
+	if err := validateServiceObject(&req); err != nil {
+		return err
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+	obj := &db.ServiceObject{
+		Name:        req.Name,
+		Description: req.Description,
+		Protocol:    req.Protocol,
+		Ports:       req.Ports,
+		CreatedBy:   userID,
+	}
+	if err := h.svcRepo.Create(c.Context(), obj); err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   constants.AuditActionCreateServiceObject,
+		Resource: "service_object:" + obj.ID,
+		Details:  fmt.Sprintf("Created service object %s: %s %s", obj.Name, obj.Protocol, formatServicePorts(obj.Ports)),
+		IP:       c.IP(),
+	})
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":        "service object created",
+		"service_object": obj,
+	})
+}
+
+// UpdateServiceObject replaces a service object's contents and rewrites every
+// installed rule that uses it. If the kernel rejects the new definition (for
+// example because it would block an immutable port), the edit is reverted.
+func (h *ObjectHandler) UpdateServiceObject(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var req ServiceObjectRequest
+	if err := c.BodyParser(&req); err != nil {
+		return constants.ErrInvalidRequestBody
+	}
+	if err := validateServiceObject(&req); err != nil {
+		return err
+	}
+
+	before, err := h.svcRepo.FindByID(c.Context(), id)
+	if err != nil {
+		return constants.ErrServiceObjectNotFound
+	}
+
+	obj, err := h.svcRepo.FindByIDAndUpdate(c.Context(), id, map[string]interface{}{
+		"name":        req.Name,
+		"description": req.Description,
+		"protocol":    req.Protocol,
+		"ports":       req.Ports,
+	})
+	if err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+	updated, err := h.fw.RefreshService(id)
+	if err != nil {
+		// Put the old definition back so DB and kernel agree again.
+		_, _ = h.svcRepo.FindByIDAndUpdate(c.Context(), id, map[string]interface{}{
+			"name":        before.Name,
+			"description": before.Description,
+			"protocol":    before.Protocol,
+			"ports":       before.Ports,
+		})
+		_, _ = h.fw.RefreshService(id)
+		h.hub.EmitError("Failed to refresh service object: "+err.Error(), userID)
+		return constants.ErrFirewallFailure.Wrap(err)
+	}
+
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   constants.AuditActionUpdateServiceObject,
+		Resource: "service_object:" + id,
+		Details: fmt.Sprintf("Updated service object %s: %s %s -> %s %s (%d live rules updated)",
+			obj.Name, before.Protocol, formatServicePorts(before.Ports), obj.Protocol, formatServicePorts(obj.Ports), updated),
+		IP: c.IP(),
+	})
+
+	h.hub.EmitRuleChange("service_object_updated", id, userID, 0)
+
+	return c.JSON(fiber.Map{
+		"message":        "service object updated",
+		"service_object": obj,
+		"rules_updated":  updated,
+	})
+}
+
+// DeleteServiceObject deletes a service object no rule references.
+func (h *ObjectHandler) DeleteServiceObject(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	n, err := h.svcRepo.CountReferences(c.Context(), id)
+	if err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+	if n > 0 {
+		return constants.ErrObjectReferenced.WithMessage(fmt.Sprintf("service object is referenced by %d rule(s)", n))
+	}
+
+	if err := h.svcRepo.DeleteOne(c.Context(), id); err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   constants.AuditActionDeleteServiceObject,
+		Resource: "service_object:" + id,
+		IP:       c.IP(),
+	})
+
+	return c.JSON(fiber.Map{"message": "service object deleted"})
+}
+
+// ---------- Helpers ----------
+
+// validateAddressObject checks and normalises an address object request.
+func validateAddressObject(req *AddressObjectRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return constants.ErrNameRequired
+	}
+	if req.Addresses == nil {
+		req.Addresses = []string{}
+	}
+	for i, a := range req.Addresses {
+		a = strings.TrimSpace(a)
+		if err := fwPkg.ValidateCIDR(a); err != nil || a == "" {
+			return constants.ErrInvalidCIDR.WithMessage(fmt.Sprintf("invalid address: %q", a))
+		}
+		req.Addresses[i] = a
+	}
+	return nil
+}
+
+// validateServiceObject checks and normalises a service object request.
+func validateServiceObject(req *ServiceObjectRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return constants.ErrNameRequired
+	}
+	req.Protocol = strings.ToLower(req.Protocol)
+	if err := fwPkg.ValidatePortList(req.Protocol, convert.PortRanges(req.Ports)); err != nil {
+		return constants.ErrInvalidRequestBody.WithMessage(err.Error())
+	}
+	return nil
+}
+
+// formatServicePorts renders ports as e.g. "80,443,8000-8100".
+func formatServicePorts(ports []db.ServicePort) string {
+	parts := make([]string, 0, len(ports))
+	for _, p := range ports {
+		if p.PortEnd > 0 {
+			parts = append(parts, fmt.Sprintf("%d-%d", p.Port, p.PortEnd))
+		} else {
+			parts = append(parts, fmt.Sprint(p.Port))
+		}
+	}
+	return strings.Join(parts, ",")
+}
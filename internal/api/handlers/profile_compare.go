@@ -0,0 +1,399 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/enjoys-in/secureflow/internal/constants"
+	"github.com/enjoys-in/secureflow/internal/convert"
+	"github.com/enjoys-in/secureflow/internal/db"
+	fwPkg "github.com/enjoys-in/secureflow/internal/firewall"
+	"github.com/enjoys-in/secureflow/internal/repository"
+)
+
+// diffAgainstLive is the "against" value that compares a group with the rules
+// currently installed in the kernel for it.
+const diffAgainstLive = "live"
+
+// CloneSecurityGroupRequest is the request body for cloning a security group.
+type CloneSecurityGroupRequest struct {
+	Name        string `json:"name,omitempty"` // defaults to "<source name> (copy)"
+	Description string `json:"description,omitempty"`
+}
+
+// GroupDiff describes how two rule sets differ. Rules are matched by what
+// traffic they select, ignoring IDs and timestamps; a match whose action,
+// rate limit or description differs is reported as modified.
+type GroupDiff struct {
+	From     string            `json:"from"`
+	To       string            `json:"to"`
+	Added    []db.FirewallRule `json:"added"`
+	Removed  []db.FirewallRule `json:"removed"`
+	Modified []GroupRuleChange `json:"modified"`
+	Summary  GroupDiffSummary  `json:"summary"`
+}
+
+// GroupRuleChange pairs two rules that select the same traffic but differ.
+type GroupRuleChange struct {
+	From    db.FirewallRule `json:"from"`
+	To      db.FirewallRule `json:"to"`
+	Changes []string        `json:"changes"`
+}
+
+// GroupDiffSummary counts the entries of a GroupDiff.
+type GroupDiffSummary struct {
+	Added     int  `json:"added"`
+	Removed   int  `json:"removed"`
+	Modified  int  `json:"modified"`
+	Unchanged int  `json:"unchanged"`
+	Identical bool `json:"identical"`
+}
+
+// CloneSecurityGroup deep-copies a security group and its rules into a new
+// group. References a rule makes to its own group are pointed at the clone.
+func (h *ProfileHandler) CloneSecurityGroup(c *fiber.Ctx) error {
+	srcID := c.Params("id")
+
+	var req CloneSecurityGroupRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return constants.ErrInvalidRequestBody
+		}
+	}
+
+	src, err := h.sgRepo.FindByID(c.Context(), srcID)
+	if err != nil {
+		return constants.ErrSecurityGroupNotFound
+	}
+	rules, err := h.ruleRepo.FindBySecurityGroup(c.Context(), srcID)
+	if err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = src.Name + " (copy)"
+	}
+	description := req.Description
+	if description == "" {
+		description = src.Description
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+	clone := &db.SecurityGroup{
+		Name:        name,
+		Description: description,
+		CreatedBy:   userID,
+	}
+	// The clone, its rules and its first revision are written in one
+	// transaction, so a half-built group is never left behind.
+	copies := make([]db.FirewallRule, 0, len(rules))
+	if err := commitGroupChange(c.Context(), h.sgRepo, h.ruleRepo, h.revRepo, userID, groupChange{
+		save: func(ctx context.Context) (string, string, error) {
+			if err := h.sgRepo.Create(ctx, clone); err != nil {
+				return "", "", constants.ErrDatabaseFailure.Wrap(err)
+			}
+			for _, r := range rules {
+				r.ID = uuid.New().String()
+				r.SecurityGroupID = clone.ID
+				r.CreatedBy = userID
+				if r.SourceGroupID == srcID {
+					r.SourceGroupID = clone.ID
+				}
+				if r.DestGroupID == srcID {
+					r.DestGroupID = clone.ID
+				}
+				copies = append(copies, r)
+			}
+			if err := h.ruleRepo.ReplaceGroupRules(ctx, clone.ID, copies); err != nil {
+				if errors.Is(err, repository.ErrReferenceCycle) {
+					return "", "", constants.ErrReferenceCycle.Wrap(err)
+				}
+				return "", "", constants.ErrDatabaseFailure.Wrap(err)
+			}
+			return clone.ID, "Cloned from " + src.Name, nil
+		},
+	}); err != nil {
+		return err
+	}
+
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   constants.AuditActionCloneSecurityGroup,
+		Resource: "security_group:" + clone.ID,
+		Details:  fmt.Sprintf("Cloned security group %s (%s) with %d rules", src.Name, srcID, len(copies)),
+		IP:       c.IP(),
+	})
+
+	created, err := h.ruleRepo.FindBySecurityGroup(c.Context(), clone.ID)
+	if err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":        "security group cloned",
+		"security_group": clone,
+		"rules":          created,
+	})
+}
+
+// DiffSecurityGroup compares a group's rules with another group's
+// (?against=<id>) or with the rules installed in the kernel (?against=live).
+func (h *ProfileHandler) DiffSecurityGroup(c *fiber.Ctx) error {
+	id := c.Params("id")
+	against := c.Query("against")
+	if against == "" {
+		return constants.ErrInvalidRequestBody.WithMessage("against must be a security group id or \"live\"")
+	}
+
+	if _, err := h.sgRepo.FindByID(c.Context(), id); err != nil {
+		return constants.ErrSecurityGroupNotFound
+	}
+	from, err := h.ruleRepo.FindBySecurityGroup(c.Context(), id)
+	if err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+
+	var to []db.FirewallRule
+	if against == diffAgainstLive {
+		live, err := h.fw.ListRules()
+		if err != nil {
+			return constants.ErrFirewallFailure.Wrap(err)
+		}
+		for _, r := range live {
+			if r.GroupID == id {
+				to = append(to, fromFirewallRule(r))
+			}
+		}
+	} else {
+		if _, err := h.sgRepo.FindByID(c.Context(), against); err != nil {
+			return constants.ErrSecurityGroupNotFound
+		}
+		to, err = h.ruleRepo.FindBySecurityGroup(c.Context(), against)
+		if err != nil {
+			return constants.ErrDatabaseFailure.Wrap(err)
+		}
+	}
+
+	// Installed rules belong to this group and carry no description.
+	live := against == diffAgainstLive
+	owner := against
+	if live {
+		owner = id
+	}
+	diff := diffRuleSets(id, owner, from, to, !live)
+	diff.To = against
+	return c.JSON(fiber.Map{"diff": diff})
+}
+
+// diffRuleSets matches rules of two sets by ruleMatchKey. fromID and toID
+// name the owning groups so self-references compare equal across groups;
+// descriptions are only compared when withDescription is set.
+func diffRuleSets(fromID, toID string, from, to []db.FirewallRule, withDescription bool) GroupDiff {
+	diff := GroupDiff{
+		From:     fromID,
+		To:       toID,
+		Added:    []db.FirewallRule{},
+		Removed:  []db.FirewallRule{},
+		Modified: []GroupRuleChange{},
+	}
+
+	// Sets may contain duplicates, so each key holds a queue of rules.
+	pending := make(map[string][]db.FirewallRule)
+	for _, r := range from {
+		k := ruleMatchKey(r, fromID)
+		pending[k] = append(pending[k], r)
+	}
+
+	for _, r := range to {
+		k := ruleMatchKey(r, toID)
+		queue := pending[k]
+		if len(queue) == 0 {
+			diff.Added = append(diff.Added, r)
+			continue
+		}
+
+		// Prefer an exact counterpart so duplicates pair up sensibly.
+		idx := 0
+		for i, prev := range queue {
+			if len(ruleEquivalenceChanges(&prev, &r, withDescription)) == 0 {
+				idx = i
+				break
+			}
+		}
+		prev := queue[idx]
+		pending[k] = append(queue[:idx], queue[idx+1:]...)
+
+		changes := ruleEquivalenceChanges(&prev, &r, withDescription)
+		if len(changes) == 0 {
+			diff.Summary.Unchanged++
+			continue
+		}
+		diff.Modified = append(diff.Modified, GroupRuleChange{
+			From:    prev,
+			To:      r,
+			Changes: changes,
+		})
+	}
+
+	// Report removals in the order the rules appear in the source set.
+	for _, r := range from {
+		k := ruleMatchKey(r, fromID)
+		queue := pending[k]
+		for i, p := range queue {
+			if p.ID == r.ID {
+				diff.Removed = append(diff.Removed, r)
+				pending[k] = append(queue[:i], queue[i+1:]...)
+				break
+			}
+		}
+	}
+
+	sort.SliceStable(diff.Added, func(i, j int) bool {
+		return ruleMatchKey(diff.Added[i], toID) < ruleMatchKey(diff.Added[j], toID)
+	})
+
+	diff.Summary.Added = len(diff.Added)
+	diff.Summary.Removed = len(diff.Removed)
+	diff.Summary.Modified = len(diff.Modified)
+	diff.Summary.Identical = diff.Summary.Added == 0 && diff.Summary.Removed == 0 && diff.Summary.Modified == 0
+	return diff
+}
+
+// ruleMatchKey identifies the traffic a rule selects. IDs, timestamps,
+// ownership, action, rate limit and description are left out; references to
+// the rule's own group are written as "self".
+func ruleMatchKey(r db.FirewallRule, ownerID string) string {
+	proto := r.Protocol
+	port, portEnd := r.Port, r.PortRangeEnd
+	if r.ServiceID != "" {
+		proto, port, portEnd = "service:"+r.ServiceID, 0, 0
+	}
+	if port == 0 || (proto != "tcp" && proto != "udp" && r.ServiceID == "") {
+		port, portEnd = 0, 0
+	}
+	ports := fmt.Sprintf("%d-%d", port, portEnd)
+	if len(r.Ports) > 0 && r.ServiceID == "" {
+		sorted := append([]db.ServicePort(nil), r.Ports...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i].Port < sorted[j].Port })
+		ports = formatServicePorts(sorted)
+	}
+	return strings.Join([]string{
+		r.Direction,
+		proto,
+		ports,
+		endpointKey(r.SourceCIDR, r.SourceGroupID, r.SourceAddressID, r.SourceFQDN, r.SourceCountries, ownerID),
+		endpointKey(r.DestCIDR, r.DestGroupID, r.DestAddressID, r.DestFQDN, r.DestCountries, ownerID),
+		r.InInterface + ">" + r.OutInterface,
+		"sport:" + portRangeString(r.SourcePort, r.SourcePortEnd),
+		"icmp:" + icmpString(r.ICMPType, r.ICMPCode),
+		"owner:" + r.OwnerUser + ":" + r.OwnerGroup + ":" + r.Cgroup,
+	}, "|")
+}
+
+// endpointKey normalises one side of a rule's address match.
+func endpointKey(cidr, groupID, addressID, fqdn string, countries []string, ownerID string) string {
+	switch {
+	case groupID != "" && groupID == ownerID:
+		return "sg:self"
+	case groupID != "":
+		return "sg:" + groupID
+	case addressID != "":
+		return "ao:" + addressID
+	case fqdn != "":
+		return "fqdn:" + fqdn
+	case len(countries) > 0:
+		return "cc:" + strings.Join(countries, ",")
+	case isAnyAddress(cidr):
+		return "any"
+	default:
+		return cidr
+	}
+}
+
+// isAnyAddress reports whether a CIDR is unset or matches every address.
+func isAnyAddress(cidr string) bool {
+	return cidr == "" || cidr == "0.0.0.0/0"
+}
+
+// ruleEquivalenceChanges lists the differing fields of two matched rules.
+func ruleEquivalenceChanges(before, after *db.FirewallRule, withDescription bool) []string {
+	var changes []string
+	if before.Action != after.Action {
+		changes = append(changes, fmt.Sprintf("action: %s -> %s", before.Action, after.Action))
+	}
+	if from, to := convert.RateLimit(before.RateLimit).String(), convert.RateLimit(after.RateLimit).String(); from != to {
+		changes = append(changes, fmt.Sprintf("rate_limit: %s -> %s", from, to))
+	}
+	if from, to := convert.ConnLimit(before.ConnLimit).String(), convert.ConnLimit(after.ConnLimit).String(); from != to {
+		changes = append(changes, fmt.Sprintf("conn_limit: %s -> %s", from, to))
+	}
+	if before.SynProxy != after.SynProxy {
+		changes = append(changes, fmt.Sprintf("synproxy: %v -> %v", before.SynProxy, after.SynProxy))
+	}
+	if withDescription && before.Description != after.Description {
+		changes = append(changes, fmt.Sprintf("description: %s -> %s", before.Description, after.Description))
+	}
+	return changes
+}
+
+// fromFirewallRule converts an installed kernel rule into the persisted form
+// so it can be compared with database rules.
+func fromFirewallRule(r fwPkg.Rule) db.FirewallRule {
+	rule := db.FirewallRule{
+		ID:              r.ID,
+		SecurityGroupID: r.GroupID,
+		Direction:       r.Direction,
+		Protocol:        r.Protocol,
+		Port:            r.Port,
+		PortRangeEnd:    r.PortEnd,
+		SourceCIDR:      r.SourceCIDR,
+		DestCIDR:        r.DestCIDR,
+		SourceGroupID:   r.SourceGroupID,
+		DestGroupID:     r.DestGroupID,
+		SourceAddressID: r.SourceAddressID,
+		DestAddressID:   r.DestAddressID,
+		SourceFQDN:      r.SourceFQDN,
+		DestFQDN:        r.DestFQDN,
+		SourceCountries: r.SourceCountries,
+		DestCountries:   r.DestCountries,
+		ServiceID:       r.ServiceID,
+		Action:          r.Action,
+		RateLimit:       fromFirewallRateLimit(r.RateLimit),
+		ConnLimit:       fromFirewallConnLimit(r.ConnLimit),
+		SynProxy:        r.SynProxy,
+		InInterface:     r.InInterface,
+		OutInterface:    r.OutInterface,
+		SourcePort:      r.SourcePort,
+		SourcePortEnd:   r.SourcePortEnd,
+		ICMPType:        r.ICMPType,
+		ICMPCode:        r.ICMPCode,
+		OwnerUser:       r.OwnerUser,
+		OwnerGroup:      r.OwnerGroup,
+		Cgroup:          r.Cgroup,
+		ScheduleID:      r.ScheduleID,
+	}
+	// Port lists from a service are the service's, not the rule's own.
+	if r.ServiceID == "" {
+		rule.Ports = fromPortRanges(r.Ports)
+	}
+	return rule
+}
+
+// fromPortRanges converts syscall-layer port ranges into their persisted form.
+func fromPortRanges(ports []fwPkg.PortRange) []db.ServicePort {
+	if len(ports) == 0 {
+		return nil
+	}
+	out := make([]db.ServicePort, 0, len(ports))
+	for _, p := range ports {
+		out = append(out, db.ServicePort{Port: p.Port, PortEnd: p.End})
+	}
+	return out
+}
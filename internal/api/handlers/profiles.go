@@ -1,13 +1,15 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/google/uuid"
 
 	"github.com/enjoys-in/secureflow/internal/constants"
+	"github.com/enjoys-in/secureflow/internal/convert"
 	"github.com/enjoys-in/secureflow/internal/db"
 	fwPkg "github.com/enjoys-in/secureflow/internal/firewall"
 	"github.com/enjoys-in/secureflow/internal/repository"
@@ -16,16 +18,19 @@ import (
 
 // ProfileHandler handles security group/profile operations.
 type ProfileHandler struct {
-	sgRepo    repository.SecurityGroupRepository
-	ruleRepo  repository.FirewallRuleRepository
-	auditRepo repository.AuditLogRepository
-	fw        *fwPkg.Manager
-	hub       *websocket.Hub
+	sgRepo       repository.SecurityGroupRepository
+	ruleRepo     repository.FirewallRuleRepository
+	revRepo      repository.SecurityGroupRevisionRepository
+	auditRepo    repository.AuditLogRepository
+	scheduleRepo repository.ScheduleRepository
+	fw           *fwPkg.Manager
+	hub          *websocket.Hub
+	serverID     string // local server row used to track applied groups
 }
 
 // NewProfileHandler creates a new profile handler.
-func NewProfileHandler(sgRepo repository.SecurityGroupRepository, ruleRepo repository.FirewallRuleRepository, auditRepo repository.AuditLogRepository, fw *fwPkg.Manager, hub *websocket.Hub) *ProfileHandler {
-	return &ProfileHandler{sgRepo: sgRepo, ruleRepo: ruleRepo, auditRepo: auditRepo, fw: fw, hub: hub}
+func NewProfileHandler(sgRepo repository.SecurityGroupRepository, ruleRepo repository.FirewallRuleRepository, revRepo repository.SecurityGroupRevisionRepository, auditRepo repository.AuditLogRepository, scheduleRepo repository.ScheduleRepository, fw *fwPkg.Manager, hub *websocket.Hub, serverID string) *ProfileHandler {
+	return &ProfileHandler{sgRepo: sgRepo, ruleRepo: ruleRepo, revRepo: revRepo, auditRepo: auditRepo, scheduleRepo: scheduleRepo, fw: fw, hub: hub, serverID: serverID}
 }
 
 // CreateSecurityGroupRequest is the request body for creating a security group.
@@ -61,8 +66,15 @@ func (h *ProfileHandler) CreateSecurityGroup(c *fiber.Ctx) error {
 		CreatedBy:   userID,
 	}
 
-	if err := h.sgRepo.Create(c.Context(), sg); err != nil {
-		return constants.ErrDatabaseFailure.Wrap(err)
+	if err := commitGroupChange(c.Context(), h.sgRepo, h.ruleRepo, h.revRepo, userID, groupChange{
+		save: func(ctx context.Context) (string, string, error) {
+			if err := h.sgRepo.Create(ctx, sg); err != nil {
+				return "", "", constants.ErrDatabaseFailure.Wrap(err)
+			}
+			return sg.ID, "Created security group", nil
+		},
+	}); err != nil {
+		return err
 	}
 
 	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
@@ -110,12 +122,24 @@ func (h *ProfileHandler) UpdateSecurityGroup(c *fiber.Ctx) error {
 		"name":        req.Name,
 		"description": req.Description,
 	}
-	sg, err := h.sgRepo.FindByIDAndUpdate(c.Context(), id, updates)
-	if err != nil {
+	if _, err := h.sgRepo.FindByID(c.Context(), id); err != nil {
 		return constants.ErrSecurityGroupNotFound
 	}
 
 	userID, _ := c.Locals("user_id").(string)
+	var sg *db.SecurityGroup
+	if err := commitGroupChange(c.Context(), h.sgRepo, h.ruleRepo, h.revRepo, userID, groupChange{
+		save: func(ctx context.Context) (string, string, error) {
+			var err error
+			if sg, err = h.sgRepo.FindByIDAndUpdate(ctx, id, updates); err != nil {
+				return "", "", constants.ErrDatabaseFailure.Wrap(err)
+			}
+			return id, "Updated name/description", nil
+		},
+	}); err != nil {
+		return err
+	}
+
 	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
 		UserID:   userID,
 		Action:   constants.AuditActionUpdateSecurityGroup,
@@ -130,11 +154,38 @@ func (h *ProfileHandler) UpdateSecurityGroup(c *fiber.Ctx) error {
 func (h *ProfileHandler) DeleteSecurityGroup(c *fiber.Ctx) error {
 	id := c.Params("id")
 
-	if err := h.sgRepo.DeleteOne(c.Context(), id); err != nil {
+	// Rules elsewhere that match this group's members would be left dangling.
+	refs, err := h.ruleRepo.FindReferencingRules(c.Context(), id)
+	if err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+	if len(refs) > 0 {
+		return constants.ErrGroupReferenced.WithMessage(
+			fmt.Sprintf("security group is referenced by %d rule(s) in other groups", len(refs)))
+	}
+
+	// Keep the rules so they can be put back if the rows survive.
+	rules, err := h.ruleRepo.FindBySecurityGroup(c.Context(), id)
+	if err != nil {
 		return constants.ErrDatabaseFailure.Wrap(err)
 	}
 
+	// Pull the group's rules out of the kernel before the rows disappear.
+	removed, err := h.fw.RemoveGroup(id)
+	if err != nil {
+		return constants.ErrFirewallFailure.Wrap(err)
+	}
+
 	userID, _ := c.Locals("user_id").(string)
+	if err := h.sgRepo.DeleteOne(c.Context(), id); err != nil {
+		if removed > 0 {
+			if rbErr := h.fw.ApplyGroup(id, convert.Rules(rules)); rbErr != nil {
+				h.hub.EmitError("Failed to re-apply security group after delete error: "+rbErr.Error(), userID)
+			}
+		}
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+
 	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
 		UserID:   userID,
 		Action:   constants.AuditActionDeleteSecurityGroup,
@@ -153,24 +204,26 @@ func (h *ProfileHandler) AddRuleToGroup(c *fiber.Ctx) error {
 		return constants.ErrInvalidRequestBody
 	}
 
-	rule := fwPkg.Rule{
-		ID:         uuid.New().String(),
-		Direction:  strings.ToLower(req.Direction),
-		Protocol:   strings.ToLower(req.Protocol),
-		Port:       req.Port,
-		PortEnd:    req.PortRangeEnd,
-		SourceCIDR: req.SourceCIDR,
-		DestCIDR:   req.DestCIDR,
-		Action:     strings.ToUpper(req.Action),
-	}
+	rule := newRuleFromRequest(req)
 
 	if err := fwPkg.ValidateRule(rule); err != nil {
 		return constants.ErrInvalidRequestBody.WithMessage(err.Error())
 	}
+	if err := fwPkg.CheckHostInterfaces(rule.InInterface, rule.OutInterface); err != nil {
+		return constants.ErrInvalidRequestBody.WithMessage(err.Error())
+	}
 
-	if h.fw.IsPortImmutable(req.Port) && strings.ToUpper(req.Action) != constants.ActionAccept {
+	if coversImmutablePort(h.fw, req.Port, req.Ports) && strings.ToUpper(req.Action) != constants.ActionAccept {
 		return constants.ErrImmutablePort
 	}
+	if err := validateExpiry(req.ExpiresAt); err != nil {
+		return err
+	}
+
+	attached, err := h.sgRepo.IsAttached(c.Context(), h.serverID, sgID)
+	if err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
 
 	userID, _ := c.Locals("user_id").(string)
 	dbRule := &db.FirewallRule{
@@ -179,16 +232,68 @@ func (h *ProfileHandler) AddRuleToGroup(c *fiber.Ctx) error {
 		Protocol:        rule.Protocol,
 		Port:            rule.Port,
 		PortRangeEnd:    rule.PortEnd,
+		Ports:           req.Ports,
 		SourceCIDR:      req.SourceCIDR,
 		DestCIDR:        req.DestCIDR,
+		SourceGroupID:   req.SourceGroupID,
+		DestGroupID:     req.DestGroupID,
+		SourceAddressID: req.SourceAddressID,
+		DestAddressID:   req.DestAddressID,
+		SourceFQDN:      rule.SourceFQDN,
+		DestFQDN:        rule.DestFQDN,
+		SourceCountries: rule.SourceCountries,
+		DestCountries:   rule.DestCountries,
+		ServiceID:       req.ServiceID,
 		Action:          rule.Action,
+		RateLimit:       req.RateLimit,
+		ConnLimit:       req.ConnLimit,
+		SynProxy:        req.SynProxy,
+		InInterface:     req.InInterface,
+		OutInterface:    req.OutInterface,
+		SourcePort:      req.SourcePort,
+		SourcePortEnd:   req.SourcePortEnd,
+		ICMPType:        req.ICMPType,
+		ICMPCode:        req.ICMPCode,
+		OwnerUser:       req.OwnerUser,
+		OwnerGroup:      req.OwnerGroup,
+		Cgroup:          req.Cgroup,
+		ScheduleID:      req.ScheduleID,
+		ExpiresAt:       req.ExpiresAt,
 		Description:     req.Description,
 		IsImmutable:     false,
 		CreatedBy:       userID,
 	}
 
-	if err := h.ruleRepo.Create(c.Context(), dbRule); err != nil {
-		return constants.ErrDatabaseFailure.Wrap(err)
+	if err := commitGroupChange(c.Context(), h.sgRepo, h.ruleRepo, h.revRepo, userID, groupChange{
+		save: func(ctx context.Context) (string, string, error) {
+			if err := h.ruleRepo.Create(ctx, dbRule); err != nil {
+				if errors.Is(err, repository.ErrReferenceCycle) {
+					return "", "", constants.ErrReferenceCycle.Wrap(err)
+				}
+				return "", "", constants.ErrDatabaseFailure.Wrap(err)
+			}
+			return sgID, fmt.Sprintf("Added rule: port=%d protocol=%s action=%s", rule.Port, rule.Protocol, rule.Action), nil
+		},
+		// A group that is applied on this host gets the new rule at once.
+		apply: func() error {
+			if !attached {
+				return nil
+			}
+			rule.ID = dbRule.ID
+			rule.GroupID = sgID
+			if err := h.fw.AddRule(rule); err != nil {
+				h.hub.EmitError(err.Error(), userID)
+				return constants.ErrFirewallFailure.Wrap(err)
+			}
+			return nil
+		},
+		undo: func() {
+			if attached {
+				_ = h.fw.DeleteRule(dbRule.ID)
+			}
+		},
+	}); err != nil {
+		return err
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
@@ -207,12 +312,36 @@ func (h *ProfileHandler) ListGroupRules(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"rules": rules})
 }
 
+// UpdateGroupRule modifies a rule that belongs to a security group.
+func (h *ProfileHandler) UpdateGroupRule(c *fiber.Ctx) error {
+	sgID := c.Params("id")
+	var req UpdateRuleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return constants.ErrInvalidRequestBody
+	}
+
+	dbRule, err := h.ruleRepo.FindByID(c.Context(), c.Params("ruleId"))
+	if err != nil || dbRule.SecurityGroupID != sgID {
+		return constants.ErrRuleNotFound
+	}
+
+	updated, err := updateRule(c, h.sgRepo, h.ruleRepo, h.revRepo, h.auditRepo, h.fw, h.hub, dbRule, req)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "rule updated",
+		"rule":    updated,
+	})
+}
+
 // DeleteRuleFromGroup deletes a rule from a security group.
 func (h *ProfileHandler) DeleteRuleFromGroup(c *fiber.Ctx) error {
 	ruleID := c.Params("ruleId")
 
 	dbRule, err := h.ruleRepo.FindByID(c.Context(), ruleID)
-	if err != nil {
+	if err != nil || dbRule.SecurityGroupID != c.Params("id") {
 		return constants.ErrRuleNotFound
 	}
 
@@ -220,48 +349,98 @@ func (h *ProfileHandler) DeleteRuleFromGroup(c *fiber.Ctx) error {
 		return constants.ErrImmutableRule
 	}
 
-	if err := h.ruleRepo.DeleteNonImmutable(c.Context(), ruleID); err != nil {
-		return constants.ErrDatabaseFailure.Wrap(err)
+	userID, _ := c.Locals("user_id").(string)
+	if err := deleteRule(c.Context(), h.sgRepo, h.ruleRepo, h.revRepo, h.fw, userID, dbRule); err != nil {
+		return err
 	}
 
 	return c.JSON(fiber.Map{"message": "rule deleted"})
 }
 
-// ApplySecurityGroup applies all rules of a security group to the firewall backend.
+// ListAppliedSecurityGroups returns the security groups active on this host.
+func (h *ProfileHandler) ListAppliedSecurityGroups(c *fiber.Ctx) error {
+	groups, err := h.sgRepo.ListAppliedByServer(c.Context(), h.serverID)
+	if err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+	return c.JSON(fiber.Map{"applied_security_groups": groups})
+}
+
+// ApplySecurityGroupRequest is the optional request body for applying a
+// security group.
+type ApplySecurityGroupRequest struct {
+	// ScheduleID limits the group's rules to a schedule's windows. Omitted
+	// keeps the current schedule; "" makes the application permanent.
+	ScheduleID *string `json:"schedule_id,omitempty"`
+}
+
+// ApplySecurityGroup applies all rules of a security group to the firewall
+// backend and records the group as active on this host. Re-applying replaces
+// the group's installed rules instead of adding duplicates.
 func (h *ProfileHandler) ApplySecurityGroup(c *fiber.Ctx) error {
 	sgID := c.Params("id")
 
+	var req ApplySecurityGroupRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return constants.ErrInvalidRequestBody
+		}
+	}
+
+	if _, err := h.sgRepo.FindByID(c.Context(), sgID); err != nil {
+		return constants.ErrSecurityGroupNotFound
+	}
+	if req.ScheduleID != nil && *req.ScheduleID != "" {
+		if _, err := h.scheduleRepo.FindByID(c.Context(), *req.ScheduleID); err != nil {
+			return constants.ErrScheduleNotFound
+		}
+	}
+
 	dbRules, err := h.ruleRepo.FindBySecurityGroup(c.Context(), sgID)
 	if err != nil {
 		return constants.ErrDatabaseFailure.Wrap(err)
 	}
 
-	var fwRules []fwPkg.Rule
-	for _, r := range dbRules {
-		fwRules = append(fwRules, fwPkg.Rule{
-			ID:         r.ID,
-			Direction:  r.Direction,
-			Protocol:   r.Protocol,
-			Port:       r.Port,
-			PortEnd:    r.PortRangeEnd,
-			SourceCIDR: r.SourceCIDR,
-			DestCIDR:   r.DestCIDR,
-			Action:     r.Action,
-		})
+	userID, _ := c.Locals("user_id").(string)
+	fwRules := convert.Rules(dbRules)
+	prevSchedule := h.fw.GroupSchedule(sgID)
+	if req.ScheduleID != nil {
+		h.fw.SetGroupSchedule(sgID, *req.ScheduleID)
 	}
-
-	if err := h.fw.ApplyRules(fwRules); err != nil {
-		userID, _ := c.Locals("user_id").(string)
+	if err := h.fw.ApplyGroup(sgID, fwRules); err != nil {
+		// The group keeps running under its old schedule.
+		h.fw.SetGroupSchedule(sgID, prevSchedule)
 		h.hub.EmitError("Failed to apply security group: "+err.Error(), userID)
 		return constants.ErrFirewallFailure.Wrap(err)
 	}
 
-	userID, _ := c.Locals("user_id").(string)
+	if err := h.sgRepo.AttachToServer(c.Context(), h.serverID, sgID, userID); err != nil {
+		return constants.ErrDatabaseFailure.WithMessage("rules applied but failed to record applied state")
+	}
+	if req.ScheduleID != nil {
+		if err := h.sgRepo.SetServerSchedule(c.Context(), h.serverID, sgID, *req.ScheduleID); err != nil {
+			return constants.ErrDatabaseFailure.WithMessage("rules applied but failed to record the schedule")
+		}
+	}
+
+	// This host is now a member of the group; rules referencing it must see that.
+	if err := h.fw.RefreshReference(fwPkg.RefSecurityGroup, sgID); err != nil {
+		h.hub.EmitError("Failed to refresh security group references: "+err.Error(), userID)
+	}
+
+	details := fmt.Sprintf("Applied security group with %d rules", len(fwRules))
+	if req.ScheduleID != nil {
+		if *req.ScheduleID == "" {
+			details += " permanently"
+		} else {
+			details += " limited to schedule " + *req.ScheduleID
+		}
+	}
 	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
 		UserID:   userID,
 		Action:   constants.AuditActionApplySecurityGroup,
 		Resource: "security_group:" + sgID,
-		Details:  fmt.Sprintf("Applied security group with %d rules", len(fwRules)),
+		Details:  details,
 		IP:       c.IP(),
 	})
 
@@ -272,3 +451,39 @@ func (h *ProfileHandler) ApplySecurityGroup(c *fiber.Ctx) error {
 		"rules_count": len(fwRules),
 	})
 }
+
+// DetachSecurityGroup removes exactly this group's rules from the kernel and
+// marks it as no longer active on this host.
+func (h *ProfileHandler) DetachSecurityGroup(c *fiber.Ctx) error {
+	sgID := c.Params("id")
+
+	removed, err := h.fw.RemoveGroup(sgID)
+	if err != nil {
+		userID, _ := c.Locals("user_id").(string)
+		h.hub.EmitError("Failed to detach security group: "+err.Error(), userID)
+		return constants.ErrFirewallFailure.Wrap(err)
+	}
+
+	if err := h.sgRepo.DetachFromServer(c.Context(), h.serverID, sgID); err != nil {
+		return constants.ErrDatabaseFailure.WithMessage("rules removed but failed to record applied state")
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+	if err := h.fw.RefreshReference(fwPkg.RefSecurityGroup, sgID); err != nil {
+		h.hub.EmitError("Failed to refresh security group references: "+err.Error(), userID)
+	}
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   constants.AuditActionDetachSecurityGroup,
+		Resource: "security_group:" + sgID,
+		Details:  fmt.Sprintf("Detached security group, removed %d rules", removed),
+		IP:       c.IP(),
+	})
+
+	h.hub.EmitRuleChange("security_group_detached", sgID, userID, 0)
+
+	return c.JSON(fiber.Map{
+		"message":       "security group detached",
+		"removed_count": removed,
+	})
+}
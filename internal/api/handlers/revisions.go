@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/enjoys-in/secureflow/internal/constants"
+	"github.com/enjoys-in/secureflow/internal/convert"
+	"github.com/enjoys-in/secureflow/internal/db"
+	fwPkg "github.com/enjoys-in/secureflow/internal/firewall"
+	"github.com/enjoys-in/secureflow/internal/repository"
+	"github.com/enjoys-in/secureflow/internal/websocket"
+)
+
+// RevisionHandler handles security group revision history and rollback.
+type RevisionHandler struct {
+	sgRepo    repository.SecurityGroupRepository
+	ruleRepo  repository.FirewallRuleRepository
+	revRepo   repository.SecurityGroupRevisionRepository
+	auditRepo repository.AuditLogRepository
+	fw        *fwPkg.Manager
+	hub       *websocket.Hub
+	serverID  string // local server row used to track applied groups
+}
+
+// NewRevisionHandler creates a new revision handler.
+func NewRevisionHandler(sgRepo repository.SecurityGroupRepository, ruleRepo repository.FirewallRuleRepository, revRepo repository.SecurityGroupRevisionRepository, auditRepo repository.AuditLogRepository, fw *fwPkg.Manager, hub *websocket.Hub, serverID string) *RevisionHandler {
+	return &RevisionHandler{sgRepo: sgRepo, ruleRepo: ruleRepo, revRepo: revRepo, auditRepo: auditRepo, fw: fw, hub: hub, serverID: serverID}
+}
+
+// RevisionDiff describes how a security group changed between two revisions.
+type RevisionDiff struct {
+	From     int                `json:"from"`
+	To       int                `json:"to"`
+	Metadata []string           `json:"metadata"`
+	Added    []db.FirewallRule  `json:"added"`
+	Removed  []db.FirewallRule  `json:"removed"`
+	Modified []RuleModification `json:"modified"`
+}
+
+// RuleModification lists the field changes of a rule present in both revisions.
+type RuleModification struct {
+	RuleID  string   `json:"rule_id"`
+	Changes []string `json:"changes"`
+}
+
+// ListRevisions returns the revision history of a security group, newest first.
+func (h *RevisionHandler) ListRevisions(c *fiber.Ctx) error {
+	sgID := c.Params("id")
+	limit, _ := strconv.Atoi(c.Query("limit", strconv.Itoa(constants.DefaultPageLimit)))
+	offset, _ := strconv.Atoi(c.Query("offset", "0"))
+	if limit <= 0 || limit > constants.MaxPageLimit {
+		limit = constants.DefaultPageLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	revs, err := h.revRepo.FindBySecurityGroup(c.Context(), sgID, limit, offset)
+	if err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+
+	return c.JSON(fiber.Map{
+		"revisions": revs,
+		"limit":     limit,
+		"offset":    offset,
+	})
+}
+
+// GetRevision returns a single revision snapshot.
+func (h *RevisionHandler) GetRevision(c *fiber.Ctx) error {
+	rev, err := h.findRevision(c, c.Params("rev"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(fiber.Map{"revision": rev})
+}
+
+// DiffRevisions compares two revisions given by the "from" and "to" query params.
+func (h *RevisionHandler) DiffRevisions(c *fiber.Ctx) error {
+	from, err := h.findRevision(c, c.Query("from"))
+	if err != nil {
+		return err
+	}
+	to, err := h.findRevision(c, c.Query("to"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{"diff": diffRevisions(from, to)})
+}
+
+// RestoreRevision rolls the security group back to a revision. If the group
+// is currently applied, the kernel is reconciled to match the restored rules.
+func (h *RevisionHandler) RestoreRevision(c *fiber.Ctx) error {
+	return h.restore(c, false)
+}
+
+// ApplyRevision restores a revision and pushes its rules into the kernel,
+// whether or not the group was applied before.
+func (h *RevisionHandler) ApplyRevision(c *fiber.Ctx) error {
+	return h.restore(c, true)
+}
+
+// restore writes a revision back as the group's current state and reconciles
+// the kernel. forceApply installs the rules even if the group was not live.
+func (h *RevisionHandler) restore(c *fiber.Ctx, forceApply bool) error {
+	sgID := c.Params("id")
+	rev, err := h.findRevision(c, c.Params("rev"))
+	if err != nil {
+		return err
+	}
+
+	for _, r := range rev.Rules {
+		if coversImmutablePort(h.fw, r.Port, r.Ports) && r.Action != constants.ActionAccept {
+			return constants.ErrImmutablePort
+		}
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+
+	// Only touch the kernel if the group is active on this host, unless the
+	// caller asked for the revision to be applied.
+	applied := forceApply
+	if !applied {
+		attached, err := h.sgRepo.IsAttached(c.Context(), h.serverID, sgID)
+		if err != nil {
+			return constants.ErrDatabaseFailure.Wrap(err)
+		}
+		applied = attached
+	}
+
+	var previous []db.FirewallRule
+	if applied {
+		if previous, err = h.ruleRepo.FindBySecurityGroup(c.Context(), sgID); err != nil {
+			return constants.ErrDatabaseFailure.Wrap(err)
+		}
+	}
+
+	summary := fmt.Sprintf("Restored revision %d", rev.Revision)
+	err = commitGroupChange(c.Context(), h.sgRepo, h.ruleRepo, h.revRepo, userID, groupChange{
+		save: func(ctx context.Context) (string, string, error) {
+			if _, err := h.sgRepo.FindByIDAndUpdate(ctx, sgID, map[string]interface{}{
+				"name":        rev.Name,
+				"description": rev.Description,
+			}); err != nil {
+				return "", "", constants.ErrDatabaseFailure.Wrap(err)
+			}
+			if err := h.ruleRepo.ReplaceGroupRules(ctx, sgID, rev.Rules); err != nil {
+				if errors.Is(err, repository.ErrReferenceCycle) {
+					return "", "", constants.ErrReferenceCycle.Wrap(err)
+				}
+				return "", "", constants.ErrDatabaseFailure.Wrap(err)
+			}
+			if applied {
+				if err := h.sgRepo.AttachToServer(ctx, h.serverID, sgID, userID); err != nil {
+					return "", "", constants.ErrDatabaseFailure.Wrap(err)
+				}
+			}
+			return sgID, summary, nil
+		},
+		apply: func() error {
+			if !applied {
+				return nil
+			}
+			if err := h.fw.ApplyGroup(sgID, convert.Rules(rev.Rules)); err != nil {
+				h.hub.EmitError("Failed to apply restored security group: "+err.Error(), userID)
+				return constants.ErrFirewallFailure.Wrap(err)
+			}
+			return nil
+		},
+		undo: func() {
+			if !applied {
+				return
+			}
+			if err := h.fw.ApplyGroup(sgID, convert.Rules(previous)); err != nil {
+				h.hub.EmitError("Failed to roll back security group after restore error: "+err.Error(), userID)
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if applied {
+		if err := h.fw.RefreshReference(fwPkg.RefSecurityGroup, sgID); err != nil {
+			h.hub.EmitError("Failed to refresh security group references: "+err.Error(), userID)
+		}
+	}
+
+	action := constants.AuditActionRestoreSecurityGroup
+	if forceApply {
+		action = constants.AuditActionApplySecurityGroup
+	}
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   action,
+		Resource: "security_group:" + sgID,
+		Details:  fmt.Sprintf("%s with %d rules (kernel updated: %t)", summary, len(rev.Rules), applied),
+		IP:       c.IP(),
+	})
+
+	h.hub.EmitRuleChange("security_group_restored", sgID, userID, 0)
+
+	return c.JSON(fiber.Map{
+		"message":     "security group restored",
+		"revision":    rev.Revision,
+		"rules_count": len(rev.Rules),
+		"applied":     applied,
+	})
+}
+
+// findRevision parses a revision number and loads it for the group in the path.
+func (h *RevisionHandler) findRevision(c *fiber.Ctx, raw string) (*db.SecurityGroupRevision, error) {
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 {
+		return nil, constants.ErrInvalidRequestBody.WithMessage("revision must be a positive integer")
+	}
+
+	rev, err := h.revRepo.FindByRevision(c.Context(), c.Params("id"), n)
+	if err != nil {
+		return nil, constants.ErrRevisionNotFound
+	}
+	return rev, nil
+}
+
+// groupChange is a change to a security group that commits together with the
+// revision recording it.
+type groupChange struct {
+	// save writes the change and returns the group it touched, "" for a
+	// standalone rule, and the revision summary.
+	save func(ctx context.Context) (sgID, summary string, err error)
+	// apply, if set, updates the kernel once the change and its revision are
+	// written; an error rolls both back.
+	apply func() error
+	// undo, if set, reverses apply when the commit fails after it.
+	undo func()
+}
+
+// commitGroupChange runs ch in one transaction so a group change is never
+// saved without its revision, and the kernel is only touched once both are
+// written. AppErrors from ch are returned as they are; any other failure is
+// a database error.
+func commitGroupChange(
+	ctx context.Context,
+	sgRepo repository.SecurityGroupRepository,
+	ruleRepo repository.FirewallRuleRepository,
+	revRepo repository.SecurityGroupRevisionRepository,
+	userID string,
+	ch groupChange,
+) error {
+	applied := false
+	err := revRepo.RunInTx(ctx, func(ctx context.Context) error {
+		sgID, summary, err := ch.save(ctx)
+		if err != nil {
+			return err
+		}
+		if sgID != "" {
+			if err := repository.RecordRevision(ctx, sgRepo, ruleRepo, revRepo, sgID, userID, summary); err != nil {
+				return constants.ErrRevisionFailure.Wrap(err)
+			}
+		}
+		if ch.apply != nil {
+			if err := ch.apply(); err != nil {
+				return err
+			}
+			applied = true
+		}
+		return nil
+	})
+	if err == nil {
+		return nil
+	}
+
+	if applied && ch.undo != nil {
+		ch.undo()
+	}
+	var appErr *constants.AppError
+	if errors.As(err, &appErr) {
+		return err
+	}
+	return constants.ErrDatabaseFailure.Wrap(err)
+}
+
+// diffRevisions compares the metadata and rules of two revisions. Rules are
+// matched by ID, which is stable across edits and restores.
+func diffRevisions(from, to *db.SecurityGroupRevision) RevisionDiff {
+	diff := RevisionDiff{
+		From:     from.Revision,
+		To:       to.Revision,
+		Metadata: []string{},
+		Added:    []db.FirewallRule{},
+		Removed:  []db.FirewallRule{},
+		Modified: []RuleModification{},
+	}
+
+	if from.Name != to.Name {
+		diff.Metadata = append(diff.Metadata, fmt.Sprintf("name: %s -> %s", from.Name, to.Name))
+	}
+	if from.Description != to.Description {
+		diff.Metadata = append(diff.Metadata, fmt.Sprintf("description: %s -> %s", from.Description, to.Description))
+	}
+
+	old := make(map[string]db.FirewallRule, len(from.Rules))
+	for _, r := range from.Rules {
+		old[r.ID] = r
+	}
+
+	for _, r := range to.Rules {
+		prev, ok := old[r.ID]
+		if !ok {
+			diff.Added = append(diff.Added, r)
+			continue
+		}
+		delete(old, r.ID)
+		if changes := ruleChanges(&prev, &r); len(changes) > 0 {
+			diff.Modified = append(diff.Modified, RuleModification{RuleID: r.ID, Changes: changes})
+		}
+	}
+
+	for _, r := range from.Rules {
+		if _, ok := old[r.ID]; ok {
+			diff.Removed = append(diff.Removed, r)
+		}
+	}
+
+	return diff
+}
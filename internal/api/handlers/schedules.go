@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/enjoys-in/secureflow/internal/constants"
+	"github.com/enjoys-in/secureflow/internal/db"
+	"github.com/enjoys-in/secureflow/internal/repository"
+	"github.com/enjoys-in/secureflow/internal/scheduler"
+	"github.com/enjoys-in/secureflow/internal/websocket"
+)
+
+// ScheduleHandler handles schedules: recurring time windows that rules and
+// security group applications can be limited to.
+type ScheduleHandler struct {
+	scheduleRepo repository.ScheduleRepository
+	auditRepo    repository.AuditLogRepository
+	sched        *scheduler.Scheduler
+	hub          *websocket.Hub
+}
+
+// NewScheduleHandler creates a new schedule handler.
+func NewScheduleHandler(scheduleRepo repository.ScheduleRepository, auditRepo repository.AuditLogRepository, sched *scheduler.Scheduler, hub *websocket.Hub) *ScheduleHandler {
+	return &ScheduleHandler{scheduleRepo: scheduleRepo, auditRepo: auditRepo, sched: sched, hub: hub}
+}
+
+// ScheduleRequest is the request body for creating or updating a schedule.
+type ScheduleRequest struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description,omitempty"`
+	Timezone    string              `json:"timezone,omitempty"` // IANA name; defaults to UTC
+	Windows     []db.ScheduleWindow `json:"windows"`
+}
+
+// ListSchedules returns all schedules.
+func (h *ScheduleHandler) ListSchedules(c *fiber.Ctx) error {
+	schedules, err := h.scheduleRepo.FindAll(c.Context(), nil, constants.MaxPageLimit, 0)
+	if err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+	return c.JSON(fiber.Map{"schedules": schedules})
+}
+
+// GetSchedule returns a single schedule.
+func (h *ScheduleHandler) GetSchedule(c *fiber.Ctx) error {
+	sched, err := h.scheduleRepo.FindByID(c.Context(), c.Params("id"))
+	if err != nil {
+		return constants.ErrScheduleNotFound
+	}
+	return c.JSON(fiber.Map{"schedule": sched})
+}
+
+// CreateSchedule persists a schedule and evaluates it right away. Nothing is
+// limited to it until rules or group applications reference it.
+func (h *ScheduleHandler) CreateSchedule(c *fiber.Ctx) error {
+	var req ScheduleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return constants.ErrInvalidRequestBody
+	}
+	if err := validateSchedule(&req); err != nil {
+		return err
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+	sched := &db.Schedule{
+		Name:        req.Name,
+		Description: req.Description,
+		Timezone:    req.Timezone,
+		Windows:     req.Windows,
+		CreatedBy:   userID,
+	}
+	if err := h.scheduleRepo.Create(c.Context(), sched); err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   constants.AuditActionCreateSchedule,
+		Resource: "schedule:" + sched.ID,
+		Details:  fmt.Sprintf("Created schedule %s: %s", sched.Name, formatScheduleWindows(sched)),
+		IP:       c.IP(),
+	})
+
+	if err := h.sched.Refresh(c.Context(), sched.ID); err != nil {
+		h.hub.EmitError("Failed to evaluate schedule: "+err.Error(), userID)
+	}
+	if fresh, err := h.scheduleRepo.FindByID(c.Context(), sched.ID); err == nil {
+		sched = fresh
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":  "schedule created",
+		"schedule": sched,
+	})
+}
+
+// UpdateSchedule replaces a schedule's definition and re-evaluates it, so
+// rules limited to it move in or out of the kernel immediately.
+func (h *ScheduleHandler) UpdateSchedule(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var req ScheduleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return constants.ErrInvalidRequestBody
+	}
+	if err := validateSchedule(&req); err != nil {
+		return err
+	}
+
+	before, err := h.scheduleRepo.FindByID(c.Context(), id)
+	if err != nil {
+		return constants.ErrScheduleNotFound
+	}
+
+	if _, err := h.scheduleRepo.FindByIDAndUpdate(c.Context(), id, map[string]interface{}{
+		"name":        req.Name,
+		"description": req.Description,
+		"timezone":    req.Timezone,
+		"windows":     req.Windows,
+	}); err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+	if err := h.sched.Refresh(c.Context(), id); err != nil {
+		h.hub.EmitError("Failed to evaluate schedule: "+err.Error(), userID)
+	}
+	sched, err := h.scheduleRepo.FindByID(c.Context(), id)
+	if err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   constants.AuditActionUpdateSchedule,
+		Resource: "schedule:" + id,
+		Details: fmt.Sprintf("Updated schedule %s: %s -> %s",
+			sched.Name, formatScheduleWindows(before), formatScheduleWindows(sched)),
+		IP: c.IP(),
+	})
+
+	h.hub.EmitRuleChange("schedule_updated", id, userID, 0)
+
+	return c.JSON(fiber.Map{"message": "schedule updated", "schedule": sched})
+}
+
+// DeleteSchedule deletes a schedule no rule or group application uses.
+func (h *ScheduleHandler) DeleteSchedule(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	n, err := h.scheduleRepo.CountReferences(c.Context(), id)
+	if err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+	if n > 0 {
+		return constants.ErrScheduleReferenced.WithMessage(fmt.Sprintf("schedule is used by %d rule(s) or applied security group(s)", n))
+	}
+
+	if err := h.scheduleRepo.DeleteOne(c.Context(), id); err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   constants.AuditActionDeleteSchedule,
+		Resource: "schedule:" + id,
+		IP:       c.IP(),
+	})
+
+	return c.JSON(fiber.Map{"message": "schedule deleted"})
+}
+
+// validateSchedule checks and normalises a schedule request.
+func validateSchedule(req *ScheduleRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return constants.ErrNameRequired
+	}
+	req.Timezone = strings.TrimSpace(req.Timezone)
+	if req.Timezone == "" {
+		req.Timezone = "UTC"
+	}
+	for i := range req.Windows {
+		req.Windows[i].Cron = strings.Join(strings.Fields(req.Windows[i].Cron), " ")
+		req.Windows[i].Duration = strings.TrimSpace(req.Windows[i].Duration)
+	}
+	if err := scheduler.Validate(req.Timezone, req.Windows); err != nil {
+		return constants.ErrInvalidRequestBody.WithMessage(err.Error())
+	}
+	return nil
+}
+
+// formatScheduleWindows renders a schedule as e.g.
+// "0 9 * * mon-fri for 8h (Europe/Berlin)".
+func formatScheduleWindows(s *db.Schedule) string {
+	parts := make([]string, 0, len(s.Windows))
+	for _, w := range s.Windows {
+		parts = append(parts, w.Cron+" for "+w.Duration)
+	}
+	return strings.Join(parts, "; ") + " (" + s.Timezone + ")"
+}
@@ -34,17 +34,7 @@ func NewSystemPortsHandler() *SystemPortsHandler {
 
 // ListListeningPorts returns all ports currently listening on the system.
 func (h *SystemPortsHandler) ListListeningPorts(c *fiber.Ctx) error {
-	var ports []ListeningPort
-	var err error
-
-	if runtime.GOOS == "linux" {
-		ports, err = getLinuxListeningPorts()
-	} else if runtime.GOOS == "windows" {
-		ports, err = getWindowsListeningPorts()
-	} else {
-		ports, err = getGenericListeningPorts()
-	}
-
+	ports, err := listeningPorts()
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   "failed to get listening ports",
@@ -58,6 +48,19 @@ func (h *SystemPortsHandler) ListListeningPorts(c *fiber.Ctx) error {
 	})
 }
 
+// listeningPorts returns the ports listening on the system, deduplicated by
+// port and protocol.
+func listeningPorts() ([]ListeningPort, error) {
+	switch runtime.GOOS {
+	case "linux":
+		return getLinuxListeningPorts()
+	case "windows":
+		return getWindowsListeningPorts()
+	default:
+		return getGenericListeningPorts()
+	}
+}
+
 // getLinuxListeningPorts reads from /proc/net/tcp and /proc/net/udp.
 func getLinuxListeningPorts() ([]ListeningPort, error) {
 	var ports []ListeningPort
@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/enjoys-in/secureflow/internal/constants"
+	"github.com/enjoys-in/secureflow/internal/db"
+	"github.com/enjoys-in/secureflow/internal/repository"
+	"github.com/enjoys-in/secureflow/internal/threatfeed"
+	"github.com/enjoys-in/secureflow/internal/websocket"
+)
+
+// ThreatFeedHandler handles threat-intelligence blocklist feeds.
+type ThreatFeedHandler struct {
+	feedRepo  repository.ThreatFeedRepository
+	auditRepo repository.AuditLogRepository
+	fetcher   *threatfeed.Fetcher
+	hub       *websocket.Hub
+}
+
+// NewThreatFeedHandler creates a new threat feed handler.
+func NewThreatFeedHandler(feedRepo repository.ThreatFeedRepository, auditRepo repository.AuditLogRepository, fetcher *threatfeed.Fetcher, hub *websocket.Hub) *ThreatFeedHandler {
+	return &ThreatFeedHandler{feedRepo: feedRepo, auditRepo: auditRepo, fetcher: fetcher, hub: hub}
+}
+
+// ThreatFeedRequest is the request body for creating or updating a feed.
+type ThreatFeedRequest struct {
+	Name           string `json:"name"`
+	Source         string `json:"source"`                    // http(s) URL or absolute file path
+	Format         string `json:"format,omitempty"`          // defaults to cidr
+	CSVColumn      int    `json:"csv_column,omitempty"`      // csv feeds only
+	RefreshMinutes int    `json:"refresh_minutes,omitempty"` // defaults to 60
+	Action         string `json:"action,omitempty"`          // defaults to DROP
+	Enabled        *bool  `json:"enabled,omitempty"`         // defaults to true
+}
+
+// ListThreatFeeds returns all feeds with their fetch statistics.
+func (h *ThreatFeedHandler) ListThreatFeeds(c *fiber.Ctx) error {
+	feeds, err := h.feedRepo.FindAll(c.Context(), nil, constants.MaxPageLimit, 0)
+	if err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+	return c.JSON(fiber.Map{"feeds": feeds})
+}
+
+// GetThreatFeed returns a single feed.
+func (h *ThreatFeedHandler) GetThreatFeed(c *fiber.Ctx) error {
+	feed, err := h.feedRepo.FindByID(c.Context(), c.Params("id"))
+	if err != nil {
+		return constants.ErrThreatFeedNotFound
+	}
+	return c.JSON(fiber.Map{"feed": feed})
+}
+
+// CreateThreatFeed stores a feed, installs its blocking rule and fetches it
+// in the background.
+func (h *ThreatFeedHandler) CreateThreatFeed(c *fiber.Ctx) error {
+	var req ThreatFeedRequest
+	if err := c.BodyParser(&req); err != nil {
+		return constants.ErrInvalidRequestBody
+	}
+	if err := validateThreatFeed(&req); err != nil {
+		return err
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+	feed := &db.ThreatFeed{
+		Name:           req.Name,
+		Source:         req.Source,
+		Format:         req.Format,
+		CSVColumn:      req.CSVColumn,
+		RefreshMinutes: req.RefreshMinutes,
+		Action:         req.Action,
+		Enabled:        *req.Enabled,
+		CreatedBy:      userID,
+	}
+	if err := h.feedRepo.Create(c.Context(), feed); err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   constants.AuditActionCreateThreatFeed,
+		Resource: "threat_feed:" + feed.ID,
+		Details:  "Created threat feed " + formatThreatFeed(feed),
+		IP:       c.IP(),
+	})
+	h.install(feed, userID)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "threat feed created",
+		"feed":    feed,
+	})
+}
+
+// UpdateThreatFeed changes a feed and fetches it again in the background.
+// A disabled feed stops being enforced but keeps its entries.
+func (h *ThreatFeedHandler) UpdateThreatFeed(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var req ThreatFeedRequest
+	if err := c.BodyParser(&req); err != nil {
+		return constants.ErrInvalidRequestBody
+	}
+	if err := validateThreatFeed(&req); err != nil {
+		return err
+	}
+
+	before, err := h.feedRepo.FindByID(c.Context(), id)
+	if err != nil {
+		return constants.ErrThreatFeedNotFound
+	}
+	feed, err := h.feedRepo.FindByIDAndUpdate(c.Context(), id, map[string]interface{}{
+		"name":            req.Name,
+		"source":          req.Source,
+		"format":          req.Format,
+		"csv_column":      req.CSVColumn,
+		"refresh_minutes": req.RefreshMinutes,
+		"action":          req.Action,
+		"enabled":         *req.Enabled,
+	})
+	if err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   constants.AuditActionUpdateThreatFeed,
+		Resource: "threat_feed:" + id,
+		Details:  fmt.Sprintf("Updated threat feed %s -> %s", formatThreatFeed(before), formatThreatFeed(feed)),
+		IP:       c.IP(),
+	})
+	h.install(feed, userID)
+
+	return c.JSON(fiber.Map{"message": "threat feed updated", "feed": feed})
+}
+
+// DeleteThreatFeed removes a feed, its blocking rule and its entries.
+func (h *ThreatFeedHandler) DeleteThreatFeed(c *fiber.Ctx) error {
+	id := c.Params("id")
+	feed, err := h.feedRepo.FindByID(c.Context(), id)
+	if err != nil {
+		return constants.ErrThreatFeedNotFound
+	}
+	if err := h.fetcher.Uninstall(id); err != nil {
+		return constants.ErrFirewallFailure.Wrap(err)
+	}
+	if err := h.feedRepo.DeleteOne(c.Context(), id); err != nil {
+		return constants.ErrDatabaseFailure.Wrap(err)
+	}
+
+	userID, _ := c.Locals("user_id").(string)
+	_ = h.auditRepo.Create(c.Context(), &db.AuditLog{
+		UserID:   userID,
+		Action:   constants.AuditActionDeleteThreatFeed,
+		Resource: "threat_feed:" + id,
+		Details:  fmt.Sprintf("Deleted threat feed %s with %d entries", formatThreatFeed(feed), feed.EntryCount),
+		IP:       c.IP(),
+	})
+	h.hub.EmitRuleChange("deleted", id, userID, 0)
+
+	return c.JSON(fiber.Map{"message": "threat feed deleted"})
+}
+
+// RefreshThreatFeed fetches a feed now and returns its updated statistics.
+func (h *ThreatFeedHandler) RefreshThreatFeed(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if _, err := h.feedRepo.FindByID(c.Context(), id); err != nil {
+		return constants.ErrThreatFeedNotFound
+	}
+	feed, err := h.fetcher.Refresh(c.Context(), id)
+	if err != nil {
+		return constants.ErrThreatFeedFetch.WithMessage("threat feed could not be fetched: " + err.Error())
+	}
+	return c.JSON(fiber.Map{"message": "threat feed refreshed", "feed": feed})
+}
+
+// install brings the kernel in line with a feed and fetches it in the
+// background, so slow downloads do not hold up the request.
+func (h *ThreatFeedHandler) install(feed *db.ThreatFeed, userID string) {
+	if err := h.fetcher.Install(feed); err != nil {
+		h.hub.EmitError("Failed to install threat feed "+feed.Name+": "+err.Error(), userID)
+		return
+	}
+	h.hub.EmitRuleChange("updated", feed.ID, userID, 0)
+	if feed.Enabled {
+		go func(id string) {
+			_, _ = h.fetcher.Refresh(context.Background(), id)
+		}(feed.ID)
+	}
+}
+
+// validateThreatFeed checks and normalises a feed request.
+func validateThreatFeed(req *ThreatFeedRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return constants.ErrNameRequired
+	}
+	req.Source = strings.TrimSpace(req.Source)
+	if req.Source == "" {
+		return constants.ErrInvalidRequestBody.WithMessage("source is required")
+	}
+	if threatfeed.IsURL(req.Source) {
+		if u, err := url.Parse(req.Source); err != nil || u.Host == "" {
+			return constants.ErrInvalidRequestBody.WithMessage("source is not a valid URL")
+		}
+	} else if !filepath.IsAbs(req.Source) {
+		return constants.ErrInvalidRequestBody.WithMessage("source must be an http(s) URL or an absolute file path")
+	}
+
+	req.Format = strings.ToLower(strings.TrimSpace(req.Format))
+	if req.Format == "" {
+		req.Format = constants.FeedFormatCIDR
+	}
+	switch req.Format {
+	case constants.FeedFormatPlain, constants.FeedFormatCIDR:
+		if req.CSVColumn != 0 {
+			return constants.ErrInvalidRequestBody.WithMessage("csv_column only applies to csv feeds")
+		}
+	case constants.FeedFormatCSV:
+		if req.CSVColumn < 0 {
+			return constants.ErrInvalidRequestBody.WithMessage("csv_column must not be negative")
+		}
+	default:
+		return constants.ErrInvalidRequestBody.WithMessage("format must be plain, cidr or csv")
+	}
+
+	if req.RefreshMinutes == 0 {
+		req.RefreshMinutes = constants.FeedDefaultRefreshMinutes
+	}
+	if req.RefreshMinutes < constants.FeedMinRefreshMinutes || req.RefreshMinutes > constants.FeedMaxRefreshMinutes {
+		return constants.ErrInvalidRequestBody.WithMessage(fmt.Sprintf("refresh_minutes must be between %d and %d", constants.FeedMinRefreshMinutes, constants.FeedMaxRefreshMinutes))
+	}
+
+	req.Action = strings.ToUpper(strings.TrimSpace(req.Action))
+	if req.Action == "" {
+		req.Action = constants.ActionDrop
+	}
+	if req.Action != constants.ActionDrop && req.Action != constants.ActionReject {
+		return constants.ErrInvalidAction.WithMessage("action must be DROP or REJECT")
+	}
+
+	if req.Enabled == nil {
+		enabled := true
+		req.Enabled = &enabled
+	}
+	return nil
+}
+
+// formatThreatFeed renders a feed for audit details, e.g.
+// "spamhaus-drop: cidr from https://www.spamhaus.org/drop/drop.txt every 720m, DROP".
+func formatThreatFeed(f *db.ThreatFeed) string {
+	s := fmt.Sprintf("%s: %s from %s every %dm, %s", f.Name, f.Format, f.Source, f.RefreshMinutes, f.Action)
+	if f.Format == constants.FeedFormatCSV {
+		s += fmt.Sprintf(", column %d", f.CSVColumn)
+	}
+	if !f.Enabled {
+		s += ", disabled"
+	}
+	return s
+}
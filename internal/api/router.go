@@ -14,8 +14,15 @@ import (
 	"github.com/enjoys-in/secureflow/internal/constants"
 	"github.com/enjoys-in/secureflow/internal/fga"
 	"github.com/enjoys-in/secureflow/internal/firewall"
+	"github.com/enjoys-in/secureflow/internal/geoip"
+	"github.com/enjoys-in/secureflow/internal/honeypot"
+	"github.com/enjoys-in/secureflow/internal/jail"
+	"github.com/enjoys-in/secureflow/internal/knock"
 	"github.com/enjoys-in/secureflow/internal/repository"
+	"github.com/enjoys-in/secureflow/internal/scheduler"
 	"github.com/enjoys-in/secureflow/internal/security"
+	"github.com/enjoys-in/secureflow/internal/templates"
+	"github.com/enjoys-in/secureflow/internal/threatfeed"
 	ws "github.com/enjoys-in/secureflow/internal/websocket"
 	"github.com/enjoys-in/secureflow/pkg/logger"
 )
@@ -38,6 +45,43 @@ type ServerDeps struct {
 	InvitationRepo    repository.InvitationRepository
 	ImmutablePortRepo repository.ImmutablePortRepository
 	BlockedIPRepo     repository.BlockedIPRepository
+	RevisionRepo      repository.SecurityGroupRevisionRepository
+	AddressObjectRepo repository.AddressObjectRepository
+	ServiceObjectRepo repository.ServiceObjectRepository
+	NATRuleRepo       repository.NATRuleRepository
+	ScheduleRepo      repository.ScheduleRepository
+	JITPolicyRepo     repository.JITPolicyRepository
+	JITGrantRepo      repository.JITGrantRepository
+	KnockGateRepo     repository.KnockGateRepository
+	FQDNRepo          repository.FQDNResolutionRepository
+	ThreatFeedRepo    repository.ThreatFeedRepository
+	JailRepo          repository.JailRepository
+	HoneypotRepo      repository.HoneypotRepository
+
+	// Scheduler activates and deactivates scheduled rules.
+	Scheduler *scheduler.Scheduler
+
+	// KnockDetector watches traffic for port knocking sequences.
+	KnockDetector *knock.Detector
+
+	// ThreatFeeds fetches blocklist feeds and installs their rules.
+	ThreatFeeds *threatfeed.Fetcher
+
+	// Jails tail log files and ban sources that keep failing.
+	Jails *jail.Watcher
+
+	// Honeypots serve decoy ports and block the sources that touch them.
+	Honeypots *honeypot.Watcher
+
+	// GeoIP maps addresses to countries; nil when no database is configured.
+	GeoIP *geoip.DB
+
+	// Templates is the catalog of security group templates.
+	Templates *templates.Library
+
+	// LocalServerID is the servers row for this host; applied security
+	// groups are recorded against it.
+	LocalServerID string
 }
 
 // NewServer creates and configures the Fiber application with all routes.
@@ -59,10 +103,21 @@ func NewServer(deps ServerDeps) *fiber.App {
 	// ---- Handlers ----
 	healthH := handlers.NewHealthHandler(deps.DB)
 	authH := handlers.NewAuthHandler(deps.Auth, deps.UserRepo, deps.InvitationRepo, deps.AuditLogRepo, deps.FGA)
-	firewallH := handlers.NewFirewallHandler(deps.FirewallRuleRepo, deps.AuditLogRepo, deps.Firewall, deps.Hub)
-	profileH := handlers.NewProfileHandler(deps.SecurityGroupRepo, deps.FirewallRuleRepo, deps.AuditLogRepo, deps.Firewall, deps.Hub)
+	firewallH := handlers.NewFirewallHandler(deps.SecurityGroupRepo, deps.FirewallRuleRepo, deps.RevisionRepo, deps.AuditLogRepo, deps.Firewall, deps.Hub)
+	profileH := handlers.NewProfileHandler(deps.SecurityGroupRepo, deps.FirewallRuleRepo, deps.RevisionRepo, deps.AuditLogRepo, deps.ScheduleRepo, deps.Firewall, deps.Hub, deps.LocalServerID)
+	revisionH := handlers.NewRevisionHandler(deps.SecurityGroupRepo, deps.FirewallRuleRepo, deps.RevisionRepo, deps.AuditLogRepo, deps.Firewall, deps.Hub, deps.LocalServerID)
+	objectH := handlers.NewObjectHandler(deps.AddressObjectRepo, deps.ServiceObjectRepo, deps.AuditLogRepo, deps.Firewall, deps.Hub)
+	natH := handlers.NewNATHandler(deps.NATRuleRepo, deps.AuditLogRepo, deps.Firewall, deps.Hub, deps.LocalServerID)
+	scheduleH := handlers.NewScheduleHandler(deps.ScheduleRepo, deps.AuditLogRepo, deps.Scheduler, deps.Hub)
+	jitH := handlers.NewJITHandler(deps.JITPolicyRepo, deps.JITGrantRepo, deps.FirewallRuleRepo, deps.AuditLogRepo, deps.Auth, deps.Firewall, deps.Hub)
+	geoipH := handlers.NewGeoIPHandler(deps.GeoIP)
+	threatFeedH := handlers.NewThreatFeedHandler(deps.ThreatFeedRepo, deps.AuditLogRepo, deps.ThreatFeeds, deps.Hub)
+	jailH := handlers.NewJailHandler(deps.JailRepo, deps.AuditLogRepo, deps.Jails, deps.Hub)
+	honeypotH := handlers.NewHoneypotHandler(deps.HoneypotRepo, deps.AuditLogRepo, deps.Honeypots, deps.Firewall, deps.Hub)
+	knockH := handlers.NewKnockHandler(deps.KnockGateRepo, deps.AuditLogRepo, deps.KnockDetector, deps.Firewall, deps.Hub)
+	templateH := handlers.NewTemplateHandler(deps.Templates, deps.SecurityGroupRepo, deps.FirewallRuleRepo, deps.RevisionRepo, deps.AuditLogRepo)
 	userH := handlers.NewUserHandler(deps.UserRepo, deps.InvitationRepo, deps.AuditLogRepo, deps.Auth, deps.FGA)
-	logsH := handlers.NewLogsHandler(deps.AuditLogRepo)
+	logsH := handlers.NewLogsHandler(deps.AuditLogRepo, deps.FQDNRepo)
 	portsH := handlers.NewImmutablePortsHandler(deps.ImmutablePortRepo, deps.AuditLogRepo)
 	sysPortsH := handlers.NewSystemPortsHandler()
 	processH := handlers.NewProcessHandler()
@@ -94,6 +149,7 @@ func NewServer(deps ServerDeps) *fiber.App {
 	rules.Get("/", firewallH.ListRules)
 	rules.Get("/all", firewallH.ListAllRulesWithDetails)
 	rules.Post("/", permMW.RequirePermission(constants.RelationCanEdit, constants.FGAObjectFirewall), firewallH.AddRule)
+	rules.Put("/:id", permMW.RequirePermission(constants.RelationCanEdit, constants.FGAObjectFirewall), firewallH.UpdateRule)
 	rules.Delete("/:id", permMW.RequirePermission(constants.RelationCanEdit, constants.FGAObjectFirewall), firewallH.DeleteRule)
 
 	// System info
@@ -112,13 +168,111 @@ func NewServer(deps ServerDeps) *fiber.App {
 	profiles := protected.Group("/profiles")
 	profiles.Get("/", profileH.ListSecurityGroups)
 	profiles.Post("/", permMW.RequirePermission(constants.RelationCanEdit, constants.FGAObjectFirewall), profileH.CreateSecurityGroup)
+	profiles.Get("/applied", profileH.ListAppliedSecurityGroups)
 	profiles.Get("/:id", profileH.GetSecurityGroup)
 	profiles.Put("/:id", permMW.RequirePermission(constants.RelationCanEdit, constants.FGAObjectFirewall), profileH.UpdateSecurityGroup)
 	profiles.Delete("/:id", permMW.RequirePermission(constants.RelationCanAdmin, constants.FGAObjectFirewall), profileH.DeleteSecurityGroup)
 	profiles.Post("/:id/rules", permMW.RequirePermission(constants.RelationCanEdit, constants.FGAObjectFirewall), profileH.AddRuleToGroup)
 	profiles.Get("/:id/rules", profileH.ListGroupRules)
+	profiles.Put("/:id/rules/:ruleId", permMW.RequirePermission(constants.RelationCanEdit, constants.FGAObjectFirewall), profileH.UpdateGroupRule)
 	profiles.Delete("/:id/rules/:ruleId", permMW.RequirePermission(constants.RelationCanEdit, constants.FGAObjectFirewall), profileH.DeleteRuleFromGroup)
 	profiles.Post("/:id/apply", permMW.RequirePermission(constants.RelationCanAdmin, constants.FGAObjectFirewall), profileH.ApplySecurityGroup)
+	profiles.Post("/:id/detach", permMW.RequirePermission(constants.RelationCanAdmin, constants.FGAObjectFirewall), profileH.DetachSecurityGroup)
+	profiles.Post("/:id/clone", permMW.RequirePermission(constants.RelationCanEdit, constants.FGAObjectFirewall), profileH.CloneSecurityGroup)
+	profiles.Get("/:id/diff", profileH.DiffSecurityGroup)
+	profiles.Get("/:id/revisions", revisionH.ListRevisions)
+	profiles.Get("/:id/revisions/diff", revisionH.DiffRevisions)
+	profiles.Get("/:id/revisions/:rev", revisionH.GetRevision)
+	profiles.Post("/:id/revisions/:rev/restore", permMW.RequirePermission(constants.RelationCanEdit, constants.FGAObjectFirewall), revisionH.RestoreRevision)
+	profiles.Post("/:id/revisions/:rev/apply", permMW.RequirePermission(constants.RelationCanAdmin, constants.FGAObjectFirewall), revisionH.ApplyRevision)
+
+	// Security group templates (editor+ to instantiate)
+	tmpl := protected.Group("/templates")
+	tmpl.Get("/", templateH.ListTemplates)
+	tmpl.Get("/:name", templateH.GetTemplate)
+	tmpl.Post("/:name/instantiate", permMW.RequirePermission(constants.RelationCanEdit, constants.FGAObjectFirewall), templateH.InstantiateTemplate)
+
+	// Address and service objects referenced by rules (editor+)
+	objects := protected.Group("/objects")
+	objects.Get("/addresses", objectH.ListAddressObjects)
+	objects.Post("/addresses", permMW.RequirePermission(constants.RelationCanEdit, constants.FGAObjectFirewall), objectH.CreateAddressObject)
+	objects.Get("/addresses/:id", objectH.GetAddressObject)
+	objects.Put("/addresses/:id", permMW.RequirePermission(constants.RelationCanEdit, constants.FGAObjectFirewall), objectH.UpdateAddressObject)
+	objects.Delete("/addresses/:id", permMW.RequirePermission(constants.RelationCanEdit, constants.FGAObjectFirewall), objectH.DeleteAddressObject)
+	objects.Get("/services", objectH.ListServiceObjects)
+	objects.Post("/services", permMW.RequirePermission(constants.RelationCanEdit, constants.FGAObjectFirewall), objectH.CreateServiceObject)
+	objects.Get("/services/:id", objectH.GetServiceObject)
+	objects.Put("/services/:id", permMW.RequirePermission(constants.RelationCanEdit, constants.FGAObjectFirewall), objectH.UpdateServiceObject)
+	objects.Delete("/services/:id", permMW.RequirePermission(constants.RelationCanEdit, constants.FGAObjectFirewall), objectH.DeleteServiceObject)
+
+	// NAT and port forwarding on this server (editor+ for mutations)
+	nat := protected.Group("/nat")
+	nat.Get("/", natH.ListNATRules)
+	nat.Get("/:id", natH.GetNATRule)
+	nat.Post("/", permMW.RequirePermission(constants.RelationCanEdit, constants.FGAObjectFirewall), natH.CreateNATRule)
+	nat.Put("/:id", permMW.RequirePermission(constants.RelationCanEdit, constants.FGAObjectFirewall), natH.UpdateNATRule)
+	nat.Delete("/:id", permMW.RequirePermission(constants.RelationCanEdit, constants.FGAObjectFirewall), natH.DeleteNATRule)
+
+	// Schedules limiting rules and group applications to time windows (editor+ for mutations)
+	schedules := protected.Group("/schedules")
+	schedules.Get("/", scheduleH.ListSchedules)
+	schedules.Get("/:id", scheduleH.GetSchedule)
+	schedules.Post("/", permMW.RequirePermission(constants.RelationCanEdit, constants.FGAObjectFirewall), scheduleH.CreateSchedule)
+	schedules.Put("/:id", permMW.RequirePermission(constants.RelationCanEdit, constants.FGAObjectFirewall), scheduleH.UpdateSchedule)
+	schedules.Delete("/:id", permMW.RequirePermission(constants.RelationCanEdit, constants.FGAObjectFirewall), scheduleH.DeleteSchedule)
+
+	// Just-in-time access: any user may request and revoke their own access;
+	// policies and approvals are admin only
+	jit := protected.Group("/jit")
+	jit.Get("/policies", jitH.ListPolicies)
+	jit.Post("/policies", permMW.RequirePermission(constants.RelationCanAdmin, constants.FGAObjectFirewall), jitH.CreatePolicy)
+	jit.Put("/policies/:id", permMW.RequirePermission(constants.RelationCanAdmin, constants.FGAObjectFirewall), jitH.UpdatePolicy)
+	jit.Delete("/policies/:id", permMW.RequirePermission(constants.RelationCanAdmin, constants.FGAObjectFirewall), jitH.DeletePolicy)
+	jit.Get("/requests", jitH.ListRequests)
+	jit.Post("/requests", jitH.RequestAccess)
+	jit.Post("/requests/:id/approve", permMW.RequirePermission(constants.RelationCanAdmin, constants.FGAObjectFirewall), jitH.ApproveRequest)
+	jit.Post("/requests/:id/deny", permMW.RequirePermission(constants.RelationCanAdmin, constants.FGAObjectFirewall), jitH.DenyRequest)
+	jit.Post("/requests/:id/revoke", jitH.RevokeRequest)
+
+	// GeoIP database status and lookups (viewer+)
+	geo := protected.Group("/geoip")
+	geo.Get("/", geoipH.GetStatus)
+	geo.Get("/lookup/:ip", geoipH.Lookup)
+
+	// Port knocking gates (admin only for mutations)
+	knockGates := protected.Group("/knock-gates")
+	knockGates.Get("/", knockH.ListKnockGates)
+	knockGates.Get("/:id", knockH.GetKnockGate)
+	knockGates.Post("/", permMW.RequirePermission(constants.RelationCanAdmin, constants.FGAObjectFirewall), knockH.CreateKnockGate)
+	knockGates.Put("/:id", permMW.RequirePermission(constants.RelationCanAdmin, constants.FGAObjectFirewall), knockH.UpdateKnockGate)
+	knockGates.Delete("/:id", permMW.RequirePermission(constants.RelationCanAdmin, constants.FGAObjectFirewall), knockH.DeleteKnockGate)
+
+	// Threat-intelligence feeds (admin only for mutations, since sources may
+	// be local files; editor+ to refresh)
+	threatFeeds := protected.Group("/threat-feeds")
+	threatFeeds.Get("/", threatFeedH.ListThreatFeeds)
+	threatFeeds.Get("/:id", threatFeedH.GetThreatFeed)
+	threatFeeds.Post("/", permMW.RequirePermission(constants.RelationCanAdmin, constants.FGAObjectFirewall), threatFeedH.CreateThreatFeed)
+	threatFeeds.Put("/:id", permMW.RequirePermission(constants.RelationCanAdmin, constants.FGAObjectFirewall), threatFeedH.UpdateThreatFeed)
+	threatFeeds.Delete("/:id", permMW.RequirePermission(constants.RelationCanAdmin, constants.FGAObjectFirewall), threatFeedH.DeleteThreatFeed)
+	threatFeeds.Post("/:id/refresh", permMW.RequirePermission(constants.RelationCanEdit, constants.FGAObjectFirewall), threatFeedH.RefreshThreatFeed)
+
+	// Jails (admin only for mutations, since they read local log files)
+	jails := protected.Group("/jails")
+	jails.Get("/", jailH.ListJails)
+	jails.Get("/presets", jailH.ListJailPresets)
+	jails.Get("/:id", jailH.GetJail)
+	jails.Post("/", permMW.RequirePermission(constants.RelationCanAdmin, constants.FGAObjectFirewall), jailH.CreateJail)
+	jails.Put("/:id", permMW.RequirePermission(constants.RelationCanAdmin, constants.FGAObjectFirewall), jailH.UpdateJail)
+	jails.Delete("/:id", permMW.RequirePermission(constants.RelationCanAdmin, constants.FGAObjectFirewall), jailH.DeleteJail)
+
+	// Honeypot decoy ports (admin only for mutations)
+	honeypots := protected.Group("/honeypots")
+	honeypots.Get("/", honeypotH.ListHoneypots)
+	honeypots.Get("/:id", honeypotH.GetHoneypot)
+	honeypots.Post("/", permMW.RequirePermission(constants.RelationCanAdmin, constants.FGAObjectFirewall), honeypotH.CreateHoneypot)
+	honeypots.Put("/:id", permMW.RequirePermission(constants.RelationCanAdmin, constants.FGAObjectFirewall), honeypotH.UpdateHoneypot)
+	honeypots.Delete("/:id", permMW.RequirePermission(constants.RelationCanAdmin, constants.FGAObjectFirewall), honeypotH.DeleteHoneypot)
 
 	// Users (admin only)
 	users := protected.Group("/users")
@@ -135,6 +289,7 @@ func NewServer(deps ServerDeps) *fiber.App {
 	// Audit logs (viewer+)
 	logs := protected.Group("/logs")
 	logs.Get("/audit", permMW.RequirePermission(constants.RelationCanView, constants.FGAObjectSystem), logsH.ListAuditLogs)
+	logs.Get("/fqdn", permMW.RequirePermission(constants.RelationCanView, constants.FGAObjectSystem), logsH.ListFQDNResolutions)
 
 	// Immutable ports (admin only)
 	ports := protected.Group("/ports")
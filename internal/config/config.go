@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"strconv"
 	"strings"
@@ -31,6 +32,22 @@ type Config struct {
 	// Firewall
 	FirewallBackend string `yaml:"firewall_backend"` // "iptables" or "nftables"
 	ImmutablePorts  []int  `yaml:"immutable_ports"`
+	DNSServer       string `yaml:"dns_server"`     // resolves FQDN rules; empty uses /etc/resolv.conf
+	GeoIPDatabase   string `yaml:"geoip_database"` // MaxMind-format .mmdb file; empty disables country rules
+
+	// Security group templates (in addition to the built-in ones)
+	TemplatesDir string `yaml:"templates_dir"`
+
+	// Port-scan detection on the live traffic stream. A threshold of 0
+	// disables its check.
+	ScanDetection       bool     `yaml:"scan_detection"`
+	ScanWindowSeconds   int      `yaml:"scan_window_seconds"`
+	ScanVerticalPorts   int      `yaml:"scan_vertical_ports"`    // distinct ports probed on one address
+	ScanHorizontalHosts int      `yaml:"scan_horizontal_hosts"`  // distinct addresses probed on one port
+	ScanSYNFloodPackets int      `yaml:"scan_syn_flood_packets"` // SYNs from a source that never ACKs
+	ScanAutoBlock       bool     `yaml:"scan_auto_block"`
+	ScanBlockSeconds    int      `yaml:"scan_block_seconds"`
+	ScanIgnoreCIDRs     []string `yaml:"scan_ignore_cidrs"`
 
 	// Logging
 	LogLevel  string `yaml:"log_level"`
@@ -56,8 +73,19 @@ func Load() (*Config, error) {
 		OpenFGAStoreID:  getEnv("OPENFGA_STORE_ID", ""),
 		JWTSecret:       getEnv("JWT_SECRET", "change-me-in-production"),
 		FirewallBackend: getEnv("FIREWALL_BACKEND", "iptables"),
+		DNSServer:       getEnv("DNS_SERVER", ""),
+		GeoIPDatabase:   getEnv("GEOIP_DATABASE", ""),
+		TemplatesDir:    getEnv("TEMPLATES_DIR", ""),
 		LogLevel:        getEnv("LOG_LEVEL", "info"),
 		LogFormat:       getEnv("LOG_FORMAT", "json"),
+
+		ScanDetection:       getEnvBool("SCAN_DETECTION", true),
+		ScanWindowSeconds:   getEnvInt("SCAN_WINDOW_SECONDS", 60),
+		ScanVerticalPorts:   getEnvInt("SCAN_VERTICAL_PORTS", 20),
+		ScanHorizontalHosts: getEnvInt("SCAN_HORIZONTAL_HOSTS", 10),
+		ScanSYNFloodPackets: getEnvInt("SCAN_SYN_FLOOD_PACKETS", 200),
+		ScanAutoBlock:       getEnvBool("SCAN_AUTO_BLOCK", false),
+		ScanBlockSeconds:    getEnvInt("SCAN_BLOCK_SECONDS", 3600),
 	}
 
 	// Parse immutable ports from env or use defaults
@@ -72,6 +100,29 @@ func Load() (*Config, error) {
 		cfg.ImmutablePorts = DefaultImmutablePorts
 	}
 
+	// Parse the networks the port-scan detector leaves alone
+	for _, c := range strings.Split(getEnv("SCAN_IGNORE_CIDRS", ""), ",") {
+		if c = strings.TrimSpace(c); c == "" {
+			continue
+		}
+		if !strings.Contains(c, "/") {
+			c += "/32"
+		}
+		if _, _, err := net.ParseCIDR(c); err != nil {
+			return nil, fmt.Errorf("invalid SCAN_IGNORE_CIDRS: %w", err)
+		}
+		cfg.ScanIgnoreCIDRs = append(cfg.ScanIgnoreCIDRs, c)
+	}
+	if cfg.ScanWindowSeconds < 1 {
+		return nil, fmt.Errorf("invalid SCAN_WINDOW_SECONDS: must be at least 1")
+	}
+	if cfg.ScanVerticalPorts < 0 || cfg.ScanHorizontalHosts < 0 || cfg.ScanSYNFloodPackets < 0 {
+		return nil, fmt.Errorf("invalid scan threshold: must not be negative")
+	}
+	if cfg.ScanBlockSeconds < 60 {
+		return nil, fmt.Errorf("invalid SCAN_BLOCK_SECONDS: must be at least 60")
+	}
+
 	// Validate
 	if cfg.JWTSecret == "change-me-in-production" {
 		fmt.Fprintln(os.Stderr, "WARNING: Using default JWT secret. Set JWT_SECRET in production!")
@@ -47,22 +47,70 @@ const (
 	EventTypeRuleChange = "rule_change"
 	EventTypeError      = "error"
 	EventTypeAudit      = "audit"
+	EventTypeAlert      = "alert"
 )
 
 // --- Audit Actions ---
 const (
-	AuditActionAddRule             = "add_rule"
-	AuditActionDeleteRule          = "delete_rule"
-	AuditActionCreateSecurityGroup = "create_security_group"
-	AuditActionUpdateSecurityGroup = "update_security_group"
-	AuditActionDeleteSecurityGroup = "delete_security_group"
-	AuditActionApplySecurityGroup  = "apply_security_group"
-	AuditActionInviteUser          = "invite_user"
-	AuditActionAcceptInvite        = "accept_invite"
-	AuditActionRegister            = "register"
-	AuditActionLogin               = "login"
-	AuditActionAddImmutablePort    = "add_immutable_port"
-	AuditActionDeleteImmutablePort = "delete_immutable_port"
+	AuditActionAddRule              = "add_rule"
+	AuditActionUpdateRule           = "update_rule"
+	AuditActionDeleteRule           = "delete_rule"
+	AuditActionCreateSecurityGroup  = "create_security_group"
+	AuditActionUpdateSecurityGroup  = "update_security_group"
+	AuditActionDeleteSecurityGroup  = "delete_security_group"
+	AuditActionApplySecurityGroup   = "apply_security_group"
+	AuditActionRestoreSecurityGroup = "restore_security_group"
+	AuditActionDetachSecurityGroup  = "detach_security_group"
+	AuditActionCreateAddressObject  = "create_address_object"
+	AuditActionUpdateAddressObject  = "update_address_object"
+	AuditActionDeleteAddressObject  = "delete_address_object"
+	AuditActionCreateServiceObject  = "create_service_object"
+	AuditActionUpdateServiceObject  = "update_service_object"
+	AuditActionDeleteServiceObject  = "delete_service_object"
+	AuditActionInstantiateTemplate  = "instantiate_template"
+	AuditActionCloneSecurityGroup   = "clone_security_group"
+	AuditActionInviteUser           = "invite_user"
+	AuditActionAcceptInvite         = "accept_invite"
+	AuditActionRegister             = "register"
+	AuditActionLogin                = "login"
+	AuditActionAddImmutablePort     = "add_immutable_port"
+	AuditActionDeleteImmutablePort  = "delete_immutable_port"
+	AuditActionAddNATRule           = "add_nat_rule"
+	AuditActionUpdateNATRule        = "update_nat_rule"
+	AuditActionDeleteNATRule        = "delete_nat_rule"
+	AuditActionCreateSchedule       = "create_schedule"
+	AuditActionUpdateSchedule       = "update_schedule"
+	AuditActionDeleteSchedule       = "delete_schedule"
+	AuditActionScheduleActivated    = "schedule_activated"
+	AuditActionScheduleDeactivated  = "schedule_deactivated"
+	AuditActionExpireRule           = "expire_rule"
+	AuditActionCreateJITPolicy      = "create_jit_policy"
+	AuditActionUpdateJITPolicy      = "update_jit_policy"
+	AuditActionDeleteJITPolicy      = "delete_jit_policy"
+	AuditActionRequestJITAccess     = "request_jit_access"
+	AuditActionGrantJITAccess       = "grant_jit_access"
+	AuditActionDenyJITAccess        = "deny_jit_access"
+	AuditActionRevokeJITAccess      = "revoke_jit_access"
+	AuditActionCreateKnockGate      = "create_knock_gate"
+	AuditActionUpdateKnockGate      = "update_knock_gate"
+	AuditActionDeleteKnockGate      = "delete_knock_gate"
+	AuditActionKnockOpened          = "knock_opened"
+	AuditActionCreateThreatFeed     = "create_threat_feed"
+	AuditActionUpdateThreatFeed     = "update_threat_feed"
+	AuditActionDeleteThreatFeed     = "delete_threat_feed"
+	AuditActionThreatFeedRefreshed  = "threat_feed_refreshed"
+	AuditActionCreateJail           = "create_jail"
+	AuditActionUpdateJail           = "update_jail"
+	AuditActionDeleteJail           = "delete_jail"
+	AuditActionJailBan              = "jail_ban"
+	AuditActionJailUnban            = "jail_unban"
+	AuditActionPortScanBan          = "portscan_ban"
+	AuditActionPortScanUnban        = "portscan_unban"
+	AuditActionCreateHoneypot       = "create_honeypot"
+	AuditActionUpdateHoneypot       = "update_honeypot"
+	AuditActionDeleteHoneypot       = "delete_honeypot"
+	AuditActionHoneypotBan          = "honeypot_ban"
+	AuditActionHoneypotUnban        = "honeypot_unban"
 )
 
 // --- Pagination ---
@@ -79,6 +127,110 @@ const (
 	InviteTokenBytes  = 32
 )
 
+// --- Rule Expiry ---
+const (
+	RuleExpiryCheckSeconds   = 30 // how often the expiry worker looks for expired rules
+	RuleExpiryWarningMinutes = 10 // owners are warned this long before a rule expires
+)
+
+// --- Just-in-Time Access ---
+const (
+	JITStatusPending = "pending"
+	JITStatusActive  = "active"
+	JITStatusDenied  = "denied"
+	JITStatusExpired = "expired"
+	JITStatusRevoked = "revoked"
+
+	JITMaxJustificationLength = 500
+)
+
+// --- Port Knocking ---
+const (
+	KnockMinSteps             = 3
+	KnockMaxSteps             = 10
+	KnockDefaultWindowSeconds = 10
+	KnockMaxWindowSeconds     = 60 // knocks older than this are forgotten
+	KnockDefaultOpenSeconds   = 300
+	KnockMaxOpenSeconds       = 86400
+	KnockMaxTrackedSources    = 10000 // bounds memory under a port scan
+)
+
+// --- FQDN Rules ---
+const (
+	FQDNCheckSeconds  = 5    // how often the resolver looks for hostnames due for re-resolution
+	FQDNMinTTLSeconds = 10   // shorter TTLs are raised to this to bound query load
+	FQDNMaxTTLSeconds = 3600 // longer TTLs are lowered so changes are still noticed
+	FQDNRetrySeconds  = 30   // wait after a failed lookup
+	FQDNGraceSeconds  = 600  // addresses dropped from DNS stay allowed this long
+)
+
+// --- GeoIP ---
+const (
+	GeoIPCheckMinutes = 60 // how often the database file is checked for updates
+)
+
+// --- Threat Feeds ---
+const (
+	FeedFormatPlain = "plain" // one address per line
+	FeedFormatCIDR  = "cidr"  // one address or network per line
+	FeedFormatCSV   = "csv"   // address or network in a chosen column
+
+	FeedCheckSeconds          = 60 // how often the fetcher looks for feeds due for a refresh
+	FeedDefaultRefreshMinutes = 60
+	FeedMinRefreshMinutes     = 5
+	FeedMaxRefreshMinutes     = 10080 // one week
+	FeedFetchTimeoutSeconds   = 60
+	FeedMaxBytes              = 64 << 20 // larger downloads are rejected
+	FeedMaxEntries            = 500000
+	FeedMinPrefixLength       = 8 // broader networks are skipped so a bad feed cannot block everything
+)
+
+// --- Jails ---
+const (
+	JailLogFormatPlain   = "plain"   // one log line per line, e.g. auth.log
+	JailLogFormatJournal = "journal" // systemd journal export format (journalctl -o export)
+
+	JailPollMillis         = 1000 // how often log files are checked for new lines
+	JailSweepSeconds       = 10   // how often expired bans are lifted
+	JailDefaultMaxFailures = 5
+	JailDefaultFindSeconds = 600
+	JailDefaultBanSeconds  = 3600
+	JailMaxFindSeconds     = 86400
+	JailMaxBanSeconds      = 30 * 86400
+	JailMaxFilters         = 20
+	JailMaxTrackedSources  = 10000   // per jail; bounds memory under a distributed attack
+	JailMaxLineBytes       = 16384   // longer lines are cut
+	JailMaxReadBytes       = 4 << 20 // read per poll, so a burst cannot stall other jails
+)
+
+// --- Port-Scan Detection ---
+const (
+	DetectorPortScan = "portscan" // detector name on blocked IPs and of its kernel set
+
+	ScanKindVertical   = "vertical_scan"   // many ports on one address
+	ScanKindHorizontal = "horizontal_scan" // one port on many addresses
+	ScanKindSYNFlood   = "syn_flood"       // many SYNs, none answered by an ACK
+
+	ScanSweepSeconds       = 10    // how often idle sources are forgotten and expired blocks lifted
+	ScanMaxTrackedSources  = 10000 // bounds memory under a distributed scan
+	ScanMaxProbesPerSource = 1024
+	ScanEphemeralPortStart = 32768 // UDP packets to ports from here on are taken for replies, not probes
+)
+
+// --- Honeypots ---
+const (
+	DetectorHoneypot  = "honeypot" // detector name on blocked IPs and of its kernel set
+	AlertKindHoneypot = "honeypot" // kind of the alert a touched decoy raises
+
+	HoneypotModeListener = "listener" // an in-process socket; TCP touches need a full handshake
+	HoneypotModeNFLOG    = "nflog"    // the traffic stream; sees touches even of filtered ports
+
+	HoneypotDefaultBlockSeconds = 86400
+	HoneypotMinBlockSeconds     = 60
+	HoneypotMaxBlockSeconds     = 30 * 86400
+	HoneypotSweepSeconds        = 10 // how often expired blocks are lifted
+)
+
 // --- OpenFGA ---
 const (
 	FGATypeUser          = "user"
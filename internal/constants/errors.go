@@ -88,6 +88,18 @@ var (
 	ErrSecurityGroupNotFound = &AppError{Status: http.StatusNotFound, Code: "SECURITY_GROUP_NOT_FOUND", Message: "security group not found"}
 	ErrInvitationNotFound    = &AppError{Status: http.StatusNotFound, Code: "INVITATION_NOT_FOUND", Message: "invitation not found or expired"}
 	ErrPortNotFound          = &AppError{Status: http.StatusNotFound, Code: "PORT_NOT_FOUND", Message: "immutable port not found"}
+	ErrRevisionNotFound      = &AppError{Status: http.StatusNotFound, Code: "REVISION_NOT_FOUND", Message: "security group revision not found"}
+	ErrAddressObjectNotFound = &AppError{Status: http.StatusNotFound, Code: "ADDRESS_OBJECT_NOT_FOUND", Message: "address object not found"}
+	ErrServiceObjectNotFound = &AppError{Status: http.StatusNotFound, Code: "SERVICE_OBJECT_NOT_FOUND", Message: "service object not found"}
+	ErrTemplateNotFound      = &AppError{Status: http.StatusNotFound, Code: "TEMPLATE_NOT_FOUND", Message: "security group template not found"}
+	ErrNATRuleNotFound       = &AppError{Status: http.StatusNotFound, Code: "NAT_RULE_NOT_FOUND", Message: "nat rule not found"}
+	ErrScheduleNotFound      = &AppError{Status: http.StatusNotFound, Code: "SCHEDULE_NOT_FOUND", Message: "schedule not found"}
+	ErrJITPolicyNotFound     = &AppError{Status: http.StatusNotFound, Code: "JIT_POLICY_NOT_FOUND", Message: "no just-in-time access policy for this port"}
+	ErrJITGrantNotFound      = &AppError{Status: http.StatusNotFound, Code: "JIT_GRANT_NOT_FOUND", Message: "just-in-time access request not found"}
+	ErrKnockGateNotFound     = &AppError{Status: http.StatusNotFound, Code: "KNOCK_GATE_NOT_FOUND", Message: "knock gate not found"}
+	ErrThreatFeedNotFound    = &AppError{Status: http.StatusNotFound, Code: "THREAT_FEED_NOT_FOUND", Message: "threat feed not found"}
+	ErrJailNotFound          = &AppError{Status: http.StatusNotFound, Code: "JAIL_NOT_FOUND", Message: "jail not found"}
+	ErrHoneypotNotFound      = &AppError{Status: http.StatusNotFound, Code: "HONEYPOT_NOT_FOUND", Message: "honeypot not found"}
 )
 
 // --- 409 Conflict ---
@@ -96,6 +108,12 @@ var (
 	ErrUserAlreadyExists    = &AppError{Status: http.StatusConflict, Code: "USER_ALREADY_EXISTS", Message: "user with this email already exists"}
 	ErrInvitationAccepted   = &AppError{Status: http.StatusConflict, Code: "INVITATION_ALREADY_ACCEPTED", Message: "invitation already accepted"}
 	ErrPortAlreadyImmutable = &AppError{Status: http.StatusConflict, Code: "PORT_ALREADY_IMMUTABLE", Message: "port is already in the immutable list"}
+	ErrReferenceCycle       = &AppError{Status: http.StatusConflict, Code: "REFERENCE_CYCLE", Message: "security group reference would create a cycle"}
+	ErrGroupReferenced      = &AppError{Status: http.StatusConflict, Code: "SECURITY_GROUP_REFERENCED", Message: "security group is referenced by rules in other groups"}
+	ErrObjectReferenced     = &AppError{Status: http.StatusConflict, Code: "OBJECT_REFERENCED", Message: "object is still referenced by firewall rules"}
+	ErrScheduleReferenced   = &AppError{Status: http.StatusConflict, Code: "SCHEDULE_REFERENCED", Message: "schedule is still used by rules or applied security groups"}
+	ErrJITGrantState        = &AppError{Status: http.StatusConflict, Code: "JIT_GRANT_STATE", Message: "just-in-time access request is not in a state that allows this"}
+	ErrHoneypotPortInUse    = &AppError{Status: http.StatusConflict, Code: "HONEYPOT_PORT_IN_USE", Message: "port is in use and cannot be a decoy"}
 )
 
 // --- 500 Internal Server Error ---
@@ -107,4 +125,15 @@ var (
 	ErrTokenGeneration  = &AppError{Status: http.StatusInternalServerError, Code: "TOKEN_GENERATION_ERROR", Message: "failed to generate token"}
 	ErrFGAFailure       = &AppError{Status: http.StatusInternalServerError, Code: "FGA_ERROR", Message: "authorization service error"}
 	ErrMigrationFailure = &AppError{Status: http.StatusInternalServerError, Code: "MIGRATION_ERROR", Message: "database migration failed"}
+	ErrRevisionFailure  = &AppError{Status: http.StatusInternalServerError, Code: "REVISION_ERROR", Message: "revision could not be recorded; the change was not saved"}
+)
+
+// --- 502 Bad Gateway ---
+var (
+	ErrThreatFeedFetch = &AppError{Status: http.StatusBadGateway, Code: "THREAT_FEED_FETCH_FAILED", Message: "threat feed could not be fetched"}
+)
+
+// --- 503 Service Unavailable ---
+var (
+	ErrGeoIPUnavailable = &AppError{Status: http.StatusServiceUnavailable, Code: "GEOIP_UNAVAILABLE", Message: "no GeoIP database is loaded; set GEOIP_DATABASE"}
 )
@@ -0,0 +1,102 @@
+// Package convert turns persisted firewall rules, and the rules implied by
+// other stored objects, into their syscall-layer form. It is shared by the API handlers and the startup restore so a new
+// rule field only has to be mapped in one place.
+package convert
+
+import (
+	"github.com/enjoys-in/secureflow/internal/constants"
+	"github.com/enjoys-in/secureflow/internal/db"
+	"github.com/enjoys-in/secureflow/internal/firewall"
+)
+
+// Rule converts a persisted rule into its syscall-layer form.
+func Rule(r db.FirewallRule) firewall.Rule {
+	return firewall.Rule{
+		ID:            r.ID,
+		Direction:     r.Direction,
+		Protocol:      r.Protocol,
+		Port:          r.Port,
+		PortEnd:       r.PortRangeEnd,
+		SourceCIDR:    r.SourceCIDR,
+		DestCIDR:      r.DestCIDR,
+		SourceGroupID: r.SourceGroupID,
+		DestGroupID:   r.DestGroupID,
+		Action:        r.Action,
+		GroupID:       r.SecurityGroupID,
+
+		SourceAddressID: r.SourceAddressID,
+		DestAddressID:   r.DestAddressID,
+		SourceFQDN:      r.SourceFQDN,
+		DestFQDN:        r.DestFQDN,
+		SourceCountries: r.SourceCountries,
+		DestCountries:   r.DestCountries,
+		ServiceID:       r.ServiceID,
+		RateLimit:       RateLimit(r.RateLimit),
+		ConnLimit:       ConnLimit(r.ConnLimit),
+		Ports:           PortRanges(r.Ports),
+		SynProxy:        r.SynProxy,
+		InInterface:     r.InInterface,
+		OutInterface:    r.OutInterface,
+		SourcePort:      r.SourcePort,
+		SourcePortEnd:   r.SourcePortEnd,
+		ICMPType:        r.ICMPType,
+		ICMPCode:        r.ICMPCode,
+		OwnerUser:       r.OwnerUser,
+		OwnerGroup:      r.OwnerGroup,
+		Cgroup:          r.Cgroup,
+		ScheduleID:      r.ScheduleID,
+	}
+}
+
+// Rules converts a slice of persisted rules.
+func Rules(rules []db.FirewallRule) []firewall.Rule {
+	out := make([]firewall.Rule, 0, len(rules))
+	for _, r := range rules {
+		out = append(out, Rule(r))
+	}
+	return out
+}
+
+// RateLimit converts a persisted rate limit; nil stays nil.
+func RateLimit(rl *db.RateLimit) *firewall.RateLimit {
+	if rl == nil {
+		return nil
+	}
+	return &firewall.RateLimit{
+		Rate:      rl.Rate,
+		Unit:      rl.Unit,
+		Burst:     rl.Burst,
+		PerSource: rl.PerSource,
+		Mode:      rl.Mode,
+	}
+}
+
+// ConnLimit converts a persisted connection limit; nil stays nil.
+func ConnLimit(cl *db.ConnLimit) *firewall.ConnLimit {
+	if cl == nil {
+		return nil
+	}
+	return &firewall.ConnLimit{Max: cl.Max, Mask: cl.Mask}
+}
+
+// PortRanges converts persisted service ports into their syscall-layer form.
+func PortRanges(ports []db.ServicePort) []firewall.PortRange {
+	out := make([]firewall.PortRange, 0, len(ports))
+	for _, p := range ports {
+		out = append(out, firewall.PortRange{Port: p.Port, End: p.PortEnd})
+	}
+	return out
+}
+
+// JITPolicyRule returns the rule that closes a just-in-time policy's port to
+// everyone without a grant. It shares the policy's ID; grants are inserted
+// ahead of it.
+func JITPolicyRule(p db.JITPolicy) firewall.Rule {
+	return firewall.Rule{
+		ID:        p.ID,
+		Direction: constants.DirectionInbound,
+		Protocol:  p.Protocol,
+		Port:      p.Port,
+		Action:    constants.ActionDrop,
+	}
+}
@@ -18,6 +18,7 @@ type Server struct {
 	Name        string    `json:"name"`
 	IPAddress   string    `json:"ip_address"`
 	Description string    `json:"description"`
+	IsLocal     bool      `json:"is_local"` // the host this instance manages
 	CreatedBy   string    `json:"created_by"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
@@ -43,21 +44,177 @@ type SecurityGroupWithDetails struct {
 	CreatedByEmail string `json:"created_by_email"`
 }
 
+// SecurityGroupRevision is an immutable snapshot of a security group and its
+// rules, recorded every time the group changes.
+type SecurityGroupRevision struct {
+	ID              string         `json:"id"`
+	SecurityGroupID string         `json:"security_group_id"`
+	Revision        int            `json:"revision"`
+	Name            string         `json:"name"`
+	Description     string         `json:"description"`
+	Rules           []FirewallRule `json:"rules"`
+	ChangeSummary   string         `json:"change_summary"`
+	CreatedBy       string         `json:"created_by"`
+	CreatedAt       time.Time      `json:"created_at"`
+}
+
 // FirewallRule represents a single firewall rule.
 type FirewallRule struct {
-	ID              string    `json:"id"`
-	SecurityGroupID string    `json:"security_group_id"`
-	Direction       string    `json:"direction"` // "inbound" or "outbound"
-	Protocol        string    `json:"protocol"`  // "tcp", "udp", "icmp", "all"
-	Port            int       `json:"port"`
-	PortRangeEnd    int       `json:"port_range_end,omitempty"` // 0 means single port
-	SourceCIDR      string    `json:"source_cidr"`              // e.g., "0.0.0.0/0"
-	DestCIDR        string    `json:"dest_cidr,omitempty"`
-	Action          string    `json:"action"` // "ACCEPT", "DROP", "REJECT"
-	Description     string    `json:"description,omitempty"`
-	IsImmutable     bool      `json:"is_immutable"`
-	CreatedBy       string    `json:"created_by"`
-	CreatedAt       time.Time `json:"created_at"`
+	ID              string        `json:"id"`
+	SecurityGroupID string        `json:"security_group_id"`
+	Direction       string        `json:"direction"` // "inbound" or "outbound"
+	Protocol        string        `json:"protocol"`  // "tcp", "udp", "icmp", "all"
+	Port            int           `json:"port"`
+	PortRangeEnd    int           `json:"port_range_end,omitempty"` // 0 means single port
+	Ports           []ServicePort `json:"ports,omitempty"`          // destination port list, instead of Port/PortRangeEnd
+	SourceCIDR      string        `json:"source_cidr"`              // e.g., "0.0.0.0/0"
+	DestCIDR        string        `json:"dest_cidr,omitempty"`
+	SourceGroupID   string        `json:"source_group_id,omitempty"` // match members of this group instead of SourceCIDR
+	DestGroupID     string        `json:"dest_group_id,omitempty"`   // match members of this group instead of DestCIDR
+	SourceAddressID string        `json:"source_address_id,omitempty"`
+	DestAddressID   string        `json:"dest_address_id,omitempty"`
+	SourceFQDN      string        `json:"source_fqdn,omitempty"` // match the addresses this hostname resolves to
+	DestFQDN        string        `json:"dest_fqdn,omitempty"`
+	SourceCountries []string      `json:"source_countries,omitempty"` // ISO country codes, matched via the GeoIP database
+	DestCountries   []string      `json:"dest_countries,omitempty"`
+	ServiceID       string        `json:"service_id,omitempty"`    // protocol and ports come from this service object
+	Action          string        `json:"action"`                  // "ACCEPT", "DROP", "REJECT"
+	RateLimit       *RateLimit    `json:"rate_limit,omitempty"`    // act only on traffic above this rate
+	ConnLimit       *ConnLimit    `json:"conn_limit,omitempty"`    // act only on sources over this many connections
+	SynProxy        bool          `json:"synproxy"`                // SYN flood protection via SYNPROXY (inbound TCP ACCEPT only)
+	InInterface     string        `json:"in_interface,omitempty"`  // inbound only; "eth*" matches by prefix
+	OutInterface    string        `json:"out_interface,omitempty"` // outbound only
+	SourcePort      int           `json:"source_port,omitempty"`   // tcp/udp only
+	SourcePortEnd   int           `json:"source_port_end,omitempty"`
+	ICMPType        *int          `json:"icmp_type,omitempty"`   // icmp only; nil matches any type
+	ICMPCode        *int          `json:"icmp_code,omitempty"`   // requires ICMPType
+	OwnerUser       string        `json:"owner_user,omitempty"`  // outbound only; user name or UID
+	OwnerGroup      string        `json:"owner_group,omitempty"` // outbound only; group name or GID
+	Cgroup          string        `json:"cgroup,omitempty"`      // outbound only; systemd unit or cgroup v2 path
+	ScheduleID      string        `json:"schedule_id,omitempty"` // installed only while this schedule is active
+	ExpiresAt       *time.Time    `json:"expires_at,omitempty"`  // removed automatically once this passes
+	Description     string        `json:"description,omitempty"`
+	IsImmutable     bool          `json:"is_immutable"`
+	CreatedBy       string        `json:"created_by"`
+	CreatedAt       time.Time     `json:"created_at"`
+}
+
+// RateLimit is a packet or new-connection rate, global or per source address.
+type RateLimit struct {
+	Rate      int    `json:"rate"`
+	Unit      string `json:"unit,omitempty"` // "second", "minute", "hour", "day"
+	Burst     int    `json:"burst,omitempty"`
+	PerSource bool   `json:"per_source,omitempty"`
+	Mode      string `json:"mode,omitempty"` // "packets" or "connections"
+}
+
+// ConnLimit caps concurrent connections per source address, or per source
+// network when Mask is below 32.
+type ConnLimit struct {
+	Max  int `json:"max"`
+	Mask int `json:"mask,omitempty"` // source prefix length sharing a count; 0 means 32
+}
+
+// AddressObject is a named, reusable list of IPs/CIDRs.
+type AddressObject struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Addresses   []string  `json:"addresses"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ServiceObject is a named protocol plus a list of destination ports/ranges.
+type ServiceObject struct {
+	ID          string        `json:"id"`
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Protocol    string        `json:"protocol"` // "tcp" or "udp"
+	Ports       []ServicePort `json:"ports"`
+	CreatedBy   string        `json:"created_by"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+}
+
+// ServicePort is a single port or an inclusive range within a service object.
+type ServicePort struct {
+	Port    int `json:"port"`
+	PortEnd int `json:"port_end,omitempty"` // 0 means single port
+}
+
+// Schedule is a set of recurring time windows in a timezone. Rules and
+// security group applications limited to a schedule are only installed while
+// one of its windows is open.
+type Schedule struct {
+	ID          string           `json:"id"`
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Timezone    string           `json:"timezone"` // IANA name, e.g. "Europe/Berlin"
+	Windows     []ScheduleWindow `json:"windows"`
+	Active      bool             `json:"active"` // state as of the scheduler's last evaluation
+	CreatedBy   string           `json:"created_by"`
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+}
+
+// ScheduleWindow opens at every minute matching Cron and stays open for
+// Duration, e.g. {"0 9 * * mon-fri", "8h"} for office hours.
+type ScheduleWindow struct {
+	Cron     string `json:"cron"`     // minute hour day-of-month month day-of-week
+	Duration string `json:"duration"` // Go duration, 1m to 168h
+}
+
+// JITPolicy makes a port available for just-in-time access: users may open
+// it to their own address for up to MaxMinutes for their role.
+type JITPolicy struct {
+	ID               string         `json:"id"`
+	Port             int            `json:"port"`
+	Protocol         string         `json:"protocol"` // "tcp" or "udp"
+	Description      string         `json:"description"`
+	MaxMinutes       map[string]int `json:"max_minutes"` // role -> longest grant; unlisted roles may not request
+	RequiresApproval bool           `json:"requires_approval"`
+	CreatedBy        string         `json:"created_by"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+}
+
+// JITGrant is a request for just-in-time access and, once granted, the
+// temporary rule that serves it.
+type JITGrant struct {
+	ID            string     `json:"id"`
+	PolicyID      string     `json:"policy_id"`
+	UserID        string     `json:"user_id"`
+	SourceIP      string     `json:"source_ip"`
+	Port          int        `json:"port"`
+	Protocol      string     `json:"protocol"`
+	Minutes       int        `json:"minutes"`
+	Justification string     `json:"justification"`
+	Status        string     `json:"status"` // "pending", "active", "denied", "expired", "revoked"
+	RuleID        string     `json:"rule_id,omitempty"`
+	DecidedBy     string     `json:"decided_by,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// KnockGate protects a port with a port-knocking sequence. The sequence is
+// stored only as a salted hash and never returned.
+type KnockGate struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	Description    string    `json:"description"`
+	Port           int       `json:"port"`
+	Protocol       string    `json:"protocol"` // "tcp" or "udp"
+	SequenceHash   string    `json:"-"`
+	SequenceSalt   string    `json:"-"`
+	SequenceLength int       `json:"sequence_length"`
+	WindowSeconds  int       `json:"window_seconds"` // the whole sequence must arrive within this
+	OpenSeconds    int       `json:"open_seconds"`   // how long a knocking source stays allowed
+	CreatedBy      string    `json:"created_by"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
 }
 
 // FirewallRuleWithDetails extends FirewallRule with security group and creator info.
@@ -68,14 +225,44 @@ type FirewallRuleWithDetails struct {
 	CreatedByEmail    string `json:"created_by_email"`
 }
 
+// NATRule is an address translation rule installed on a server: a DNAT
+// port forward, a fixed-address SNAT, or masquerade on an interface.
+type NATRule struct {
+	ID           string    `json:"id"`
+	ServerID     string    `json:"server_id"`
+	Type         string    `json:"type"` // "dnat", "snat", "masquerade"
+	Interface    string    `json:"interface"`
+	Protocol     string    `json:"protocol"`
+	SourceCIDR   string    `json:"source_cidr"`
+	DestCIDR     string    `json:"dest_cidr"`
+	Port         int       `json:"port"`
+	PortRangeEnd int       `json:"port_range_end"`
+	ToAddress    string    `json:"to_address"`
+	ToPort       int       `json:"to_port"`
+	Description  string    `json:"description"`
+	CreatedBy    string    `json:"created_by"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
 // ServerSecurityGroup links a security group to a server.
 type ServerSecurityGroup struct {
 	ServerID        string    `json:"server_id"`
 	SecurityGroupID string    `json:"security_group_id"`
+	ScheduleID      string    `json:"schedule_id,omitempty"` // the group's rules are live only while it is active
 	AppliedAt       time.Time `json:"applied_at"`
 	AppliedBy       string    `json:"applied_by"`
 }
 
+// AppliedSecurityGroup is a security group currently active on a server.
+type AppliedSecurityGroup struct {
+	SecurityGroup
+	ScheduleID    string    `json:"schedule_id,omitempty"`
+	AppliedAt     time.Time `json:"applied_at"`
+	AppliedBy     string    `json:"applied_by"`
+	AppliedByName string    `json:"applied_by_name"`
+}
+
 // AuditLog records every significant action.
 type AuditLog struct {
 	ID        string    `json:"id"`
@@ -135,6 +322,10 @@ type BlockedIP struct {
 	BlockedAt   time.Time  `json:"blocked_at"`
 	UnblockedAt *time.Time `json:"unblocked_at,omitempty"`
 	CreatedAt   time.Time  `json:"created_at"`
+	FeedID      string     `json:"feed_id,omitempty"`    // threat feed the entry came from, empty for manual blocks
+	JailID      string     `json:"jail_id,omitempty"`    // jail that banned the address, empty for manual blocks
+	Detector    string     `json:"detector,omitempty"`   // traffic detector that blocked the address, e.g. "portscan"
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"` // when a jail or detector ban lifts
 }
 
 // BlockedIPWithUser extends BlockedIP with user details.
@@ -145,3 +336,69 @@ type BlockedIPWithUser struct {
 	UnblockedByName  string `json:"unblocked_by_name,omitempty"`
 	UnblockedByEmail string `json:"unblocked_by_email,omitempty"`
 }
+
+// FQDNResolution records what a rule hostname resolved to whenever the
+// answer changed.
+type FQDNResolution struct {
+	ID         string    `json:"id"`
+	Hostname   string    `json:"hostname"`
+	Addresses  []string  `json:"addresses"`
+	TTLSeconds int       `json:"ttl_seconds"`
+	ResolvedAt time.Time `json:"resolved_at"`
+}
+
+// ThreatFeed is a blocklist fetched periodically from a URL or local file.
+// Its entries are stored as blocked IPs and enforced through one kernel set.
+type ThreatFeed struct {
+	ID             string     `json:"id"`
+	Name           string     `json:"name"`
+	Source         string     `json:"source"`     // http(s) URL or local file path
+	Format         string     `json:"format"`     // "plain", "cidr" or "csv"
+	CSVColumn      int        `json:"csv_column"` // zero-based column holding the address in csv feeds
+	RefreshMinutes int        `json:"refresh_minutes"`
+	Action         string     `json:"action"` // "DROP" or "REJECT"
+	Enabled        bool       `json:"enabled"`
+	EntryCount     int        `json:"entry_count"`   // entries in the last successful fetch
+	SkippedCount   int        `json:"skipped_count"` // unparsable or IPv6 lines in the last successful fetch
+	LastAdded      int        `json:"last_added"`
+	LastRemoved    int        `json:"last_removed"`
+	LastFetchedAt  *time.Time `json:"last_fetched_at,omitempty"`
+	LastSuccessAt  *time.Time `json:"last_success_at,omitempty"`
+	LastError      string     `json:"last_error"` // empty when the last fetch succeeded
+	CreatedBy      string     `json:"created_by"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// Jail bans sources whose failures, found by matching a log file against
+// regex filters, exceed MaxFailures within FindSeconds.
+type Jail struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	LogPath     string    `json:"log_path"`
+	LogFormat   string    `json:"log_format"`   // "plain" or "journal" (journalctl -o export)
+	Filters     []string  `json:"filters"`      // regexes with a <HOST> placeholder for the source address
+	IgnoreCIDRs []string  `json:"ignore_cidrs"` // sources that are never banned
+	MaxFailures int       `json:"max_failures"`
+	FindSeconds int       `json:"find_seconds"` // window failures are counted in
+	BanSeconds  int       `json:"ban_seconds"`  // how long a ban lasts
+	Action      string    `json:"action"`       // "DROP" or "REJECT"
+	Enabled     bool      `json:"enabled"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Honeypot is a decoy port. Any source that touches it is blocked.
+type Honeypot struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Protocol     string    `json:"protocol"` // "tcp" or "udp"
+	Port         int       `json:"port"`
+	Mode         string    `json:"mode"`          // "listener" or "nflog"
+	BlockSeconds int       `json:"block_seconds"` // how long a toucher stays blocked
+	Enabled      bool      `json:"enabled"`
+	CreatedBy    string    `json:"created_by"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
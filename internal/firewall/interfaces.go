@@ -0,0 +1,64 @@
+package firewall
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ifNameMax is the longest interface name the kernel accepts (IFNAMSIZ - 1).
+const ifNameMax = 15
+
+// ifWildcard ends an interface name that matches by prefix, e.g. "eth*".
+const ifWildcard = "*"
+
+// ValidateInterface checks a network interface name; empty means any. A
+// trailing "*" matches every interface whose name starts with the rest.
+func ValidateInterface(name string) error {
+	if name == "" {
+		return nil
+	}
+	base := strings.TrimSuffix(name, ifWildcard)
+	if base == "" || len(base) > ifNameMax || strings.ContainsAny(base, " /\t\n*") {
+		return fmt.Errorf("invalid interface: %q", name)
+	}
+	return nil
+}
+
+// ValidateRuleInterfaces checks a rule's interface matches. Inbound rules
+// only see the incoming interface and outbound rules the outgoing one.
+func ValidateRuleInterfaces(rule Rule) error {
+	if err := ValidateInterface(rule.InInterface); err != nil {
+		return err
+	}
+	if err := ValidateInterface(rule.OutInterface); err != nil {
+		return err
+	}
+	if rule.Direction == "inbound" && rule.OutInterface != "" {
+		return fmt.Errorf("out_interface is only supported on outbound rules")
+	}
+	if rule.Direction == "outbound" && rule.InInterface != "" {
+		return fmt.Errorf("in_interface is only supported on inbound rules")
+	}
+	return nil
+}
+
+// CheckHostInterfaces returns an error naming the first interface that does
+// not exist on this host. Wildcards are not checked, as they usually cover
+// interfaces created later (e.g. "veth*").
+func CheckHostInterfaces(names ...string) error {
+	for _, name := range names {
+		if name == "" || isWildcardInterface(name) {
+			continue
+		}
+		if _, err := net.InterfaceByName(name); err != nil {
+			return fmt.Errorf("interface %q does not exist on this host", name)
+		}
+	}
+	return nil
+}
+
+// isWildcardInterface reports whether an interface name matches by prefix.
+func isWildcardInterface(name string) bool {
+	return strings.HasSuffix(name, ifWildcard)
+}
@@ -3,8 +3,12 @@
 package firewall
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"os/exec"
 	"strconv"
+	"strings"
 
 	"github.com/coreos/go-iptables/iptables"
 
@@ -15,10 +19,15 @@ import (
 // All managed rules are placed in these chains to avoid polluting
 // the built-in INPUT / OUTPUT chains.
 const (
-	iptFilterTable = "filter"
-	iptInputChain  = "FM_INPUT"
-	iptOutputChain = "FM_OUTPUT"
-	iptCommentTag  = "fm:" // prefix used in --comment to tag rules
+	iptFilterTable  = "filter"
+	iptRawTable     = "raw"
+	iptNATTable     = "nat"
+	iptInputChain   = "FM_INPUT"
+	iptOutputChain  = "FM_OUTPUT"
+	iptRawChain     = "FM_PREROUTING"      // raw table, for SYNPROXY notrack rules
+	iptNATPreChain  = "FM_NAT_PREROUTING"  // nat table, for DNAT rules
+	iptNATPostChain = "FM_NAT_POSTROUTING" // nat table, for SNAT and masquerade rules
+	iptCommentTag   = "fm:"                // prefix used in --comment to tag rules
 )
 
 // IPTablesBackend implements the Backend interface via the iptables userspace
@@ -33,9 +42,11 @@ const (
 // Jump rules from the built-in INPUT/OUTPUT chains route traffic through
 // our chains first.
 type IPTablesBackend struct {
-	logger *logger.Logger
-	ipt    *iptables.IPTables
-	rules  map[string]Rule // track managed rules by ID
+	logger   *logger.Logger
+	ipt      *iptables.IPTables
+	rules    map[string]Rule    // track managed rules by ID
+	natRules map[string]NATRule // track managed NAT rules by ID
+	logGroup uint16             // NFLOG group for limit hits; 0 until SetupNFLOG
 }
 
 // NewIPTablesBackend creates and initialises the iptables backend.
@@ -83,9 +94,10 @@ func NewIPTablesBackend(log *logger.Logger) (*IPTablesBackend, error) {
 	)
 
 	return &IPTablesBackend{
-		logger: log,
-		ipt:    ipt,
-		rules:  make(map[string]Rule),
+		logger:   log,
+		ipt:      ipt,
+		rules:    make(map[string]Rule),
+		natRules: make(map[string]NATRule),
 	}, nil
 }
 
@@ -101,15 +113,108 @@ func chainFor(direction string) string {
 // Each rule is tagged with "-m comment --comment fm:<id>" so it can be
 // unambiguously identified during deletion.
 func ruleSpec(rule Rule) []string {
+	spec := matchSpec(rule)
+
+	// Comment tag for identification
+	spec = append(spec, "-m", "comment", "--comment", iptCommentTag+rule.ID)
+
+	// Target / action
+	spec = append(spec, "-j", rule.Action)
+
+	return spec
+}
+
+// companionTag is the comment of a rule's companion, e.g. "fm:<id>:log".
+func companionTag(id, role string) string {
+	return iptCommentTag + id + ":" + role
+}
+
+// companionSpecs builds the rules installed directly in front of a rule in
+// its chain, each tagged "fm:<id>:<role>":
+//
+//   - log: sends connection limit hits to NFLOG, since iptables cannot log
+//     and act in one rule
+//   - synproxy: answers the untracked handshake for a SYN-protected port
+//   - invalid: drops what SYNPROXY leaves invalid (bad cookies, stray ACKs)
+func (b *IPTablesBackend) companionSpecs(rule Rule) [][]string {
+	var specs [][]string
+	if rule.ConnLimit != nil && b.logGroup != 0 {
+		spec := matchSpec(rule)
+		spec = append(spec, "-m", "comment", "--comment", companionTag(rule.ID, "log"))
+		spec = append(spec, "-j", "NFLOG",
+			"--nflog-group", strconv.Itoa(int(b.logGroup)),
+			"--nflog-prefix", hitPrefix(rule, HitConnLimit),
+		)
+		specs = append(specs, spec)
+	}
+	if rule.SynProxy {
+		spec := matchSpec(rule)
+		spec = append(spec, "-m", "conntrack", "--ctstate", "INVALID,UNTRACKED")
+		spec = append(spec, "-m", "comment", "--comment", companionTag(rule.ID, "synproxy"))
+		spec = append(spec, "-j", "SYNPROXY", "--sack-perm", "--timestamp",
+			"--wscale", strconv.Itoa(synproxyWscale),
+			"--mss", strconv.Itoa(synproxyMSS),
+		)
+		specs = append(specs, spec)
+
+		spec = matchSpec(rule)
+		spec = append(spec, "-m", "conntrack", "--ctstate", "INVALID")
+		spec = append(spec, "-m", "comment", "--comment", companionTag(rule.ID, "invalid"))
+		spec = append(spec, "-j", "DROP")
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+// notrackSpec builds the raw table rule that exempts a SYN-protected port's
+// handshakes from conntrack so they reach SYNPROXY untracked. It returns nil
+// for rules without SYN flood protection.
+func notrackSpec(rule Rule) []string {
+	if !rule.SynProxy {
+		return nil
+	}
+	spec := matchSpec(rule)
+	spec = append(spec, "--syn")
+	spec = append(spec, "-m", "comment", "--comment", companionTag(rule.ID, "notrack"))
+	spec = append(spec, "-j", "CT", "--notrack")
+	return spec
+}
+
+// matchSpec builds the match part of a rule's iptables arguments.
+func matchSpec(rule Rule) []string {
 	var spec []string
 
+	// Interfaces
+	if rule.InInterface != "" {
+		spec = append(spec, "-i", iptIfname(rule.InInterface))
+	}
+	if rule.OutInterface != "" {
+		spec = append(spec, "-o", iptIfname(rule.OutInterface))
+	}
+
+	// Socket owner and cgroup (outbound only)
+	if rule.UID != nil || rule.GID != nil {
+		spec = append(spec, "-m", "owner")
+		if rule.UID != nil {
+			spec = append(spec, "--uid-owner", strconv.FormatUint(uint64(*rule.UID), 10))
+		}
+		if rule.GID != nil {
+			spec = append(spec, "--gid-owner", strconv.FormatUint(uint64(*rule.GID), 10))
+		}
+	}
+	if rule.CgroupPath != "" {
+		spec = append(spec, "-m", "cgroup", "--path", rule.CgroupPath)
+	}
+
 	// Protocol
 	if rule.Protocol != "" && rule.Protocol != "all" {
 		spec = append(spec, "-p", rule.Protocol)
 	}
 
 	// Destination port (only meaningful for TCP / UDP)
-	if rule.Port > 0 && (rule.Protocol == "tcp" || rule.Protocol == "udp") {
+	if len(rule.Ports) > 0 && (rule.Protocol == "tcp" || rule.Protocol == "udp") {
+		spec = append(spec, "-m", "multiport", "--dports", multiportList(rule.Ports))
+	} else if rule.Port > 0 && (rule.Protocol == "tcp" || rule.Protocol == "udp") {
 		if rule.PortEnd > 0 && rule.PortEnd > rule.Port {
 			spec = append(spec, "--dport", fmt.Sprintf("%d:%d", rule.Port, rule.PortEnd))
 		} else {
@@ -117,6 +222,24 @@ func ruleSpec(rule Rule) []string {
 		}
 	}
 
+	// Source port (only meaningful for TCP / UDP)
+	if rule.SourcePort > 0 && (rule.Protocol == "tcp" || rule.Protocol == "udp") {
+		if rule.SourcePortEnd > rule.SourcePort {
+			spec = append(spec, "--sport", fmt.Sprintf("%d:%d", rule.SourcePort, rule.SourcePortEnd))
+		} else {
+			spec = append(spec, "--sport", strconv.Itoa(rule.SourcePort))
+		}
+	}
+
+	// ICMP type, optionally narrowed to one code ("8" or "3/4")
+	if rule.Protocol == "icmp" && rule.ICMPType != nil {
+		icmp := strconv.Itoa(*rule.ICMPType)
+		if rule.ICMPCode != nil {
+			icmp += "/" + strconv.Itoa(*rule.ICMPCode)
+		}
+		spec = append(spec, "--icmp-type", icmp)
+	}
+
 	// Source CIDR
 	if rule.SourceCIDR != "" && rule.SourceCIDR != "0.0.0.0/0" {
 		spec = append(spec, "-s", rule.SourceCIDR)
@@ -127,15 +250,72 @@ func ruleSpec(rule Rule) []string {
 		spec = append(spec, "-d", rule.DestCIDR)
 	}
 
-	// Comment tag for identification
-	spec = append(spec, "-m", "comment", "--comment", iptCommentTag+rule.ID)
+	// Referenced address sets (ipsets maintained by SyncSet)
+	if rule.SourceSet != "" {
+		spec = append(spec, "-m", "set", "--match-set", rule.SourceSet, "src")
+	}
+	if rule.DestSet != "" {
+		spec = append(spec, "-m", "set", "--match-set", rule.DestSet, "dst")
+	}
 
-	// Target / action
-	spec = append(spec, "-j", rule.Action)
+	// Rate limit: the rule only fires above the rate
+	if rl := rule.RateLimit; rl != nil {
+		if rl.mode() == RateModeConnections {
+			spec = append(spec, "-m", "conntrack", "--ctstate", "NEW")
+		}
+		spec = append(spec, "-m", "hashlimit",
+			"--hashlimit-above", fmt.Sprintf("%d/%s", rl.Rate, hashlimitUnits[rl.unit()]),
+			"--hashlimit-burst", strconv.Itoa(rl.burst()),
+			"--hashlimit-name", limitName(rule),
+		)
+		if rl.PerSource {
+			spec = append(spec, "--hashlimit-mode", "srcip")
+		}
+	}
+
+	// Connection limit: only new connections from sources over the cap
+	if cl := rule.ConnLimit; cl != nil {
+		spec = append(spec, "-m", "conntrack", "--ctstate", "NEW",
+			"-m", "connlimit",
+			"--connlimit-above", strconv.Itoa(cl.Max),
+			"--connlimit-mask", strconv.Itoa(cl.mask()),
+			"--connlimit-saddr",
+		)
+	}
 
 	return spec
 }
 
+// hashlimitUnits maps rate limit units to hashlimit's spelling.
+var hashlimitUnits = map[string]string{
+	"second": "sec",
+	"minute": "min",
+	"hour":   "hour",
+	"day":    "day",
+}
+
+// multiportList renders port ranges as a multiport argument, e.g. "80,443,8000:8100".
+func multiportList(ports []PortRange) string {
+	parts := make([]string, 0, len(ports))
+	for _, p := range mergePortRanges(ports) {
+		if p.End > p.Port {
+			parts = append(parts, fmt.Sprintf("%d:%d", p.Port, p.End))
+		} else {
+			parts = append(parts, strconv.Itoa(p.Port))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// iptIfname renders an interface name for -i/-o, where iptables spells the
+// prefix wildcard "+" (e.g. "eth*" becomes "eth+").
+func iptIfname(name string) string {
+	if isWildcardInterface(name) {
+		return strings.TrimSuffix(name, ifWildcard) + "+"
+	}
+	return name
+}
+
 // ListRules returns all managed rules.
 func (b *IPTablesBackend) ListRules() ([]Rule, error) {
 	out := make([]Rule, 0, len(b.rules))
@@ -150,10 +330,32 @@ func (b *IPTablesBackend) AddRule(rule Rule) error {
 	chain := chainFor(rule.Direction)
 	spec := ruleSpec(rule)
 
-	if err := b.ipt.AppendUnique(iptFilterTable, chain, spec...); err != nil {
+	for _, c := range b.companionSpecs(rule) {
+		if err := b.ipt.AppendUnique(iptFilterTable, chain, c...); err != nil {
+			b.deleteCompanions(chain, rule.ID)
+			return fmt.Errorf("iptables: add companion rule to %s: %w", chain, err)
+		}
+	}
+
+	// Priority rules are inserted at the head of the chain instead.
+	add := b.ipt.AppendUnique
+	if rule.Priority {
+		add = func(table, chain string, spec ...string) error {
+			return b.ipt.Insert(table, chain, 1, spec...)
+		}
+	}
+	if err := add(iptFilterTable, chain, spec...); err != nil {
+		b.deleteCompanions(chain, rule.ID)
 		return fmt.Errorf("iptables: add rule to %s: %w", chain, err)
 	}
 
+	// Untrack handshakes only once SYNPROXY is in place to answer them.
+	if err := b.addNotrack(rule); err != nil {
+		_ = b.ipt.Delete(iptFilterTable, chain, spec...)
+		b.deleteCompanions(chain, rule.ID)
+		return err
+	}
+
 	b.rules[rule.ID] = rule
 	b.logger.Info("iptables: rule added to kernel",
 		"chain", chain,
@@ -165,6 +367,182 @@ func (b *IPTablesBackend) AddRule(rule Rule) error {
 	return nil
 }
 
+// ReplaceRule rewrites a managed rule in place using its chain position.
+// When the direction changes the rule moves chains, so the new rule is
+// appended before the old one is removed to avoid an unprotected gap.
+func (b *IPTablesBackend) ReplaceRule(rule Rule) error {
+	old, ok := b.rules[rule.ID]
+	if !ok {
+		return fmt.Errorf("iptables: rule %s not found in tracker", rule.ID)
+	}
+
+	oldChain := chainFor(old.Direction)
+	newChain := chainFor(rule.Direction)
+
+	if oldChain == newChain {
+		pos, err := b.position(oldChain, iptCommentTag+rule.ID)
+		if err != nil {
+			return err
+		}
+		if err := b.ipt.Replace(iptFilterTable, oldChain, pos, ruleSpec(rule)...); err != nil {
+			return fmt.Errorf("iptables: replace rule in %s: %w", oldChain, err)
+		}
+		// Swap the companions in front of the rule.
+		b.deleteCompanions(oldChain, rule.ID)
+		if err := b.insertCompanions(oldChain, rule); err != nil {
+			return err
+		}
+	} else {
+		for _, c := range b.companionSpecs(rule) {
+			if err := b.ipt.Append(iptFilterTable, newChain, c...); err != nil {
+				return fmt.Errorf("iptables: add replacement companion rule to %s: %w", newChain, err)
+			}
+		}
+		if err := b.ipt.Append(iptFilterTable, newChain, ruleSpec(rule)...); err != nil {
+			return fmt.Errorf("iptables: add replacement rule to %s: %w", newChain, err)
+		}
+		if err := b.ipt.Delete(iptFilterTable, oldChain, ruleSpec(old)...); err != nil {
+			b.logger.Warn("iptables: kernel delete of replaced rule failed",
+				"rule_id", rule.ID, "chain", oldChain, "error", err,
+			)
+		}
+		b.deleteCompanions(oldChain, rule.ID)
+	}
+
+	b.deleteNotrack(old)
+	if err := b.addNotrack(rule); err != nil {
+		return err
+	}
+
+	b.rules[rule.ID] = rule
+	b.logger.Info("iptables: rule replaced in kernel",
+		"chain", newChain,
+		"rule_id", rule.ID,
+		"port", rule.Port,
+		"protocol", rule.Protocol,
+		"action", rule.Action,
+	)
+	return nil
+}
+
+// insertCompanions inserts a rule's companions directly in front of it.
+func (b *IPTablesBackend) insertCompanions(chain string, rule Rule) error {
+	specs := b.companionSpecs(rule)
+	if len(specs) == 0 {
+		return nil
+	}
+	pos, err := b.position(chain, iptCommentTag+rule.ID)
+	if err != nil {
+		return err
+	}
+	for i, c := range specs {
+		if err := b.ipt.Insert(iptFilterTable, chain, pos+i, c...); err != nil {
+			return fmt.Errorf("iptables: insert companion rule in %s: %w", chain, err)
+		}
+	}
+	return nil
+}
+
+// deleteCompanions removes every companion of rule id from chain. Failures
+// are logged; a leftover companion only repeats matches of a removed rule.
+func (b *IPTablesBackend) deleteCompanions(chain, id string) {
+	lines, err := b.ipt.List(iptFilterTable, chain)
+	if err != nil {
+		b.logger.Warn("iptables: list for companion delete failed", "chain", chain, "error", err)
+		return
+	}
+
+	tag := "--comment " + iptCommentTag + id + ":"
+	var positions []int
+	pos := 0
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "-A ") {
+			continue
+		}
+		pos++
+		if strings.Contains(line, tag) {
+			positions = append(positions, pos)
+		}
+	}
+
+	// Delete from the bottom so earlier positions stay valid.
+	for i := len(positions) - 1; i >= 0; i-- {
+		if err := b.ipt.Delete(iptFilterTable, chain, strconv.Itoa(positions[i])); err != nil {
+			b.logger.Warn("iptables: kernel delete of companion rule failed",
+				"rule_id", id, "chain", chain, "error", err,
+			)
+		}
+	}
+}
+
+// addNotrack installs a rule's raw table notrack rule, if it has one,
+// creating the raw chain and its PREROUTING jump on first use.
+func (b *IPTablesBackend) addNotrack(rule Rule) error {
+	spec := notrackSpec(rule)
+	if spec == nil {
+		return nil
+	}
+	ok, err := b.ipt.ChainExists(iptRawTable, iptRawChain)
+	if err != nil {
+		return fmt.Errorf("iptables: check chain %s: %w", iptRawChain, err)
+	}
+	if !ok {
+		if err := b.ipt.NewChain(iptRawTable, iptRawChain); err != nil {
+			return fmt.Errorf("iptables: create chain %s: %w", iptRawChain, err)
+		}
+	}
+	jump := []string{"-j", iptRawChain}
+	if ok, _ := b.ipt.Exists(iptRawTable, "PREROUTING", jump...); !ok {
+		if err := b.ipt.Insert(iptRawTable, "PREROUTING", 1, jump...); err != nil {
+			return fmt.Errorf("iptables: insert PREROUTING jump: %w", err)
+		}
+	}
+	if err := b.ipt.AppendUnique(iptRawTable, iptRawChain, spec...); err != nil {
+		return fmt.Errorf("iptables: add notrack rule: %w", err)
+	}
+	return nil
+}
+
+// deleteNotrack removes a rule's raw table notrack rule, if it has one.
+func (b *IPTablesBackend) deleteNotrack(rule Rule) {
+	spec := notrackSpec(rule)
+	if spec == nil {
+		return
+	}
+	if err := b.ipt.DeleteIfExists(iptRawTable, iptRawChain, spec...); err != nil {
+		b.logger.Warn("iptables: kernel delete of notrack rule failed",
+			"rule_id", rule.ID, "error", err,
+		)
+	}
+}
+
+// position returns the 1-based index of the rule whose comment is exactly
+// comment (e.g. "fm:<id>") in a filter table chain.
+func (b *IPTablesBackend) position(chain, comment string) (int, error) {
+	return b.positionIn(iptFilterTable, chain, comment)
+}
+
+// positionIn is position for a chain of any table.
+func (b *IPTablesBackend) positionIn(table, chain, comment string) (int, error) {
+	lines, err := b.ipt.List(table, chain)
+	if err != nil {
+		return 0, fmt.Errorf("iptables: list %s: %w", chain, err)
+	}
+
+	tag := "--comment " + comment + " "
+	pos := 0
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "-A ") {
+			continue // skip the "-N <chain>" header
+		}
+		pos++
+		if strings.Contains(line+" ", tag) {
+			return pos, nil
+		}
+	}
+	return 0, fmt.Errorf("iptables: rule %s not found in chain %s", comment, chain)
+}
+
 // DeleteRule removes a rule from the kernel via iptables.
 func (b *IPTablesBackend) DeleteRule(id string) error {
 	rule, ok := b.rules[id]
@@ -175,11 +553,15 @@ func (b *IPTablesBackend) DeleteRule(id string) error {
 	chain := chainFor(rule.Direction)
 	spec := ruleSpec(rule)
 
+	// Stop untracking handshakes before SYNPROXY goes away.
+	b.deleteNotrack(rule)
+
 	if err := b.ipt.Delete(iptFilterTable, chain, spec...); err != nil {
 		b.logger.Warn("iptables: kernel delete failed, removing from tracker",
 			"rule_id", id, "error", err,
 		)
 	}
+	b.deleteCompanions(chain, id)
 
 	delete(b.rules, id)
 	b.logger.Info("iptables: rule deleted", "chain", chain, "rule_id", id)
@@ -188,6 +570,11 @@ func (b *IPTablesBackend) DeleteRule(id string) error {
 
 // Flush clears all rules from the custom chains.
 func (b *IPTablesBackend) Flush() error {
+	if ok, _ := b.ipt.ChainExists(iptRawTable, iptRawChain); ok {
+		if err := b.ipt.ClearChain(iptRawTable, iptRawChain); err != nil {
+			return fmt.Errorf("iptables: flush %s: %w", iptRawChain, err)
+		}
+	}
 	if err := b.ipt.ClearChain(iptFilterTable, iptInputChain); err != nil {
 		return fmt.Errorf("iptables: flush %s: %w", iptInputChain, err)
 	}
@@ -219,10 +606,213 @@ func (b *IPTablesBackend) EnsurePort(port int, protocol, action string) error {
 	return b.AddRule(rule)
 }
 
+// SyncSet creates an ipset of type hash:net and atomically swaps in the
+// given members. The new contents are built in a temporary set and swapped
+// so rules matching the set never see it half-populated. The temporary set
+// is sized for the members, since country sets can outgrow ipset's default
+// limit of 65536 entries; swapping carries the size over.
+func (b *IPTablesBackend) SyncSet(name string, cidrs []string) error {
+	tmp := name + "_t"
+	maxElem := ipsetDefaultMaxElem
+	for maxElem < len(cidrs) {
+		maxElem *= 2
+	}
+
+	var script bytes.Buffer
+	if !ipsetExists(name) {
+		fmt.Fprintf(&script, "create %s hash:net family inet maxelem %d\n", name, maxElem)
+	}
+	if ipsetExists(tmp) {
+		fmt.Fprintf(&script, "destroy %s\n", tmp) // left over from a failed sync
+	}
+	fmt.Fprintf(&script, "create %s hash:net family inet maxelem %d\n", tmp, maxElem)
+	for _, c := range cidrs {
+		fmt.Fprintf(&script, "add %s %s -exist\n", tmp, c)
+	}
+	fmt.Fprintf(&script, "swap %s %s\n", tmp, name)
+	fmt.Fprintf(&script, "destroy %s\n", tmp)
+
+	if err := ipsetRestore(&script); err != nil {
+		return fmt.Errorf("iptables: sync ipset %s: %w", name, err)
+	}
+
+	b.logger.Info("iptables: ipset synced", "set", name, "members", len(cidrs))
+	return nil
+}
+
+// DeleteSet destroys an ipset. Rules referencing it must be removed first.
+func (b *IPTablesBackend) DeleteSet(name string) error {
+	if err := ipsetRestore(strings.NewReader("destroy " + name + "\n")); err != nil {
+		return fmt.Errorf("iptables: destroy ipset %s: %w", name, err)
+	}
+	b.logger.Info("iptables: ipset destroyed", "set", name)
+	return nil
+}
+
+// ipsetDefaultMaxElem is ipset's default limit on the entries of a set.
+const ipsetDefaultMaxElem = 65536
+
+// ipsetExists reports whether an ipset with the given name exists.
+func ipsetExists(name string) bool {
+	return exec.Command("ipset", "list", "-name", name).Run() == nil
+}
+
+// ipsetRestore feeds a batch of commands to "ipset restore".
+func ipsetRestore(script io.Reader) error {
+	cmd := exec.Command("ipset", "restore")
+	cmd.Stdin = script
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// ---------- NAT ----------
+
+// natChainFor returns the nat table chain holding a NAT rule.
+func natChainFor(rule NATRule) string {
+	if rule.inbound() {
+		return iptNATPreChain
+	}
+	return iptNATPostChain
+}
+
+// natSpec builds the iptables argument list for a NAT rule, tagged with
+// "-m comment --comment fm:<id>" like filter rules.
+func natSpec(rule NATRule) []string {
+	spec := matchSpec(rule.match())
+	spec = append(spec, "-m", "comment", "--comment", iptCommentTag+rule.ID)
+
+	switch rule.Type {
+	case NATTypeDNAT:
+		to := rule.ToAddress
+		if rule.ToPort > 0 {
+			to += ":" + strconv.Itoa(rule.ToPort)
+		}
+		spec = append(spec, "-j", "DNAT", "--to-destination", to)
+	case NATTypeSNAT:
+		spec = append(spec, "-j", "SNAT", "--to-source", rule.ToAddress)
+	case NATTypeMasquerade:
+		spec = append(spec, "-j", "MASQUERADE")
+	}
+	return spec
+}
+
+// ensureNATChains creates the nat table chains and their jumps on first use.
+func (b *IPTablesBackend) ensureNATChains() error {
+	for chain, hook := range map[string]string{iptNATPreChain: "PREROUTING", iptNATPostChain: "POSTROUTING"} {
+		ok, err := b.ipt.ChainExists(iptNATTable, chain)
+		if err != nil {
+			return fmt.Errorf("iptables: check chain %s: %w", chain, err)
+		}
+		if !ok {
+			if err := b.ipt.NewChain(iptNATTable, chain); err != nil {
+				return fmt.Errorf("iptables: create chain %s: %w", chain, err)
+			}
+		}
+		jump := []string{"-j", chain}
+		if ok, _ := b.ipt.Exists(iptNATTable, hook, jump...); !ok {
+			if err := b.ipt.Insert(iptNATTable, hook, 1, jump...); err != nil {
+				return fmt.Errorf("iptables: insert %s jump: %w", hook, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ListNATRules returns all managed NAT rules.
+func (b *IPTablesBackend) ListNATRules() ([]NATRule, error) {
+	out := make([]NATRule, 0, len(b.natRules))
+	for _, r := range b.natRules {
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// AddNATRule appends a NAT rule to its nat table chain.
+func (b *IPTablesBackend) AddNATRule(rule NATRule) error {
+	if err := b.ensureNATChains(); err != nil {
+		return err
+	}
+	chain := natChainFor(rule)
+	if err := b.ipt.AppendUnique(iptNATTable, chain, natSpec(rule)...); err != nil {
+		return fmt.Errorf("iptables: add nat rule to %s: %w", chain, err)
+	}
+
+	b.natRules[rule.ID] = rule
+	b.logger.Info("iptables: nat rule added to kernel",
+		"chain", chain,
+		"rule_id", rule.ID,
+		"type", rule.Type,
+		"port", rule.Port,
+	)
+	return nil
+}
+
+// ReplaceNATRule rewrites a managed NAT rule in place using its chain
+// position, or moves it when its type changes chains.
+func (b *IPTablesBackend) ReplaceNATRule(rule NATRule) error {
+	old, ok := b.natRules[rule.ID]
+	if !ok {
+		return fmt.Errorf("iptables: nat rule %s not found in tracker", rule.ID)
+	}
+
+	oldChain := natChainFor(old)
+	newChain := natChainFor(rule)
+
+	if oldChain == newChain {
+		pos, err := b.positionIn(iptNATTable, oldChain, iptCommentTag+rule.ID)
+		if err != nil {
+			return err
+		}
+		if err := b.ipt.Replace(iptNATTable, oldChain, pos, natSpec(rule)...); err != nil {
+			return fmt.Errorf("iptables: replace nat rule in %s: %w", oldChain, err)
+		}
+	} else {
+		if err := b.ipt.Append(iptNATTable, newChain, natSpec(rule)...); err != nil {
+			return fmt.Errorf("iptables: add replacement nat rule to %s: %w", newChain, err)
+		}
+		if err := b.ipt.Delete(iptNATTable, oldChain, natSpec(old)...); err != nil {
+			b.logger.Warn("iptables: kernel delete of replaced nat rule failed",
+				"rule_id", rule.ID, "chain", oldChain, "error", err,
+			)
+		}
+	}
+
+	b.natRules[rule.ID] = rule
+	b.logger.Info("iptables: nat rule replaced in kernel",
+		"chain", newChain,
+		"rule_id", rule.ID,
+		"type", rule.Type,
+		"port", rule.Port,
+	)
+	return nil
+}
+
+// DeleteNATRule removes a NAT rule from the kernel.
+func (b *IPTablesBackend) DeleteNATRule(id string) error {
+	rule, ok := b.natRules[id]
+	if !ok {
+		return fmt.Errorf("iptables: nat rule %s not found in tracker", id)
+	}
+
+	chain := natChainFor(rule)
+	if err := b.ipt.Delete(iptNATTable, chain, natSpec(rule)...); err != nil {
+		b.logger.Warn("iptables: kernel delete of nat rule failed, removing from tracker",
+			"rule_id", id, "error", err,
+		)
+	}
+
+	delete(b.natRules, id)
+	b.logger.Info("iptables: nat rule deleted", "chain", chain, "rule_id", id)
+	return nil
+}
+
 // SetupNFLOG installs NFLOG rules in the INPUT and OUTPUT chains so that
 // the kernel copies packet metadata to userspace via netlink. This is used
 // by the real-time traffic monitor.
 func (b *IPTablesBackend) SetupNFLOG(group uint16) error {
+	b.logGroup = group
 	groupStr := strconv.Itoa(int(group))
 
 	// NFLOG rule for INPUT chain — log all incoming packets.
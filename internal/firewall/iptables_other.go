@@ -11,16 +11,20 @@ import (
 // IPTablesBackend is a development stub for non-Linux platforms.
 // On Linux, the real implementation in iptables_linux.go is used instead.
 type IPTablesBackend struct {
-	logger *logger.Logger
-	rules  map[string]Rule
+	logger   *logger.Logger
+	rules    map[string]Rule
+	sets     map[string][]string
+	natRules map[string]NATRule
 }
 
 // NewIPTablesBackend creates a stub iptables backend (non-Linux).
 func NewIPTablesBackend(log *logger.Logger) (*IPTablesBackend, error) {
 	log.Info("iptables: using in-memory stub (non-Linux platform)")
 	return &IPTablesBackend{
-		logger: log,
-		rules:  make(map[string]Rule),
+		logger:   log,
+		rules:    make(map[string]Rule),
+		sets:     make(map[string][]string),
+		natRules: make(map[string]NATRule),
 	}, nil
 }
 
@@ -38,6 +42,15 @@ func (b *IPTablesBackend) AddRule(rule Rule) error {
 	return nil
 }
 
+func (b *IPTablesBackend) ReplaceRule(rule Rule) error {
+	if _, ok := b.rules[rule.ID]; !ok {
+		return fmt.Errorf("iptables-stub: rule %s not found", rule.ID)
+	}
+	b.rules[rule.ID] = rule
+	b.logger.Info("iptables-stub: rule replaced", "rule_id", rule.ID, "port", rule.Port)
+	return nil
+}
+
 func (b *IPTablesBackend) DeleteRule(id string) error {
 	if _, ok := b.rules[id]; !ok {
 		return fmt.Errorf("iptables-stub: rule %s not found", id)
@@ -66,7 +79,51 @@ func (b *IPTablesBackend) EnsurePort(port int, protocol, action string) error {
 	return nil
 }
 
+func (b *IPTablesBackend) SyncSet(name string, cidrs []string) error {
+	b.sets[name] = append([]string(nil), cidrs...)
+	b.logger.Info("iptables-stub: set synced", "set", name, "members", len(cidrs))
+	return nil
+}
+
+func (b *IPTablesBackend) DeleteSet(name string) error {
+	delete(b.sets, name)
+	b.logger.Info("iptables-stub: set deleted", "set", name)
+	return nil
+}
+
 func (b *IPTablesBackend) SetupNFLOG(group uint16) error {
 	b.logger.Info("iptables-stub: NFLOG setup skipped (non-Linux)", "group", group)
 	return nil
 }
+
+func (b *IPTablesBackend) ListNATRules() ([]NATRule, error) {
+	out := make([]NATRule, 0, len(b.natRules))
+	for _, r := range b.natRules {
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+func (b *IPTablesBackend) AddNATRule(rule NATRule) error {
+	b.natRules[rule.ID] = rule
+	b.logger.Info("iptables-stub: nat rule added", "rule_id", rule.ID, "type", rule.Type)
+	return nil
+}
+
+func (b *IPTablesBackend) ReplaceNATRule(rule NATRule) error {
+	if _, ok := b.natRules[rule.ID]; !ok {
+		return fmt.Errorf("iptables-stub: nat rule %s not found", rule.ID)
+	}
+	b.natRules[rule.ID] = rule
+	b.logger.Info("iptables-stub: nat rule replaced", "rule_id", rule.ID, "type", rule.Type)
+	return nil
+}
+
+func (b *IPTablesBackend) DeleteNATRule(id string) error {
+	if _, ok := b.natRules[id]; !ok {
+		return fmt.Errorf("iptables-stub: nat rule %s not found", id)
+	}
+	delete(b.natRules, id)
+	b.logger.Info("iptables-stub: nat rule deleted", "rule_id", id)
+	return nil
+}
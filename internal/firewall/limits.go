@@ -0,0 +1,169 @@
+package firewall
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+)
+
+// Rate limit modes.
+const (
+	RateModePackets     = "packets"     // count every matched packet
+	RateModeConnections = "connections" // count only packets opening a connection
+)
+
+// defaultRateBurst matches the default burst of both nft limit and hashlimit.
+const defaultRateBurst = 5
+
+// rateUnits maps a rate limit unit to its length in seconds.
+var rateUnits = map[string]uint64{
+	"second": 1,
+	"minute": 60,
+	"hour":   60 * 60,
+	"day":    60 * 60 * 24,
+}
+
+// RateLimit restricts a rule to traffic above a rate. The rule's action only
+// applies to packets exceeding Rate per Unit (plus Burst), so a DROP rule
+// with a limit sheds the excess while conforming traffic continues down the
+// chain.
+type RateLimit struct {
+	Rate      int    `json:"rate"`                 // packets or connections per Unit
+	Unit      string `json:"unit,omitempty"`       // "second" (default), "minute", "hour", "day"
+	Burst     int    `json:"burst,omitempty"`      // 0 = default of 5
+	PerSource bool   `json:"per_source,omitempty"` // track each source address separately
+	Mode      string `json:"mode,omitempty"`       // "packets" (default) or "connections"
+}
+
+// ConnLimit caps concurrent connections per source. The rule's action only
+// applies to new connections from a source that already has more than Max
+// open; hits are logged to the traffic monitor.
+type ConnLimit struct {
+	Max  int `json:"max"`            // concurrent connections allowed per source
+	Mask int `json:"mask,omitempty"` // source prefix length to group by; 0 = 32 (per address)
+}
+
+// Prefix tags identifying why a logged packet matched.
+const (
+	HitConnLimit = "CONNLIMIT"
+)
+
+// ValidateRateLimit checks a rule's rate limit. Limits only make sense on
+// rules that discard the excess, so the action must be DROP or REJECT.
+func ValidateRateLimit(rl *RateLimit, action string) error {
+	if rl == nil {
+		return nil
+	}
+	if rl.Rate < 1 {
+		return fmt.Errorf("invalid rate limit: rate must be at least 1")
+	}
+	if _, ok := rateUnits[rl.unit()]; !ok {
+		return fmt.Errorf("invalid rate limit unit: %s (must be second, minute, hour, or day)", rl.Unit)
+	}
+	if rl.Burst < 0 {
+		return fmt.Errorf("invalid rate limit: burst cannot be negative")
+	}
+	if m := rl.mode(); m != RateModePackets && m != RateModeConnections {
+		return fmt.Errorf("invalid rate limit mode: %s (must be packets or connections)", rl.Mode)
+	}
+	if a := strings.ToUpper(action); a != "DROP" && a != "REJECT" {
+		return fmt.Errorf("rate-limited rules must DROP or REJECT the excess, not %s", action)
+	}
+	return nil
+}
+
+// ValidateConnLimit checks a rule's connection limit. Like rate limits it
+// must DROP or REJECT the excess.
+func ValidateConnLimit(cl *ConnLimit, action string) error {
+	if cl == nil {
+		return nil
+	}
+	if cl.Max < 1 {
+		return fmt.Errorf("invalid connection limit: max must be at least 1")
+	}
+	if cl.Mask < 0 || cl.Mask > 32 {
+		return fmt.Errorf("invalid connection limit mask: %d (must be 0-32)", cl.Mask)
+	}
+	if a := strings.ToUpper(action); a != "DROP" && a != "REJECT" {
+		return fmt.Errorf("connection-limited rules must DROP or REJECT the excess, not %s", action)
+	}
+	return nil
+}
+
+// mask returns the source prefix length, defaulting to a single address.
+func (cl *ConnLimit) mask() int {
+	if cl.Mask == 0 {
+		return 32
+	}
+	return cl.Mask
+}
+
+// String renders the limit, e.g. "20 per /32".
+func (cl *ConnLimit) String() string {
+	if cl == nil {
+		return "none"
+	}
+	return fmt.Sprintf("%d per /%d", cl.Max, cl.mask())
+}
+
+// hitPrefix is the NFLOG prefix for packets a rule matched because of a
+// limit, e.g. "FM:INPUT:DROP:CONNLIMIT:<rule id>". The leading fields follow
+// the monitor's "FM:<CHAIN>:<ACTION>:" format.
+func hitPrefix(rule Rule, tag string) string {
+	chain := "INPUT"
+	if rule.Direction == "outbound" {
+		chain = "OUTPUT"
+	}
+	return fmt.Sprintf("FM:%s:%s:%s:%s", chain, rule.Action, tag, rule.ID)
+}
+
+// unit returns the limit's unit, defaulting to "second".
+func (rl *RateLimit) unit() string {
+	if rl.Unit == "" {
+		return "second"
+	}
+	return strings.ToLower(rl.Unit)
+}
+
+// mode returns the limit's mode, defaulting to packets.
+func (rl *RateLimit) mode() string {
+	if rl.Mode == "" {
+		return RateModePackets
+	}
+	return strings.ToLower(rl.Mode)
+}
+
+// burst returns the limit's burst, defaulting to defaultRateBurst.
+func (rl *RateLimit) burst() int {
+	if rl.Burst == 0 {
+		return defaultRateBurst
+	}
+	return rl.Burst
+}
+
+// window returns the length of one limit unit.
+func (rl *RateLimit) window() time.Duration {
+	return time.Duration(rateUnits[rl.unit()]) * time.Second
+}
+
+// String renders the limit, e.g. "10/minute burst 5 per source (connections)".
+func (rl *RateLimit) String() string {
+	if rl == nil {
+		return "none"
+	}
+	s := fmt.Sprintf("%d/%s burst %d", rl.Rate, rl.unit(), rl.burst())
+	if rl.PerSource {
+		s += " per source"
+	}
+	return s + " (" + rl.mode() + ")"
+}
+
+// limitName derives a short, stable name for the kernel state backing a
+// rule's limits. The limit parameters are part of the hash so a changed limit
+// gets fresh state instead of inheriting the old one's configuration.
+func limitName(rule Rule) string {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s|%s|%s", rule.ID, rule.RateLimit.String(), rule.ConnLimit.String())
+	return fmt.Sprintf("fm_rl_%08x", h.Sum32())
+}
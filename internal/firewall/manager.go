@@ -1,7 +1,9 @@
 package firewall
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
 
 	"github.com/enjoys-in/secureflow/pkg/logger"
@@ -16,15 +18,111 @@ type Rule struct {
 	PortEnd    int    `json:"port_end"` // 0 = single port
 	SourceCIDR string `json:"source_cidr"`
 	DestCIDR   string `json:"dest_cidr"`
-	Action     string `json:"action"` // "ACCEPT", "DROP", "REJECT"
+	Action     string `json:"action"`             // "ACCEPT", "DROP", "REJECT"
+	GroupID    string `json:"group_id,omitempty"` // owning security group, if applied as part of one
+
+	// ScheduleID limits the rule to the time windows of a schedule. The
+	// manager keeps the rule out of the kernel while the schedule is inactive.
+	ScheduleID string `json:"schedule_id,omitempty"`
+
+	// SourcePort / SourcePortEnd match the TCP/UDP source port or range.
+	SourcePort    int `json:"source_port,omitempty"`
+	SourcePortEnd int `json:"source_port_end,omitempty"`
+	// ICMPType / ICMPCode narrow an icmp rule to one message type and,
+	// optionally, one code. nil matches any.
+	ICMPType *int `json:"icmp_type,omitempty"`
+	ICMPCode *int `json:"icmp_code,omitempty"`
+
+	// OwnerUser / OwnerGroup (names or numeric IDs) and Cgroup (a systemd
+	// unit or cgroup v2 path) match the socket owner of outbound traffic.
+	// The manager resolves them into UID / GID / CgroupPath at install time.
+	OwnerUser  string  `json:"owner_user,omitempty"`
+	OwnerGroup string  `json:"owner_group,omitempty"`
+	Cgroup     string  `json:"cgroup,omitempty"`
+	UID        *uint32 `json:"uid,omitempty"`
+	GID        *uint32 `json:"gid,omitempty"`
+	CgroupPath string  `json:"cgroup_path,omitempty"`
+
+	// InInterface / OutInterface match the incoming (inbound rules) or
+	// outgoing (outbound rules) interface; "eth*" matches by prefix.
+	InInterface  string `json:"in_interface,omitempty"`
+	OutInterface string `json:"out_interface,omitempty"`
+
+	// SourceGroupID / DestGroupID match the members of another security group
+	// instead of a literal CIDR. The manager compiles them into named kernel
+	// sets and fills in SourceSet / DestSet before the rule reaches a backend.
+	SourceGroupID string `json:"source_group_id,omitempty"`
+	DestGroupID   string `json:"dest_group_id,omitempty"`
+	SourceSet     string `json:"source_set,omitempty"`
+	DestSet       string `json:"dest_set,omitempty"`
+
+	// SourceAddressID / DestAddressID reference named address objects and
+	// are compiled into sets the same way as group references.
+	SourceAddressID string `json:"source_address_id,omitempty"`
+	DestAddressID   string `json:"dest_address_id,omitempty"`
+
+	// SourceFQDN / DestFQDN match the addresses a hostname resolves to.
+	// They are compiled into sets like the references above, which the
+	// resolver refreshes as the hostname's DNS records expire.
+	SourceFQDN string `json:"source_fqdn,omitempty"`
+	DestFQDN   string `json:"dest_fqdn,omitempty"`
+
+	// SourceCountries / DestCountries match the networks the GeoIP database
+	// assigns to any of these ISO country codes, e.g. ["CN", "RU"].
+	SourceCountries []string `json:"source_countries,omitempty"`
+	DestCountries   []string `json:"dest_countries,omitempty"`
+
+	// SourceFeedID matches the addresses a threat feed currently blocks,
+	// SourceJailID those a jail has banned and SourceDetector those a traffic
+	// detector such as "portscan" has blocked.
+	SourceFeedID   string `json:"source_feed_id,omitempty"`
+	SourceJailID   string `json:"source_jail_id,omitempty"`
+	SourceDetector string `json:"source_detector,omitempty"`
+
+	// Priority places a rule at the head of its chain, ahead of the
+	// immutable port rules and any appended DROP. A DROP/REJECT then also
+	// applies to immutable ports; an ACCEPT for a single source, e.g. a knock
+	// opening, gets through a port closed further down.
+	Priority bool `json:"priority,omitempty"`
+
+	// ServiceID references a service object. Its protocol and port list
+	// replace Protocol / Port / PortEnd and are expanded into Ports.
+	ServiceID string      `json:"service_id,omitempty"`
+	Ports     []PortRange `json:"ports,omitempty"`
+
+	// RateLimit, when set, makes the rule act only on traffic above the rate.
+	RateLimit *RateLimit `json:"rate_limit,omitempty"`
+	// ConnLimit, when set, makes the rule act only on new connections from
+	// sources over their concurrent connection cap.
+	ConnLimit *ConnLimit `json:"conn_limit,omitempty"`
+
+	// SynProxy enables SYN flood protection for the rule's ports: handshakes
+	// are answered by the kernel's SYNPROXY and only completed connections
+	// reach the rule.
+	SynProxy bool `json:"synproxy,omitempty"`
 }
 
+// PortRange is an inclusive destination port range. End 0 means a single port.
+type PortRange struct {
+	Port int `json:"port"`
+	End  int `json:"end,omitempty"`
+}
+
+// Service is the resolved content of a service object.
+type Service struct {
+	Protocol string
+	Ports    []PortRange
+}
+
+// ServiceResolver loads the current definition of a service object.
+type ServiceResolver func(id string) (*Service, error)
+
 // FirewallManager defines the interface for firewall operations.
 type FirewallManager interface {
 	ListRules() ([]Rule, error)
 	AddRule(rule Rule) error
+	ReplaceRule(rule Rule) error
 	DeleteRule(id string) error
-	ApplyRules(rules []Rule) error
 	EnsureImmutablePorts() error
 	IsPortImmutable(port int) bool
 	Flush() error
@@ -34,9 +132,17 @@ type FirewallManager interface {
 type Backend interface {
 	ListRules() ([]Rule, error)
 	AddRule(rule Rule) error
+	// ReplaceRule swaps the kernel rule tagged with rule.ID for the new
+	// definition without a window where neither version is installed.
+	ReplaceRule(rule Rule) error
 	DeleteRule(id string) error
 	Flush() error
 	EnsurePort(port int, protocol, action string) error
+	// SyncSet creates the named IPv4 address set if needed and atomically
+	// replaces its members with cidrs.
+	SyncSet(name string, cidrs []string) error
+	// DeleteSet removes a named address set no rule references any more.
+	DeleteSet(name string) error
 	// SetupNFLOG installs NFLOG rules so the kernel sends packet metadata
 	// to userspace (NFLOG group 100) for live traffic monitoring.
 	SetupNFLOG(group uint16) error
@@ -45,7 +151,14 @@ type Backend interface {
 // Manager is the concrete implementation with concurrency safety.
 type Manager struct {
 	backend        Backend
+	nat            NATBackend // nil if the backend cannot manage NAT
 	immutablePorts []int
+	resolver       AddressResolver
+	services       ServiceResolver
+	sets           map[string]setRef // kernel sets compiled from references
+	schedules      map[string]bool   // schedule ID -> currently active
+	groupSchedules map[string]string // group ID -> schedule its application is limited to
+	parked         map[string]Rule   // rules held out of the kernel by an inactive schedule
 	mu             sync.Mutex
 	logger         *logger.Logger
 }
@@ -68,13 +181,52 @@ func NewManager(backendType string, immutablePorts []int, log *logger.Logger) (*
 		return nil, fmt.Errorf("init backend %s: %w", backendType, err)
 	}
 
+	nat, _ := backend.(NATBackend)
+
 	return &Manager{
 		backend:        backend,
+		nat:            nat,
 		immutablePorts: immutablePorts,
+		sets:           make(map[string]setRef),
+		schedules:      make(map[string]bool),
+		groupSchedules: make(map[string]string),
+		parked:         make(map[string]Rule),
 		logger:         log,
 	}, nil
 }
 
+// References returns the IDs of the references of one kind that installed
+// rules currently use, e.g. the hostnames behind FQDN sets.
+func (m *Manager) References(kind string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var ids []string
+	for _, ref := range m.sets {
+		if ref.kind == kind {
+			ids = append(ids, ref.id)
+		}
+	}
+	return ids
+}
+
+// SetAddressResolver registers the function used to expand security group,
+// address object, FQDN, country, threat feed, jail and detector references
+// into addresses. It must be set before rules with references are applied.
+func (m *Manager) SetAddressResolver(r AddressResolver) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.resolver = r
+}
+
+// SetServiceResolver registers the function used to expand service object
+// references. It must be set before rules with a ServiceID are applied.
+func (m *Manager) SetServiceResolver(r ServiceResolver) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.services = r
+}
+
 // IsPortImmutable checks if a port is in the immutable list.
 func (m *Manager) IsPortImmutable(port int) bool {
 	for _, p := range m.immutablePorts {
@@ -85,6 +237,19 @@ func (m *Manager) IsPortImmutable(port int) bool {
 	return false
 }
 
+// ImmutablePortIn returns the first immutable port covered by a port list,
+// counting every port inside a range.
+func (m *Manager) ImmutablePortIn(ports []PortRange) (int, bool) {
+	for _, pr := range ports {
+		for _, p := range m.immutablePorts {
+			if p == pr.Port || (pr.End > 0 && p >= pr.Port && p <= pr.End) {
+				return p, true
+			}
+		}
+	}
+	return 0, false
+}
+
 // EnsureImmutablePorts opens all immutable ports (called on startup).
 func (m *Manager) EnsureImmutablePorts() error {
 	m.mu.Lock()
@@ -116,7 +281,18 @@ func (m *Manager) AddRule(rule Rule) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	if !m.ruleLive(rule) {
+		m.parked[rule.ID] = rule
+		m.logger.Info("Rule parked until its schedule is active", "rule_id", rule.ID)
+		return nil
+	}
+
+	if err := m.prepare(&rule); err != nil {
+		return err
+	}
+
 	if err := m.backend.AddRule(rule); err != nil {
+		m.pruneSets()
 		return fmt.Errorf("add rule: %w", err)
 	}
 
@@ -124,16 +300,90 @@ func (m *Manager) AddRule(rule Rule) error {
 	return nil
 }
 
+// HasRule reports whether a rule with the given ID is installed or parked
+// until its schedule is active.
+func (m *Manager) HasRule(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.parked[id]; ok {
+		return true
+	}
+	rules, err := m.backend.ListRules()
+	if err != nil {
+		return false
+	}
+	for _, r := range rules {
+		if r.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// ReplaceRule updates an installed rule in place after validation.
+func (m *Manager) ReplaceRule(rule Rule) error {
+	if (rule.Action == "DROP" || rule.Action == "REJECT") && m.IsPortImmutable(rule.Port) {
+		return fmt.Errorf("port %d is immutable and cannot be blocked", rule.Port)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// A schedule change can move the rule into or out of the kernel.
+	_, wasParked := m.parked[rule.ID]
+	if !m.ruleLive(rule) {
+		if !wasParked {
+			if err := m.backend.DeleteRule(rule.ID); err != nil {
+				return fmt.Errorf("replace rule %s: %w", rule.ID, err)
+			}
+			m.pruneSets()
+			for _, port := range m.immutablePorts {
+				_ = m.backend.EnsurePort(port, "tcp", "ACCEPT")
+			}
+		}
+		m.parked[rule.ID] = rule
+		m.logger.Info("Rule parked until its schedule is active", "rule_id", rule.ID)
+		return nil
+	}
+
+	if err := m.prepare(&rule); err != nil {
+		return err
+	}
+
+	if wasParked {
+		if err := m.backend.AddRule(rule); err != nil {
+			m.pruneSets()
+			return fmt.Errorf("replace rule %s: %w", rule.ID, err)
+		}
+		delete(m.parked, rule.ID)
+	} else if err := m.backend.ReplaceRule(rule); err != nil {
+		m.pruneSets()
+		return fmt.Errorf("replace rule %s: %w", rule.ID, err)
+	}
+	m.pruneSets()
+
+	m.logger.Info("Rule replaced", "rule_id", rule.ID, "port", rule.Port, "action", rule.Action)
+	return nil
+}
+
 // DeleteRule removes a firewall rule (immutable rules cannot be deleted).
 func (m *Manager) DeleteRule(id string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	if _, ok := m.parked[id]; ok {
+		delete(m.parked, id)
+		m.logger.Info("Parked rule deleted", "rule_id", id)
+		return nil
+	}
+
 	if err := m.backend.DeleteRule(id); err != nil {
 		return fmt.Errorf("delete rule %s: %w", id, err)
 	}
 
 	m.logger.Info("Rule deleted", "rule_id", id)
+	m.pruneSets()
 
 	// Re-ensure immutable ports after any delete
 	for _, port := range m.immutablePorts {
@@ -143,40 +393,167 @@ func (m *Manager) DeleteRule(id string) error {
 	return nil
 }
 
-// ApplyRules applies a batch of rules atomically (for security group application).
-func (m *Manager) ApplyRules(rules []Rule) error {
+// ApplyGroup installs rules as the complete kernel rule set of a security
+// group. Rules already installed are replaced in place, new ones are added
+// and installed rules of the group missing from the set are removed, so
+// re-applying a group never duplicates rules. On failure, changes made so far
+// are rolled back.
+func (m *Manager) ApplyGroup(groupID string, rules []Rule) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// Validate all rules first
 	for _, rule := range rules {
 		if (rule.Action == "DROP" || rule.Action == "REJECT") && m.IsPortImmutable(rule.Port) {
-			return fmt.Errorf("cannot apply rules: port %d is immutable", rule.Port)
+			return fmt.Errorf("cannot apply group: port %d is immutable", rule.Port)
 		}
 	}
 
-	// Apply rules one by one; rollback on failure
-	var applied []Rule
+	installed, err := m.groupRules(groupID)
+	if err != nil {
+		return err
+	}
+
+	var added []string
+	var replaced []Rule
+	// rollback undoes the changes made so far and folds any step it could not
+	// undo into err, so a half-applied group is reported rather than hidden.
+	rollback := func(err error) error {
+		var errs []error
+		for _, id := range added {
+			if rbErr := m.backend.DeleteRule(id); rbErr != nil {
+				errs = append(errs, fmt.Errorf("remove added rule %s: %w", id, rbErr))
+			}
+		}
+		for _, prev := range replaced {
+			if rbErr := m.backend.ReplaceRule(prev); rbErr != nil {
+				errs = append(errs, fmt.Errorf("restore rule %s: %w", prev.ID, rbErr))
+			}
+		}
+		m.pruneSets()
+		if len(errs) == 0 {
+			return err
+		}
+		rbErr := errors.Join(errs...)
+		m.logger.Error("Group rollback incomplete, kernel is partially applied", "group_id", groupID, "error", rbErr)
+		return fmt.Errorf("%w (rollback incomplete: %v)", err, rbErr)
+	}
+
+	keep := make(map[string]bool, len(rules))
+	var park []Rule
 	for _, rule := range rules {
-		if err := m.backend.AddRule(rule); err != nil {
-			m.logger.Error("Rule apply failed, rolling back", "error", err)
-			for _, r := range applied {
-				_ = m.backend.DeleteRule(r.ID)
+		rule.GroupID = groupID
+		if !m.ruleLive(rule) {
+			// Installed copies are removed below with the stale rules.
+			park = append(park, rule)
+			continue
+		}
+		keep[rule.ID] = true
+
+		if err := m.prepare(&rule); err != nil {
+			return rollback(err)
+		}
+
+		if prev, ok := installed[rule.ID]; ok {
+			if err := m.backend.ReplaceRule(rule); err != nil {
+				m.logger.Error("Group apply failed, rolling back", "group_id", groupID, "error", err)
+				return rollback(fmt.Errorf("apply group %s failed at rule %s: %w", groupID, rule.ID, err))
 			}
-			return fmt.Errorf("apply rules failed at rule %s: %w", rule.ID, err)
+			replaced = append(replaced, prev)
+			continue
 		}
-		applied = append(applied, rule)
+
+		if err := m.backend.AddRule(rule); err != nil {
+			m.logger.Error("Group apply failed, rolling back", "group_id", groupID, "error", err)
+			return rollback(fmt.Errorf("apply group %s failed at rule %s: %w", groupID, rule.ID, err))
+		}
+		added = append(added, rule.ID)
+	}
+
+	removed := 0
+	for id := range installed {
+		if keep[id] {
+			continue
+		}
+		if err := m.backend.DeleteRule(id); err != nil {
+			m.logger.Warn("Failed to remove stale group rule", "group_id", groupID, "rule_id", id, "error", err)
+			continue
+		}
+		removed++
+	}
+
+	m.dropParkedGroup(groupID)
+	for _, rule := range park {
+		m.parked[rule.ID] = rule
 	}
 
-	// Always re-ensure immutable ports
 	for _, port := range m.immutablePorts {
 		_ = m.backend.EnsurePort(port, "tcp", "ACCEPT")
 	}
 
-	m.logger.Info("Rules applied", "count", len(rules))
+	m.pruneSets()
+
+	m.logger.Info("Security group applied",
+		"group_id", groupID,
+		"added", len(added),
+		"replaced", len(replaced),
+		"removed", removed,
+		"parked", len(park),
+	)
 	return nil
 }
 
+// RemoveGroup deletes every installed rule that belongs to a security group
+// and returns how many were removed.
+func (m *Manager) RemoveGroup(groupID string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	installed, err := m.groupRules(groupID)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for id := range installed {
+		if err := m.backend.DeleteRule(id); err != nil {
+			return removed, fmt.Errorf("remove group %s rule %s: %w", groupID, id, err)
+		}
+		removed++
+	}
+	m.dropParkedGroup(groupID)
+	delete(m.groupSchedules, groupID)
+
+	for _, port := range m.immutablePorts {
+		_ = m.backend.EnsurePort(port, "tcp", "ACCEPT")
+	}
+
+	m.pruneSets()
+
+	m.logger.Info("Security group removed", "group_id", groupID, "rules", removed)
+	return removed, nil
+}
+
+// groupRules returns the installed rules of a group keyed by rule ID.
+// The caller must hold m.mu.
+func (m *Manager) groupRules(groupID string) (map[string]Rule, error) {
+	if groupID == "" {
+		return nil, fmt.Errorf("group ID is required")
+	}
+
+	all, err := m.backend.ListRules()
+	if err != nil {
+		return nil, fmt.Errorf("list rules: %w", err)
+	}
+
+	out := make(map[string]Rule)
+	for _, r := range all {
+		if r.GroupID == groupID {
+			out[r.ID] = r
+		}
+	}
+	return out, nil
+}
+
 // Flush removes all non-immutable rules.
 func (m *Manager) Flush() error {
 	m.mu.Lock()
@@ -185,6 +562,8 @@ func (m *Manager) Flush() error {
 	if err := m.backend.Flush(); err != nil {
 		return err
 	}
+	m.parked = make(map[string]Rule)
+	m.pruneSets()
 
 	// Re-ensure immutable ports after flush
 	for _, port := range m.immutablePorts {
@@ -194,6 +573,186 @@ func (m *Manager) Flush() error {
 	return nil
 }
 
+// RefreshReference re-resolves a reference whose membership changed (e.g. a
+// group was applied to or detached from a server) and updates its kernel set
+// in place. It is a no-op when no installed rule uses the reference.
+func (m *Manager) RefreshReference(kind, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := setName(kind, id)
+	if _, ok := m.sets[name]; !ok {
+		return nil
+	}
+	return m.syncSet(kind, id, name)
+}
+
+// RefreshService re-resolves a service object that was edited and rewrites
+// every installed rule that uses it. It returns the number of rules updated.
+func (m *Manager) RefreshService(id string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rules, err := m.backend.ListRules()
+	if err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for _, rule := range rules {
+		if rule.ServiceID != id {
+			continue
+		}
+		if err := m.bindRefs(&rule); err != nil {
+			return updated, err
+		}
+		if err := m.backend.ReplaceRule(rule); err != nil {
+			return updated, fmt.Errorf("replace rule %s: %w", rule.ID, err)
+		}
+		updated++
+	}
+
+	m.logger.Info("Service object refreshed", "service_id", id, "rules", updated)
+	return updated, nil
+}
+
+// prepare readies a rule for a backend: its references are bound, and for
+// SYN flood protection the resolved protocol and the host's sysctls are
+// checked. The caller must hold m.mu.
+func (m *Manager) prepare(rule *Rule) error {
+	if err := m.bindRefs(rule); err != nil {
+		return err
+	}
+	if err := resolveOwner(rule); err != nil {
+		return err
+	}
+	if rule.SynProxy {
+		if err := ValidateSynProxy(*rule); err != nil {
+			return err
+		}
+		if err := checkSynProxySysctls(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bindRefs resolves a rule's references before it reaches a backend: group
+// and address object references are compiled into kernel sets, and a service
+// reference is expanded into its protocol and port list. The caller must
+// hold m.mu.
+func (m *Manager) bindRefs(rule *Rule) error {
+	rule.SourceSet, rule.DestSet = "", ""
+
+	if kind, id := sourceRef(rule); id != "" {
+		name, err := m.ensureSet(kind, id)
+		if err != nil {
+			return err
+		}
+		rule.SourceSet = name
+	}
+	if kind, id := destRef(rule); id != "" {
+		name, err := m.ensureSet(kind, id)
+		if err != nil {
+			return err
+		}
+		rule.DestSet = name
+	}
+
+	if rule.ServiceID != "" {
+		if m.services == nil {
+			return fmt.Errorf("cannot resolve service %s: no service resolver configured", rule.ServiceID)
+		}
+		svc, err := m.services(rule.ServiceID)
+		if err != nil {
+			return fmt.Errorf("resolve service %s: %w", rule.ServiceID, err)
+		}
+		rule.Protocol = svc.Protocol
+		rule.Port, rule.PortEnd = 0, 0
+		rule.Ports = svc.Ports
+	}
+
+	if rule.Action == "DROP" || rule.Action == "REJECT" {
+		if p, ok := m.ImmutablePortIn(rule.Ports); ok {
+			return fmt.Errorf("port %d is immutable and cannot be blocked", p)
+		}
+	}
+	return nil
+}
+
+// ensureSet makes sure the set for a reference exists in the kernel.
+// The caller must hold m.mu.
+func (m *Manager) ensureSet(kind, id string) (string, error) {
+	name := setName(kind, id)
+	if _, ok := m.sets[name]; ok {
+		return name, nil
+	}
+	if err := m.syncSet(kind, id, name); err != nil {
+		return "", err
+	}
+	m.sets[name] = setRef{kind: kind, id: id}
+	return name, nil
+}
+
+// syncSet resolves a reference and pushes its members into the kernel set.
+// The caller must hold m.mu.
+func (m *Manager) syncSet(kind, id, name string) error {
+	if m.resolver == nil {
+		return fmt.Errorf("cannot resolve %s %s: no address resolver configured", kind, id)
+	}
+
+	addrs, err := m.resolver(kind, id)
+	if err != nil {
+		return fmt.Errorf("resolve %s %s: %w", kind, id, err)
+	}
+
+	// A set that silently lost all its members would turn a DROP into a no-op,
+	// so refuse it; partial losses are logged.
+	cidrs, skipped := ipv4CIDRs(addrs)
+	if len(skipped) > 0 {
+		if len(cidrs) == 0 {
+			return fmt.Errorf("%s %s has no IPv4 members (skipped: %s)", kind, id, strings.Join(skipped, ", "))
+		}
+		m.logger.Warn("Skipped non-IPv4 set members", "set", name, "kind", kind, "ref_id", id, "skipped", skipped)
+	}
+	if err := m.backend.SyncSet(name, cidrs); err != nil {
+		return fmt.Errorf("sync set %s: %w", name, err)
+	}
+
+	m.logger.Info("Address set synced", "set", name, "kind", kind, "ref_id", id, "members", len(cidrs))
+	return nil
+}
+
+// pruneSets deletes kernel sets that no installed rule references any more.
+// The caller must hold m.mu.
+func (m *Manager) pruneSets() {
+	if len(m.sets) == 0 {
+		return
+	}
+
+	rules, err := m.backend.ListRules()
+	if err != nil {
+		return
+	}
+
+	used := make(map[string]bool)
+	for _, r := range rules {
+		used[r.SourceSet] = true
+		used[r.DestSet] = true
+	}
+
+	for name := range m.sets {
+		if used[name] {
+			continue
+		}
+		if err := m.backend.DeleteSet(name); err != nil {
+			m.logger.Warn("Failed to delete unused address set", "set", name, "error", err)
+			continue
+		}
+		delete(m.sets, name)
+	}
+}
+
 // AddImmutablePort adds a port to the immutable list and ensures it's open.
 func (m *Manager) AddImmutablePort(port int) error {
 	m.mu.Lock()
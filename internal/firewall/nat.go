@@ -0,0 +1,180 @@
+package firewall
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// NAT rule types.
+const (
+	NATTypeDNAT       = "dnat"       // rewrite the destination (port forward)
+	NATTypeSNAT       = "snat"       // rewrite the source to a fixed address
+	NATTypeMasquerade = "masquerade" // rewrite the source to the outgoing interface's address
+)
+
+// NATRule is a network address translation rule for the syscall layer.
+// DNAT rules are evaluated before routing on incoming traffic; SNAT and
+// masquerade rules after routing on outgoing traffic.
+type NATRule struct {
+	ID         string `json:"id"`
+	Type       string `json:"type"`                // "dnat", "snat", "masquerade"
+	Interface  string `json:"interface,omitempty"` // incoming for dnat, outgoing otherwise; "" = any, "eth*" = prefix
+	Protocol   string `json:"protocol"`            // "tcp", "udp", "all"
+	SourceCIDR string `json:"source_cidr,omitempty"`
+	DestCIDR   string `json:"dest_cidr,omitempty"`
+	Port       int    `json:"port,omitempty"` // matched destination port
+	PortEnd    int    `json:"port_end,omitempty"`
+	ToAddress  string `json:"to_address,omitempty"` // dnat/snat translated address
+	ToPort     int    `json:"to_port,omitempty"`    // dnat translated port; 0 keeps the original
+}
+
+// NATBackend manages NAT rules in chains of their own, alongside the filter
+// rules of a Backend.
+type NATBackend interface {
+	ListNATRules() ([]NATRule, error)
+	AddNATRule(rule NATRule) error
+	// ReplaceNATRule swaps the NAT rule tagged with rule.ID for the new
+	// definition, keeping its place in the chain.
+	ReplaceNATRule(rule NATRule) error
+	DeleteNATRule(id string) error
+}
+
+// ValidateNATRule performs complete validation of a NAT rule.
+func ValidateNATRule(rule NATRule) error {
+	switch rule.Type {
+	case NATTypeDNAT, NATTypeSNAT, NATTypeMasquerade:
+	default:
+		return fmt.Errorf("invalid nat type: %s (must be dnat, snat, or masquerade)", rule.Type)
+	}
+	if rule.Protocol != "tcp" && rule.Protocol != "udp" && rule.Protocol != "all" {
+		return fmt.Errorf("invalid nat protocol: %s (must be tcp, udp, or all)", rule.Protocol)
+	}
+	if err := ValidateInterface(rule.Interface); err != nil {
+		return err
+	}
+	if err := ValidateCIDR(rule.SourceCIDR); err != nil {
+		return err
+	}
+	if err := ValidateCIDR(rule.DestCIDR); err != nil {
+		return err
+	}
+	if err := ValidatePortRange(rule.Port, rule.PortEnd); err != nil {
+		return err
+	}
+	if err := ValidatePort(rule.ToPort); err != nil {
+		return err
+	}
+	if rule.Protocol == "all" && (rule.Port != 0 || rule.PortEnd != 0 || rule.ToPort != 0) {
+		return fmt.Errorf("ports require protocol tcp or udp")
+	}
+
+	switch rule.Type {
+	case NATTypeDNAT, NATTypeSNAT:
+		if ip := net.ParseIP(rule.ToAddress); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("invalid to_address: %q (must be an IPv4 address)", rule.ToAddress)
+		}
+		if rule.Type == NATTypeSNAT && rule.ToPort != 0 {
+			return fmt.Errorf("to_port is only supported on dnat rules")
+		}
+	case NATTypeMasquerade:
+		if rule.ToAddress != "" || rule.ToPort != 0 {
+			return fmt.Errorf("masquerade takes no to_address or to_port")
+		}
+	}
+	return nil
+}
+
+// match returns the filter rule carrying the NAT rule's match, so backends
+// can build it with their filter rule match builders.
+func (r NATRule) match() Rule {
+	rule := Rule{
+		ID:         r.ID,
+		Protocol:   r.Protocol,
+		Port:       r.Port,
+		PortEnd:    r.PortEnd,
+		SourceCIDR: r.SourceCIDR,
+		DestCIDR:   r.DestCIDR,
+	}
+	if r.inbound() {
+		rule.InInterface = r.Interface
+	} else {
+		rule.OutInterface = r.Interface
+	}
+	return rule
+}
+
+// inbound reports whether the rule is evaluated on incoming traffic.
+func (r NATRule) inbound() bool {
+	return r.Type == NATTypeDNAT
+}
+
+// errNoNAT is returned when the backend cannot manage NAT rules.
+var errNoNAT = errors.New("firewall backend does not support nat")
+
+// ListNATRules returns all installed NAT rules.
+func (m *Manager) ListNATRules() ([]NATRule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.nat == nil {
+		return nil, errNoNAT
+	}
+	return m.nat.ListNATRules()
+}
+
+// AddNATRule installs a NAT rule after validation.
+func (m *Manager) AddNATRule(rule NATRule) error {
+	if err := ValidateNATRule(rule); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.nat == nil {
+		return errNoNAT
+	}
+	if err := m.nat.AddNATRule(rule); err != nil {
+		return fmt.Errorf("add nat rule: %w", err)
+	}
+
+	m.logger.Info("NAT rule added", "rule_id", rule.ID, "type", rule.Type, "port", rule.Port)
+	return nil
+}
+
+// ReplaceNATRule updates an installed NAT rule in place after validation.
+func (m *Manager) ReplaceNATRule(rule NATRule) error {
+	if err := ValidateNATRule(rule); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.nat == nil {
+		return errNoNAT
+	}
+	if err := m.nat.ReplaceNATRule(rule); err != nil {
+		return fmt.Errorf("replace nat rule %s: %w", rule.ID, err)
+	}
+
+	m.logger.Info("NAT rule replaced", "rule_id", rule.ID, "type", rule.Type, "port", rule.Port)
+	return nil
+}
+
+// DeleteNATRule removes an installed NAT rule.
+func (m *Manager) DeleteNATRule(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.nat == nil {
+		return errNoNAT
+	}
+	if err := m.nat.DeleteNATRule(id); err != nil {
+		return fmt.Errorf("delete nat rule %s: %w", id, err)
+	}
+
+	m.logger.Info("NAT rule deleted", "rule_id", id)
+	return nil
+}
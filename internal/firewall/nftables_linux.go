@@ -6,8 +6,12 @@ import (
 	"encoding/binary"
 	"fmt"
 	"net"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/google/nftables"
+	"github.com/google/nftables/binaryutil"
 	"github.com/google/nftables/expr"
 
 	"github.com/enjoys-in/secureflow/pkg/logger"
@@ -15,9 +19,12 @@ import (
 
 // Table and chain names managed by this backend.
 const (
-	nftTableName   = "firewall_manager"
-	nftInputChain  = "fm_input"
-	nftOutputChain = "fm_output"
+	nftTableName       = "firewall_manager"
+	nftInputChain      = "fm_input"
+	nftOutputChain     = "fm_output"
+	nftPreroutingChain = "fm_prerouting" // raw priority, for SYNPROXY notrack rules
+	nftNATPreChain     = "fm_nat_prerouting"
+	nftNATPostChain    = "fm_nat_postrouting"
 )
 
 // Protocol numbers (IANA).
@@ -34,11 +41,31 @@ const (
 	icmpPortUnreach      = 3 // ICMP destination port unreachable
 )
 
+// Dynamic set constants (linux/netfilter/nf_tables.h).
+const (
+	nftDynsetOpAdd     = 0     // NFT_DYNSET_OP_ADD
+	nftDynsetOpUpdate  = 1     // NFT_DYNSET_OP_UPDATE
+	nftMeterSize       = 65535 // max tracked sources per meter, as nft uses
+	nftConnlimitInvert = 1     // NFT_CONNLIMIT_F_INV: match when over the count
+)
+
+// Log attribute bits selecting which expr.Log fields are sent to the kernel
+// (NFTA_LOG_* attribute numbers).
+const (
+	nftLogGroup   = 1 << 1 // NFTA_LOG_GROUP
+	nftLogPrefix  = 1 << 2 // NFTA_LOG_PREFIX
+	nftLogSnaplen = 1 << 3 // NFTA_LOG_SNAPLEN
+)
+
+// nftProtoIPv4 is NFPROTO_IPV4, the address family of NAT expressions.
+const nftProtoIPv4 = 2
+
 // nftRuleEntry tracks an nftables kernel rule alongside our logical Rule.
 type nftRuleEntry struct {
 	fwRule  Rule           // our application-level rule
 	nftRule *nftables.Rule // kernel rule (Handle populated after Flush)
 	chain   *nftables.Chain
+	meter   *nftables.Set // per-source rate or connection limit state, if any
 }
 
 // NFTablesBackend implements the Backend interface using the nftables netlink
@@ -58,7 +85,13 @@ type NFTablesBackend struct {
 	table    *nftables.Table
 	inChain  *nftables.Chain
 	outChain *nftables.Chain
+	preChain *nftables.Chain
 	rules    map[string]*nftRuleEntry // keyed by our rule ID
+	sets     map[string]*nftables.Set // named address sets keyed by name
+	natPre   *nftables.Chain          // DNAT chain, created on first use
+	natPost  *nftables.Chain          // SNAT / masquerade chain, created on first use
+	natRules map[string]NATRule       // managed NAT rules keyed by ID
+	logGroup uint16                   // NFLOG group for limit hits; 0 until SetupNFLOG
 }
 
 // NewNFTablesBackend opens a netlink socket to the kernel's nf_tables
@@ -100,6 +133,15 @@ func NewNFTablesBackend(log *logger.Logger) (*NFTablesBackend, error) {
 		Priority: nftables.ChainPriorityFilter,
 	})
 
+	// Create PREROUTING chain at raw priority, ahead of conntrack.
+	preChain := conn.AddChain(&nftables.Chain{
+		Name:     nftPreroutingChain,
+		Table:    table,
+		Type:     nftables.ChainTypeFilter,
+		Hooknum:  nftables.ChainHookPrerouting,
+		Priority: nftables.ChainPriorityRaw,
+	})
+
 	// Commit table + chains to kernel as an atomic batch.
 	if err := conn.Flush(); err != nil {
 		return nil, fmt.Errorf("nftables: flush initial setup: %w", err)
@@ -117,7 +159,10 @@ func NewNFTablesBackend(log *logger.Logger) (*NFTablesBackend, error) {
 		table:    table,
 		inChain:  inChain,
 		outChain: outChain,
+		preChain: preChain,
 		rules:    make(map[string]*nftRuleEntry),
+		sets:     make(map[string]*nftables.Set),
+		natRules: make(map[string]NATRule),
 	}, nil
 }
 
@@ -134,11 +179,29 @@ func (b *NFTablesBackend) ListRules() ([]Rule, error) {
 
 // AddRule builds nftables expressions for the given rule and sends them
 // to the kernel via a netlink batch.
-func (b *NFTablesBackend) AddRule(rule Rule) error {
+func (b *NFTablesBackend) AddRule(rule Rule) (err error) {
+	defer b.discardOnError(&err)
+
 	chain := b.chainFor(rule.Direction)
-	exprs := b.buildExprs(rule)
+	exprs, meter, err := b.buildExprs(rule, nil)
+	if err != nil {
+		return err
+	}
+
+	companions, err := b.companionRules(rule, chain)
+	if err != nil {
+		return err
+	}
+	for _, c := range companions {
+		b.conn.AddRule(c)
+	}
 
-	nftRule := b.conn.AddRule(&nftables.Rule{
+	// Priority rules are inserted at the head of the chain instead.
+	add := b.conn.AddRule
+	if rule.Priority {
+		add = b.conn.InsertRule
+	}
+	nftRule := add(&nftables.Rule{
 		Table:    b.table,
 		Chain:    chain,
 		Exprs:    exprs,
@@ -155,6 +218,7 @@ func (b *NFTablesBackend) AddRule(rule Rule) error {
 		fwRule:  rule,
 		nftRule: nftRule,
 		chain:   chain,
+		meter:   meter,
 	}
 
 	b.logger.Info("nftables: rule added via netlink",
@@ -167,6 +231,104 @@ func (b *NFTablesBackend) AddRule(rule Rule) error {
 	return nil
 }
 
+// ReplaceRule swaps an existing kernel rule for a new definition. Within the
+// same chain this is an NLM_F_REPLACE by handle; across chains the add and
+// delete are sent in one netlink batch, which the kernel commits atomically.
+func (b *NFTablesBackend) ReplaceRule(rule Rule) (err error) {
+	defer b.discardOnError(&err)
+
+	entry, ok := b.rules[rule.ID]
+	if !ok {
+		return fmt.Errorf("nftables: rule %s not found in tracker", rule.ID)
+	}
+
+	handle := entry.nftRule.Handle
+	if handle == 0 {
+		h, err := b.lookupHandle(rule.ID, entry.chain)
+		if err != nil {
+			return err
+		}
+		handle = h
+	}
+
+	chain := b.chainFor(rule.Direction)
+	exprs, meter, err := b.buildExprs(rule, entry.meter)
+	if err != nil {
+		return err
+	}
+
+	// Companions are swapped in the same batch: the old ones deleted and the
+	// new ones queued in front of the rule.
+	companions, err := b.companionRules(rule, chain)
+	if err != nil {
+		return err
+	}
+	if err := b.delCompanions(entry); err != nil {
+		return err
+	}
+	for _, c := range companions {
+		if c.Chain == entry.chain {
+			c.Position = handle
+			b.conn.InsertRule(c)
+		} else {
+			b.conn.AddRule(c)
+		}
+	}
+
+	var nftRule *nftables.Rule
+	if chain == entry.chain {
+		nftRule = b.conn.ReplaceRule(&nftables.Rule{
+			Table:    b.table,
+			Chain:    chain,
+			Handle:   handle,
+			Exprs:    exprs,
+			UserData: []byte(rule.ID),
+		})
+	} else {
+		nftRule = b.conn.AddRule(&nftables.Rule{
+			Table:    b.table,
+			Chain:    chain,
+			Exprs:    exprs,
+			UserData: []byte(rule.ID),
+		})
+		if err := b.conn.DelRule(&nftables.Rule{
+			Table:  b.table,
+			Chain:  entry.chain,
+			Handle: handle,
+		}); err != nil {
+			return fmt.Errorf("nftables: del replaced rule: %w", err)
+		}
+	}
+
+	// A meter the new definition no longer uses goes in the same batch.
+	if entry.meter != nil && entry.meter != meter {
+		b.conn.DelSet(entry.meter)
+	}
+
+	if err := b.conn.Flush(); err != nil {
+		return fmt.Errorf("nftables: replace rule: %w", err)
+	}
+
+	// The kernel allocates a fresh handle for the replacement; clear ours so
+	// later operations resolve it via UserData instead of a stale value.
+	nftRule.Handle = 0
+
+	b.rules[rule.ID] = &nftRuleEntry{
+		fwRule:  rule,
+		nftRule: nftRule,
+		chain:   chain,
+		meter:   meter,
+	}
+
+	b.logger.Info("nftables: rule replaced via netlink",
+		"rule_id", rule.ID,
+		"port", rule.Port,
+		"protocol", rule.Protocol,
+		"action", rule.Action,
+	)
+	return nil
+}
+
 // DeleteRule removes a rule from the kernel using its handle.
 func (b *NFTablesBackend) DeleteRule(id string) error {
 	entry, ok := b.rules[id]
@@ -185,6 +347,12 @@ func (b *NFTablesBackend) DeleteRule(id string) error {
 			return err
 		}
 	}
+	if err := b.delCompanions(entry); err != nil {
+		return err
+	}
+	if entry.meter != nil {
+		b.conn.DelSet(entry.meter)
+	}
 
 	if err := b.conn.Flush(); err != nil {
 		// Rule may have been removed externally; log and continue.
@@ -200,8 +368,14 @@ func (b *NFTablesBackend) DeleteRule(id string) error {
 
 // Flush removes all rules from the managed chains.
 func (b *NFTablesBackend) Flush() error {
+	b.conn.FlushChain(b.preChain)
 	b.conn.FlushChain(b.inChain)
 	b.conn.FlushChain(b.outChain)
+	for _, entry := range b.rules {
+		if entry.meter != nil {
+			b.conn.DelSet(entry.meter)
+		}
+	}
 
 	if err := b.conn.Flush(); err != nil {
 		return fmt.Errorf("nftables: flush chains: %w", err)
@@ -231,6 +405,58 @@ func (b *NFTablesBackend) EnsurePort(port int, protocol, action string) error {
 	return b.AddRule(rule)
 }
 
+// SyncSet creates a named IPv4 interval set on first use and replaces its
+// members. The flush and re-add go out in one netlink batch, so the kernel
+// swaps the contents atomically.
+func (b *NFTablesBackend) SyncSet(name string, cidrs []string) error {
+	elems := setElements(cidrs)
+
+	set, ok := b.sets[name]
+	if !ok {
+		set = &nftables.Set{
+			Table:    b.table,
+			Name:     name,
+			KeyType:  nftables.TypeIPAddr,
+			Interval: true,
+		}
+		if err := b.conn.AddSet(set, elems); err != nil {
+			return fmt.Errorf("nftables: add set %s: %w", name, err)
+		}
+	} else {
+		b.conn.FlushSet(set)
+		if len(elems) > 0 {
+			if err := b.conn.SetAddElements(set, elems); err != nil {
+				return fmt.Errorf("nftables: add elements to %s: %w", name, err)
+			}
+		}
+	}
+
+	if err := b.conn.Flush(); err != nil {
+		return fmt.Errorf("nftables: sync set %s: %w", name, err)
+	}
+
+	b.sets[name] = set
+	b.logger.Info("nftables: set synced via netlink", "set", name, "members", len(cidrs))
+	return nil
+}
+
+// DeleteSet removes a named set. Rules referencing it must be removed first.
+func (b *NFTablesBackend) DeleteSet(name string) error {
+	set, ok := b.sets[name]
+	if !ok {
+		return nil
+	}
+
+	b.conn.DelSet(set)
+	if err := b.conn.Flush(); err != nil {
+		return fmt.Errorf("nftables: delete set %s: %w", name, err)
+	}
+
+	delete(b.sets, name)
+	b.logger.Info("nftables: set deleted via netlink", "set", name)
+	return nil
+}
+
 // ---------- Internal helpers ----------
 
 // chainFor returns the nftables chain for the given direction.
@@ -260,18 +486,227 @@ func (b *NFTablesBackend) deleteByUserData(id string, chain *nftables.Chain) err
 	return nil
 }
 
+// discardOnError drops every operation queued since the last Flush when *err
+// is set, so a half-built change cannot ride along with the next unrelated
+// Flush. google/nftables has no way to clear a batch, but a non-lasting Conn
+// holds nothing besides it, so a fresh one does the job.
+func (b *NFTablesBackend) discardOnError(err *error) {
+	if *err == nil {
+		return
+	}
+	if conn, cerr := nftables.New(); cerr == nil {
+		b.conn = conn
+	}
+}
+
+// lookupHandle fetches rules from the kernel and returns the handle of the
+// one whose UserData matches the given ID.
+func (b *NFTablesBackend) lookupHandle(id string, chain *nftables.Chain) (uint64, error) {
+	kernelRules, err := b.conn.GetRules(b.table, chain)
+	if err != nil {
+		return 0, fmt.Errorf("nftables: get rules for handle lookup: %w", err)
+	}
+	for _, kr := range kernelRules {
+		if string(kr.UserData) == id {
+			return kr.Handle, nil
+		}
+	}
+	return 0, fmt.Errorf("nftables: rule %s not found in kernel", id)
+}
+
 // buildExprs constructs the nftables expression list for a firewall rule.
 //
 // The expression pipeline mirrors what `nft add rule` does internally:
 //
+//  0. Match incoming/outgoing interface name (meta iifname/oifname), then
+//     the socket owner (meta skuid/skgid) and cgroup (socket cgroupv2)
 //  1. Match L4 protocol (meta l4proto)
-//  2. Match destination port (payload transport header offset 2)
+//  2. Match destination port (payload transport header offset 2), or a port
+//     list via an anonymous interval set queued in the same batch; then the
+//     source port (offset 0), or the ICMP type and code (offsets 0 and 1)
 //  3. Match source CIDR (payload network header offset 12 + bitwise mask)
 //  4. Match destination CIDR (payload network header offset 16 + bitwise mask)
-//  5. Terminal action (verdict ACCEPT/DROP or reject expression)
-func (b *NFTablesBackend) buildExprs(rule Rule) []expr.Any {
+//     and any referenced address sets (payload + lookup)
+//  5. Rate limit (limit, or a per-source meter set updated via dynset), or
+//     connection limit (ct count per source, kept in a meter set), logged
+//     to NFLOG when traffic monitoring is on
+//  6. Terminal action (verdict ACCEPT/DROP or reject expression)
+//
+// prevMeter is the meter of the rule being replaced, if any; it is reused
+// when the limit is unchanged so per-source state survives. The returned set
+// is the rule's meter, queued in the same batch when newly created.
+func (b *NFTablesBackend) buildExprs(rule Rule, prevMeter *nftables.Set) ([]expr.Any, *nftables.Set, error) {
+	exprs, err := b.matchExprs(rule)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 5. Rate limit
+	var meter *nftables.Set
+	if rl := rule.RateLimit; rl != nil {
+		if rl.mode() == RateModeConnections {
+			exprs = append(exprs, ctStateExprs(expr.CtStateBitNEW)...)
+		}
+
+		limit := &expr.Limit{
+			Type:  expr.LimitTypePkts,
+			Rate:  uint64(rl.Rate),
+			Unit:  expr.LimitTime(rateUnits[rl.unit()]),
+			Over:  true,
+			Burst: uint32(rl.burst()),
+		}
+
+		if !rl.PerSource {
+			exprs = append(exprs, limit)
+		} else {
+			var err error
+			meter, err = b.meterFor(rule, prevMeter, meterTimeout(rl))
+			if err != nil {
+				return nil, nil, err
+			}
+			exprs = append(exprs,
+				// payload load 4b @ network header + 12 => reg 1
+				&expr.Payload{
+					DestRegister: 1,
+					Base:         expr.PayloadBaseNetworkHeader,
+					Offset:       12,
+					Len:          4,
+				},
+				// dynset update reg 1 @ <meter> { limit over ... }
+				&expr.Dynset{
+					SrcRegKey: 1,
+					SetName:   meter.Name,
+					SetID:     meter.ID,
+					Operation: nftDynsetOpUpdate,
+					Timeout:   meter.Timeout,
+					Exprs:     []expr.Any{limit},
+				},
+			)
+		}
+	}
+
+	// 5b. Connection limit
+	if cl := rule.ConnLimit; cl != nil {
+		exprs = append(exprs, ctStateExprs(expr.CtStateBitNEW)...)
+
+		var err error
+		meter, err = b.meterFor(rule, prevMeter, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// payload load 4b @ network header + 12 => reg 1
+		exprs = append(exprs, &expr.Payload{
+			DestRegister: 1,
+			Base:         expr.PayloadBaseNetworkHeader,
+			Offset:       12,
+			Len:          4,
+		})
+		if mask := cl.mask(); mask < 32 {
+			// bitwise reg1 = reg1 & <prefix mask>, so a subnet shares a count
+			exprs = append(exprs, &expr.Bitwise{
+				SourceRegister: 1,
+				DestRegister:   1,
+				Len:            4,
+				Mask:           net.CIDRMask(mask, 32),
+				Xor:            []byte{0, 0, 0, 0},
+			})
+		}
+		exprs = append(exprs,
+			// dynset add reg 1 @ <meter> { ct count over N }
+			&expr.Dynset{
+				SrcRegKey: 1,
+				SetName:   meter.Name,
+				SetID:     meter.ID,
+				Operation: nftDynsetOpAdd,
+				Exprs: []expr.Any{
+					&expr.Connlimit{Count: uint32(cl.Max), Flags: nftConnlimitInvert},
+				},
+			},
+		)
+		if b.logGroup != 0 {
+			exprs = append(exprs, &expr.Log{
+				Key:   nftLogGroup | nftLogPrefix,
+				Group: b.logGroup,
+				Data:  []byte(hitPrefix(rule, HitConnLimit)),
+			})
+		}
+	}
+
+	// 6. Terminal action
+	exprs = append(exprs, actionExprs(rule.Action, rule.Protocol)...)
+
+	return exprs, meter, nil
+}
+
+// meterFor returns the per-source meter set for a limited rule, reusing
+// prevMeter when its name (and so its limit) is unchanged. A new set is
+// queued in the current batch. A zero timeout leaves entries to be dropped
+// by the set's own expressions, as connlimit does once a source's
+// connections close.
+func (b *NFTablesBackend) meterFor(rule Rule, prevMeter *nftables.Set, timeout time.Duration) (*nftables.Set, error) {
+	name := limitName(rule)
+	if prevMeter != nil && prevMeter.Name == name {
+		return prevMeter, nil
+	}
+	meter := &nftables.Set{
+		Table:      b.table,
+		Name:       name,
+		KeyType:    nftables.TypeIPAddr,
+		Dynamic:    true,
+		HasTimeout: timeout > 0,
+		Timeout:    timeout,
+		Size:       nftMeterSize,
+	}
+	if err := b.conn.AddSet(meter, nil); err != nil {
+		return nil, fmt.Errorf("nftables: add meter %s: %w", name, err)
+	}
+	return meter, nil
+}
+
+// matchExprs builds the match part of a rule (steps 0-4 of buildExprs),
+// shared by the rule and its companions.
+func (b *NFTablesBackend) matchExprs(rule Rule) ([]expr.Any, error) {
 	var exprs []expr.Any
 
+	// 0. Interface matches
+	if rule.InInterface != "" {
+		exprs = append(exprs, ifnameExprs(expr.MetaKeyIIFNAME, rule.InInterface)...)
+	}
+	if rule.OutInterface != "" {
+		exprs = append(exprs, ifnameExprs(expr.MetaKeyOIFNAME, rule.OutInterface)...)
+	}
+
+	// 0b. Socket owner and cgroup matches
+	if rule.UID != nil {
+		exprs = append(exprs,
+			// meta load skuid => reg 1
+			&expr.Meta{Key: expr.MetaKeySKUID, Register: 1},
+			// cmp eq reg 1 <uid>
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: binaryutil.NativeEndian.PutUint32(*rule.UID)},
+		)
+	}
+	if rule.GID != nil {
+		exprs = append(exprs,
+			// meta load skgid => reg 1
+			&expr.Meta{Key: expr.MetaKeySKGID, Register: 1},
+			// cmp eq reg 1 <gid>
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: binaryutil.NativeEndian.PutUint32(*rule.GID)},
+		)
+	}
+	if rule.CgroupPath != "" {
+		id, err := cgroupID(rule.CgroupPath)
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs,
+			// socket cgroupv2 level <n> => reg 1
+			&expr.Socket{Key: expr.SocketKeyCgroupv2, Level: cgroupLevel(rule.CgroupPath), Register: 1},
+			// cmp eq reg 1 <cgroup id>
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: binaryutil.NativeEndian.PutUint64(id)},
+		)
+	}
+
 	// 1. Protocol match
 	if rule.Protocol != "" && rule.Protocol != "all" {
 		proto := protocolNumber(rule.Protocol)
@@ -290,36 +725,47 @@ func (b *NFTablesBackend) buildExprs(rule Rule) []expr.Any {
 	}
 
 	// 2. Destination port match (TCP / UDP only)
-	if rule.Port > 0 && (rule.Protocol == "tcp" || rule.Protocol == "udp") {
-		// payload load 2b @ transport header + 2 => reg 1
-		exprs = append(exprs, &expr.Payload{
-			DestRegister: 1,
-			Base:         expr.PayloadBaseTransportHeader,
-			Offset:       2, // destination port offset in TCP/UDP header
-			Len:          2,
-		})
+	if len(rule.Ports) > 0 && (rule.Protocol == "tcp" || rule.Protocol == "udp") {
+		// Anonymous sets live and die with the rule that references them.
+		set := &nftables.Set{
+			Table:     b.table,
+			Anonymous: true,
+			Constant:  true,
+			Interval:  true,
+			KeyType:   nftables.TypeInetService,
+		}
+		if err := b.conn.AddSet(set, portElements(rule.Ports)); err != nil {
+			return nil, fmt.Errorf("nftables: add port set: %w", err)
+		}
+		exprs = append(exprs,
+			// payload load 2b @ transport header + 2 => reg 1
+			&expr.Payload{
+				DestRegister: 1,
+				Base:         expr.PayloadBaseTransportHeader,
+				Offset:       2,
+				Len:          2,
+			},
+			// lookup reg 1 @ <anonymous set>
+			&expr.Lookup{
+				SourceRegister: 1,
+				SetName:        set.Name,
+				SetID:          set.ID,
+			},
+		)
+	} else if rule.Port > 0 && (rule.Protocol == "tcp" || rule.Protocol == "udp") {
+		exprs = append(exprs, portMatchExprs(2, rule.Port, rule.PortEnd)...)
+	}
 
-		if rule.PortEnd > 0 && rule.PortEnd > rule.Port {
-			// Port range: reg1 >= start AND reg1 <= end
-			exprs = append(exprs,
-				&expr.Cmp{
-					Op:       expr.CmpOpGte,
-					Register: 1,
-					Data:     uint16BE(uint16(rule.Port)),
-				},
-				&expr.Cmp{
-					Op:       expr.CmpOpLte,
-					Register: 1,
-					Data:     uint16BE(uint16(rule.PortEnd)),
-				},
-			)
-		} else {
-			// Single port
-			exprs = append(exprs, &expr.Cmp{
-				Op:       expr.CmpOpEq,
-				Register: 1,
-				Data:     uint16BE(uint16(rule.Port)),
-			})
+	// 2b. Source port match (TCP / UDP only)
+	if rule.SourcePort > 0 && (rule.Protocol == "tcp" || rule.Protocol == "udp") {
+		exprs = append(exprs, portMatchExprs(0, rule.SourcePort, rule.SourcePortEnd)...)
+	}
+
+	// 2c. ICMP type and code match
+	if rule.Protocol == "icmp" && rule.ICMPType != nil {
+		exprs = append(exprs, icmpByteExprs(0, *rule.ICMPType)...)
+		if rule.ICMPCode != nil {
+			exprs = append(exprs, icmpByteExprs(1, *rule.ICMPCode)...)
 		}
 	}
 
@@ -333,10 +779,204 @@ func (b *NFTablesBackend) buildExprs(rule Rule) []expr.Any {
 		exprs = append(exprs, cidrExprs...)
 	}
 
-	// 5. Terminal action
-	exprs = append(exprs, actionExprs(rule.Action, rule.Protocol)...)
+	// 4b. Referenced address sets. A missing set must fail the rule: dropping
+	// the match would widen it to every address.
+	if rule.SourceSet != "" {
+		set, ok := b.sets[rule.SourceSet]
+		if !ok {
+			return nil, fmt.Errorf("source set %q not found", rule.SourceSet)
+		}
+		exprs = append(exprs, setMatchExprs(set, 12)...)
+	}
+	if rule.DestSet != "" {
+		set, ok := b.sets[rule.DestSet]
+		if !ok {
+			return nil, fmt.Errorf("destination set %q not found", rule.DestSet)
+		}
+		exprs = append(exprs, setMatchExprs(set, 16)...)
+	}
 
-	return exprs
+	return exprs, nil
+}
+
+// portMatchExprs matches a TCP/UDP port or inclusive range at offset in the
+// transport header: 0 for the source port, 2 for the destination port.
+func portMatchExprs(offset uint32, port, end int) []expr.Any {
+	exprs := []expr.Any{
+		// payload load 2b @ transport header + offset => reg 1
+		&expr.Payload{
+			DestRegister: 1,
+			Base:         expr.PayloadBaseTransportHeader,
+			Offset:       offset,
+			Len:          2,
+		},
+	}
+
+	if end > 0 && end > port {
+		// Port range: reg1 >= start AND reg1 <= end
+		return append(exprs,
+			&expr.Cmp{
+				Op:       expr.CmpOpGte,
+				Register: 1,
+				Data:     uint16BE(uint16(port)),
+			},
+			&expr.Cmp{
+				Op:       expr.CmpOpLte,
+				Register: 1,
+				Data:     uint16BE(uint16(end)),
+			},
+		)
+	}
+
+	// Single port
+	return append(exprs, &expr.Cmp{
+		Op:       expr.CmpOpEq,
+		Register: 1,
+		Data:     uint16BE(uint16(port)),
+	})
+}
+
+// icmpByteExprs matches one byte of the ICMP header: the type at offset 0 or
+// the code at offset 1.
+func icmpByteExprs(offset uint32, v int) []expr.Any {
+	return []expr.Any{
+		// payload load 1b @ transport header + offset => reg 1
+		&expr.Payload{
+			DestRegister: 1,
+			Base:         expr.PayloadBaseTransportHeader,
+			Offset:       offset,
+			Len:          1,
+		},
+		// cmp eq reg 1 <v>
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{byte(v)}},
+	}
+}
+
+// companionRules builds the kernel rules that accompany a SYN-protected
+// rule, tagged "<id>:<role>" in UserData: a notrack rule in the prerouting
+// chain so handshakes reach SYNPROXY untracked, and in the rule's own chain a
+// SYNPROXY rule answering them followed by a drop of what SYNPROXY leaves
+// invalid. The rules are not queued; callers place them in front of the rule.
+func (b *NFTablesBackend) companionRules(rule Rule, chain *nftables.Chain) ([]*nftables.Rule, error) {
+	if !rule.SynProxy {
+		return nil, nil
+	}
+
+	build := func(role string, c *nftables.Chain, tail ...expr.Any) (*nftables.Rule, error) {
+		exprs, err := b.matchExprs(rule)
+		if err != nil {
+			return nil, err
+		}
+		return &nftables.Rule{
+			Table:    b.table,
+			Chain:    c,
+			Exprs:    append(exprs, tail...),
+			UserData: []byte(rule.ID + ":" + role),
+		}, nil
+	}
+
+	// tcp flags & (fin|syn|rst|ack) == syn
+	synOnly := []expr.Any{
+		&expr.Payload{
+			DestRegister: 1,
+			Base:         expr.PayloadBaseTransportHeader,
+			Offset:       13,
+			Len:          1,
+		},
+		&expr.Bitwise{
+			SourceRegister: 1,
+			DestRegister:   1,
+			Len:            1,
+			Mask:           []byte{0x17},
+			Xor:            []byte{0x00},
+		},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{0x02}},
+	}
+	notrack, err := build("notrack", b.preChain, append(synOnly, &expr.Notrack{})...)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy, err := build("synproxy", chain,
+		append(ctStateExprs(expr.CtStateBitINVALID|expr.CtStateBitUNTRACKED),
+			&expr.SynProxy{
+				Mss:            synproxyMSS,
+				MssValueSet:    true,
+				Wscale:         synproxyWscale,
+				WscaleValueSet: true,
+				Timestamp:      true,
+				SackPerm:       true,
+			},
+		)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	invalid, err := build("invalid", chain,
+		append(ctStateExprs(expr.CtStateBitINVALID),
+			&expr.Verdict{Kind: expr.VerdictDrop},
+		)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*nftables.Rule{proxy, invalid, notrack}, nil
+}
+
+// delCompanions queues deletion of the companion rules of an installed rule.
+func (b *NFTablesBackend) delCompanions(entry *nftRuleEntry) error {
+	if !entry.fwRule.SynProxy {
+		return nil
+	}
+	prefix := entry.fwRule.ID + ":"
+	for _, chain := range []*nftables.Chain{b.preChain, entry.chain} {
+		kernelRules, err := b.conn.GetRules(b.table, chain)
+		if err != nil {
+			return fmt.Errorf("nftables: get rules for companion delete: %w", err)
+		}
+		for _, kr := range kernelRules {
+			if strings.HasPrefix(string(kr.UserData), prefix) {
+				if err := b.conn.DelRule(kr); err != nil {
+					return fmt.Errorf("nftables: del companion rule: %w", err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ctStateExprs matches packets whose conntrack state is any of bits, e.g.
+// ct state new.
+func ctStateExprs(bits uint32) []expr.Any {
+	return []expr.Any{
+		// ct load state => reg 1
+		&expr.Ct{Register: 1, Key: expr.CtKeySTATE},
+		// bitwise reg1 = reg1 & bits
+		&expr.Bitwise{
+			SourceRegister: 1,
+			DestRegister:   1,
+			Len:            4,
+			Mask:           binaryutil.NativeEndian.PutUint32(bits),
+			Xor:            binaryutil.NativeEndian.PutUint32(0),
+		},
+		// cmp neq reg1 0
+		&expr.Cmp{
+			Op:       expr.CmpOpNeq,
+			Register: 1,
+			Data:     binaryutil.NativeEndian.PutUint32(0),
+		},
+	}
+}
+
+// meterTimeout is how long an idle source stays in a meter: two limit
+// windows, but at least a minute.
+func meterTimeout(rl *RateLimit) time.Duration {
+	if t := 2 * rl.window(); t > time.Minute {
+		return t
+	}
+	return time.Minute
 }
 
 // cidrMatchExprs builds payload + bitwise + cmp expressions for an IPv4 CIDR.
@@ -389,6 +1029,58 @@ func cidrMatchExprs(cidr string, offset uint32) []expr.Any {
 	}
 }
 
+// setMatchExprs builds payload + lookup expressions matching an address
+// against a named set. offset is 12 for source IP, 16 for destination IP.
+func setMatchExprs(set *nftables.Set, offset uint32) []expr.Any {
+	return []expr.Any{
+		// payload load 4b @ network header + offset => reg 1
+		&expr.Payload{
+			DestRegister: 1,
+			Base:         expr.PayloadBaseNetworkHeader,
+			Offset:       offset,
+			Len:          4,
+		},
+		// lookup reg 1 @ <set>
+		&expr.Lookup{
+			SourceRegister: 1,
+			SetName:        set.Name,
+			SetID:          set.ID,
+		},
+	}
+}
+
+// setElements encodes CIDRs as interval set elements. Each range is a start
+// key plus an IntervalEnd key one past the last address; a range ending at
+// 255.255.255.255 has no end marker.
+func setElements(cidrs []string) []nftables.SetElement {
+	var elems []nftables.SetElement
+	for _, r := range ipv4Ranges(cidrs) {
+		start := make([]byte, 4)
+		binary.BigEndian.PutUint32(start, r.start)
+		elems = append(elems, nftables.SetElement{Key: start})
+
+		if r.end != ^uint32(0) {
+			end := make([]byte, 4)
+			binary.BigEndian.PutUint32(end, r.end+1)
+			elems = append(elems, nftables.SetElement{Key: end, IntervalEnd: true})
+		}
+	}
+	return elems
+}
+
+// portElements encodes port ranges as interval set elements, following the
+// same start / IntervalEnd layout as setElements.
+func portElements(ports []PortRange) []nftables.SetElement {
+	var elems []nftables.SetElement
+	for _, p := range mergePortRanges(ports) {
+		elems = append(elems, nftables.SetElement{Key: uint16BE(uint16(p.Port))})
+		if p.End < 65535 {
+			elems = append(elems, nftables.SetElement{Key: uint16BE(uint16(p.End + 1)), IntervalEnd: true})
+		}
+	}
+	return elems
+}
+
 // actionExprs returns the terminal expression(s) for a firewall action.
 func actionExprs(action, protocol string) []expr.Any {
 	switch action {
@@ -434,29 +1126,256 @@ func uint16BE(v uint16) []byte {
 	return b
 }
 
+// ---------- NAT ----------
+
+// natChainFor returns the nat chain holding a NAT rule, queuing the nat
+// chains for creation on first use. nat chains need the kernel's NAT
+// support, so hosts that never use NAT don't require it.
+func (b *NFTablesBackend) natChainFor(rule NATRule) *nftables.Chain {
+	if b.natPre == nil {
+		b.natPre = b.conn.AddChain(&nftables.Chain{
+			Name:     nftNATPreChain,
+			Table:    b.table,
+			Type:     nftables.ChainTypeNAT,
+			Hooknum:  nftables.ChainHookPrerouting,
+			Priority: nftables.ChainPriorityNATDest,
+		})
+		b.natPost = b.conn.AddChain(&nftables.Chain{
+			Name:     nftNATPostChain,
+			Table:    b.table,
+			Type:     nftables.ChainTypeNAT,
+			Hooknum:  nftables.ChainHookPostrouting,
+			Priority: nftables.ChainPriorityNATSource,
+		})
+	}
+	if rule.inbound() {
+		return b.natPre
+	}
+	return b.natPost
+}
+
+// buildNATExprs constructs the expression list for a NAT rule: the shared
+// match expressions, then the translation.
+func (b *NFTablesBackend) buildNATExprs(rule NATRule) ([]expr.Any, error) {
+	var exprs []expr.Any
+
+	match, err := b.matchExprs(rule.match())
+	if err != nil {
+		return nil, err
+	}
+	exprs = append(exprs, match...)
+
+	switch rule.Type {
+	case NATTypeDNAT, NATTypeSNAT:
+		nat := &expr.NAT{
+			Type:       expr.NATTypeDestNAT,
+			Family:     nftProtoIPv4,
+			RegAddrMin: 1,
+		}
+		if rule.Type == NATTypeSNAT {
+			nat.Type = expr.NATTypeSourceNAT
+		}
+		exprs = append(exprs, &expr.Immediate{
+			Register: 1,
+			Data:     net.ParseIP(rule.ToAddress).To4(),
+		})
+		if rule.ToPort > 0 {
+			exprs = append(exprs, &expr.Immediate{
+				Register: 2,
+				Data:     uint16BE(uint16(rule.ToPort)),
+			})
+			nat.RegProtoMin = 2
+		}
+		exprs = append(exprs, nat)
+	case NATTypeMasquerade:
+		exprs = append(exprs, &expr.Masq{})
+	}
+	return exprs, nil
+}
+
+// cgroupRoot is where the unified (v2) cgroup hierarchy is mounted.
+const cgroupRoot = "/sys/fs/cgroup"
+
+// cgroupID returns the ID the kernel matches for a cgroup v2 path: the inode
+// number of its directory, as nft resolves it. The cgroup must exist.
+func cgroupID(path string) (uint64, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(cgroupRoot+"/"+path, &st); err != nil {
+		return 0, fmt.Errorf("nftables: cgroup %s: %w", path, err)
+	}
+	return st.Ino, nil
+}
+
+// ifname pads an interface name to IFNAMSIZ, as the kernel compares it.
+func ifname(name string) []byte {
+	b := make([]byte, ifNameMax+1)
+	copy(b, name)
+	return b
+}
+
+// ifnameExprs matches the incoming or outgoing interface name. A wildcard
+// compares only the prefix, as nft does for iifname "eth*".
+func ifnameExprs(key expr.MetaKey, name string) []expr.Any {
+	data := ifname(name)
+	if isWildcardInterface(name) {
+		data = []byte(strings.TrimSuffix(name, ifWildcard))
+	}
+	return []expr.Any{
+		// meta load iifname/oifname => reg 1
+		&expr.Meta{Key: key, Register: 1},
+		// cmp eq reg 1 "<name>\0..." (or just "<prefix>")
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: data},
+	}
+}
+
+// ListNATRules returns all managed NAT rules.
+func (b *NFTablesBackend) ListNATRules() ([]NATRule, error) {
+	out := make([]NATRule, 0, len(b.natRules))
+	for _, r := range b.natRules {
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// AddNATRule appends a NAT rule to its nat chain.
+func (b *NFTablesBackend) AddNATRule(rule NATRule) error {
+	chain := b.natChainFor(rule)
+	exprs, err := b.buildNATExprs(rule)
+	if err != nil {
+		return err
+	}
+
+	b.conn.AddRule(&nftables.Rule{
+		Table:    b.table,
+		Chain:    chain,
+		Exprs:    exprs,
+		UserData: []byte(rule.ID),
+	})
+	if err := b.conn.Flush(); err != nil {
+		if len(b.natRules) == 0 {
+			// The nat chains went down with the batch; queue them again.
+			b.natPre, b.natPost = nil, nil
+		}
+		return fmt.Errorf("nftables: add nat rule: %w", err)
+	}
+
+	b.natRules[rule.ID] = rule
+	b.logger.Info("nftables: nat rule added via netlink",
+		"rule_id", rule.ID,
+		"type", rule.Type,
+		"port", rule.Port,
+	)
+	return nil
+}
+
+// ReplaceNATRule swaps a NAT rule for a new definition in one batch,
+// replacing it by handle when it stays in the same chain.
+func (b *NFTablesBackend) ReplaceNATRule(rule NATRule) error {
+	old, ok := b.natRules[rule.ID]
+	if !ok {
+		return fmt.Errorf("nftables: nat rule %s not found in tracker", rule.ID)
+	}
+
+	oldChain := b.natChainFor(old)
+	chain := b.natChainFor(rule)
+	handle, err := b.lookupHandle(rule.ID, oldChain)
+	if err != nil {
+		return err
+	}
+	exprs, err := b.buildNATExprs(rule)
+	if err != nil {
+		return err
+	}
+
+	if chain == oldChain {
+		b.conn.ReplaceRule(&nftables.Rule{
+			Table:    b.table,
+			Chain:    chain,
+			Handle:   handle,
+			Exprs:    exprs,
+			UserData: []byte(rule.ID),
+		})
+	} else {
+		b.conn.AddRule(&nftables.Rule{
+			Table:    b.table,
+			Chain:    chain,
+			Exprs:    exprs,
+			UserData: []byte(rule.ID),
+		})
+		if err := b.conn.DelRule(&nftables.Rule{
+			Table:  b.table,
+			Chain:  oldChain,
+			Handle: handle,
+		}); err != nil {
+			return fmt.Errorf("nftables: del replaced nat rule: %w", err)
+		}
+	}
+	if err := b.conn.Flush(); err != nil {
+		return fmt.Errorf("nftables: replace nat rule: %w", err)
+	}
+
+	b.natRules[rule.ID] = rule
+	b.logger.Info("nftables: nat rule replaced via netlink",
+		"rule_id", rule.ID,
+		"type", rule.Type,
+		"port", rule.Port,
+	)
+	return nil
+}
+
+// DeleteNATRule removes a NAT rule from the kernel.
+func (b *NFTablesBackend) DeleteNATRule(id string) error {
+	rule, ok := b.natRules[id]
+	if !ok {
+		return fmt.Errorf("nftables: nat rule %s not found in tracker", id)
+	}
+
+	if err := b.deleteByUserData(id, b.natChainFor(rule)); err != nil {
+		return err
+	}
+	if err := b.conn.Flush(); err != nil {
+		b.logger.Warn("nftables: kernel flush for nat delete failed",
+			"rule_id", id, "error", err,
+		)
+	}
+
+	delete(b.natRules, id)
+	b.logger.Info("nftables: nat rule deleted via netlink", "rule_id", id)
+	return nil
+}
+
 // SetupNFLOG installs NFLOG rules in the nftables chains so that
 // the kernel copies packet metadata to userspace via netlink.
+//
+// Key must name the attributes to send; without the group attribute the
+// kernel falls back to syslog logging and nothing reaches the NFLOG group.
 func (b *NFTablesBackend) SetupNFLOG(group uint16) error {
+	b.logGroup = group
+
 	// Add a log rule at the start of the input chain.
-	b.conn.AddRule(&nftables.Rule{
+	b.conn.InsertRule(&nftables.Rule{
 		Table: b.table,
 		Chain: b.inChain,
 		Exprs: []expr.Any{
 			&expr.Log{
+				Key:     nftLogGroup | nftLogPrefix | nftLogSnaplen,
 				Group:   group,
 				Snaplen: 128,
+				Data:    []byte("FM:INPUT:ACCEPT:"),
 			},
 		},
 	})
 
 	// Add a log rule at the start of the output chain.
-	b.conn.AddRule(&nftables.Rule{
+	b.conn.InsertRule(&nftables.Rule{
 		Table: b.table,
 		Chain: b.outChain,
 		Exprs: []expr.Any{
 			&expr.Log{
+				Key:     nftLogGroup | nftLogPrefix | nftLogSnaplen,
 				Group:   group,
 				Snaplen: 128,
+				Data:    []byte("FM:OUTPUT:ACCEPT:"),
 			},
 		},
 	})
@@ -470,4 +1389,7 @@ func (b *NFTablesBackend) SetupNFLOG(group uint16) error {
 }
 
 // Ensure compile-time interface compliance.
-var _ Backend = (*NFTablesBackend)(nil)
+var (
+	_ Backend    = (*NFTablesBackend)(nil)
+	_ NATBackend = (*NFTablesBackend)(nil)
+)
@@ -11,16 +11,20 @@ import (
 // NFTablesBackend is a development stub for non-Linux platforms.
 // On Linux, the real implementation in nftables_linux.go is used instead.
 type NFTablesBackend struct {
-	logger *logger.Logger
-	rules  map[string]Rule
+	logger   *logger.Logger
+	rules    map[string]Rule
+	sets     map[string][]string
+	natRules map[string]NATRule
 }
 
 // NewNFTablesBackend creates a stub nftables backend (non-Linux).
 func NewNFTablesBackend(log *logger.Logger) (*NFTablesBackend, error) {
 	log.Info("nftables: using in-memory stub (non-Linux platform)")
 	return &NFTablesBackend{
-		logger: log,
-		rules:  make(map[string]Rule),
+		logger:   log,
+		rules:    make(map[string]Rule),
+		sets:     make(map[string][]string),
+		natRules: make(map[string]NATRule),
 	}, nil
 }
 
@@ -38,6 +42,15 @@ func (b *NFTablesBackend) AddRule(rule Rule) error {
 	return nil
 }
 
+func (b *NFTablesBackend) ReplaceRule(rule Rule) error {
+	if _, ok := b.rules[rule.ID]; !ok {
+		return fmt.Errorf("nftables-stub: rule %s not found", rule.ID)
+	}
+	b.rules[rule.ID] = rule
+	b.logger.Info("nftables-stub: rule replaced", "rule_id", rule.ID, "port", rule.Port)
+	return nil
+}
+
 func (b *NFTablesBackend) DeleteRule(id string) error {
 	if _, ok := b.rules[id]; !ok {
 		return fmt.Errorf("nftables-stub: rule %s not found", id)
@@ -66,7 +79,51 @@ func (b *NFTablesBackend) EnsurePort(port int, protocol, action string) error {
 	return nil
 }
 
+func (b *NFTablesBackend) SyncSet(name string, cidrs []string) error {
+	b.sets[name] = append([]string(nil), cidrs...)
+	b.logger.Info("nftables-stub: set synced", "set", name, "members", len(cidrs))
+	return nil
+}
+
+func (b *NFTablesBackend) DeleteSet(name string) error {
+	delete(b.sets, name)
+	b.logger.Info("nftables-stub: set deleted", "set", name)
+	return nil
+}
+
 func (b *NFTablesBackend) SetupNFLOG(group uint16) error {
 	b.logger.Info("nftables-stub: NFLOG setup skipped (non-Linux)", "group", group)
 	return nil
 }
+
+func (b *NFTablesBackend) ListNATRules() ([]NATRule, error) {
+	out := make([]NATRule, 0, len(b.natRules))
+	for _, r := range b.natRules {
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+func (b *NFTablesBackend) AddNATRule(rule NATRule) error {
+	b.natRules[rule.ID] = rule
+	b.logger.Info("nftables-stub: nat rule added", "rule_id", rule.ID, "type", rule.Type)
+	return nil
+}
+
+func (b *NFTablesBackend) ReplaceNATRule(rule NATRule) error {
+	if _, ok := b.natRules[rule.ID]; !ok {
+		return fmt.Errorf("nftables-stub: nat rule %s not found", rule.ID)
+	}
+	b.natRules[rule.ID] = rule
+	b.logger.Info("nftables-stub: nat rule replaced", "rule_id", rule.ID, "type", rule.Type)
+	return nil
+}
+
+func (b *NFTablesBackend) DeleteNATRule(id string) error {
+	if _, ok := b.natRules[id]; !ok {
+		return fmt.Errorf("nftables-stub: nat rule %s not found", id)
+	}
+	delete(b.natRules, id)
+	b.logger.Info("nftables-stub: nat rule deleted", "rule_id", id)
+	return nil
+}
@@ -0,0 +1,134 @@
+package firewall
+
+import (
+	"fmt"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// ValidateOwner checks a rule's socket owner and cgroup matches. Only locally
+// generated traffic has a socket to match, so they are limited to outbound
+// rules.
+func ValidateOwner(rule Rule) error {
+	if rule.OwnerUser == "" && rule.OwnerGroup == "" && rule.Cgroup == "" {
+		return nil
+	}
+	if rule.Direction != "outbound" {
+		return fmt.Errorf("owner_user, owner_group and cgroup are only supported on outbound rules")
+	}
+	if strings.ContainsAny(rule.OwnerUser, " :/\t\n") {
+		return fmt.Errorf("invalid owner_user: %q", rule.OwnerUser)
+	}
+	if strings.ContainsAny(rule.OwnerGroup, " :/\t\n") {
+		return fmt.Errorf("invalid owner_group: %q", rule.OwnerGroup)
+	}
+	if rule.Cgroup != "" {
+		c := strings.Trim(rule.Cgroup, "/")
+		if c == "" || strings.ContainsAny(c, " \t\n") || strings.Contains(c, "..") {
+			return fmt.Errorf("invalid cgroup: %q", rule.Cgroup)
+		}
+	}
+	return nil
+}
+
+// resolveOwner fills in a rule's UID, GID and CgroupPath from its owner and
+// cgroup names. It runs every time the rule is installed, so accounts and
+// units created after the rule was saved are picked up.
+func resolveOwner(rule *Rule) error {
+	rule.UID, rule.GID, rule.CgroupPath = nil, nil, ""
+
+	if rule.OwnerUser != "" {
+		uid, err := lookupID(rule.OwnerUser, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		if err != nil {
+			return fmt.Errorf("resolve owner_user %q: %w", rule.OwnerUser, err)
+		}
+		rule.UID = &uid
+	}
+	if rule.OwnerGroup != "" {
+		gid, err := lookupID(rule.OwnerGroup, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if err != nil {
+			return fmt.Errorf("resolve owner_group %q: %w", rule.OwnerGroup, err)
+		}
+		rule.GID = &gid
+	}
+	if rule.Cgroup != "" {
+		path, err := resolveCgroup(rule.Cgroup)
+		if err != nil {
+			return fmt.Errorf("resolve cgroup %q: %w", rule.Cgroup, err)
+		}
+		rule.CgroupPath = path
+	}
+	return nil
+}
+
+// lookupID returns a numeric ID as is, or looks a name up.
+func lookupID(name string, lookup func(string) (string, error)) (uint32, error) {
+	id := name
+	if _, err := strconv.ParseUint(name, 10, 32); err != nil {
+		if id, err = lookup(name); err != nil {
+			return 0, err
+		}
+	}
+	n, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid id %q", id)
+	}
+	return uint32(n), nil
+}
+
+// systemdUnitSuffixes are the unit types that own a cgroup.
+var systemdUnitSuffixes = []string{".service", ".scope", ".slice"}
+
+// resolveCgroup returns the cgroup v2 path, relative to the cgroup root, of a
+// systemd unit name (e.g. "nginx.service") or of a path given directly (e.g.
+// "system.slice/nginx.service").
+func resolveCgroup(name string) (string, error) {
+	if strings.Contains(name, "/") || !isSystemdUnit(name) {
+		return strings.Trim(name, "/"), nil
+	}
+
+	out, err := exec.Command("systemctl", "show", "--property=ControlGroup", "--value", name).Output()
+	if err != nil {
+		// Without systemctl, assume the default placement of system units.
+		if strings.HasSuffix(name, ".service") {
+			return "system.slice/" + name, nil
+		}
+		return "", fmt.Errorf("systemctl show: %w", err)
+	}
+	path := strings.Trim(strings.TrimSpace(string(out)), "/")
+	if path == "" {
+		return "", fmt.Errorf("unit %s has no cgroup (is it running?)", name)
+	}
+	return path, nil
+}
+
+// isSystemdUnit reports whether name looks like a systemd unit that owns a
+// cgroup.
+func isSystemdUnit(name string) bool {
+	for _, suffix := range systemdUnitSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// cgroupLevel is the depth of a cgroup path below the root, as nft's
+// "socket cgroupv2 level" counts it.
+func cgroupLevel(path string) uint32 {
+	return uint32(strings.Count(path, "/") + 1)
+}
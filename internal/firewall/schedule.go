@@ -0,0 +1,135 @@
+package firewall
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Rules limited to a schedule, directly or through the schedule of their
+// security group's application, are only in the kernel while that schedule is
+// active. The manager holds the others as "parked" and moves rules between
+// the two states when a schedule changes; a schedule it has not been told
+// about counts as inactive.
+
+// SetScheduleActive records whether a schedule is currently inside one of its
+// windows, installs the parked rules it now allows and parks the installed
+// rules it no longer allows. It returns how many rules moved each way.
+func (m *Manager) SetScheduleActive(id string, active bool) (activated, deactivated int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if prev, known := m.schedules[id]; known && prev == active {
+		return 0, 0, nil
+	}
+	m.schedules[id] = active
+	return m.reconcile()
+}
+
+// SetGroupSchedule limits the rules of a security group's application to a
+// schedule; an empty scheduleID lifts the limit. It takes effect the next
+// time the group is applied.
+func (m *Manager) SetGroupSchedule(groupID, scheduleID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if scheduleID == "" {
+		delete(m.groupSchedules, groupID)
+		return
+	}
+	m.groupSchedules[groupID] = scheduleID
+}
+
+// GroupSchedule returns the schedule a security group's application is
+// limited to, or "" if it has none.
+func (m *Manager) GroupSchedule(groupID string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.groupSchedules[groupID]
+}
+
+// ParkedRules returns the rules currently held out of the kernel by an
+// inactive schedule.
+func (m *Manager) ParkedRules() []Rule {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]Rule, 0, len(m.parked))
+	for _, r := range m.parked {
+		out = append(out, r)
+	}
+	return out
+}
+
+// ruleLive reports whether a rule's schedules allow it in the kernel right
+// now. The caller must hold m.mu.
+func (m *Manager) ruleLive(rule Rule) bool {
+	if rule.ScheduleID != "" && !m.schedules[rule.ScheduleID] {
+		return false
+	}
+	if rule.GroupID != "" {
+		if id := m.groupSchedules[rule.GroupID]; id != "" && !m.schedules[id] {
+			return false
+		}
+	}
+	return true
+}
+
+// dropParkedGroup forgets the parked rules of a security group. The caller
+// must hold m.mu.
+func (m *Manager) dropParkedGroup(groupID string) {
+	for id, r := range m.parked {
+		if r.GroupID == groupID {
+			delete(m.parked, id)
+		}
+	}
+}
+
+// reconcile parks installed rules that are no longer live and installs parked
+// rules that are. A rule that fails to move stays where it is and the errors
+// are returned together. The caller must hold m.mu.
+func (m *Manager) reconcile() (activated, deactivated int, err error) {
+	installed, err := m.backend.ListRules()
+	if err != nil {
+		return 0, 0, fmt.Errorf("list rules: %w", err)
+	}
+
+	var errs []error
+	for _, rule := range installed {
+		if m.ruleLive(rule) {
+			continue
+		}
+		if err := m.backend.DeleteRule(rule.ID); err != nil {
+			errs = append(errs, fmt.Errorf("park rule %s: %w", rule.ID, err))
+			continue
+		}
+		m.parked[rule.ID] = rule
+		deactivated++
+	}
+
+	for id, rule := range m.parked {
+		if !m.ruleLive(rule) {
+			continue
+		}
+		if err := m.prepare(&rule); err != nil {
+			errs = append(errs, fmt.Errorf("activate rule %s: %w", id, err))
+			continue
+		}
+		if err := m.backend.AddRule(rule); err != nil {
+			errs = append(errs, fmt.Errorf("activate rule %s: %w", id, err))
+			continue
+		}
+		delete(m.parked, id)
+		activated++
+	}
+
+	for _, port := range m.immutablePorts {
+		_ = m.backend.EnsurePort(port, "tcp", "ACCEPT")
+	}
+	m.pruneSets()
+
+	if activated > 0 || deactivated > 0 {
+		m.logger.Info("Scheduled rules reconciled", "activated", activated, "deactivated", deactivated)
+	}
+	return activated, deactivated, errors.Join(errs...)
+}
@@ -0,0 +1,175 @@
+package firewall
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"sort"
+	"strings"
+)
+
+// Reference kinds a rule can use in place of a literal source/destination CIDR.
+// Each referenced object is compiled into a named kernel set (nftables set or
+// ipset) holding the addresses it currently stands for.
+const (
+	RefSecurityGroup = "security_group" // IPs of servers the group is applied to
+	RefAddressObject = "address_object" // addresses listed in a named address object
+	RefFQDN          = "fqdn"           // addresses a hostname currently resolves to
+	RefCountry       = "country"        // GeoIP networks of a comma-separated list of country codes
+	RefThreatFeed    = "threat_feed"    // addresses a threat feed currently blocks
+	RefJail          = "jail"           // addresses a jail has banned
+	RefDetector      = "detector"       // addresses a traffic detector, e.g. "portscan", has blocked
+)
+
+// setPrefixes keeps set names short enough for ipset (31 chars max).
+var setPrefixes = map[string]string{
+	RefSecurityGroup: "fm_sg_",
+	RefAddressObject: "fm_ao_",
+	RefFQDN:          "fm_fq_",
+	RefCountry:       "fm_cc_",
+	RefThreatFeed:    "fm_tf_",
+	RefJail:          "fm_jl_",
+	RefDetector:      "fm_dt_",
+}
+
+// AddressResolver expands a reference into the IPs/CIDRs it currently stands for.
+type AddressResolver func(kind, id string) ([]string, error)
+
+// setRef identifies the object a kernel set was compiled from.
+type setRef struct {
+	kind string
+	id   string
+}
+
+// sourceRef returns the reference a rule matches its source address against.
+func sourceRef(rule *Rule) (kind, id string) {
+	if rule.SourceAddressID != "" {
+		return RefAddressObject, rule.SourceAddressID
+	}
+	if rule.SourceFQDN != "" {
+		return RefFQDN, rule.SourceFQDN
+	}
+	if len(rule.SourceCountries) > 0 {
+		return RefCountry, strings.Join(rule.SourceCountries, ",")
+	}
+	if rule.SourceFeedID != "" {
+		return RefThreatFeed, rule.SourceFeedID
+	}
+	if rule.SourceJailID != "" {
+		return RefJail, rule.SourceJailID
+	}
+	if rule.SourceDetector != "" {
+		return RefDetector, rule.SourceDetector
+	}
+	return RefSecurityGroup, rule.SourceGroupID
+}
+
+// destRef returns the reference a rule matches its destination address against.
+func destRef(rule *Rule) (kind, id string) {
+	if rule.DestAddressID != "" {
+		return RefAddressObject, rule.DestAddressID
+	}
+	if rule.DestFQDN != "" {
+		return RefFQDN, rule.DestFQDN
+	}
+	if len(rule.DestCountries) > 0 {
+		return RefCountry, strings.Join(rule.DestCountries, ",")
+	}
+	return RefSecurityGroup, rule.DestGroupID
+}
+
+// setName derives a stable kernel set name from a reference. Hostnames and
+// country lists are hashed, since they may be long and contain punctuation.
+func setName(kind, id string) string {
+	if kind == RefFQDN || kind == RefCountry {
+		sum := sha256.Sum256([]byte(id))
+		id = hex.EncodeToString(sum[:])
+	}
+	compact := strings.ReplaceAll(id, "-", "")
+	if len(compact) > 16 {
+		compact = compact[:16]
+	}
+	return setPrefixes[kind] + compact
+}
+
+// ipv4CIDRs normalises addresses to IPv4 CIDR notation. Anything that is not
+// IPv4 (our managed tables are IPv4-only) is returned in skipped.
+func ipv4CIDRs(addrs []string) (cidrs, skipped []string) {
+	cidrs = make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		a = strings.TrimSpace(a)
+		c := a
+		if !strings.Contains(c, "/") {
+			c += "/32"
+		}
+		ip, ipNet, err := net.ParseCIDR(c)
+		if err != nil || ip.To4() == nil {
+			skipped = append(skipped, a)
+			continue
+		}
+		cidrs = append(cidrs, ipNet.String())
+	}
+	return cidrs, skipped
+}
+
+// ipv4Range is an inclusive range of IPv4 addresses as integers.
+type ipv4Range struct {
+	start uint32
+	end   uint32
+}
+
+// ipv4Ranges converts CIDRs to sorted, merged address ranges. Interval sets
+// reject overlapping elements, so overlaps and adjacency are collapsed here.
+func ipv4Ranges(cidrs []string) []ipv4Range {
+	var ranges []ipv4Range
+	valid, _ := ipv4CIDRs(cidrs)
+	for _, c := range valid {
+		_, ipNet, _ := net.ParseCIDR(c)
+		start := binary.BigEndian.Uint32(ipNet.IP.To4())
+		ones, bits := ipNet.Mask.Size()
+		size := uint32(uint64(1)<<uint(bits-ones) - 1)
+		ranges = append(ranges, ipv4Range{start: start, end: start + size})
+	}
+
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].start < ranges[j].start })
+
+	merged := ranges[:0]
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && (merged[n-1].end == ^uint32(0) || r.start <= merged[n-1].end+1) {
+			if r.end > merged[n-1].end {
+				merged[n-1].end = r.end
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// mergePortRanges sorts port ranges and collapses overlapping or adjacent
+// ones, returning them with End always set.
+func mergePortRanges(ports []PortRange) []PortRange {
+	ranges := make([]PortRange, 0, len(ports))
+	for _, p := range ports {
+		end := p.End
+		if end < p.Port {
+			end = p.Port
+		}
+		ranges = append(ranges, PortRange{Port: p.Port, End: end})
+	}
+
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Port < ranges[j].Port })
+
+	merged := ranges[:0]
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && r.Port <= merged[n-1].End+1 {
+			if r.End > merged[n-1].End {
+				merged[n-1].End = r.End
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
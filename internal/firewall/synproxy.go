@@ -0,0 +1,34 @@
+package firewall
+
+import "fmt"
+
+// SYNPROXY options. The MSS and window scale are what the proxy advertises
+// to clients before the real server is involved, so they are set to common
+// values for Ethernet hosts running a current kernel.
+const (
+	synproxyMSS    = 1460
+	synproxyWscale = 7
+)
+
+// ValidateSynProxy checks that SYN flood protection is only enabled where
+// SYNPROXY can work: an inbound TCP rule that accepts a specific port.
+func ValidateSynProxy(rule Rule) error {
+	if !rule.SynProxy {
+		return nil
+	}
+	if rule.Direction != "inbound" {
+		return fmt.Errorf("synproxy is only supported on inbound rules")
+	}
+	// Service references are checked again once the manager has resolved
+	// their protocol.
+	if rule.Protocol != "tcp" && !(rule.ServiceID != "" && rule.Protocol == "all") {
+		return fmt.Errorf("synproxy is only supported on tcp rules")
+	}
+	if rule.Action != "ACCEPT" {
+		return fmt.Errorf("synproxy requires an ACCEPT rule")
+	}
+	if rule.Port == 0 && rule.ServiceID == "" && len(rule.Ports) == 0 {
+		return fmt.Errorf("synproxy requires a port")
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+//go:build linux
+
+package firewall
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// procSys is where kernel parameters are read from.
+const procSys = "/proc/sys"
+
+// readSysctl returns the value of a kernel parameter, e.g.
+// "net/ipv4/tcp_syncookies". ok is false when the parameter does not exist.
+func readSysctl(name string) (value string, ok bool, err error) {
+	b, err := os.ReadFile(filepath.Join(procSys, name))
+	if os.IsNotExist(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("read sysctl %s: %w", name, err)
+	}
+	return strings.TrimSpace(string(b)), true, nil
+}
+
+// checkSynProxySysctls verifies the kernel settings SYNPROXY depends on.
+// The proxy answers handshakes with SYN cookies carrying TCP timestamp
+// options, and conntrack must not pick up mid-stream ACKs itself or the
+// proxied connections are never handed to the server.
+func checkSynProxySysctls() error {
+	checks := []struct {
+		name string
+		ok   func(string) bool
+		want string
+	}{
+		{"net/ipv4/tcp_syncookies", func(v string) bool { return v != "0" }, "1"},
+		{"net/ipv4/tcp_timestamps", func(v string) bool { return v != "0" }, "1"},
+		{"net/netfilter/nf_conntrack_tcp_loose", func(v string) bool { return v == "0" }, "0"},
+	}
+	for _, c := range checks {
+		v, exists, err := readSysctl(c.name)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			// nf_conntrack is loaded on demand; a missing key is checked
+			// again the next time a protected rule is installed.
+			if strings.HasPrefix(c.name, "net/netfilter/") {
+				continue
+			}
+			return fmt.Errorf("synproxy: sysctl %s not available", strings.ReplaceAll(c.name, "/", "."))
+		}
+		if !c.ok(v) {
+			return fmt.Errorf("synproxy: sysctl %s is %s, must be %s",
+				strings.ReplaceAll(c.name, "/", "."), v, c.want)
+		}
+	}
+	return nil
+}
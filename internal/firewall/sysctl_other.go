@@ -0,0 +1,9 @@
+//go:build !linux
+
+package firewall
+
+// checkSynProxySysctls is a no-op on non-Linux platforms, where the stub
+// backends never touch the kernel.
+func checkSynProxySysctls() error {
+	return nil
+}
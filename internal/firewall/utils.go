@@ -3,6 +3,7 @@ package firewall
 import (
 	"fmt"
 	"net"
+	"sort"
 	"strings"
 )
 
@@ -39,6 +40,43 @@ func ValidatePortRange(start, end int) error {
 	return nil
 }
 
+// ValidateSourcePort checks a rule's source port match, which needs a TCP or
+// UDP protocol (directly or through a service object).
+func ValidateSourcePort(rule Rule) error {
+	if rule.SourcePort == 0 && rule.SourcePortEnd == 0 {
+		return nil
+	}
+	if rule.Protocol != "tcp" && rule.Protocol != "udp" && rule.ServiceID == "" {
+		return fmt.Errorf("source_port requires protocol tcp or udp")
+	}
+	if rule.SourcePort < 1 {
+		return fmt.Errorf("invalid source_port: %d (must be 1-65535)", rule.SourcePort)
+	}
+	return ValidatePortRange(rule.SourcePort, rule.SourcePortEnd)
+}
+
+// ValidateICMP checks a rule's ICMP type and code match.
+func ValidateICMP(rule Rule) error {
+	if rule.ICMPType == nil {
+		if rule.ICMPCode != nil {
+			return fmt.Errorf("icmp_code requires icmp_type")
+		}
+		return nil
+	}
+	if rule.Protocol != "icmp" {
+		return fmt.Errorf("icmp_type requires protocol icmp")
+	}
+	if t := *rule.ICMPType; t < 0 || t > 255 {
+		return fmt.Errorf("invalid icmp_type: %d (must be 0-255)", t)
+	}
+	if rule.ICMPCode != nil {
+		if c := *rule.ICMPCode; c < 0 || c > 255 {
+			return fmt.Errorf("invalid icmp_code: %d (must be 0-255)", c)
+		}
+	}
+	return nil
+}
+
 // ValidateCIDR checks if a CIDR notation is valid.
 func ValidateCIDR(cidr string) error {
 	if cidr == "" {
@@ -54,6 +92,64 @@ func ValidateCIDR(cidr string) error {
 	return nil
 }
 
+// NormalizeFQDN lowercases a hostname and strips surrounding space and the
+// trailing root dot.
+func NormalizeFQDN(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}
+
+// ValidateFQDN checks that a normalised hostname is syntactically valid.
+// Empty is allowed, and IP addresses are refused: use a CIDR for those.
+func ValidateFQDN(name string) error {
+	if name == "" {
+		return nil
+	}
+	if len(name) > 253 || net.ParseIP(name) != nil {
+		return fmt.Errorf("invalid hostname: %s", name)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("invalid hostname: %s", name)
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return fmt.Errorf("invalid hostname: %s", name)
+			}
+		}
+	}
+	return nil
+}
+
+// NormalizeCountries uppercases country codes, then sorts and deduplicates
+// them, so the same countries always map to the same kernel set.
+func NormalizeCountries(codes []string) []string {
+	if len(codes) == 0 {
+		return nil
+	}
+	seen := make(map[string]bool, len(codes))
+	out := make([]string, 0, len(codes))
+	for _, code := range codes {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if !seen[code] {
+			seen[code] = true
+			out = append(out, code)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// ValidateCountries checks that each normalised code is two letters, as in
+// ISO 3166-1 alpha-2.
+func ValidateCountries(codes []string) error {
+	for _, code := range codes {
+		if len(code) != 2 || code[0] < 'A' || code[0] > 'Z' || code[1] < 'A' || code[1] > 'Z' {
+			return fmt.Errorf("invalid country code: %q (must be two letters, e.g. CN)", code)
+		}
+	}
+	return nil
+}
+
 // ValidateAction checks if a firewall action is valid.
 func ValidateAction(action string) error {
 	valid := map[string]bool{"ACCEPT": true, "DROP": true, "REJECT": true}
@@ -89,8 +185,131 @@ func ValidateRule(rule Rule) error {
 	if err := ValidateCIDR(rule.DestCIDR); err != nil {
 		return err
 	}
+	if err := ValidateSourcePort(rule); err != nil {
+		return err
+	}
+	if err := ValidateICMP(rule); err != nil {
+		return err
+	}
+	if err := ValidateOwner(rule); err != nil {
+		return err
+	}
+	if err := ValidateRuleInterfaces(rule); err != nil {
+		return err
+	}
+	if err := ValidateFQDN(rule.SourceFQDN); err != nil {
+		return err
+	}
+	if err := ValidateFQDN(rule.DestFQDN); err != nil {
+		return err
+	}
+	if err := ValidateCountries(rule.SourceCountries); err != nil {
+		return err
+	}
+	if err := ValidateCountries(rule.DestCountries); err != nil {
+		return err
+	}
+	if countSet(!isAnyCIDR(rule.SourceCIDR), rule.SourceGroupID != "", rule.SourceAddressID != "", rule.SourceFQDN != "", len(rule.SourceCountries) > 0, rule.SourceFeedID != "", rule.SourceJailID != "", rule.SourceDetector != "") > 1 {
+		return fmt.Errorf("source_cidr, source_group_id, source_address_id, source_fqdn, source_countries, source_feed_id, source_jail_id and source_detector are mutually exclusive")
+	}
+	if countSet(!isAnyCIDR(rule.DestCIDR), rule.DestGroupID != "", rule.DestAddressID != "", rule.DestFQDN != "", len(rule.DestCountries) > 0) > 1 {
+		return fmt.Errorf("dest_cidr, dest_group_id, dest_address_id, dest_fqdn and dest_countries are mutually exclusive")
+	}
+	if rule.ServiceID != "" && (rule.Port != 0 || rule.PortEnd != 0) {
+		return fmt.Errorf("port and service_id are mutually exclusive")
+	}
+	if len(rule.Ports) > 0 {
+		if rule.ServiceID != "" || rule.Port != 0 || rule.PortEnd != 0 {
+			return fmt.Errorf("ports is mutually exclusive with port and service_id")
+		}
+		if err := ValidatePortList(rule.Protocol, rule.Ports); err != nil {
+			return err
+		}
+	}
 	if err := ValidateAction(rule.Action); err != nil {
 		return err
 	}
+	if err := ValidateRateLimit(rule.RateLimit, rule.Action); err != nil {
+		return err
+	}
+	if err := ValidateConnLimit(rule.ConnLimit, rule.Action); err != nil {
+		return err
+	}
+	if rule.RateLimit != nil && rule.ConnLimit != nil {
+		return fmt.Errorf("rate_limit and conn_limit are mutually exclusive")
+	}
+	if err := ValidateSynProxy(rule); err != nil {
+		return err
+	}
+	if rule.Priority {
+		switch rule.Action {
+		case "DROP", "REJECT":
+		case "ACCEPT":
+			if !isHostCIDR(rule.SourceCIDR) {
+				return fmt.Errorf("a priority ACCEPT rule must match a single source address")
+			}
+		default:
+			return fmt.Errorf("only DROP, REJECT and single-source ACCEPT rules can take priority")
+		}
+	}
 	return nil
 }
+
+// isHostCIDR reports whether a CIDR matches exactly one IPv4 address.
+func isHostCIDR(cidr string) bool {
+	_, n, err := net.ParseCIDR(cidr)
+	if err != nil || n.IP.To4() == nil {
+		return false
+	}
+	ones, bits := n.Mask.Size()
+	return ones == bits
+}
+
+// isAnyCIDR reports whether a CIDR is unset or matches every address.
+func isAnyCIDR(cidr string) bool {
+	return cidr == "" || cidr == "0.0.0.0/0"
+}
+
+// multiportMaxSlots is the xt_multiport limit: 15 ports, a range using two.
+const multiportMaxSlots = 15
+
+// ValidatePortList checks the protocol and port list of a service object.
+// The list is capped at what one iptables multiport match can hold so both
+// backends accept it.
+func ValidatePortList(protocol string, ports []PortRange) error {
+	if protocol != "tcp" && protocol != "udp" {
+		return fmt.Errorf("invalid service protocol: %s (must be tcp or udp)", protocol)
+	}
+	if len(ports) == 0 {
+		return fmt.Errorf("at least one port is required")
+	}
+
+	slots := 0
+	for _, p := range ports {
+		if p.Port < 1 {
+			return fmt.Errorf("invalid port: %d (must be 1-65535)", p.Port)
+		}
+		if err := ValidatePortRange(p.Port, p.End); err != nil {
+			return err
+		}
+		slots++
+		if p.End > 0 {
+			slots++
+		}
+	}
+	if slots > multiportMaxSlots {
+		return fmt.Errorf("too many ports: %d slots used, at most %d (a range counts as two)", slots, multiportMaxSlots)
+	}
+	return nil
+}
+
+// countSet returns how many of the given conditions are true.
+func countSet(conds ...bool) int {
+	n := 0
+	for _, c := range conds {
+		if c {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,192 @@
+// Package fqdn keeps hostname-based firewall rules current. Hostnames are
+// resolved against a configurable DNS server, re-resolved when their records'
+// TTL runs out, and every change in the answer is recorded for audits.
+package fqdn
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	queryTimeout = 5 * time.Second
+	maxUDPSize   = 1232 // EDNS buffer size recommended to avoid fragmentation
+)
+
+// errNoSuchHost is returned for NXDOMAIN answers.
+var errNoSuchHost = errors.New("no such host")
+
+// DefaultServer returns the first nameserver in /etc/resolv.conf, or the
+// local stub resolver when there is none.
+func DefaultServer() string {
+	f, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return "127.0.0.1:53"
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return net.JoinHostPort(fields[1], "53")
+		}
+	}
+	return "127.0.0.1:53"
+}
+
+// serverAddr adds the default DNS port to a server without one.
+func serverAddr(server string) string {
+	if _, _, err := net.SplitHostPort(server); err == nil {
+		return server
+	}
+	return net.JoinHostPort(strings.Trim(server, "[]"), "53")
+}
+
+// lookupA asks server for the IPv4 addresses of host. It returns them with
+// the smallest TTL in the answer, which is how long they may be cached.
+// Truncated UDP answers are retried over TCP.
+func lookupA(ctx context.Context, server, host string) ([]string, time.Duration, error) {
+	name, err := dnsmessage.NewName(host + ".")
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid hostname %s: %w", host, err)
+	}
+	var idBytes [2]byte
+	if _, err := rand.Read(idBytes[:]); err != nil {
+		return nil, 0, err
+	}
+	id := binary.BigEndian.Uint16(idBytes[:])
+
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, 0, err
+	}
+	if err := b.Question(dnsmessage.Question{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, 0, err
+	}
+	if err := b.StartAdditionals(); err != nil {
+		return nil, 0, err
+	}
+	var opt dnsmessage.ResourceHeader
+	if err := opt.SetEDNS0(maxUDPSize, dnsmessage.RCodeSuccess, false); err != nil {
+		return nil, 0, err
+	}
+	if err := b.OPTResource(opt, dnsmessage.OPTResource{}); err != nil {
+		return nil, 0, err
+	}
+	query, err := b.Finish()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	resp, err := exchange(ctx, "udp", serverAddr(server), query)
+	if err != nil {
+		return nil, 0, err
+	}
+	msg, err := parseResponse(resp, id)
+	if err != nil {
+		return nil, 0, err
+	}
+	if msg.Truncated {
+		if resp, err = exchange(ctx, "tcp", serverAddr(server), query); err != nil {
+			return nil, 0, err
+		}
+		if msg, err = parseResponse(resp, id); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	switch msg.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, 0, errNoSuchHost
+	default:
+		return nil, 0, fmt.Errorf("dns server answered %s", msg.RCode)
+	}
+
+	var addrs []string
+	ttl := uint32(0)
+	for _, rr := range msg.Answers {
+		if ttl == 0 || rr.Header.TTL < ttl {
+			ttl = rr.Header.TTL
+		}
+		if a, ok := rr.Body.(*dnsmessage.AResource); ok {
+			addrs = append(addrs, net.IP(a.A[:]).String())
+		}
+	}
+	return addrs, time.Duration(ttl) * time.Second, nil
+}
+
+// exchange sends one query and reads one response. TCP messages carry a
+// two-byte length prefix.
+func exchange(ctx context.Context, network, server string, query []byte) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if network == "tcp" {
+		msg := make([]byte, 2+len(query))
+		binary.BigEndian.PutUint16(msg, uint16(len(query)))
+		copy(msg[2:], query)
+		if _, err := conn.Write(msg); err != nil {
+			return nil, err
+		}
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return nil, err
+		}
+		resp := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, resp); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, 65535)
+	n, err := conn.Read(resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp[:n], nil
+}
+
+// parsedResponse is the part of a DNS response the resolver uses.
+type parsedResponse struct {
+	dnsmessage.Header
+	Answers []dnsmessage.Resource
+}
+
+func parseResponse(resp []byte, id uint16) (*parsedResponse, error) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(resp); err != nil {
+		return nil, fmt.Errorf("malformed dns response: %w", err)
+	}
+	if !msg.Response || msg.ID != id {
+		return nil, fmt.Errorf("unexpected dns response")
+	}
+	return &parsedResponse{Header: msg.Header, Answers: msg.Answers}, nil
+}
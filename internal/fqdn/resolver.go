@@ -0,0 +1,231 @@
+package fqdn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/enjoys-in/secureflow/internal/constants"
+	"github.com/enjoys-in/secureflow/internal/db"
+	"github.com/enjoys-in/secureflow/internal/firewall"
+	"github.com/enjoys-in/secureflow/internal/repository"
+	"github.com/enjoys-in/secureflow/pkg/logger"
+)
+
+// host is the resolution state of one hostname. A host is never modified
+// once stored in Resolver.hosts, so it can be read after r.mu is released;
+// changes store a new one instead.
+type host struct {
+	answer []string             // addresses in the last answer, sorted
+	seen   map[string]time.Time // address -> when it was last in an answer
+	next   time.Time            // when to resolve again
+}
+
+// allowed returns the addresses still within the grace period, sorted.
+// Clients that cached an earlier answer keep working while it ages out.
+func (h *host) allowed(now time.Time) []string {
+	var addrs []string
+	for addr, at := range h.seen {
+		if now.Sub(at) <= constants.FQDNGraceSeconds*time.Second {
+			addrs = append(addrs, addr)
+		}
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+// Resolver resolves the hostnames used by firewall rules and keeps their
+// kernel sets current. It is the address resolver for firewall.RefFQDN.
+type Resolver struct {
+	server  string
+	history repository.FQDNResolutionRepository
+	fw      *firewall.Manager
+	logger  *logger.Logger
+
+	mu    sync.Mutex
+	hosts map[string]*host
+}
+
+// NewResolver creates a resolver that queries server ("host" or
+// "host:port"). An empty server uses the system's first nameserver.
+func NewResolver(server string, history repository.FQDNResolutionRepository, fw *firewall.Manager, log *logger.Logger) *Resolver {
+	if server == "" {
+		server = DefaultServer()
+	}
+	return &Resolver{
+		server:  server,
+		history: history,
+		fw:      fw,
+		logger:  log,
+		hosts:   make(map[string]*host),
+	}
+}
+
+// Addresses returns the addresses a hostname should match. A hostname seen
+// for the first time is resolved immediately; if that fails, the last
+// recorded answer is used so rules survive a restart during a DNS outage.
+func (r *Resolver) Addresses(name string) ([]string, error) {
+	now := time.Now()
+	r.mu.Lock()
+	h, ok := r.hosts[name]
+	r.mu.Unlock()
+	if ok {
+		return h.allowed(now), nil
+	}
+
+	ctx := context.Background()
+	h, _, err := r.resolve(ctx, name, nil)
+	if err != nil {
+		last, lerr := r.history.FindLatest(ctx, name)
+		if lerr != nil {
+			return nil, err
+		}
+		r.logger.Warn("Using last recorded addresses for hostname", "hostname", name, "error", err)
+		h = &host{answer: last.Addresses, seen: make(map[string]time.Time), next: now.Add(constants.FQDNRetrySeconds * time.Second)}
+		for _, addr := range last.Addresses {
+			h.seen[addr] = now
+		}
+	}
+
+	r.mu.Lock()
+	if existing, ok := r.hosts[name]; ok {
+		h = existing
+	} else {
+		r.hosts[name] = h
+	}
+	r.mu.Unlock()
+	return h.allowed(now), nil
+}
+
+// Run re-resolves hostnames as their TTLs run out and refreshes the kernel
+// sets of those whose addresses changed, until ctx is cancelled.
+func (r *Resolver) Run(ctx context.Context) {
+	ticker := time.NewTicker(constants.FQDNCheckSeconds * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			r.check(ctx, now)
+		}
+	}
+}
+
+// check re-resolves the due hostnames still used by installed rules and
+// forgets the rest.
+func (r *Resolver) check(ctx context.Context, now time.Time) {
+	inUse := make(map[string]bool)
+	for _, name := range r.fw.References(firewall.RefFQDN) {
+		inUse[name] = true
+	}
+
+	due := make(map[string]*host) // hostname -> previous state, nil if unknown
+	r.mu.Lock()
+	for name := range r.hosts {
+		if !inUse[name] {
+			delete(r.hosts, name)
+		}
+	}
+	for name := range inUse {
+		if h, ok := r.hosts[name]; !ok || !now.Before(h.next) {
+			due[name] = h
+		}
+	}
+	r.mu.Unlock()
+
+	for name, old := range due {
+		h, changed, err := r.resolve(ctx, name, old)
+		if err != nil {
+			r.logger.Warn("Failed to re-resolve hostname", "hostname", name, "error", err)
+			if old != nil {
+				retry := &host{answer: old.answer, seen: old.seen, next: now.Add(constants.FQDNRetrySeconds * time.Second)}
+				r.mu.Lock()
+				if r.hosts[name] == old {
+					r.hosts[name] = retry
+				}
+				r.mu.Unlock()
+			}
+			continue
+		}
+
+		var before []string
+		if old != nil {
+			before = old.allowed(now)
+		}
+		r.mu.Lock()
+		r.hosts[name] = h
+		r.mu.Unlock()
+		if !changed && equal(before, h.allowed(now)) {
+			continue
+		}
+		if err := r.fw.RefreshReference(firewall.RefFQDN, name); err != nil {
+			r.logger.Error("Failed to refresh hostname set", "hostname", name, "error", err)
+		}
+	}
+}
+
+// resolve looks a hostname up and merges the answer into its previous state,
+// which may be nil. It reports whether the answer differs from the previous
+// one, in which case the new answer is recorded in the history.
+func (r *Resolver) resolve(ctx context.Context, name string, prev *host) (*host, bool, error) {
+	addrs, ttl, err := lookupA(ctx, r.server, name)
+	if err != nil && !errors.Is(err, errNoSuchHost) {
+		return nil, false, fmt.Errorf("resolve %s via %s: %w", name, r.server, err)
+	}
+	sort.Strings(addrs)
+	ttl = clampTTL(ttl)
+
+	now := time.Now()
+	h := &host{answer: addrs, seen: make(map[string]time.Time), next: now.Add(ttl)}
+	if prev != nil {
+		for addr, at := range prev.seen {
+			h.seen[addr] = at
+		}
+	}
+	for _, addr := range addrs {
+		h.seen[addr] = now
+	}
+
+	if prev != nil && equal(prev.answer, addrs) {
+		return h, false, nil
+	}
+	if prev == nil {
+		if last, err := r.history.FindLatest(ctx, name); err == nil && equal(last.Addresses, addrs) {
+			return h, false, nil
+		}
+	}
+	res := &db.FQDNResolution{Hostname: name, Addresses: addrs, TTLSeconds: int(ttl / time.Second)}
+	if err := r.history.Create(ctx, res); err != nil {
+		r.logger.Warn("Failed to record hostname resolution", "hostname", name, "error", err)
+	}
+	r.logger.Info("Hostname resolved", "hostname", name, "addresses", len(addrs), "ttl", ttl)
+	return h, true, nil
+}
+
+// clampTTL keeps re-resolution between the configured bounds.
+func clampTTL(ttl time.Duration) time.Duration {
+	if ttl < constants.FQDNMinTTLSeconds*time.Second {
+		return constants.FQDNMinTTLSeconds * time.Second
+	}
+	if ttl > constants.FQDNMaxTTLSeconds*time.Second {
+		return constants.FQDNMaxTTLSeconds * time.Second
+	}
+	return ttl
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,217 @@
+// Package geoip maps addresses to countries using a local MaxMind-format
+// (MMDB) database such as GeoLite2-Country, and expands country codes into
+// the networks that country rules match.
+package geoip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+
+	"github.com/enjoys-in/secureflow/internal/constants"
+	"github.com/enjoys-in/secureflow/internal/firewall"
+	"github.com/enjoys-in/secureflow/pkg/logger"
+)
+
+// record is the part of a country or city database entry that is used.
+// Anycast and satellite networks may have no country; their registered
+// country is used instead.
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+func (r *record) code() string {
+	if r.Country.ISOCode != "" {
+		return r.Country.ISOCode
+	}
+	return r.RegisteredCountry.ISOCode
+}
+
+// Info describes the loaded database.
+type Info struct {
+	Path      string    `json:"path"`
+	Type      string    `json:"type"` // e.g. "GeoLite2-Country"
+	BuildTime time.Time `json:"build_time"`
+	LoadedAt  time.Time `json:"loaded_at"`
+}
+
+// DB is a GeoIP database that is reloaded when its file changes, e.g. after
+// geoipupdate runs.
+type DB struct {
+	path   string
+	fw     *firewall.Manager
+	logger *logger.Logger
+
+	mu      sync.RWMutex
+	reader  *maxminddb.Reader
+	info    Info
+	modTime time.Time
+
+	indexMu sync.Mutex
+	index   map[string][]string // country code -> IPv4 networks, built on first use
+}
+
+// Open loads the database at path.
+func Open(path string, fw *firewall.Manager, log *logger.Logger) (*DB, error) {
+	d := &DB{path: path, fw: fw, logger: log}
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// load opens the database file and replaces the current one.
+func (d *DB) load() error {
+	st, err := os.Stat(d.path)
+	if err != nil {
+		return fmt.Errorf("open GeoIP database: %w", err)
+	}
+	reader, err := maxminddb.Open(d.path)
+	if err != nil {
+		return fmt.Errorf("open GeoIP database %s: %w", d.path, err)
+	}
+
+	info := Info{
+		Path:      d.path,
+		Type:      reader.Metadata.DatabaseType,
+		BuildTime: time.Unix(int64(reader.Metadata.BuildEpoch), 0).UTC(),
+		LoadedAt:  time.Now().UTC(),
+	}
+
+	d.mu.Lock()
+	old := d.reader
+	d.reader = reader
+	d.modTime = st.ModTime()
+	d.info = info
+	d.mu.Unlock()
+
+	d.indexMu.Lock()
+	d.index = nil
+	d.indexMu.Unlock()
+
+	if old != nil {
+		_ = old.Close()
+	}
+	d.logger.Info("GeoIP database loaded", "path", d.path, "type", info.Type, "build_time", info.BuildTime)
+	return nil
+}
+
+// Info describes the loaded database.
+func (d *DB) Info() Info {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.info
+}
+
+// Country returns the ISO code of the country an address belongs to, or ""
+// when it is unknown or not an address.
+func (d *DB) Country(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var rec record
+	if err := d.reader.Lookup(parsed, &rec); err != nil {
+		return ""
+	}
+	return rec.code()
+}
+
+// Addresses returns the IPv4 networks of every country in a comma-separated
+// list of codes, the reference ID of firewall.RefCountry.
+func (d *DB) Addresses(codes string) ([]string, error) {
+	d.indexMu.Lock()
+	defer d.indexMu.Unlock()
+
+	if d.index == nil {
+		index, err := d.buildIndex()
+		if err != nil {
+			return nil, err
+		}
+		d.index = index
+	}
+
+	var networks []string
+	for _, code := range strings.Split(codes, ",") {
+		networks = append(networks, d.index[code]...)
+	}
+	return networks, nil
+}
+
+// buildIndex walks every IPv4 network in the database once and groups them
+// by country. The caller must hold d.indexMu.
+func (d *DB) buildIndex() (map[string][]string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	start := time.Now()
+	_, ipv4, _ := net.ParseCIDR("0.0.0.0/0")
+	index := make(map[string][]string)
+	networks := d.reader.NetworksWithin(ipv4, maxminddb.SkipAliasedNetworks)
+	for networks.Next() {
+		var rec record
+		network, err := networks.Network(&rec)
+		if err != nil {
+			return nil, fmt.Errorf("read GeoIP network: %w", err)
+		}
+		if code := rec.code(); code != "" {
+			index[code] = append(index[code], network.String())
+		}
+	}
+	if err := networks.Err(); err != nil {
+		return nil, fmt.Errorf("walk GeoIP networks: %w", err)
+	}
+
+	d.logger.Info("GeoIP country index built", "countries", len(index), "duration", time.Since(start))
+	return index, nil
+}
+
+// Run reloads the database when its file changes and refreshes the kernel
+// sets of installed country rules, until ctx is cancelled.
+func (d *DB) Run(ctx context.Context) {
+	ticker := time.NewTicker(constants.GeoIPCheckMinutes * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			st, err := os.Stat(d.path)
+			if err != nil {
+				d.logger.Warn("Failed to check GeoIP database", "path", d.path, "error", err)
+				continue
+			}
+			d.mu.RLock()
+			unchanged := st.ModTime().Equal(d.modTime)
+			d.mu.RUnlock()
+			if unchanged {
+				continue
+			}
+
+			if err := d.load(); err != nil {
+				d.logger.Error("Failed to reload GeoIP database", "error", err)
+				continue
+			}
+			for _, codes := range d.fw.References(firewall.RefCountry) {
+				if err := d.fw.RefreshReference(firewall.RefCountry, codes); err != nil {
+					d.logger.Error("Failed to refresh country set", "countries", codes, "error", err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,415 @@
+package honeypot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/enjoys-in/secureflow/internal/constants"
+	"github.com/enjoys-in/secureflow/internal/db"
+	"github.com/enjoys-in/secureflow/internal/firewall"
+	"github.com/enjoys-in/secureflow/internal/realtime"
+	"github.com/enjoys-in/secureflow/internal/repository"
+	"github.com/enjoys-in/secureflow/internal/websocket"
+	"github.com/enjoys-in/secureflow/pkg/logger"
+)
+
+// ruleID identifies the rule that enforces honeypot blocks.
+const ruleID = "detector-" + constants.DetectorHoneypot
+
+// Status is the runtime state of a decoy. Counters start at zero when the
+// server starts.
+type Status struct {
+	Listening  bool       `json:"listening"`       // listener mode: the socket is bound
+	Error      string     `json:"error,omitempty"` // why the socket could not be bound
+	Touches    int64      `json:"touches"`
+	Blocks     int64      `json:"blocks"`
+	LastTouch  *time.Time `json:"last_touch,omitempty"`
+	LastSource string     `json:"last_source,omitempty"`
+}
+
+// decoy is what the watcher keeps per enabled honeypot.
+type decoy struct {
+	hp     db.Honeypot
+	close  func() // stops the listener; nil unless bound
+	status Status
+}
+
+// touch is a source that touched a decoy and is not blocked yet.
+type touch struct {
+	hp db.Honeypot
+	ip string
+}
+
+// Watcher serves the decoy ports and blocks every IPv4 source that touches
+// one, through the blocked IPs list.
+type Watcher struct {
+	repo        repository.HoneypotRepository
+	blockedRepo repository.BlockedIPRepository
+	auditRepo   repository.AuditLogRepository
+	fw          *firewall.Manager
+	hub         *websocket.Hub
+	logger      *logger.Logger
+
+	mu      sync.Mutex
+	decoys  map[string]*decoy // honeypot ID -> decoy
+	pending map[string]bool   // sources with a touch not yet handled
+	blocked map[string]bool   // sources blocked right now, refreshed every sweep
+
+	touches chan touch
+}
+
+// NewWatcher creates a honeypot watcher. Call Reload to open the decoys.
+func NewWatcher(repo repository.HoneypotRepository, blockedRepo repository.BlockedIPRepository, auditRepo repository.AuditLogRepository, fw *firewall.Manager, hub *websocket.Hub, log *logger.Logger) *Watcher {
+	return &Watcher{
+		repo:        repo,
+		blockedRepo: blockedRepo,
+		auditRepo:   auditRepo,
+		fw:          fw,
+		hub:         hub,
+		logger:      log,
+		decoys:      make(map[string]*decoy),
+		pending:     make(map[string]bool),
+		blocked:     make(map[string]bool),
+		touches:     make(chan touch, 64),
+	}
+}
+
+// Rule returns the firewall rule that drops blocked touchers. It takes
+// priority, so blocks also apply to the immutable ports.
+func Rule() firewall.Rule {
+	return firewall.Rule{
+		ID:             ruleID,
+		Direction:      "inbound",
+		Protocol:       "all",
+		SourceDetector: constants.DetectorHoneypot,
+		Action:         constants.ActionDrop,
+		Priority:       true,
+	}
+}
+
+// Reload reads the honeypots from the database, e.g. after one was edited,
+// and opens or closes their listeners. Decoys whose port and mode did not
+// change keep their listener and counters.
+func (w *Watcher) Reload(ctx context.Context) error {
+	honeypots, err := w.repo.FindAll(ctx, nil, constants.MaxPageLimit, 0)
+	if err != nil {
+		return fmt.Errorf("load honeypots: %w", err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	decoys := make(map[string]*decoy, len(honeypots))
+	for _, hp := range honeypots {
+		if !hp.Enabled {
+			continue
+		}
+		if old, ok := w.decoys[hp.ID]; ok && old.hp.Protocol == hp.Protocol && old.hp.Port == hp.Port && old.hp.Mode == hp.Mode {
+			old.hp = hp
+			decoys[hp.ID] = old
+			delete(w.decoys, hp.ID)
+			continue
+		}
+		decoys[hp.ID] = &decoy{hp: hp}
+	}
+
+	// Close what went away or changed before binding, so a decoy moved
+	// between modes or IDs can take over its port.
+	for _, d := range w.decoys {
+		if d.close != nil {
+			d.close()
+		}
+	}
+	w.decoys = decoys
+	for _, d := range decoys {
+		if d.hp.Mode == constants.HoneypotModeListener && d.close == nil {
+			w.listen(d)
+		}
+	}
+	return nil
+}
+
+// listen binds a listener-mode decoy. The caller must hold w.mu.
+func (w *Watcher) listen(d *decoy) {
+	addr := ":" + strconv.Itoa(d.hp.Port)
+	id := d.hp.ID
+
+	if d.hp.Protocol == constants.ProtocolUDP {
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			w.bindFailed(d, err)
+			return
+		}
+		d.close = func() { _ = conn.Close() }
+		go w.serveUDP(id, conn)
+	} else {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			w.bindFailed(d, err)
+			return
+		}
+		d.close = func() { _ = ln.Close() }
+		go w.serveTCP(id, ln)
+	}
+	d.status.Listening, d.status.Error = true, ""
+}
+
+func (w *Watcher) bindFailed(d *decoy, err error) {
+	d.status.Listening, d.status.Error = false, err.Error()
+	w.logger.Error("Cannot open honeypot", "honeypot", d.hp.Name, "port", d.hp.Port, "protocol", d.hp.Protocol, "error", err)
+}
+
+// serveTCP records every completed connection and closes it right away.
+func (w *Watcher) serveTCP(id string, ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		addr, _ := conn.RemoteAddr().(*net.TCPAddr)
+		_ = conn.Close()
+		if addr != nil {
+			w.touched(id, addr.IP)
+		}
+	}
+}
+
+// serveUDP records every datagram's sender without answering.
+func (w *Watcher) serveUDP(id string, conn net.PacketConn) {
+	buf := make([]byte, 2048)
+	for {
+		_, from, err := conn.ReadFrom(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			continue
+		}
+		if addr, ok := from.(*net.UDPAddr); ok {
+			w.touched(id, addr.IP)
+		}
+	}
+}
+
+// Holds reports whether a decoy's own listener has the port bound, so it
+// is not mistaken for a real service.
+func (w *Watcher) Holds(protocol string, port int) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, d := range w.decoys {
+		if d.close != nil && d.hp.Protocol == protocol && d.hp.Port == port {
+			return true
+		}
+	}
+	return false
+}
+
+// Status returns the runtime state of a decoy; ok is false for honeypots
+// that are disabled or unknown.
+func (w *Watcher) Status(id string) (Status, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	d, ok := w.decoys[id]
+	if !ok {
+		return Status{}, false
+	}
+	return d.status, true
+}
+
+// Observe records a touch if the event is a new inbound TCP connection or a
+// UDP packet to an nflog-mode decoy. It runs on the NFLOG callback, so it
+// never blocks.
+func (w *Watcher) Observe(ev realtime.TrafficEvent) {
+	// Every inbound packet is logged once with this prefix at the head of
+	// INPUT, before the firewall may drop it.
+	if ev.Prefix != "FM:INPUT:ACCEPT:" || ev.Match != "" || ev.DstPort == 0 {
+		return
+	}
+	switch ev.Protocol {
+	case "TCP":
+		if ev.TCPFlags&(realtime.TCPFlagSYN|realtime.TCPFlagACK) != realtime.TCPFlagSYN {
+			return
+		}
+	case "UDP":
+	default:
+		return
+	}
+	protocol := strings.ToLower(ev.Protocol)
+	ip := net.ParseIP(ev.SrcIP)
+	if ip == nil {
+		return
+	}
+
+	w.mu.Lock()
+	var id string
+	for _, d := range w.decoys {
+		if d.hp.Mode == constants.HoneypotModeNFLOG && d.hp.Protocol == protocol && d.hp.Port == ev.DstPort {
+			id = d.hp.ID
+			break
+		}
+	}
+	w.mu.Unlock()
+	if id != "" {
+		w.touched(id, ip)
+	}
+}
+
+// touched counts a touch and queues the source to be blocked. Loopback is
+// never blocked, and IPv6 sources are only counted, as the kernel sets hold
+// IPv4 only.
+func (w *Watcher) touched(id string, ip net.IP) {
+	if ip.IsLoopback() {
+		return
+	}
+	src := ip.String()
+	if v4 := ip.To4(); v4 != nil {
+		src = v4.String()
+	}
+	now := time.Now()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	d, ok := w.decoys[id]
+	if !ok {
+		return
+	}
+	d.status.Touches++
+	d.status.LastTouch, d.status.LastSource = &now, src
+
+	if ip.To4() == nil || w.blocked[src] || w.pending[src] {
+		return
+	}
+	select {
+	case w.touches <- touch{hp: d.hp, ip: src}:
+		w.pending[src] = true
+	default:
+		w.logger.Warn("Honeypot touches backlogged; dropping", "honeypot", d.hp.Name, "source", src)
+	}
+}
+
+// Run installs the blocking rule, blocks touchers and lifts expired blocks
+// until ctx is cancelled, then closes the decoys.
+func (w *Watcher) Run(ctx context.Context) {
+	if err := w.fw.AddRule(Rule()); err != nil {
+		w.logger.Error("Failed to install honeypot block rule", "error", err)
+	}
+	w.sweep(ctx, time.Now())
+
+	ticker := time.NewTicker(constants.HoneypotSweepSeconds * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.mu.Lock()
+			for _, d := range w.decoys {
+				if d.close != nil {
+					d.close()
+					d.close = nil
+				}
+			}
+			w.mu.Unlock()
+			return
+		case t := <-w.touches:
+			w.block(ctx, t)
+		case now := <-ticker.C:
+			w.sweep(ctx, now)
+		}
+	}
+}
+
+// block adds a toucher to the blocked IPs list for the decoy's block time
+// and raises an alert.
+func (w *Watcher) block(ctx context.Context, t touch) {
+	hp := t.hp
+	expiresAt := time.Now().Add(time.Duration(hp.BlockSeconds) * time.Second)
+	entry := &db.BlockedIP{
+		IP:        t.ip,
+		Reason:    fmt.Sprintf("Honeypot %s: touched %s/%d", hp.Name, hp.Protocol, hp.Port),
+		Detector:  constants.DetectorHoneypot,
+		ExpiresAt: &expiresAt,
+	}
+
+	action := "detected"
+	err := w.blockedRepo.CreateBan(ctx, entry)
+	if err == nil {
+		err = w.fw.RefreshReference(firewall.RefDetector, constants.DetectorHoneypot)
+	}
+	if err != nil {
+		w.logger.Error("Failed to block honeypot toucher", "honeypot", hp.Name, "source", t.ip, "error", err)
+		w.hub.EmitError("Failed to block "+t.ip+" for touching honeypot "+hp.Name+": "+err.Error(), "")
+	} else {
+		action = "blocked"
+	}
+
+	w.mu.Lock()
+	delete(w.pending, t.ip)
+	if err == nil {
+		w.blocked[t.ip] = true
+		if d, ok := w.decoys[hp.ID]; ok {
+			d.status.Blocks++
+		}
+	}
+	w.mu.Unlock()
+
+	until := expiresAt.UTC().Format(time.RFC3339)
+	if err == nil {
+		_ = w.auditRepo.Create(ctx, &db.AuditLog{
+			Action:   constants.AuditActionHoneypotBan,
+			Resource: "honeypot:" + hp.ID,
+			Details:  fmt.Sprintf("%s, blocked until %s", entry.Reason, until),
+			IP:       t.ip,
+		})
+	}
+	w.hub.EmitAlert(constants.AlertKindHoneypot, action, t.ip, "", hp.Protocol, hp.Port, entry.Reason)
+	w.logger.Warn("Honeypot touched", "honeypot", hp.Name, "source", t.ip, "action", action, "until", until)
+}
+
+// sweep lifts expired blocks and picks up blocks users lifted or re-imposed
+// through the blocked IPs API.
+func (w *Watcher) sweep(ctx context.Context, now time.Time) {
+	expired, err := w.blockedRepo.ExpireDetectorBans(ctx, constants.DetectorHoneypot, now)
+	if err != nil {
+		if ctx.Err() == nil {
+			w.logger.Error("Failed to lift expired honeypot blocks", "error", err)
+		}
+		return
+	}
+	for _, e := range expired {
+		_ = w.auditRepo.Create(ctx, &db.AuditLog{
+			Action:   constants.AuditActionHoneypotUnban,
+			Resource: "detector:" + constants.DetectorHoneypot,
+			Details:  "Block expired: " + e.Reason,
+			IP:       e.IP,
+		})
+		w.hub.EmitBan("unbanned", constants.DetectorHoneypot, e.IP, "block expired")
+	}
+	if len(expired) > 0 {
+		if err := w.fw.RefreshReference(firewall.RefDetector, constants.DetectorHoneypot); err != nil {
+			w.logger.Error("Failed to refresh honeypot set", "error", err)
+		}
+	}
+
+	ips, err := w.blockedRepo.ListDetectorIPs(ctx, constants.DetectorHoneypot, "blocked")
+	if err != nil {
+		w.logger.Error("Failed to load honeypot blocks", "error", err)
+		return
+	}
+	blocked := make(map[string]bool, len(ips))
+	for _, ip := range ips {
+		blocked[ip] = true
+	}
+	w.mu.Lock()
+	w.blocked = blocked
+	w.mu.Unlock()
+}
@@ -0,0 +1,96 @@
+package jail
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// hostPlaceholder marks where the source address appears in a filter.
+const hostPlaceholder = "<HOST>"
+
+// hostPattern matches an IPv4 or IPv6 address in place of <HOST>.
+const hostPattern = `(?P<host>\d{1,3}(?:\.\d{1,3}){3}|[0-9A-Fa-f]*:[0-9A-Fa-f:.]+)`
+
+// Presets are ready-made filters for common services, matched against
+// plain syslog lines or journal entries rendered as "ident[pid]: message".
+var Presets = map[string][]string{
+	"sshd": {
+		`sshd\[\d+\]: Failed \S+ for (?:invalid user )?\S* from <HOST> port \d+`,
+		`sshd\[\d+\]: Invalid user \S* from <HOST>`,
+		`sshd\[\d+\]: Connection closed by (?:authenticating|invalid) user \S* <HOST> port \d+ \[preauth\]`,
+		`sshd\[\d+\]: maximum authentication attempts exceeded for .* from <HOST> port \d+`,
+	},
+	"postfix-sasl": {
+		`postfix/\S*smtpd\[\d+\]: warning: \S+\[<HOST>\]: SASL \S+ authentication failed`,
+	},
+}
+
+// Compile turns filters into regexes. Each filter must contain <HOST>
+// exactly once; the rest is a Go regular expression.
+func Compile(filters []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(filters))
+	for _, f := range filters {
+		if n := strings.Count(f, hostPlaceholder); n != 1 {
+			return nil, fmt.Errorf("filter %q must contain %s exactly once", f, hostPlaceholder)
+		}
+		re, err := regexp.Compile(strings.Replace(f, hostPlaceholder, hostPattern, 1))
+		if err != nil {
+			return nil, fmt.Errorf("filter %q: %w", f, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// match returns the IPv4 source address of the first filter a line matches.
+// IPv6 sources are ignored, as the kernel sets hold IPv4 only.
+func match(filters []*regexp.Regexp, line string) (string, bool) {
+	for _, re := range filters {
+		m := re.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		ip := net.ParseIP(m[re.SubexpIndex("host")]).To4()
+		if ip == nil {
+			return "", false
+		}
+		return ip.String(), true
+	}
+	return "", false
+}
+
+// ParseIgnore parses CIDRs or single addresses that are never banned.
+func ParseIgnore(entries []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(entries))
+	for _, e := range entries {
+		if !strings.Contains(e, "/") {
+			if ip := net.ParseIP(e); ip != nil && ip.To4() != nil {
+				e += "/32"
+			} else if ip != nil {
+				e += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(e)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ignore entry %q", e)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// ignored reports whether an address is loopback or in an ignore list.
+func ignored(nets []*net.IPNet, ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil || parsed.IsLoopback() {
+		return true
+	}
+	for _, n := range nets {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
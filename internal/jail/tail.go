@@ -0,0 +1,253 @@
+package jail
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/enjoys-in/secureflow/internal/constants"
+)
+
+// tailer follows a log file by polling, like tail -F: it starts at the end,
+// and when the file is rotated or truncated it continues from the start of
+// the new content.
+type tailer struct {
+	path    string
+	file    *os.File
+	info    os.FileInfo
+	offset  int64
+	started bool // false until the first open, which skips existing content
+
+	partial []byte         // incomplete last line of a plain log
+	journal *journalParser // set for journal export logs
+}
+
+func newTailer(path, format string) *tailer {
+	t := &tailer{path: path}
+	if format == constants.JailLogFormatJournal {
+		t.journal = &journalParser{}
+	}
+	return t
+}
+
+// close releases the file.
+func (t *tailer) close() {
+	if t.file != nil {
+		_ = t.file.Close()
+		t.file = nil
+	}
+}
+
+// poll returns the lines appended since the last call. Journal entries are
+// rendered as "ident[pid]: message" so the same filters fit both formats.
+func (t *tailer) poll() ([]string, error) {
+	if err := t.reopenIfRotated(); err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	buf := make([]byte, 64*1024)
+	read := 0
+	for read < constants.JailMaxReadBytes {
+		n, err := t.file.Read(buf)
+		if n > 0 {
+			read += n
+			t.offset += int64(n)
+			lines = append(lines, t.split(buf[:n])...)
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return lines, err
+		}
+	}
+	return lines, nil
+}
+
+// reopenIfRotated opens the file on first use, after it was replaced (a new
+// inode at the same path) and rewinds it after truncation.
+func (t *tailer) reopenIfRotated() error {
+	st, err := os.Stat(t.path)
+	if err != nil {
+		t.close()
+		return err
+	}
+
+	if t.file != nil && os.SameFile(t.info, st) {
+		if st.Size() < t.offset {
+			if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			t.offset = 0
+			t.reset()
+		}
+		return nil
+	}
+
+	t.close()
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	t.file, t.info, t.offset = f, st, 0
+	t.reset()
+	if !t.started {
+		t.started = true
+		if t.offset, err = f.Seek(0, io.SeekEnd); err != nil {
+			t.close()
+			return err
+		}
+	}
+	return nil
+}
+
+// reset drops any partly read line or journal entry.
+func (t *tailer) reset() {
+	t.partial = t.partial[:0]
+	if t.journal != nil {
+		*t.journal = journalParser{}
+	}
+}
+
+// split turns newly read bytes into complete lines or journal entries.
+func (t *tailer) split(data []byte) []string {
+	if t.journal != nil {
+		return t.journal.feed(data)
+	}
+
+	var lines []string
+	for len(data) > 0 {
+		nl := bytes.IndexByte(data, '\n')
+		if nl < 0 {
+			if len(t.partial)+len(data) <= constants.JailMaxLineBytes {
+				t.partial = append(t.partial, data...)
+			}
+			break
+		}
+		t.partial = append(t.partial, data[:nl]...)
+		lines = append(lines, truncate(string(t.partial)))
+		t.partial = t.partial[:0]
+		data = data[nl+1:]
+	}
+	return lines
+}
+
+// journalParser reads the journal export format: entries of "FIELD=value"
+// lines ended by an empty line, where fields holding binary data or newlines
+// are written as "FIELD\n", a little-endian 64-bit size, the data and "\n".
+type journalParser struct {
+	buf  []byte
+	skip uint64 // bytes of an oversized binary field still to discard
+
+	message, ident, pid string
+}
+
+// feed consumes data and returns the entries it completed.
+func (p *journalParser) feed(data []byte) []string {
+	if p.skip > 0 {
+		n := uint64(len(data))
+		if n > p.skip {
+			n = p.skip
+		}
+		p.skip -= n
+		data = data[n:]
+	}
+	p.buf = append(p.buf, data...)
+
+	var entries []string
+	for {
+		nl := bytes.IndexByte(p.buf, '\n')
+		if nl < 0 {
+			if len(p.buf) > constants.JailMaxLineBytes {
+				p.buf = p.buf[:0] // a field this long is not worth waiting for
+			}
+			break
+		}
+		line := p.buf[:nl]
+
+		if len(line) == 0 {
+			if entry := p.entry(); entry != "" {
+				entries = append(entries, entry)
+			}
+			p.buf = p.buf[1:]
+			continue
+		}
+		if eq := bytes.IndexByte(line, '='); eq >= 0 {
+			p.set(string(line[:eq]), string(line[eq+1:]))
+			p.buf = p.buf[nl+1:]
+			continue
+		}
+
+		// Binary field: name, 8-byte size, data, newline.
+		if len(p.buf) < nl+9 {
+			break
+		}
+		size := binary.LittleEndian.Uint64(p.buf[nl+1 : nl+9])
+		if size > constants.JailMaxLineBytes {
+			rest := uint64(len(p.buf) - (nl + 9))
+			if rest >= size+1 {
+				p.buf = p.buf[uint64(nl+9)+size+1:]
+				continue
+			}
+			p.skip = size + 1 - rest
+			p.buf = p.buf[:0]
+			break
+		}
+		end := nl + 9 + int(size)
+		if len(p.buf) < end+1 {
+			break
+		}
+		p.set(string(line), string(p.buf[nl+9:end]))
+		p.buf = p.buf[end+1:]
+	}
+
+	// Keep the unread tail in a fresh array so the old one can be freed.
+	p.buf = append([]byte(nil), p.buf...)
+	return entries
+}
+
+// set records the fields an entry is rendered from.
+func (p *journalParser) set(name, value string) {
+	switch name {
+	case "MESSAGE":
+		p.message = value
+	case "SYSLOG_IDENTIFIER":
+		p.ident = value
+	case "_PID":
+		p.pid = value
+	case "SYSLOG_PID":
+		if p.pid == "" {
+			p.pid = value
+		}
+	}
+}
+
+// entry renders the finished entry like a syslog line and starts a new one.
+func (p *journalParser) entry() string {
+	var b strings.Builder
+	if p.ident != "" {
+		b.WriteString(p.ident)
+		if p.pid != "" {
+			b.WriteString("[" + p.pid + "]")
+		}
+		b.WriteString(": ")
+	}
+	b.WriteString(p.message)
+	msg := p.message
+	p.message, p.ident, p.pid = "", "", ""
+	if msg == "" {
+		return ""
+	}
+	return truncate(b.String())
+}
+
+func truncate(line string) string {
+	if len(line) > constants.JailMaxLineBytes {
+		return line[:constants.JailMaxLineBytes]
+	}
+	return line
+}
@@ -0,0 +1,415 @@
+// Package jail bans sources that fail authentication too often, in the
+// manner of fail2ban. Log files are tailed and matched against each jail's
+// regex filters; a source with too many failures inside the jail's window is
+// added to the blocked IPs with an expiry, and enforced through the jail's
+// kernel set by a priority rule that also covers the immutable ports.
+package jail
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/enjoys-in/secureflow/internal/constants"
+	"github.com/enjoys-in/secureflow/internal/db"
+	"github.com/enjoys-in/secureflow/internal/firewall"
+	"github.com/enjoys-in/secureflow/internal/repository"
+	"github.com/enjoys-in/secureflow/internal/websocket"
+	"github.com/enjoys-in/secureflow/pkg/logger"
+)
+
+// maxListedSources caps the sources a status lists.
+const maxListedSources = 50
+
+// Status is the runtime state of a jail. Counters start at zero when the
+// server starts.
+type Status struct {
+	Watching  bool     `json:"watching"`
+	Error     string   `json:"error,omitempty"` // why the log cannot be read
+	LinesRead int64    `json:"lines_read"`
+	Failures  int64    `json:"failures"` // lines matching a filter
+	Bans      int64    `json:"bans"`
+	Banned    int      `json:"banned"` // sources banned right now
+	Tracked   []Source `json:"tracked"`
+}
+
+// Source is an address with failures inside a jail's window.
+type Source struct {
+	IP          string    `json:"ip"`
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"last_failure"`
+}
+
+// state is what the watcher keeps per jail.
+type state struct {
+	jail    db.Jail
+	filters []*regexp.Regexp
+	ignore  []*net.IPNet
+	tail    *tailer
+	sources map[string][]time.Time // source IP -> failure times in the window, oldest first
+	banned  map[string]bool
+	status  Status
+}
+
+// ban is a source that crossed a jail's threshold.
+type ban struct {
+	jail     db.Jail
+	ip       string
+	failures int
+}
+
+// Watcher tails the logs of enabled jails and bans and releases sources.
+type Watcher struct {
+	jailRepo    repository.JailRepository
+	blockedRepo repository.BlockedIPRepository
+	auditRepo   repository.AuditLogRepository
+	fw          *firewall.Manager
+	hub         *websocket.Hub
+	logger      *logger.Logger
+
+	mu     sync.Mutex
+	states map[string]*state // jail ID -> state
+}
+
+// NewWatcher creates a jail watcher. Call Reload to load the jails.
+func NewWatcher(jailRepo repository.JailRepository, blockedRepo repository.BlockedIPRepository, auditRepo repository.AuditLogRepository, fw *firewall.Manager, hub *websocket.Hub, log *logger.Logger) *Watcher {
+	return &Watcher{
+		jailRepo:    jailRepo,
+		blockedRepo: blockedRepo,
+		auditRepo:   auditRepo,
+		fw:          fw,
+		hub:         hub,
+		logger:      log,
+		states:      make(map[string]*state),
+	}
+}
+
+// Rule returns the firewall rule that blocks inbound traffic from a jail's
+// banned sources. It shares the jail's ID and takes priority, so bans also
+// apply to the immutable ports.
+func Rule(j *db.Jail) firewall.Rule {
+	return firewall.Rule{
+		ID:           j.ID,
+		Direction:    "inbound",
+		Protocol:     "all",
+		SourceJailID: j.ID,
+		Action:       j.Action,
+		Priority:     true,
+	}
+}
+
+// Reload reads the jails from the database, e.g. after one was edited, and
+// installs or removes their rules. Failure counts of unchanged jails are
+// kept; a jail whose log changed is tailed from the current end.
+func (w *Watcher) Reload(ctx context.Context) error {
+	jails, err := w.jailRepo.FindAll(ctx, nil, constants.MaxPageLimit, 0)
+	if err != nil {
+		return fmt.Errorf("load jails: %w", err)
+	}
+
+	states := make(map[string]*state, len(jails))
+	for _, j := range jails {
+		if err := w.install(&j); err != nil {
+			w.logger.Error("Failed to install jail rule", "jail", j.Name, "error", err)
+		}
+		if !j.Enabled {
+			continue
+		}
+		filters, err := Compile(j.Filters)
+		if err != nil {
+			w.logger.Error("Invalid jail filters", "jail", j.Name, "error", err)
+			continue
+		}
+		ignore, err := ParseIgnore(j.IgnoreCIDRs)
+		if err != nil {
+			w.logger.Error("Invalid jail ignore list", "jail", j.Name, "error", err)
+			continue
+		}
+		banned, err := w.bannedIPs(ctx, j.ID)
+		if err != nil {
+			return err
+		}
+		states[j.ID] = &state{
+			jail:    j,
+			filters: filters,
+			ignore:  ignore,
+			sources: make(map[string][]time.Time),
+			banned:  banned,
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for id, old := range w.states {
+		s, ok := states[id]
+		if !ok || old.jail.LogPath != s.jail.LogPath || old.jail.LogFormat != s.jail.LogFormat {
+			old.tail.close()
+			continue
+		}
+		s.tail = old.tail
+		s.sources = old.sources
+		s.status = old.status
+	}
+	for _, s := range states {
+		if s.tail == nil {
+			s.tail = newTailer(s.jail.LogPath, s.jail.LogFormat)
+		}
+		s.status.Banned = len(s.banned)
+	}
+	w.states = states
+	return nil
+}
+
+// install makes the kernel match a jail's definition: an enabled jail's rule
+// is added or replaced, a disabled jail's rule is removed.
+func (w *Watcher) install(j *db.Jail) error {
+	if !j.Enabled {
+		return w.Uninstall(j.ID)
+	}
+	if w.fw.HasRule(j.ID) {
+		return w.fw.ReplaceRule(Rule(j))
+	}
+	return w.fw.AddRule(Rule(j))
+}
+
+// Uninstall removes a jail's rule; its kernel set goes with it.
+func (w *Watcher) Uninstall(jailID string) error {
+	if !w.fw.HasRule(jailID) {
+		return nil
+	}
+	return w.fw.DeleteRule(jailID)
+}
+
+func (w *Watcher) bannedIPs(ctx context.Context, jailID string) (map[string]bool, error) {
+	ips, err := w.blockedRepo.ListJailIPs(ctx, jailID, "blocked")
+	if err != nil {
+		return nil, fmt.Errorf("load jail bans: %w", err)
+	}
+	banned := make(map[string]bool, len(ips))
+	for _, ip := range ips {
+		banned[ip] = true
+	}
+	return banned, nil
+}
+
+// Status returns the runtime state of a jail; ok is false for jails that are
+// disabled or unknown.
+func (w *Watcher) Status(jailID string) (Status, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	s, ok := w.states[jailID]
+	if !ok {
+		return Status{}, false
+	}
+	st := s.status
+	st.Tracked = make([]Source, 0, len(s.sources))
+	for ip, times := range s.sources {
+		st.Tracked = append(st.Tracked, Source{IP: ip, Failures: len(times), LastFailure: times[len(times)-1]})
+	}
+	sort.Slice(st.Tracked, func(i, j int) bool {
+		if st.Tracked[i].Failures != st.Tracked[j].Failures {
+			return st.Tracked[i].Failures > st.Tracked[j].Failures
+		}
+		return st.Tracked[i].IP < st.Tracked[j].IP
+	})
+	if len(st.Tracked) > maxListedSources {
+		st.Tracked = st.Tracked[:maxListedSources]
+	}
+	return st, true
+}
+
+// Run tails the jails' logs, bans sources over their threshold and lifts
+// expired bans, until ctx is cancelled. Bans that expired while the server
+// was down are lifted first.
+func (w *Watcher) Run(ctx context.Context) {
+	poll := time.NewTicker(constants.JailPollMillis * time.Millisecond)
+	defer poll.Stop()
+	sweep := time.NewTicker(constants.JailSweepSeconds * time.Second)
+	defer sweep.Stop()
+
+	w.sweep(ctx, time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			w.mu.Lock()
+			for _, s := range w.states {
+				s.tail.close()
+			}
+			w.mu.Unlock()
+			return
+		case now := <-poll.C:
+			for _, b := range w.poll(now) {
+				w.ban(ctx, b)
+			}
+		case now := <-sweep.C:
+			w.sweep(ctx, now)
+		}
+	}
+}
+
+// poll reads new log lines of every jail and returns the sources that
+// crossed their jail's threshold.
+func (w *Watcher) poll(now time.Time) []ban {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var bans []ban
+	for _, s := range w.states {
+		lines, err := s.tail.poll()
+		if err != nil {
+			if s.status.Error != err.Error() {
+				w.logger.Warn("Cannot read jail log", "jail", s.jail.Name, "path", s.jail.LogPath, "error", err)
+			}
+			s.status.Watching, s.status.Error = false, err.Error()
+		} else {
+			s.status.Watching, s.status.Error = true, ""
+		}
+
+		window := time.Duration(s.jail.FindSeconds) * time.Second
+		for _, line := range lines {
+			s.status.LinesRead++
+			ip, ok := match(s.filters, line)
+			if !ok {
+				continue
+			}
+			s.status.Failures++
+			if s.banned[ip] || ignored(s.ignore, ip) {
+				continue
+			}
+
+			times, tracked := s.sources[ip]
+			if !tracked && len(s.sources) >= constants.JailMaxTrackedSources {
+				prune(s.sources, now, window)
+				if len(s.sources) >= constants.JailMaxTrackedSources {
+					continue
+				}
+			}
+			stale := 0
+			for stale < len(times) && now.Sub(times[stale]) > window {
+				stale++
+			}
+			times = append(times[stale:], now)
+			if len(times) < s.jail.MaxFailures {
+				s.sources[ip] = times
+				continue
+			}
+
+			delete(s.sources, ip)
+			s.banned[ip] = true
+			s.status.Banned = len(s.banned)
+			bans = append(bans, ban{jail: s.jail, ip: ip, failures: len(times)})
+		}
+	}
+	return bans
+}
+
+// prune drops sources whose last failure left the window.
+func prune(sources map[string][]time.Time, now time.Time, window time.Duration) {
+	for ip, times := range sources {
+		if now.Sub(times[len(times)-1]) > window {
+			delete(sources, ip)
+		}
+	}
+}
+
+// ban blocks a source until the jail's ban time has passed.
+func (w *Watcher) ban(ctx context.Context, b ban) {
+	j := b.jail
+	expiresAt := time.Now().Add(time.Duration(j.BanSeconds) * time.Second)
+	entry := &db.BlockedIP{
+		IP:        b.ip,
+		Reason:    fmt.Sprintf("Jail %s: %d failures within %ds", j.Name, b.failures, j.FindSeconds),
+		JailID:    j.ID,
+		ExpiresAt: &expiresAt,
+	}
+	if err := w.blockedRepo.CreateBan(ctx, entry); err != nil {
+		w.logger.Error("Failed to record jail ban", "jail", j.Name, "source", b.ip, "error", err)
+		w.forget(j.ID, b.ip)
+		return
+	}
+	if err := w.fw.RefreshReference(firewall.RefJail, j.ID); err != nil {
+		w.logger.Error("Failed to refresh jail set", "jail", j.Name, "error", err)
+		w.hub.EmitError("Failed to ban "+b.ip+" in jail "+j.Name+": "+err.Error(), "")
+	}
+
+	w.mu.Lock()
+	if s, ok := w.states[j.ID]; ok {
+		s.status.Bans++
+	}
+	w.mu.Unlock()
+
+	until := expiresAt.UTC().Format(time.RFC3339)
+	_ = w.auditRepo.Create(ctx, &db.AuditLog{
+		Action:   constants.AuditActionJailBan,
+		Resource: "jail:" + j.ID,
+		Details:  fmt.Sprintf("%s, banned until %s", entry.Reason, until),
+		IP:       b.ip,
+	})
+	w.hub.EmitBan("banned", j.ID, b.ip, entry.Reason+", until "+until)
+	w.logger.Info("Source banned", "jail", j.Name, "source", b.ip, "failures", b.failures, "until", until)
+}
+
+// forget clears a ban that could not be recorded, so the source can be
+// counted again.
+func (w *Watcher) forget(jailID, ip string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if s, ok := w.states[jailID]; ok {
+		delete(s.banned, ip)
+		s.status.Banned = len(s.banned)
+	}
+}
+
+// sweep lifts expired bans and picks up bans users lifted or re-imposed
+// through the blocked IPs API.
+func (w *Watcher) sweep(ctx context.Context, now time.Time) {
+	expired, err := w.blockedRepo.ExpireJailBans(ctx, now)
+	if err != nil {
+		if ctx.Err() == nil {
+			w.logger.Error("Failed to lift expired bans", "error", err)
+		}
+		return
+	}
+
+	refresh := make(map[string]bool)
+	for _, e := range expired {
+		refresh[e.JailID] = true
+		_ = w.auditRepo.Create(ctx, &db.AuditLog{
+			Action:   constants.AuditActionJailUnban,
+			Resource: "jail:" + e.JailID,
+			Details:  "Ban expired: " + e.Reason,
+			IP:       e.IP,
+		})
+		w.hub.EmitBan("unbanned", e.JailID, e.IP, "ban expired")
+	}
+	for id := range refresh {
+		if err := w.fw.RefreshReference(firewall.RefJail, id); err != nil {
+			w.logger.Error("Failed to refresh jail set", "jail_id", id, "error", err)
+		}
+	}
+
+	w.mu.Lock()
+	ids := make([]string, 0, len(w.states))
+	for id := range w.states {
+		ids = append(ids, id)
+	}
+	w.mu.Unlock()
+	for _, id := range ids {
+		banned, err := w.bannedIPs(ctx, id)
+		if err != nil {
+			w.logger.Error("Failed to load jail bans", "jail_id", id, "error", err)
+			continue
+		}
+		w.mu.Lock()
+		if s, ok := w.states[id]; ok {
+			s.banned = banned
+			s.status.Banned = len(banned)
+		}
+		w.mu.Unlock()
+	}
+}
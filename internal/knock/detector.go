@@ -0,0 +1,289 @@
+package knock
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/enjoys-in/secureflow/internal/constants"
+	"github.com/enjoys-in/secureflow/internal/db"
+	"github.com/enjoys-in/secureflow/internal/firewall"
+	"github.com/enjoys-in/secureflow/internal/realtime"
+	"github.com/enjoys-in/secureflow/internal/repository"
+	"github.com/enjoys-in/secureflow/internal/websocket"
+	"github.com/enjoys-in/secureflow/pkg/logger"
+)
+
+const maxWindow = constants.KnockMaxWindowSeconds * time.Second
+
+// seen is one observed knock.
+type seen struct {
+	step Step
+	at   time.Time
+}
+
+// match is a source that completed a gate's sequence.
+type match struct {
+	gate db.KnockGate
+	ip   string
+}
+
+// Detector watches inbound traffic for knock sequences and opens the gate's
+// port to sources that complete one. Each gate closes its port with a DROP
+// rule; an opening is a temporary ACCEPT rule for the source address at the
+// head of the chain, removed by the rule expiry worker.
+type Detector struct {
+	gateRepo  repository.KnockGateRepository
+	ruleRepo  repository.FirewallRuleRepository
+	auditRepo repository.AuditLogRepository
+	fw        *firewall.Manager
+	hub       *websocket.Hub
+	logger    *logger.Logger
+
+	mu      sync.Mutex
+	gates   []db.KnockGate
+	sources map[string][]seen // source IP -> recent knocks, oldest first
+
+	matches chan match
+	opened  map[string]string // gate ID + "|" + IP -> rule ID; owned by Run
+}
+
+// NewDetector creates a knock detector. Call Reload to load the gates.
+func NewDetector(gateRepo repository.KnockGateRepository, ruleRepo repository.FirewallRuleRepository, auditRepo repository.AuditLogRepository, fw *firewall.Manager, hub *websocket.Hub, log *logger.Logger) *Detector {
+	return &Detector{
+		gateRepo:  gateRepo,
+		ruleRepo:  ruleRepo,
+		auditRepo: auditRepo,
+		fw:        fw,
+		hub:       hub,
+		logger:    log,
+		sources:   make(map[string][]seen),
+		matches:   make(chan match, 64),
+		opened:    make(map[string]string),
+	}
+}
+
+// Rule returns the rule that closes a gate's port to sources that have not
+// knocked. It shares the gate's ID; openings are inserted ahead of it.
+func Rule(g *db.KnockGate) firewall.Rule {
+	return firewall.Rule{
+		ID:        g.ID,
+		Direction: constants.DirectionInbound,
+		Protocol:  g.Protocol,
+		Port:      g.Port,
+		Action:    constants.ActionDrop,
+	}
+}
+
+// Reload reads the gates from the database, e.g. after one was edited, and
+// installs their rules. Knocks in progress are kept.
+func (d *Detector) Reload(ctx context.Context) error {
+	gates, err := d.gateRepo.FindAll(ctx, nil, math.MaxInt32, 0)
+	if err != nil {
+		return fmt.Errorf("load knock gates: %w", err)
+	}
+	for i := range gates {
+		if err := d.Install(&gates[i]); err != nil {
+			d.logger.Error("Failed to install knock gate rule", "gate", gates[i].Name, "error", err)
+		}
+	}
+	d.mu.Lock()
+	d.gates = gates
+	d.mu.Unlock()
+	return nil
+}
+
+// Install closes a gate's port, or moves the rule when the gate's port
+// changed.
+func (d *Detector) Install(g *db.KnockGate) error {
+	if d.fw.HasRule(g.ID) {
+		return d.fw.ReplaceRule(Rule(g))
+	}
+	return d.fw.AddRule(Rule(g))
+}
+
+// Uninstall removes a gate's rule, reopening its port.
+func (d *Detector) Uninstall(gateID string) error {
+	if !d.fw.HasRule(gateID) {
+		return nil
+	}
+	return d.fw.DeleteRule(gateID)
+}
+
+// Observe records a knock if the event is a new inbound TCP connection or a
+// UDP packet, and queues an opening when it completes a gate's sequence. It
+// runs on the NFLOG callback, so it never blocks.
+func (d *Detector) Observe(ev realtime.TrafficEvent) {
+	if !strings.HasPrefix(ev.Prefix, "FM:INPUT:") || ev.Match != "" || ev.SrcIP == "" || ev.DstPort == 0 {
+		return
+	}
+	var step Step
+	switch ev.Protocol {
+	case "TCP":
+		if ev.TCPFlags&(realtime.TCPFlagSYN|realtime.TCPFlagACK) != realtime.TCPFlagSYN {
+			return
+		}
+		step = Step{Protocol: constants.ProtocolTCP, Port: ev.DstPort}
+	case "UDP":
+		step = Step{Protocol: constants.ProtocolUDP, Port: ev.DstPort}
+	default:
+		return
+	}
+	now := ev.Timestamp
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.gates) == 0 {
+		return
+	}
+
+	knocks, tracked := d.sources[ev.SrcIP]
+	// A retransmitted SYN, or the same packet logged twice, is not a knock.
+	if n := len(knocks); n > 0 && knocks[n-1].step == step {
+		return
+	}
+	stale := 0
+	for stale < len(knocks) && now.Sub(knocks[stale].at) > maxWindow {
+		stale++
+	}
+	knocks = append(knocks[stale:], seen{step: step, at: now})
+	if len(knocks) > constants.KnockMaxSteps {
+		knocks = knocks[len(knocks)-constants.KnockMaxSteps:]
+	}
+
+	for i := range d.gates {
+		g := &d.gates[i]
+		if g.SequenceLength > len(knocks) {
+			continue
+		}
+		tail := knocks[len(knocks)-g.SequenceLength:]
+		if now.Sub(tail[0].at) > time.Duration(g.WindowSeconds)*time.Second {
+			continue
+		}
+		steps := make([]Step, len(tail))
+		for j, k := range tail {
+			steps[j] = k.step
+		}
+		if subtle.ConstantTimeCompare([]byte(Hash(g.SequenceSalt, steps)), []byte(g.SequenceHash)) != 1 {
+			continue
+		}
+
+		delete(d.sources, ev.SrcIP)
+		select {
+		case d.matches <- match{gate: *g, ip: ev.SrcIP}:
+		default:
+			d.logger.Warn("Knock openings backlogged; dropping", "gate", g.Name, "source", ev.SrcIP)
+		}
+		return
+	}
+
+	if !tracked && len(d.sources) >= constants.KnockMaxTrackedSources {
+		d.pruneSources(now)
+		if len(d.sources) >= constants.KnockMaxTrackedSources {
+			return
+		}
+	}
+	d.sources[ev.SrcIP] = knocks
+}
+
+// Run opens gates for completed sequences and forgets stale knocks until ctx
+// is cancelled.
+func (d *Detector) Run(ctx context.Context) {
+	ticker := time.NewTicker(maxWindow)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case m := <-d.matches:
+			d.open(ctx, m)
+		case now := <-ticker.C:
+			d.mu.Lock()
+			d.pruneSources(now)
+			d.mu.Unlock()
+			for key, ruleID := range d.opened {
+				if !d.fw.HasRule(ruleID) {
+					delete(d.opened, key)
+				}
+			}
+		}
+	}
+}
+
+// pruneSources drops sources whose last knock is too old to complete any
+// sequence. The caller must hold d.mu.
+func (d *Detector) pruneSources(now time.Time) {
+	for ip, knocks := range d.sources {
+		if now.Sub(knocks[len(knocks)-1].at) > maxWindow {
+			delete(d.sources, ip)
+		}
+	}
+}
+
+// open allows a source to reach the gate's port for the gate's open time.
+// The rule takes priority so it is matched before the gate's DROP and any
+// other DROP for the port. Knocking again while open extends the existing
+// rule instead of adding one.
+func (d *Detector) open(ctx context.Context, m match) {
+	g := m.gate
+	key := g.ID + "|" + m.ip
+	expiresAt := time.Now().Add(time.Duration(g.OpenSeconds) * time.Second)
+	target := fmt.Sprintf("%s/%d for %s until %s", g.Protocol, g.Port, m.ip, expiresAt.UTC().Format(time.RFC3339))
+
+	if ruleID, ok := d.opened[key]; ok && d.fw.HasRule(ruleID) {
+		if _, err := d.ruleRepo.FindByIDAndUpdate(ctx, ruleID, map[string]interface{}{"expires_at": expiresAt}); err == nil {
+			d.audit(ctx, g, m.ip, "Port knock on gate "+g.Name+" extended "+target)
+			return
+		}
+	}
+	delete(d.opened, key)
+
+	dbRule := &db.FirewallRule{
+		Direction:   constants.DirectionInbound,
+		Protocol:    g.Protocol,
+		Port:        g.Port,
+		SourceCIDR:  m.ip + "/32",
+		Action:      constants.ActionAccept,
+		ExpiresAt:   &expiresAt,
+		Description: "Port knock: " + g.Name,
+	}
+	if err := d.ruleRepo.Create(ctx, dbRule); err != nil {
+		d.logger.Error("Failed to persist knock rule", "gate", g.Name, "source", m.ip, "error", err)
+		return
+	}
+	rule := firewall.Rule{
+		ID:         dbRule.ID,
+		Direction:  dbRule.Direction,
+		Protocol:   dbRule.Protocol,
+		Port:       dbRule.Port,
+		SourceCIDR: dbRule.SourceCIDR,
+		Action:     dbRule.Action,
+		Priority:   true,
+	}
+	if err := d.fw.AddRule(rule); err != nil {
+		_ = d.ruleRepo.DeleteOne(ctx, dbRule.ID)
+		d.logger.Error("Failed to install knock rule", "gate", g.Name, "source", m.ip, "error", err)
+		d.hub.EmitError("Failed to open knock gate "+g.Name+": "+err.Error(), "")
+		return
+	}
+	d.opened[key] = dbRule.ID
+
+	d.audit(ctx, g, m.ip, "Port knock on gate "+g.Name+" opened "+target)
+	d.hub.EmitRuleChange("knock_opened", dbRule.ID, "", g.Port)
+
+	d.logger.Info("Knock gate opened", "gate", g.Name, "source", m.ip, "rule_id", dbRule.ID)
+}
+
+func (d *Detector) audit(ctx context.Context, g db.KnockGate, ip, details string) {
+	_ = d.auditRepo.Create(ctx, &db.AuditLog{
+		Action:   constants.AuditActionKnockOpened,
+		Resource: "knock_gate:" + g.ID,
+		Details:  details,
+		IP:       ip,
+	})
+}
@@ -0,0 +1,74 @@
+// Package knock implements port knocking gates: a source that sends packets
+// to a secret sequence of ports is allowed to reach a protected port for a
+// while. Knocks are observed in the NFLOG traffic stream, so the knock ports
+// never appear in the kernel ruleset and are stored only as a salted hash.
+package knock
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/enjoys-in/secureflow/internal/constants"
+)
+
+// Step is one knock: a TCP SYN or UDP packet to Port.
+type Step struct {
+	Protocol string `json:"protocol,omitempty"` // "tcp" or "udp"; defaults to tcp
+	Port     int    `json:"port"`
+}
+
+// Validate normalises a knock sequence's protocols and checks its length
+// and ports. The same step twice in a row is refused: retransmitted SYNs
+// look exactly like it and are ignored.
+func Validate(steps []Step) error {
+	if len(steps) < constants.KnockMinSteps || len(steps) > constants.KnockMaxSteps {
+		return fmt.Errorf("sequence must have %d to %d knocks", constants.KnockMinSteps, constants.KnockMaxSteps)
+	}
+	for i := range steps {
+		s := &steps[i]
+		s.Protocol = strings.ToLower(strings.TrimSpace(s.Protocol))
+		if s.Protocol == "" {
+			s.Protocol = constants.ProtocolTCP
+		}
+		if s.Protocol != constants.ProtocolTCP && s.Protocol != constants.ProtocolUDP {
+			return fmt.Errorf("knock %d: protocol must be tcp or udp", i+1)
+		}
+		if s.Port < 1 || s.Port > 65535 {
+			return fmt.Errorf("knock %d: port must be between 1 and 65535", i+1)
+		}
+		if i > 0 && *s == steps[i-1] {
+			return fmt.Errorf("knock %d repeats the previous knock", i+1)
+		}
+	}
+	return nil
+}
+
+// NewSalt returns a random salt for Hash.
+func NewSalt() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Hash returns the hex SHA-256 of the salt and the canonical form of a
+// sequence, e.g. "tcp:7000,udp:8000,tcp:9000".
+func Hash(salt string, steps []Step) string {
+	var b strings.Builder
+	b.WriteString(salt)
+	for i, s := range steps {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(s.Protocol)
+		b.WriteByte(':')
+		b.WriteString(strconv.Itoa(s.Port))
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
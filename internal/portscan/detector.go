@@ -0,0 +1,400 @@
+package portscan
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/enjoys-in/secureflow/internal/constants"
+	"github.com/enjoys-in/secureflow/internal/db"
+	"github.com/enjoys-in/secureflow/internal/firewall"
+	"github.com/enjoys-in/secureflow/internal/realtime"
+	"github.com/enjoys-in/secureflow/internal/repository"
+	"github.com/enjoys-in/secureflow/internal/websocket"
+	"github.com/enjoys-in/secureflow/pkg/logger"
+)
+
+// ruleID identifies the rule that enforces the detector's blocks.
+const ruleID = "detector-" + constants.DetectorPortScan
+
+// Config holds the detection thresholds. A threshold of 0 disables its check.
+type Config struct {
+	Window          time.Duration // sliding window the thresholds apply to
+	VerticalPorts   int           // distinct ports probed on one address
+	HorizontalHosts int           // distinct addresses probed on one port
+	SYNFloodPackets int           // SYNs from a source that sent no ACK
+	AutoBlock       bool          // block offenders, besides alerting
+	BlockFor        time.Duration
+	Ignore          []*net.IPNet // sources never flagged, besides loopback
+}
+
+// Alert is a source that crossed a threshold.
+type Alert struct {
+	Kind     string // constants.ScanKind*
+	IP       string
+	DstIP    string // the address scanned, for vertical scans
+	Protocol string // with Port, the port scanned, for horizontal scans
+	Port     int
+	Count    int // ports, addresses or SYNs seen within the window
+}
+
+// Describe renders an alert, e.g. "vertical scan: 20 ports on 10.0.0.1
+// within 60s".
+func (a Alert) Describe(window time.Duration) string {
+	secs := int(window / time.Second)
+	switch a.Kind {
+	case constants.ScanKindVertical:
+		return fmt.Sprintf("vertical scan: %d ports on %s within %ds", a.Count, a.DstIP, secs)
+	case constants.ScanKindHorizontal:
+		return fmt.Sprintf("horizontal scan: %s/%d on %d addresses within %ds", strings.ToLower(a.Protocol), a.Port, a.Count, secs)
+	default:
+		return fmt.Sprintf("SYN flood: %d SYNs without an ACK within %ds", a.Count, secs)
+	}
+}
+
+// probe is a new TCP connection attempt or a UDP packet to a port.
+type probe struct {
+	dst   string
+	proto string
+	port  int
+}
+
+// source is what the detector keeps per source address.
+type source struct {
+	probes   map[probe]time.Time // last time each probe was seen within the window
+	lastSeen time.Time
+	lastAck  time.Time // last TCP packet with the ACK flag
+
+	// SYNs are counted in fixed windows; the sliding count weighs the
+	// previous window by how much of it still overlaps.
+	synSlot int64
+	synCur  int
+	synPrev int
+}
+
+// Detector watches inbound traffic for port scans and SYN floods. It alerts
+// on the WebSocket stream and, with AutoBlock, blocks the source for a while
+// through the blocked IPs list.
+type Detector struct {
+	cfg         Config
+	blockedRepo repository.BlockedIPRepository
+	auditRepo   repository.AuditLogRepository
+	fw          *firewall.Manager
+	hub         *websocket.Hub
+	logger      *logger.Logger
+
+	mu      sync.Mutex
+	sources map[string]*source
+	quiet   map[string]time.Time // source IP -> alerts suppressed until
+	pending map[string]bool      // sources with an alert not yet handled
+	blocked map[string]bool      // sources blocked right now, refreshed every sweep
+
+	alerts chan Alert
+}
+
+// NewDetector creates a port-scan detector.
+func NewDetector(cfg Config, blockedRepo repository.BlockedIPRepository, auditRepo repository.AuditLogRepository, fw *firewall.Manager, hub *websocket.Hub, log *logger.Logger) *Detector {
+	return &Detector{
+		cfg:         cfg,
+		blockedRepo: blockedRepo,
+		auditRepo:   auditRepo,
+		fw:          fw,
+		hub:         hub,
+		logger:      log,
+		sources:     make(map[string]*source),
+		quiet:       make(map[string]time.Time),
+		pending:     make(map[string]bool),
+		blocked:     make(map[string]bool),
+		alerts:      make(chan Alert, 64),
+	}
+}
+
+// Rule returns the firewall rule that drops the sources the detector has
+// blocked. It takes priority, so blocks also apply to the immutable ports.
+func Rule() firewall.Rule {
+	return firewall.Rule{
+		ID:             ruleID,
+		Direction:      "inbound",
+		Protocol:       "all",
+		SourceDetector: constants.DetectorPortScan,
+		Action:         constants.ActionDrop,
+		Priority:       true,
+	}
+}
+
+// Observe counts the event if it is a new inbound TCP connection, a UDP
+// packet to a service port or a TCP packet acknowledging data, and queues an
+// alert when a source crosses a threshold. It runs on the NFLOG callback, so
+// it never blocks.
+func (d *Detector) Observe(ev realtime.TrafficEvent) {
+	// Every inbound packet is logged once with this prefix at the head of
+	// INPUT; the drop log of the managed chain would count it twice.
+	if ev.Prefix != "FM:INPUT:ACCEPT:" || ev.Match != "" || ev.DstPort == 0 {
+		return
+	}
+	src := net.ParseIP(ev.SrcIP).To4()
+	dst := net.ParseIP(ev.DstIP)
+	if src == nil || dst == nil || src.IsLoopback() || src.Equal(dst) || dst.IsMulticast() || strings.HasSuffix(ev.DstIP, ".255") {
+		return
+	}
+	for _, n := range d.cfg.Ignore {
+		if n.Contains(src) {
+			return
+		}
+	}
+
+	var syn, ack bool
+	switch ev.Protocol {
+	case "TCP":
+		syn = ev.TCPFlags&(realtime.TCPFlagSYN|realtime.TCPFlagACK) == realtime.TCPFlagSYN
+		ack = ev.TCPFlags&realtime.TCPFlagACK != 0
+		if !syn && !ack {
+			return
+		}
+	case "UDP":
+		// Replies to our own queries arrive on ephemeral ports.
+		if ev.DstPort >= constants.ScanEphemeralPortStart {
+			return
+		}
+	default:
+		return
+	}
+	now := ev.Timestamp
+	ip := src.String()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.blocked[ip] || d.pending[ip] || now.Before(d.quiet[ip]) {
+		return
+	}
+
+	s, ok := d.sources[ip]
+	if ack {
+		// Only sources that were seen probing are worth tracking.
+		if ok {
+			s.lastSeen, s.lastAck = now, now
+		}
+		return
+	}
+	if !ok {
+		if len(d.sources) >= constants.ScanMaxTrackedSources {
+			d.pruneSources(now)
+			if len(d.sources) >= constants.ScanMaxTrackedSources {
+				return
+			}
+		}
+		s = &source{probes: make(map[probe]time.Time)}
+		d.sources[ip] = s
+	}
+	s.lastSeen = now
+
+	alert, flagged := d.count(s, probe{dst: dst.String(), proto: ev.Protocol, port: ev.DstPort}, syn, now)
+	if !flagged {
+		return
+	}
+	alert.IP = ip
+
+	delete(d.sources, ip)
+	select {
+	case d.alerts <- alert:
+		d.pending[ip] = true
+	default:
+		d.logger.Warn("Port-scan alerts backlogged; dropping", "source", ip, "kind", alert.Kind)
+	}
+}
+
+// count records a probe and returns an alert if the source crossed a
+// threshold. The caller must hold d.mu.
+func (d *Detector) count(s *source, p probe, syn bool, now time.Time) (Alert, bool) {
+	if syn && d.cfg.SYNFloodPackets > 0 {
+		window := int64(d.cfg.Window)
+		slot := now.UnixNano() / window
+		switch {
+		case slot == s.synSlot+1:
+			s.synPrev, s.synCur = s.synCur, 0
+		case slot != s.synSlot:
+			s.synPrev, s.synCur = 0, 0
+		}
+		s.synSlot = slot
+		s.synCur++
+		overlap := 1 - float64(now.UnixNano()%window)/float64(window)
+		syns := s.synCur + int(float64(s.synPrev)*overlap)
+		if syns >= d.cfg.SYNFloodPackets && now.Sub(s.lastAck) > d.cfg.Window {
+			return Alert{Kind: constants.ScanKindSYNFlood, Count: syns}, true
+		}
+	}
+
+	if _, seen := s.probes[p]; seen {
+		s.probes[p] = now
+		return Alert{}, false
+	}
+	s.probes[p] = now
+
+	// A new probe is the only way to reach a scan threshold, so the probes
+	// are pruned and counted only then.
+	ports, hosts := 0, 0
+	for q, at := range s.probes {
+		if now.Sub(at) > d.cfg.Window {
+			delete(s.probes, q)
+			continue
+		}
+		if q.dst == p.dst {
+			ports++
+		}
+		if q.proto == p.proto && q.port == p.port {
+			hosts++
+		}
+	}
+	if len(s.probes) > constants.ScanMaxProbesPerSource {
+		delete(s.probes, p)
+	}
+	if d.cfg.VerticalPorts > 0 && ports >= d.cfg.VerticalPorts {
+		return Alert{Kind: constants.ScanKindVertical, DstIP: p.dst, Count: ports}, true
+	}
+	if d.cfg.HorizontalHosts > 0 && hosts >= d.cfg.HorizontalHosts {
+		return Alert{Kind: constants.ScanKindHorizontal, Protocol: p.proto, Port: p.port, Count: hosts}, true
+	}
+	return Alert{}, false
+}
+
+// pruneSources drops sources not seen within the window, and expired quiet
+// periods. The caller must hold d.mu.
+func (d *Detector) pruneSources(now time.Time) {
+	for ip, s := range d.sources {
+		if now.Sub(s.lastSeen) > d.cfg.Window {
+			delete(d.sources, ip)
+		}
+	}
+	for ip, until := range d.quiet {
+		if !now.Before(until) {
+			delete(d.quiet, ip)
+		}
+	}
+}
+
+// Run handles alerts, forgets idle sources and lifts expired blocks until
+// ctx is cancelled. With AutoBlock it first installs the blocking rule with
+// the blocks still in force.
+func (d *Detector) Run(ctx context.Context) {
+	if d.cfg.AutoBlock {
+		if err := d.fw.AddRule(Rule()); err != nil {
+			d.logger.Error("Failed to install port-scan block rule", "error", err)
+		}
+	}
+	d.sweep(ctx, time.Now())
+
+	ticker := time.NewTicker(constants.ScanSweepSeconds * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case a := <-d.alerts:
+			d.handle(ctx, a)
+		case now := <-ticker.C:
+			d.mu.Lock()
+			d.pruneSources(now)
+			d.mu.Unlock()
+			d.sweep(ctx, now)
+		}
+	}
+}
+
+// handle reports an alert and, with AutoBlock, blocks its source. Further
+// alerts for the source wait until its block is lifted, or for one window.
+func (d *Detector) handle(ctx context.Context, a Alert) {
+	msg := a.Describe(d.cfg.Window)
+	action := "detected"
+	if d.cfg.AutoBlock {
+		if err := d.block(ctx, a, msg); err != nil {
+			d.logger.Error("Failed to block port scanner", "source", a.IP, "error", err)
+		} else {
+			action = "blocked"
+		}
+	}
+
+	d.mu.Lock()
+	delete(d.pending, a.IP)
+	if action == "blocked" {
+		d.blocked[a.IP] = true
+	} else {
+		d.quiet[a.IP] = time.Now().Add(d.cfg.Window)
+	}
+	d.mu.Unlock()
+
+	d.logger.Warn("Port scan detected", "source", a.IP, "kind", a.Kind, "count", a.Count, "action", action)
+	d.hub.EmitAlert(a.Kind, action, a.IP, a.DstIP, a.Protocol, a.Port, msg)
+}
+
+// block adds the source to the blocked IPs list until the block time has
+// passed.
+func (d *Detector) block(ctx context.Context, a Alert, msg string) error {
+	expiresAt := time.Now().Add(d.cfg.BlockFor)
+	entry := &db.BlockedIP{
+		IP:        a.IP,
+		Reason:    "Port-scan detector: " + msg,
+		Detector:  constants.DetectorPortScan,
+		ExpiresAt: &expiresAt,
+	}
+	if err := d.blockedRepo.CreateBan(ctx, entry); err != nil {
+		return err
+	}
+	if err := d.fw.RefreshReference(firewall.RefDetector, constants.DetectorPortScan); err != nil {
+		d.hub.EmitError("Failed to block port scanner "+a.IP+": "+err.Error(), "")
+		return err
+	}
+
+	_ = d.auditRepo.Create(ctx, &db.AuditLog{
+		Action:   constants.AuditActionPortScanBan,
+		Resource: "detector:" + constants.DetectorPortScan,
+		Details:  fmt.Sprintf("%s, blocked until %s", entry.Reason, expiresAt.UTC().Format(time.RFC3339)),
+		IP:       a.IP,
+	})
+	return nil
+}
+
+// sweep lifts expired blocks and, with AutoBlock, picks up blocks users
+// lifted or re-imposed through the blocked IPs API.
+func (d *Detector) sweep(ctx context.Context, now time.Time) {
+	expired, err := d.blockedRepo.ExpireDetectorBans(ctx, constants.DetectorPortScan, now)
+	if err != nil {
+		if ctx.Err() == nil {
+			d.logger.Error("Failed to lift expired port-scan blocks", "error", err)
+		}
+		return
+	}
+	for _, e := range expired {
+		_ = d.auditRepo.Create(ctx, &db.AuditLog{
+			Action:   constants.AuditActionPortScanUnban,
+			Resource: "detector:" + constants.DetectorPortScan,
+			Details:  "Block expired: " + e.Reason,
+			IP:       e.IP,
+		})
+		d.hub.EmitBan("unbanned", constants.DetectorPortScan, e.IP, "block expired")
+	}
+	if len(expired) > 0 {
+		if err := d.fw.RefreshReference(firewall.RefDetector, constants.DetectorPortScan); err != nil {
+			d.logger.Error("Failed to refresh port-scan set", "error", err)
+		}
+	}
+
+	if !d.cfg.AutoBlock {
+		return
+	}
+	ips, err := d.blockedRepo.ListDetectorIPs(ctx, constants.DetectorPortScan, "blocked")
+	if err != nil {
+		d.logger.Error("Failed to load port-scan blocks", "error", err)
+		return
+	}
+	blocked := make(map[string]bool, len(ips))
+	for _, ip := range ips {
+		blocked[ip] = true
+	}
+	d.mu.Lock()
+	d.blocked = blocked
+	d.mu.Unlock()
+}
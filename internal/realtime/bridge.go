@@ -52,10 +52,12 @@ func isInternalTraffic(srcIP, dstIP string) bool {
 // Every captured packet is forwarded as a WebSocket Event to all connected
 // browser clients, after filtering internal traffic and applying rate limiting.
 type Bridge struct {
-	monitor *NFLOGMonitor
-	hub     *websocket.Hub
-	logger  *logger.Logger
-	emitted atomic.Int64 // events emitted in the current window
+	monitor   *NFLOGMonitor
+	hub       *websocket.Hub
+	logger    *logger.Logger
+	emitted   atomic.Int64      // events emitted in the current window
+	observers []TrafficCallback // see every event, before filtering and rate limiting
+	country   func(ip string) string
 }
 
 // NewBridge creates a bridge between the traffic monitor and WebSocket hub.
@@ -67,6 +69,19 @@ func NewBridge(monitor *NFLOGMonitor, hub *websocket.Hub, log *logger.Logger) *B
 	}
 }
 
+// Observe registers a callback that sees every captured event, including
+// those not forwarded to the browser. It must be called before Run and must
+// not block.
+func (b *Bridge) Observe(cb TrafficCallback) {
+	b.observers = append(b.observers, cb)
+}
+
+// SetCountryLookup makes forwarded events carry the country codes of their
+// addresses. It must be called before Run.
+func (b *Bridge) SetCountryLookup(lookup func(ip string) string) {
+	b.country = lookup
+}
+
 // Run wires the monitor callback to the hub and starts capturing.
 // It blocks until ctx is cancelled.
 func (b *Bridge) Run(ctx context.Context) error {
@@ -85,6 +100,10 @@ func (b *Bridge) Run(ctx context.Context) error {
 	}()
 
 	b.monitor.SetCallback(func(event TrafficEvent) {
+		for _, observe := range b.observers {
+			observe(event)
+		}
+
 		// 1) Skip internal/loopback traffic — only forward inbound & outbound
 		if isInternalTraffic(event.SrcIP, event.DstIP) {
 			return
@@ -95,12 +114,34 @@ func (b *Bridge) Run(ctx context.Context) error {
 			return
 		}
 
+		var srcCountry, dstCountry string
+		if b.country != nil {
+			srcCountry, dstCountry = b.country(event.SrcIP), b.country(event.DstIP)
+		}
+
+		if event.Match != "" {
+			b.hub.EmitLimitHit(
+				event.SrcIP,
+				event.DstIP,
+				event.Protocol,
+				event.Action,
+				event.Match,
+				event.RuleID,
+				event.DstPort,
+				srcCountry,
+				dstCountry,
+			)
+			return
+		}
+
 		b.hub.EmitTraffic(
 			event.SrcIP,
 			event.DstIP,
 			event.Protocol,
 			event.Action,
 			event.DstPort,
+			srcCountry,
+			dstCountry,
 		)
 	})
 
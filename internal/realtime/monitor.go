@@ -17,10 +17,21 @@ type TrafficEvent struct {
 	Length    int       `json:"length"`   // packet length in bytes
 	Action    string    `json:"action"`   // from the NFLOG prefix, e.g. "ACCEPT", "DROP"
 	Prefix    string    `json:"prefix"`   // raw NFLOG prefix
+	Match     string    `json:"match"`    // limit the packet tripped, e.g. "CONNLIMIT"; empty for plain traffic
+	RuleID    string    `json:"rule_id"`  // rule whose limit was tripped
 	InDev     string    `json:"in_dev"`   // incoming interface name
 	OutDev    string    `json:"out_dev"`  // outgoing interface name
+
+	// TCPFlags holds the TCP header flags (TCPFlagSYN etc.) for TCP packets.
+	TCPFlags uint8 `json:"tcp_flags,omitempty"`
 }
 
+// TCP header flag bits, as found in TrafficEvent.TCPFlags.
+const (
+	TCPFlagSYN = 0x02
+	TCPFlagACK = 0x10
+)
+
 // TrafficCallback is called for every captured traffic event.
 type TrafficCallback func(event TrafficEvent)
 
@@ -107,6 +107,7 @@ func (m *NFLOGMonitor) parseAttributes(attrs nflog.Attribute) TrafficEvent {
 		event.Prefix = strings.TrimRight(*attrs.Prefix, "\x00")
 		// Parse our prefixes: "FM:INPUT:DROP:", "FM:OUTPUT:ACCEPT:" etc.
 		event.Action = actionFromPrefix(event.Prefix)
+		event.Match, event.RuleID = hitFromPrefix(event.Prefix)
 	}
 
 	// Raw payload — parse IP header for src/dst/proto/ports
@@ -126,6 +127,9 @@ func (m *NFLOGMonitor) parseAttributes(attrs nflog.Attribute) TrafficEvent {
 			event.SrcPort = int(binary.BigEndian.Uint16(pkt[ihl : ihl+2]))
 			event.DstPort = int(binary.BigEndian.Uint16(pkt[ihl+2 : ihl+4]))
 		}
+		if protoNum == 6 && len(pkt) >= ihl+14 {
+			event.TCPFlags = pkt[ihl+13]
+		}
 	}
 
 	return event
@@ -144,3 +148,14 @@ func actionFromPrefix(prefix string) string {
 	}
 	return "ACCEPT"
 }
+
+// hitFromPrefix extracts the limit tag and rule ID from a limit-hit prefix.
+// Expected format: "FM:<CHAIN>:<ACTION>:<TAG>:<RULE ID>"
+// e.g. "FM:INPUT:DROP:CONNLIMIT:6f1c...". Other prefixes yield empty strings.
+func hitFromPrefix(prefix string) (match, ruleID string) {
+	parts := strings.SplitN(prefix, ":", 5)
+	if len(parts) != 5 || parts[0] != "FM" || parts[3] == "" {
+		return "", ""
+	}
+	return parts[3], parts[4]
+}
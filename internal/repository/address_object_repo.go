@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/enjoys-in/secureflow/internal/db"
+)
+
+// AddressObjectRepository defines the interface for address object data access.
+type AddressObjectRepository interface {
+	Repository[db.AddressObject]
+	CountReferences(ctx context.Context, id string) (int, error)
+}
+
+type addressObjectRepo struct {
+	BasePostgresRepo
+}
+
+// NewAddressObjectRepository creates a new AddressObjectRepository.
+func NewAddressObjectRepository(conn *sql.DB) AddressObjectRepository {
+	return &addressObjectRepo{BasePostgresRepo{DB: conn}}
+}
+
+var addressObjectCols = `id, name, COALESCE(description, '') AS description, addresses, COALESCE(created_by::text, '') AS created_by, created_at, updated_at`
+
+func scanAddressObject(scanner interface{ Scan(...interface{}) error }) (*db.AddressObject, error) {
+	o := &db.AddressObject{}
+	var addrs []byte
+	err := scanner.Scan(&o.ID, &o.Name, &o.Description, &addrs, &o.CreatedBy, &o.CreatedAt, &o.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(addrs, &o.Addresses); err != nil {
+		return nil, fmt.Errorf("decode addresses: %w", err)
+	}
+	return o, nil
+}
+
+func (r *addressObjectRepo) FindByID(ctx context.Context, id string) (*db.AddressObject, error) {
+	query := fmt.Sprintf(`SELECT %s FROM address_objects WHERE id = $1`, addressObjectCols)
+	return scanAddressObject(r.QueryRowContext(ctx, query, id))
+}
+
+func (r *addressObjectRepo) FindOne(ctx context.Context, filter map[string]interface{}) (*db.AddressObject, error) {
+	where, args := BuildWhereClause(filter, 1)
+	query := fmt.Sprintf(`SELECT %s FROM address_objects %s LIMIT 1`, addressObjectCols, where)
+	return scanAddressObject(r.QueryRowContext(ctx, query, args...))
+}
+
+func (r *addressObjectRepo) FindAll(ctx context.Context, filter map[string]interface{}, limit, offset int) ([]db.AddressObject, error) {
+	where, args := BuildWhereClause(filter, 1)
+	nextParam := len(args) + 1
+	query := fmt.Sprintf(`SELECT %s FROM address_objects %s ORDER BY name LIMIT $%d OFFSET $%d`, addressObjectCols, where, nextParam, nextParam+1)
+	args = append(args, limit, offset)
+
+	rows, err := r.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var objs []db.AddressObject
+	for rows.Next() {
+		o, err := scanAddressObject(rows)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, *o)
+	}
+	return objs, rows.Err()
+}
+
+func (r *addressObjectRepo) Create(ctx context.Context, o *db.AddressObject) error {
+	if o.Addresses == nil {
+		o.Addresses = []string{}
+	}
+	addrs, err := json.Marshal(o.Addresses)
+	if err != nil {
+		return fmt.Errorf("encode addresses: %w", err)
+	}
+
+	return r.QueryRowContext(ctx,
+		`INSERT INTO address_objects (name, description, addresses, created_by) VALUES ($1, $2, $3, NULLIF($4, '')::uuid) RETURNING id, created_at, updated_at`,
+		o.Name, o.Description, addrs, o.CreatedBy,
+	).Scan(&o.ID, &o.CreatedAt, &o.UpdatedAt)
+}
+
+// FindByIDAndUpdate updates an address object. An "addresses" value given as
+// []string is encoded to JSON.
+func (r *addressObjectRepo) FindByIDAndUpdate(ctx context.Context, id string, updates map[string]interface{}) (*db.AddressObject, error) {
+	if addrs, ok := updates["addresses"].([]string); ok {
+		b, err := json.Marshal(addrs)
+		if err != nil {
+			return nil, fmt.Errorf("encode addresses: %w", err)
+		}
+		updates["addresses"] = b
+	}
+
+	setClause, args := BuildUpdateSet(updates, 1)
+	args = append(args, id)
+	query := fmt.Sprintf(`UPDATE address_objects %s, updated_at = NOW() WHERE id = $%d RETURNING %s`, setClause, len(args), addressObjectCols)
+	return scanAddressObject(r.QueryRowContext(ctx, query, args...))
+}
+
+func (r *addressObjectRepo) FindAndUpdate(ctx context.Context, filter map[string]interface{}, updates map[string]interface{}) (*db.AddressObject, error) {
+	setClause, setArgs := BuildUpdateSet(updates, 1)
+	whereClause, whereArgs := BuildWhereClause(filter, len(setArgs)+1)
+	args := append(setArgs, whereArgs...)
+	query := fmt.Sprintf(`UPDATE address_objects %s %s RETURNING %s`, setClause, whereClause, addressObjectCols)
+	return scanAddressObject(r.QueryRowContext(ctx, query, args...))
+}
+
+func (r *addressObjectRepo) DeleteOne(ctx context.Context, id string) error {
+	_, err := r.ExecContext(ctx, `DELETE FROM address_objects WHERE id = $1`, id)
+	return err
+}
+
+func (r *addressObjectRepo) DeleteMany(ctx context.Context, filter map[string]interface{}) (int64, error) {
+	where, args := BuildWhereClause(filter, 1)
+	query := fmt.Sprintf(`DELETE FROM address_objects %s`, where)
+	res, err := r.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// CountReferences returns how many firewall rules use the address object.
+func (r *addressObjectRepo) CountReferences(ctx context.Context, id string) (int, error) {
+	var n int
+	err := r.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM firewall_rules WHERE source_address_id = $1 OR dest_address_id = $1`,
+		id,
+	).Scan(&n)
+	return n, err
+}
@@ -24,11 +24,11 @@ func NewAuditLogRepository(conn *sql.DB) AuditLogRepository {
 	return &auditLogRepo{BasePostgresRepo{DB: conn}}
 }
 
-var auditLogCols = `a.id, a.user_id, a.action, a.resource, a.details, a.ip, a.timestamp, COALESCE(u.email, ''), COALESCE(u.name, '')`
+var auditLogCols = `a.id, COALESCE(a.user_id::text, '') AS user_id, a.action, a.resource, a.details, a.ip, a.timestamp, COALESCE(u.email, ''), COALESCE(u.name, '')`
 
 func (r *auditLogRepo) Create(ctx context.Context, log *db.AuditLog) error {
 	return r.QueryRowContext(ctx,
-		`INSERT INTO audit_logs (user_id, action, resource, details, ip) VALUES ($1,$2,$3,$4,$5) RETURNING id, timestamp`,
+		`INSERT INTO audit_logs (user_id, action, resource, details, ip) VALUES (NULLIF($1, '')::uuid,$2,$3,$4,$5) RETURNING id, timestamp`,
 		log.UserID, log.Action, log.Resource, log.Details, log.IP,
 	).Scan(&log.ID, &log.Timestamp)
 }
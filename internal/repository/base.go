@@ -12,19 +12,57 @@ type BasePostgresRepo struct {
 	DB *sql.DB
 }
 
+// txKey is the context key for the transaction started by RunInTx.
+type txKey struct{}
+
+// querier is the part of *sql.DB and *sql.Tx the helpers below use.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// conn returns the transaction carried by ctx, or the connection pool.
+func (b *BasePostgresRepo) conn(ctx context.Context) querier {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return b.DB
+}
+
+// RunInTx runs fn in a single transaction. Repository calls made with the
+// context passed to fn join it, whichever repository they belong to, so a
+// change and the records that must go with it commit or roll back together.
+// If ctx already carries a transaction, fn simply joins that one.
+func (b *BasePostgresRepo) RunInTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := b.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
 // ExecContext executes a query that doesn't return rows.
 func (b *BasePostgresRepo) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
-	return b.DB.ExecContext(ctx, query, args...)
+	return b.conn(ctx).ExecContext(ctx, query, args...)
 }
 
 // QueryRowContext executes a query that returns at most one row.
 func (b *BasePostgresRepo) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
-	return b.DB.QueryRowContext(ctx, query, args...)
+	return b.conn(ctx).QueryRowContext(ctx, query, args...)
 }
 
 // QueryContext executes a query that returns rows.
 func (b *BasePostgresRepo) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
-	return b.DB.QueryContext(ctx, query, args...)
+	return b.conn(ctx).QueryContext(ctx, query, args...)
 }
 
 // BuildWhereClause constructs a WHERE clause from a filter map.
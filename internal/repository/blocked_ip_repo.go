@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/lib/pq"
+
 	"github.com/enjoys-in/secureflow/internal/db"
 )
 
@@ -19,6 +21,13 @@ type BlockedIPRepository interface {
 	BulkCreate(ctx context.Context, entries []db.BlockedIP) (int, error)
 	BulkUnblock(ctx context.Context, ips []string, unblockedBy string) (int, error)
 	Count(ctx context.Context, status string) (int, error)
+	ListFeedIPs(ctx context.Context, feedID, status string) ([]string, error)
+	SyncFeed(ctx context.Context, feedID, reason string, add, remove []string) error
+	CreateBan(ctx context.Context, entry *db.BlockedIP) error
+	ListJailIPs(ctx context.Context, jailID, status string) ([]string, error)
+	ListDetectorIPs(ctx context.Context, detector, status string) ([]string, error)
+	ExpireJailBans(ctx context.Context, now time.Time) ([]db.BlockedIP, error)
+	ExpireDetectorBans(ctx context.Context, detector string, now time.Time) ([]db.BlockedIP, error)
 }
 
 type blockedIPRepo struct {
@@ -33,7 +42,7 @@ func NewBlockedIPRepository(conn *sql.DB) BlockedIPRepository {
 func (r *blockedIPRepo) Create(ctx context.Context, entry *db.BlockedIP) error {
 	return r.QueryRowContext(ctx,
 		`INSERT INTO blocked_ips (ip, reason, status, blocked_by, blocked_at)
-		 VALUES ($1, $2, $3, $4, $5)
+		 VALUES ($1, $2, $3, NULLIF($4, '')::uuid, $5)
 		 RETURNING id, created_at`,
 		entry.IP, entry.Reason, "blocked", entry.BlockedBy, time.Now(),
 	).Scan(&entry.ID, &entry.CreatedAt)
@@ -41,8 +50,9 @@ func (r *blockedIPRepo) Create(ctx context.Context, entry *db.BlockedIP) error {
 
 func (r *blockedIPRepo) FindAll(ctx context.Context, status string, limit, offset int) ([]db.BlockedIPWithUser, error) {
 	query := `
-		SELECT b.id, b.ip, b.reason, b.status, b.blocked_by, b.unblocked_by,
-		       b.blocked_at, b.unblocked_at, b.created_at,
+		SELECT b.id, b.ip, b.reason, b.status, COALESCE(b.blocked_by::text, ''), b.unblocked_by,
+		       b.blocked_at, b.unblocked_at, b.created_at, COALESCE(b.feed_id::text, ''),
+		       COALESCE(b.jail_id::text, ''), COALESCE(b.detector, ''), b.expires_at,
 		       COALESCE(ub.name, '') AS blocked_by_name,
 		       COALESCE(ub.email, '') AS blocked_by_email,
 		       COALESCE(uu.name, '') AS unblocked_by_name,
@@ -74,7 +84,7 @@ func (r *blockedIPRepo) FindAll(ctx context.Context, status string, limit, offse
 		var e db.BlockedIPWithUser
 		if err := rows.Scan(
 			&e.ID, &e.IP, &e.Reason, &e.Status, &e.BlockedBy, &e.UnblockedBy,
-			&e.BlockedAt, &e.UnblockedAt, &e.CreatedAt,
+			&e.BlockedAt, &e.UnblockedAt, &e.CreatedAt, &e.FeedID, &e.JailID, &e.Detector, &e.ExpiresAt,
 			&e.BlockedByName, &e.BlockedByEmail, &e.UnblockedByName, &e.UnblockedByEmail,
 		); err != nil {
 			return nil, err
@@ -87,10 +97,11 @@ func (r *blockedIPRepo) FindAll(ctx context.Context, status string, limit, offse
 func (r *blockedIPRepo) FindByIP(ctx context.Context, ip string) (*db.BlockedIP, error) {
 	e := &db.BlockedIP{}
 	err := r.QueryRowContext(ctx,
-		`SELECT id, ip, reason, status, blocked_by, unblocked_by, blocked_at, unblocked_at, created_at
+		`SELECT id, ip, reason, status, COALESCE(blocked_by::text, ''), unblocked_by, blocked_at, unblocked_at, created_at, COALESCE(feed_id::text, ''),
+		        COALESCE(jail_id::text, ''), COALESCE(detector, ''), expires_at
 		 FROM blocked_ips WHERE ip = $1 AND status = 'blocked' LIMIT 1`,
 		ip,
-	).Scan(&e.ID, &e.IP, &e.Reason, &e.Status, &e.BlockedBy, &e.UnblockedBy, &e.BlockedAt, &e.UnblockedAt, &e.CreatedAt)
+	).Scan(&e.ID, &e.IP, &e.Reason, &e.Status, &e.BlockedBy, &e.UnblockedBy, &e.BlockedAt, &e.UnblockedAt, &e.CreatedAt, &e.FeedID, &e.JailID, &e.Detector, &e.ExpiresAt)
 	if err != nil {
 		return nil, err
 	}
@@ -105,9 +116,11 @@ func (r *blockedIPRepo) Unblock(ctx context.Context, id string, unblockedBy stri
 	return err
 }
 
+// Reblock blocks an entry again. A re-blocked jail or detector ban no longer
+// expires.
 func (r *blockedIPRepo) Reblock(ctx context.Context, id string) error {
 	_, err := r.ExecContext(ctx,
-		`UPDATE blocked_ips SET status = 'blocked', unblocked_by = NULL, unblocked_at = NULL WHERE id = $1`,
+		`UPDATE blocked_ips SET status = 'blocked', unblocked_by = NULL, unblocked_at = NULL, expires_at = NULL WHERE id = $1`,
 		id,
 	)
 	return err
@@ -156,3 +169,172 @@ func (r *blockedIPRepo) Count(ctx context.Context, status string) (int, error) {
 	err := r.QueryRowContext(ctx, query, args...).Scan(&count)
 	return count, err
 }
+
+// ListFeedIPs returns the addresses a threat feed contributed, optionally
+// only those with the given status.
+func (r *blockedIPRepo) ListFeedIPs(ctx context.Context, feedID, status string) ([]string, error) {
+	query := `SELECT ip FROM blocked_ips WHERE feed_id = $1`
+	args := []interface{}{feedID}
+	if status != "" && status != "all" {
+		query += ` AND status = $2`
+		args = append(args, status)
+	}
+
+	rows, err := r.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ips []string
+	for rows.Next() {
+		var ip string
+		if err := rows.Scan(&ip); err != nil {
+			return nil, err
+		}
+		ips = append(ips, ip)
+	}
+	return ips, rows.Err()
+}
+
+// SyncFeed applies the difference between a feed's last two fetches in one
+// transaction: new addresses are blocked with reason, and addresses that left
+// the feed are deleted, including ones a user unblocked meanwhile. Existing
+// entries take on reason too, so they follow a renamed feed.
+func (r *blockedIPRepo) SyncFeed(ctx context.Context, feedID, reason string, add, remove []string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE blocked_ips SET reason = $2 WHERE feed_id = $1 AND reason <> $2`,
+		feedID, reason,
+	); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if len(remove) > 0 {
+		if _, err := tx.ExecContext(ctx,
+			`DELETE FROM blocked_ips WHERE feed_id = $1 AND ip = ANY($2)`,
+			feedID, pq.Array(remove),
+		); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	if len(add) > 0 {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO blocked_ips (ip, reason, status, feed_id, blocked_at)
+			 SELECT ip, $2, 'blocked', $1, NOW() FROM unnest($3::text[]) AS ip`,
+			feedID, reason, pq.Array(add),
+		); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// CreateBan records a ban by a jail or a traffic detector; entry.JailID or
+// entry.Detector must be set, and entry.ExpiresAt usually is.
+func (r *blockedIPRepo) CreateBan(ctx context.Context, entry *db.BlockedIP) error {
+	entry.Status = "blocked"
+	return r.QueryRowContext(ctx,
+		`INSERT INTO blocked_ips (ip, reason, status, jail_id, detector, expires_at)
+		 VALUES ($1, $2, 'blocked', NULLIF($3, '')::uuid, NULLIF($4, ''), $5)
+		 RETURNING id, blocked_at, created_at`,
+		entry.IP, entry.Reason, entry.JailID, entry.Detector, entry.ExpiresAt,
+	).Scan(&entry.ID, &entry.BlockedAt, &entry.CreatedAt)
+}
+
+// ListJailIPs returns the addresses a jail banned, optionally only those
+// with the given status.
+func (r *blockedIPRepo) ListJailIPs(ctx context.Context, jailID, status string) ([]string, error) {
+	query := `SELECT ip FROM blocked_ips WHERE jail_id = $1`
+	args := []interface{}{jailID}
+	if status != "" && status != "all" {
+		query += ` AND status = $2`
+		args = append(args, status)
+	}
+
+	rows, err := r.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ips []string
+	for rows.Next() {
+		var ip string
+		if err := rows.Scan(&ip); err != nil {
+			return nil, err
+		}
+		ips = append(ips, ip)
+	}
+	return ips, rows.Err()
+}
+
+// ListDetectorIPs returns the addresses a traffic detector blocked,
+// optionally only those with the given status.
+func (r *blockedIPRepo) ListDetectorIPs(ctx context.Context, detector, status string) ([]string, error) {
+	query := `SELECT ip FROM blocked_ips WHERE detector = $1`
+	args := []interface{}{detector}
+	if status != "" && status != "all" {
+		query += ` AND status = $2`
+		args = append(args, status)
+	}
+
+	rows, err := r.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ips []string
+	for rows.Next() {
+		var ip string
+		if err := rows.Scan(&ip); err != nil {
+			return nil, err
+		}
+		ips = append(ips, ip)
+	}
+	return ips, rows.Err()
+}
+
+// ExpireJailBans unblocks every jail ban whose expires_at has passed and
+// returns them.
+func (r *blockedIPRepo) ExpireJailBans(ctx context.Context, now time.Time) ([]db.BlockedIP, error) {
+	return r.expireBans(ctx, `jail_id IS NOT NULL`, now)
+}
+
+// ExpireDetectorBans unblocks every ban of a traffic detector whose
+// expires_at has passed and returns them.
+func (r *blockedIPRepo) ExpireDetectorBans(ctx context.Context, detector string, now time.Time) ([]db.BlockedIP, error) {
+	return r.expireBans(ctx, `detector = $2`, now, detector)
+}
+
+// expireBans unblocks the expired entries matching cond, whose parameters
+// start at $2.
+func (r *blockedIPRepo) expireBans(ctx context.Context, cond string, now time.Time, args ...interface{}) ([]db.BlockedIP, error) {
+	rows, err := r.QueryContext(ctx,
+		`UPDATE blocked_ips SET status = 'unblocked', unblocked_at = $1
+		 WHERE status = 'blocked' AND expires_at <= $1 AND `+cond+`
+		 RETURNING id, ip, reason, COALESCE(jail_id::text, ''), COALESCE(detector, ''), expires_at`,
+		append([]interface{}{now}, args...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var expired []db.BlockedIP
+	for rows.Next() {
+		var e db.BlockedIP
+		if err := rows.Scan(&e.ID, &e.IP, &e.Reason, &e.JailID, &e.Detector, &e.ExpiresAt); err != nil {
+			return nil, err
+		}
+		expired = append(expired, e)
+	}
+	return expired, rows.Err()
+}
@@ -3,7 +3,10 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/enjoys-in/secureflow/internal/db"
 )
@@ -14,8 +17,16 @@ type FirewallRuleRepository interface {
 	FindBySecurityGroup(ctx context.Context, sgID string) ([]db.FirewallRule, error)
 	FindAllWithDetails(ctx context.Context, limit, offset int) ([]db.FirewallRuleWithDetails, error)
 	DeleteNonImmutable(ctx context.Context, id string) error
+	ReplaceGroupRules(ctx context.Context, sgID string, rules []db.FirewallRule) error
+	CheckReferenceCycle(ctx context.Context, sgID string, refIDs ...string) error
+	FindReferencingRules(ctx context.Context, sgID string) ([]db.FirewallRule, error)
+	FindExpiring(ctx context.Context, before time.Time) ([]db.FirewallRule, error)
 }
 
+// ErrReferenceCycle is returned when a rule's group reference would make a
+// security group (indirectly) reference itself.
+var ErrReferenceCycle = errors.New("security group reference cycle")
+
 // firewallRuleRepo is the Postgres implementation.
 type firewallRuleRepo struct {
 	BasePostgresRepo
@@ -26,19 +37,97 @@ func NewFirewallRuleRepository(conn *sql.DB) FirewallRuleRepository {
 	return &firewallRuleRepo{BasePostgresRepo{DB: conn}}
 }
 
-var firewallRuleCols = `id, COALESCE(security_group_id::text, '') AS security_group_id, direction, protocol, port, port_range_end, source_cidr, COALESCE(dest_cidr, '') AS dest_cidr, action, COALESCE(description, '') AS description, is_immutable, COALESCE(created_by::text, '') AS created_by, created_at`
+var firewallRuleCols = `id, COALESCE(security_group_id::text, '') AS security_group_id, direction, protocol, port, port_range_end, source_cidr, COALESCE(dest_cidr, '') AS dest_cidr, COALESCE(source_group_id::text, '') AS source_group_id, COALESCE(dest_group_id::text, '') AS dest_group_id, COALESCE(source_address_id::text, '') AS source_address_id, COALESCE(dest_address_id::text, '') AS dest_address_id, COALESCE(service_id::text, '') AS service_id, action, rate_limit, conn_limit, synproxy, COALESCE(in_interface, '') AS in_interface, COALESCE(out_interface, '') AS out_interface, source_port, source_port_end, icmp_type, icmp_code, COALESCE(owner_user, '') AS owner_user, COALESCE(owner_group, '') AS owner_group, COALESCE(cgroup, '') AS cgroup, COALESCE(schedule_id::text, '') AS schedule_id, expires_at, source_fqdn, dest_fqdn, source_countries, dest_countries, ports, COALESCE(description, '') AS description, is_immutable, COALESCE(created_by::text, '') AS created_by, created_at`
 
 func scanFirewallRule(scanner interface{ Scan(...interface{}) error }) (*db.FirewallRule, error) {
 	r := &db.FirewallRule{}
+	var rateLimit, connLimit, portList, srcCountries, dstCountries []byte
 	err := scanner.Scan(&r.ID, &r.SecurityGroupID, &r.Direction, &r.Protocol, &r.Port,
-		&r.PortRangeEnd, &r.SourceCIDR, &r.DestCIDR, &r.Action, &r.Description,
+		&r.PortRangeEnd, &r.SourceCIDR, &r.DestCIDR, &r.SourceGroupID, &r.DestGroupID,
+		&r.SourceAddressID, &r.DestAddressID, &r.ServiceID, &r.Action, &rateLimit, &connLimit, &r.SynProxy, &r.InInterface, &r.OutInterface, &r.SourcePort, &r.SourcePortEnd, &r.ICMPType, &r.ICMPCode, &r.OwnerUser, &r.OwnerGroup, &r.Cgroup, &r.ScheduleID, &r.ExpiresAt, &r.SourceFQDN, &r.DestFQDN, &srcCountries, &dstCountries, &portList, &r.Description,
 		&r.IsImmutable, &r.CreatedBy, &r.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
+	if r.RateLimit, err = decodeJSONColumn[db.RateLimit]("rate_limit", rateLimit); err != nil {
+		return nil, err
+	}
+	if r.ConnLimit, err = decodeJSONColumn[db.ConnLimit]("conn_limit", connLimit); err != nil {
+		return nil, err
+	}
+	if r.Ports, err = decodePortList(portList); err != nil {
+		return nil, err
+	}
+	if r.SourceCountries, err = decodeCountries("source_countries", srcCountries); err != nil {
+		return nil, err
+	}
+	if r.DestCountries, err = decodeCountries("dest_countries", dstCountries); err != nil {
+		return nil, err
+	}
 	return r, nil
 }
 
+// encodeJSONColumn converts v into a JSONB value for column col; nil becomes
+// NULL.
+func encodeJSONColumn[T any](col string, v *T) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("encode %s: %w", col, err)
+	}
+	return b, nil
+}
+
+// decodeJSONColumn parses the nullable JSONB column col.
+func decodeJSONColumn[T any](col string, b []byte) (*T, error) {
+	if b == nil {
+		return nil, nil
+	}
+	v := new(T)
+	if err := json.Unmarshal(b, v); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", col, err)
+	}
+	return v, nil
+}
+
+// encodePortList converts a rule's port list into a JSONB value; an empty
+// list becomes NULL.
+func encodePortList(ports []db.ServicePort) (interface{}, error) {
+	if len(ports) == 0 {
+		return nil, nil
+	}
+	return encodeJSONColumn("ports", &ports)
+}
+
+// encodeCountries converts a country code list into a JSONB value for column
+// col; an empty list becomes NULL.
+func encodeCountries(col string, codes []string) (interface{}, error) {
+	if len(codes) == 0 {
+		return nil, nil
+	}
+	return encodeJSONColumn(col, &codes)
+}
+
+// decodeCountries parses the nullable country code list column col.
+func decodeCountries(col string, b []byte) ([]string, error) {
+	codes, err := decodeJSONColumn[[]string](col, b)
+	if err != nil || codes == nil {
+		return nil, err
+	}
+	return *codes, nil
+}
+
+// decodePortList parses the nullable ports column.
+func decodePortList(b []byte) ([]db.ServicePort, error) {
+	ports, err := decodeJSONColumn[[]db.ServicePort]("ports", b)
+	if err != nil || ports == nil {
+		return nil, err
+	}
+	return *ports, nil
+}
+
 func (r *firewallRuleRepo) FindByID(ctx context.Context, id string) (*db.FirewallRule, error) {
 	query := fmt.Sprintf(`SELECT %s FROM firewall_rules WHERE id = $1`, firewallRuleCols)
 	return scanFirewallRule(r.QueryRowContext(ctx, query, id))
@@ -92,11 +181,35 @@ func (r *firewallRuleRepo) FindBySecurityGroup(ctx context.Context, sgID string)
 	return rules, rows.Err()
 }
 
+// FindExpiring returns the non-immutable rules that expire at or before
+// before, soonest first.
+func (r *firewallRuleRepo) FindExpiring(ctx context.Context, before time.Time) ([]db.FirewallRule, error) {
+	query := fmt.Sprintf(`SELECT %s FROM firewall_rules WHERE expires_at <= $1 AND is_immutable = FALSE ORDER BY expires_at`, firewallRuleCols)
+	rows, err := r.QueryContext(ctx, query, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []db.FirewallRule
+	for rows.Next() {
+		rule, err := scanFirewallRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, *rule)
+	}
+	return rules, rows.Err()
+}
+
 func (r *firewallRuleRepo) FindAllWithDetails(ctx context.Context, limit, offset int) ([]db.FirewallRuleWithDetails, error) {
 	query := `SELECT fr.id, COALESCE(fr.security_group_id::text, '') AS security_group_id,
 		fr.direction, fr.protocol, fr.port, fr.port_range_end,
 		fr.source_cidr, COALESCE(fr.dest_cidr, '') AS dest_cidr,
-		fr.action, COALESCE(fr.description, '') AS description,
+		COALESCE(fr.source_group_id::text, '') AS source_group_id, COALESCE(fr.dest_group_id::text, '') AS dest_group_id,
+		COALESCE(fr.source_address_id::text, '') AS source_address_id, COALESCE(fr.dest_address_id::text, '') AS dest_address_id,
+		COALESCE(fr.service_id::text, '') AS service_id,
+		fr.action, fr.rate_limit, fr.conn_limit, fr.synproxy, COALESCE(fr.in_interface, '') AS in_interface, COALESCE(fr.out_interface, '') AS out_interface, fr.source_port, fr.source_port_end, fr.icmp_type, fr.icmp_code, COALESCE(fr.owner_user, '') AS owner_user, COALESCE(fr.owner_group, '') AS owner_group, COALESCE(fr.cgroup, '') AS cgroup, COALESCE(fr.schedule_id::text, '') AS schedule_id, fr.expires_at, fr.source_fqdn, fr.dest_fqdn, fr.source_countries, fr.dest_countries, fr.ports, COALESCE(fr.description, '') AS description,
 		fr.is_immutable, COALESCE(fr.created_by::text, '') AS created_by, fr.created_at,
 		COALESCE(sg.name, '') AS security_group_name,
 		COALESCE(u.name, '') AS created_by_name,
@@ -116,28 +229,170 @@ func (r *firewallRuleRepo) FindAllWithDetails(ctx context.Context, limit, offset
 	var rules []db.FirewallRuleWithDetails
 	for rows.Next() {
 		var rd db.FirewallRuleWithDetails
+		var rateLimit, connLimit, portList, srcCountries, dstCountries []byte
 		if err := rows.Scan(
 			&rd.ID, &rd.SecurityGroupID, &rd.Direction, &rd.Protocol, &rd.Port, &rd.PortRangeEnd,
-			&rd.SourceCIDR, &rd.DestCIDR, &rd.Action, &rd.Description, &rd.IsImmutable, &rd.CreatedBy, &rd.CreatedAt,
+			&rd.SourceCIDR, &rd.DestCIDR, &rd.SourceGroupID, &rd.DestGroupID,
+			&rd.SourceAddressID, &rd.DestAddressID, &rd.ServiceID, &rd.Action, &rateLimit, &connLimit, &rd.SynProxy, &rd.InInterface, &rd.OutInterface, &rd.SourcePort, &rd.SourcePortEnd, &rd.ICMPType, &rd.ICMPCode, &rd.OwnerUser, &rd.OwnerGroup, &rd.Cgroup, &rd.ScheduleID, &rd.ExpiresAt, &rd.SourceFQDN, &rd.DestFQDN, &srcCountries, &dstCountries, &portList, &rd.Description, &rd.IsImmutable, &rd.CreatedBy, &rd.CreatedAt,
 			&rd.SecurityGroupName, &rd.CreatedByName, &rd.CreatedByEmail,
 		); err != nil {
 			return nil, err
 		}
+		if rd.RateLimit, err = decodeJSONColumn[db.RateLimit]("rate_limit", rateLimit); err != nil {
+			return nil, err
+		}
+		if rd.ConnLimit, err = decodeJSONColumn[db.ConnLimit]("conn_limit", connLimit); err != nil {
+			return nil, err
+		}
+		if rd.Ports, err = decodePortList(portList); err != nil {
+			return nil, err
+		}
+		if rd.SourceCountries, err = decodeCountries("source_countries", srcCountries); err != nil {
+			return nil, err
+		}
+		if rd.DestCountries, err = decodeCountries("dest_countries", dstCountries); err != nil {
+			return nil, err
+		}
 		rules = append(rules, rd)
 	}
 	return rules, rows.Err()
 }
 
+// Create inserts a rule. Group references on rules that belong to a security
+// group are checked for cycles first.
 func (r *firewallRuleRepo) Create(ctx context.Context, rule *db.FirewallRule) error {
+	if rule.SecurityGroupID != "" {
+		if err := r.CheckReferenceCycle(ctx, rule.SecurityGroupID, rule.SourceGroupID, rule.DestGroupID); err != nil {
+			return err
+		}
+	}
+
+	rateLimit, err := encodeJSONColumn("rate_limit", rule.RateLimit)
+	if err != nil {
+		return err
+	}
+	connLimit, err := encodeJSONColumn("conn_limit", rule.ConnLimit)
+	if err != nil {
+		return err
+	}
+	portList, err := encodePortList(rule.Ports)
+	if err != nil {
+		return err
+	}
+	srcCountries, err := encodeCountries("source_countries", rule.SourceCountries)
+	if err != nil {
+		return err
+	}
+	dstCountries, err := encodeCountries("dest_countries", rule.DestCountries)
+	if err != nil {
+		return err
+	}
+
 	return r.QueryRowContext(ctx,
-		`INSERT INTO firewall_rules (security_group_id, direction, protocol, port, port_range_end, source_cidr, dest_cidr, action, description, is_immutable, created_by)
-		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11) RETURNING id, created_at`,
+		`INSERT INTO firewall_rules (security_group_id, direction, protocol, port, port_range_end, source_cidr, dest_cidr, source_group_id, dest_group_id, source_address_id, dest_address_id, service_id, action, rate_limit, conn_limit, synproxy, in_interface, out_interface, source_port, source_port_end, icmp_type, icmp_code, owner_user, owner_group, cgroup, schedule_id, expires_at, source_fqdn, dest_fqdn, source_countries, dest_countries, ports, description, is_immutable, created_by)
+		 VALUES (NULLIF($1, '')::uuid,$2,$3,$4,$5,$6,$7,NULLIF($8, '')::uuid,NULLIF($9, '')::uuid,NULLIF($10, '')::uuid,NULLIF($11, '')::uuid,NULLIF($12, '')::uuid,$13,$14,$15,$16,$17,$18,$19,$20,$21,$22,$23,$24,$25,NULLIF($26, '')::uuid,$27,$28,$29,$30,$31,$32,$33,$34,NULLIF($35, '')::uuid) RETURNING id, created_at`,
 		rule.SecurityGroupID, rule.Direction, rule.Protocol, rule.Port, rule.PortRangeEnd,
-		rule.SourceCIDR, rule.DestCIDR, rule.Action, rule.Description, rule.IsImmutable, rule.CreatedBy,
+		rule.SourceCIDR, rule.DestCIDR, rule.SourceGroupID, rule.DestGroupID,
+		rule.SourceAddressID, rule.DestAddressID, rule.ServiceID,
+		rule.Action, rateLimit, connLimit, rule.SynProxy, rule.InInterface, rule.OutInterface, rule.SourcePort, rule.SourcePortEnd, rule.ICMPType, rule.ICMPCode, rule.OwnerUser, rule.OwnerGroup, rule.Cgroup, rule.ScheduleID, rule.ExpiresAt, rule.SourceFQDN, rule.DestFQDN, srcCountries, dstCountries, portList, rule.Description, rule.IsImmutable, rule.CreatedBy,
 	).Scan(&rule.ID, &rule.CreatedAt)
 }
 
+// CheckReferenceCycle returns ErrReferenceCycle if sgID is reachable from any
+// of refIDs by following the group references of existing rules, i.e. adding
+// an edge sgID -> ref would close a loop. A group referencing itself is
+// allowed (members may talk to each other), and empty IDs are ignored.
+func (r *firewallRuleRepo) CheckReferenceCycle(ctx context.Context, sgID string, refIDs ...string) error {
+	for _, ref := range refIDs {
+		if ref == "" || ref == sgID {
+			continue
+		}
+
+		var cycle bool
+		err := r.QueryRowContext(ctx,
+			`WITH RECURSIVE reachable(id) AS (
+				SELECT $1::uuid
+				UNION
+				SELECT ref FROM (
+					SELECT fr.source_group_id AS ref, fr.security_group_id AS owner FROM firewall_rules fr
+					UNION ALL
+					SELECT fr.dest_group_id, fr.security_group_id FROM firewall_rules fr
+				) edges
+				JOIN reachable ON edges.owner = reachable.id
+				WHERE edges.ref IS NOT NULL
+			)
+			SELECT EXISTS (SELECT 1 FROM reachable WHERE id = $2::uuid)`,
+			ref, sgID,
+		).Scan(&cycle)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return fmt.Errorf("%w: group %s already depends on %s", ErrReferenceCycle, ref, sgID)
+		}
+	}
+	return nil
+}
+
+// FindReferencingRules returns rules of other groups (or standalone rules)
+// that use sgID as their source or destination group.
+func (r *firewallRuleRepo) FindReferencingRules(ctx context.Context, sgID string) ([]db.FirewallRule, error) {
+	query := fmt.Sprintf(`SELECT %s FROM firewall_rules
+		WHERE (source_group_id = $1 OR dest_group_id = $1)
+		  AND security_group_id IS DISTINCT FROM $1
+		ORDER BY created_at`, firewallRuleCols)
+	rows, err := r.QueryContext(ctx, query, sgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []db.FirewallRule
+	for rows.Next() {
+		rule, err := scanFirewallRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, *rule)
+	}
+	return rules, rows.Err()
+}
+
+// FindByIDAndUpdate updates a rule. "rate_limit" and "conn_limit" values
+// given as *db.RateLimit / *db.ConnLimit are encoded to JSON, nil clearing
+// them.
 func (r *firewallRuleRepo) FindByIDAndUpdate(ctx context.Context, id string, updates map[string]interface{}) (*db.FirewallRule, error) {
+	if rl, ok := updates["rate_limit"].(*db.RateLimit); ok {
+		v, err := encodeJSONColumn("rate_limit", rl)
+		if err != nil {
+			return nil, err
+		}
+		updates["rate_limit"] = v
+	}
+	if cl, ok := updates["conn_limit"].(*db.ConnLimit); ok {
+		v, err := encodeJSONColumn("conn_limit", cl)
+		if err != nil {
+			return nil, err
+		}
+		updates["conn_limit"] = v
+	}
+	if ports, ok := updates["ports"].([]db.ServicePort); ok {
+		v, err := encodePortList(ports)
+		if err != nil {
+			return nil, err
+		}
+		updates["ports"] = v
+	}
+	for _, col := range []string{"source_countries", "dest_countries"} {
+		if codes, ok := updates[col].([]string); ok {
+			v, err := encodeCountries(col, codes)
+			if err != nil {
+				return nil, err
+			}
+			updates[col] = v
+		}
+	}
+
 	setClause, args := BuildUpdateSet(updates, 1)
 	args = append(args, id)
 	query := fmt.Sprintf(`UPDATE firewall_rules %s WHERE id = $%d RETURNING %s`, setClause, len(args), firewallRuleCols)
@@ -171,3 +426,59 @@ func (r *firewallRuleRepo) DeleteMany(ctx context.Context, filter map[string]int
 	}
 	return res.RowsAffected()
 }
+
+// ReplaceGroupRules swaps every rule of a security group for the given set in
+// a single transaction. Rule IDs are preserved so kernel rules tagged with
+// them stay addressable.
+func (r *firewallRuleRepo) ReplaceGroupRules(ctx context.Context, sgID string, rules []db.FirewallRule) error {
+	return r.RunInTx(ctx, func(ctx context.Context) error {
+		return r.replaceGroupRules(ctx, sgID, rules)
+	})
+}
+
+// replaceGroupRules deletes a group's rules and inserts the given ones. The
+// caller runs it in a transaction, so each cycle check sees the rules
+// inserted before it.
+func (r *firewallRuleRepo) replaceGroupRules(ctx context.Context, sgID string, rules []db.FirewallRule) error {
+	if _, err := r.ExecContext(ctx, `DELETE FROM firewall_rules WHERE security_group_id = $1`, sgID); err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		if err := r.CheckReferenceCycle(ctx, sgID, rule.SourceGroupID, rule.DestGroupID); err != nil {
+			return err
+		}
+		rateLimit, err := encodeJSONColumn("rate_limit", rule.RateLimit)
+		if err != nil {
+			return err
+		}
+		connLimit, err := encodeJSONColumn("conn_limit", rule.ConnLimit)
+		if err != nil {
+			return err
+		}
+		portList, err := encodePortList(rule.Ports)
+		if err != nil {
+			return err
+		}
+		srcCountries, err := encodeCountries("source_countries", rule.SourceCountries)
+		if err != nil {
+			return err
+		}
+		dstCountries, err := encodeCountries("dest_countries", rule.DestCountries)
+		if err != nil {
+			return err
+		}
+		if _, err := r.ExecContext(ctx,
+			`INSERT INTO firewall_rules (id, security_group_id, direction, protocol, port, port_range_end, source_cidr, dest_cidr, source_group_id, dest_group_id, source_address_id, dest_address_id, service_id, action, rate_limit, conn_limit, synproxy, in_interface, out_interface, source_port, source_port_end, icmp_type, icmp_code, owner_user, owner_group, cgroup, schedule_id, expires_at, source_fqdn, dest_fqdn, source_countries, dest_countries, ports, description, is_immutable, created_by)
+			 VALUES ($1,$2,$3,$4,$5,$6,$7,$8,NULLIF($9, '')::uuid,NULLIF($10, '')::uuid,NULLIF($11, '')::uuid,NULLIF($12, '')::uuid,NULLIF($13, '')::uuid,$14,$15,$16,$17,$18,$19,$20,$21,$22,$23,$24,$25,$26,NULLIF($27, '')::uuid,$28,$29,$30,$31,$32,$33,$34,$35,NULLIF($36, '')::uuid)`,
+			rule.ID, sgID, rule.Direction, rule.Protocol, rule.Port, rule.PortRangeEnd,
+			rule.SourceCIDR, rule.DestCIDR, rule.SourceGroupID, rule.DestGroupID,
+			rule.SourceAddressID, rule.DestAddressID, rule.ServiceID,
+			rule.Action, rateLimit, connLimit, rule.SynProxy, rule.InInterface, rule.OutInterface, rule.SourcePort, rule.SourcePortEnd, rule.ICMPType, rule.ICMPCode, rule.OwnerUser, rule.OwnerGroup, rule.Cgroup, rule.ScheduleID, rule.ExpiresAt, rule.SourceFQDN, rule.DestFQDN, srcCountries, dstCountries, portList, rule.Description, rule.IsImmutable, rule.CreatedBy,
+		); err != nil {
+			return fmt.Errorf("restore rule %s: %w", rule.ID, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/enjoys-in/secureflow/internal/db"
+)
+
+// FQDNResolutionRepository defines the interface for FQDN resolution history
+// data access. History is append-only.
+type FQDNResolutionRepository interface {
+	Create(ctx context.Context, res *db.FQDNResolution) error
+	FindAll(ctx context.Context, filter map[string]interface{}, limit, offset int) ([]db.FQDNResolution, error)
+	FindLatest(ctx context.Context, hostname string) (*db.FQDNResolution, error)
+}
+
+type fqdnResolutionRepo struct {
+	BasePostgresRepo
+}
+
+// NewFQDNResolutionRepository creates a new FQDNResolutionRepository.
+func NewFQDNResolutionRepository(conn *sql.DB) FQDNResolutionRepository {
+	return &fqdnResolutionRepo{BasePostgresRepo{DB: conn}}
+}
+
+var fqdnResolutionCols = `id, hostname, addresses, ttl_seconds, resolved_at`
+
+func scanFQDNResolution(scanner interface{ Scan(...interface{}) error }) (*db.FQDNResolution, error) {
+	res := &db.FQDNResolution{}
+	var addrs []byte
+	err := scanner.Scan(&res.ID, &res.Hostname, &addrs, &res.TTLSeconds, &res.ResolvedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(addrs, &res.Addresses); err != nil {
+		return nil, fmt.Errorf("decode addresses: %w", err)
+	}
+	return res, nil
+}
+
+func (r *fqdnResolutionRepo) Create(ctx context.Context, res *db.FQDNResolution) error {
+	if res.Addresses == nil {
+		res.Addresses = []string{}
+	}
+	addrs, err := json.Marshal(res.Addresses)
+	if err != nil {
+		return fmt.Errorf("encode addresses: %w", err)
+	}
+	return r.QueryRowContext(ctx,
+		`INSERT INTO fqdn_resolutions (hostname, addresses, ttl_seconds) VALUES ($1, $2, $3) RETURNING id, resolved_at`,
+		res.Hostname, addrs, res.TTLSeconds,
+	).Scan(&res.ID, &res.ResolvedAt)
+}
+
+func (r *fqdnResolutionRepo) FindAll(ctx context.Context, filter map[string]interface{}, limit, offset int) ([]db.FQDNResolution, error) {
+	where, args := BuildWhereClause(filter, 1)
+	nextParam := len(args) + 1
+	query := fmt.Sprintf(`SELECT %s FROM fqdn_resolutions %s ORDER BY resolved_at DESC LIMIT $%d OFFSET $%d`, fqdnResolutionCols, where, nextParam, nextParam+1)
+	args = append(args, limit, offset)
+
+	rows, err := r.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []db.FQDNResolution
+	for rows.Next() {
+		res, err := scanFQDNResolution(rows)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, *res)
+	}
+	return history, rows.Err()
+}
+
+// FindLatest returns the most recent resolution recorded for a hostname.
+func (r *fqdnResolutionRepo) FindLatest(ctx context.Context, hostname string) (*db.FQDNResolution, error) {
+	query := fmt.Sprintf(`SELECT %s FROM fqdn_resolutions WHERE hostname = $1 ORDER BY resolved_at DESC LIMIT 1`, fqdnResolutionCols)
+	return scanFQDNResolution(r.QueryRowContext(ctx, query, hostname))
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/enjoys-in/secureflow/internal/db"
+)
+
+// HoneypotRepository defines the interface for honeypot data access.
+type HoneypotRepository interface {
+	Repository[db.Honeypot]
+}
+
+type honeypotRepo struct {
+	BasePostgresRepo
+}
+
+// NewHoneypotRepository creates a new HoneypotRepository.
+func NewHoneypotRepository(conn *sql.DB) HoneypotRepository {
+	return &honeypotRepo{BasePostgresRepo{DB: conn}}
+}
+
+var honeypotCols = `id, name, protocol, port, mode, block_seconds, enabled, COALESCE(created_by::text, '') AS created_by, created_at, updated_at`
+
+func scanHoneypot(scanner interface{ Scan(...interface{}) error }) (*db.Honeypot, error) {
+	h := &db.Honeypot{}
+	err := scanner.Scan(&h.ID, &h.Name, &h.Protocol, &h.Port, &h.Mode, &h.BlockSeconds, &h.Enabled, &h.CreatedBy, &h.CreatedAt, &h.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (r *honeypotRepo) FindByID(ctx context.Context, id string) (*db.Honeypot, error) {
+	query := fmt.Sprintf(`SELECT %s FROM honeypots WHERE id = $1`, honeypotCols)
+	return scanHoneypot(r.QueryRowContext(ctx, query, id))
+}
+
+func (r *honeypotRepo) FindOne(ctx context.Context, filter map[string]interface{}) (*db.Honeypot, error) {
+	where, args := BuildWhereClause(filter, 1)
+	query := fmt.Sprintf(`SELECT %s FROM honeypots %s LIMIT 1`, honeypotCols, where)
+	return scanHoneypot(r.QueryRowContext(ctx, query, args...))
+}
+
+func (r *honeypotRepo) FindAll(ctx context.Context, filter map[string]interface{}, limit, offset int) ([]db.Honeypot, error) {
+	where, args := BuildWhereClause(filter, 1)
+	nextParam := len(args) + 1
+	query := fmt.Sprintf(`SELECT %s FROM honeypots %s ORDER BY protocol, port LIMIT $%d OFFSET $%d`, honeypotCols, where, nextParam, nextParam+1)
+	args = append(args, limit, offset)
+
+	rows, err := r.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var honeypots []db.Honeypot
+	for rows.Next() {
+		h, err := scanHoneypot(rows)
+		if err != nil {
+			return nil, err
+		}
+		honeypots = append(honeypots, *h)
+	}
+	return honeypots, rows.Err()
+}
+
+func (r *honeypotRepo) Create(ctx context.Context, h *db.Honeypot) error {
+	return r.QueryRowContext(ctx,
+		`INSERT INTO honeypots (name, protocol, port, mode, block_seconds, enabled, created_by) VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, '')::uuid) RETURNING id, created_at, updated_at`,
+		h.Name, h.Protocol, h.Port, h.Mode, h.BlockSeconds, h.Enabled, h.CreatedBy,
+	).Scan(&h.ID, &h.CreatedAt, &h.UpdatedAt)
+}
+
+func (r *honeypotRepo) FindByIDAndUpdate(ctx context.Context, id string, updates map[string]interface{}) (*db.Honeypot, error) {
+	setClause, args := BuildUpdateSet(updates, 1)
+	args = append(args, id)
+	query := fmt.Sprintf(`UPDATE honeypots %s, updated_at = NOW() WHERE id = $%d RETURNING %s`, setClause, len(args), honeypotCols)
+	return scanHoneypot(r.QueryRowContext(ctx, query, args...))
+}
+
+func (r *honeypotRepo) FindAndUpdate(ctx context.Context, filter map[string]interface{}, updates map[string]interface{}) (*db.Honeypot, error) {
+	setClause, setArgs := BuildUpdateSet(updates, 1)
+	whereClause, whereArgs := BuildWhereClause(filter, len(setArgs)+1)
+	args := append(setArgs, whereArgs...)
+	query := fmt.Sprintf(`UPDATE honeypots %s %s RETURNING %s`, setClause, whereClause, honeypotCols)
+	return scanHoneypot(r.QueryRowContext(ctx, query, args...))
+}
+
+func (r *honeypotRepo) DeleteOne(ctx context.Context, id string) error {
+	_, err := r.ExecContext(ctx, `DELETE FROM honeypots WHERE id = $1`, id)
+	return err
+}
+
+func (r *honeypotRepo) DeleteMany(ctx context.Context, filter map[string]interface{}) (int64, error) {
+	where, args := BuildWhereClause(filter, 1)
+	query := fmt.Sprintf(`DELETE FROM honeypots %s`, where)
+	res, err := r.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
@@ -81,6 +82,8 @@ func (r *invitationRepo) FindPending(ctx context.Context, limit, offset int) ([]
 // ServerRepository defines the interface for server data access.
 type ServerRepository interface {
 	Repository[db.Server]
+	FindLocal(ctx context.Context) (*db.Server, error)
+	EnsureLocal(ctx context.Context, name, ip string) (*db.Server, error)
 }
 
 type serverRepo struct {
@@ -92,11 +95,11 @@ func NewServerRepository(conn *sql.DB) ServerRepository {
 	return &serverRepo{BasePostgresRepo{DB: conn}}
 }
 
-var serverCols = `id, name, ip_address, description, created_by, created_at, updated_at`
+var serverCols = `id, name, ip_address, COALESCE(description, '') AS description, is_local, COALESCE(created_by::text, '') AS created_by, created_at, updated_at`
 
 func scanServer(scanner interface{ Scan(...interface{}) error }) (*db.Server, error) {
 	s := &db.Server{}
-	err := scanner.Scan(&s.ID, &s.Name, &s.IPAddress, &s.Description, &s.CreatedBy, &s.CreatedAt, &s.UpdatedAt)
+	err := scanner.Scan(&s.ID, &s.Name, &s.IPAddress, &s.Description, &s.IsLocal, &s.CreatedBy, &s.CreatedAt, &s.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -137,6 +140,31 @@ func (r *serverRepo) FindAll(ctx context.Context, filter map[string]interface{},
 	return servers, rows.Err()
 }
 
+// FindLocal returns the row representing the host this instance runs on.
+func (r *serverRepo) FindLocal(ctx context.Context) (*db.Server, error) {
+	query := fmt.Sprintf(`SELECT %s FROM servers WHERE is_local LIMIT 1`, serverCols)
+	return scanServer(r.QueryRowContext(ctx, query))
+}
+
+// EnsureLocal returns the local server row, creating it on first start and
+// refreshing its name and address on later ones.
+func (r *serverRepo) EnsureLocal(ctx context.Context, name, ip string) (*db.Server, error) {
+	existing, err := r.FindLocal(ctx)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	if existing != nil {
+		return r.FindByIDAndUpdate(ctx, existing.ID, map[string]interface{}{
+			"name":       name,
+			"ip_address": ip,
+		})
+	}
+
+	query := fmt.Sprintf(`INSERT INTO servers (name, ip_address, description, is_local) VALUES ($1, $2, 'Local host', TRUE) RETURNING %s`, serverCols)
+	return scanServer(r.QueryRowContext(ctx, query, name, ip))
+}
+
 func (r *serverRepo) Create(ctx context.Context, s *db.Server) error {
 	return r.QueryRowContext(ctx,
 		`INSERT INTO servers (name, ip_address, description, created_by) VALUES ($1,$2,$3,$4) RETURNING id, created_at, updated_at`,
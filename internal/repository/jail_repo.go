@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/enjoys-in/secureflow/internal/db"
+)
+
+// JailRepository defines the interface for jail data access.
+type JailRepository interface {
+	Repository[db.Jail]
+}
+
+type jailRepo struct {
+	BasePostgresRepo
+}
+
+// NewJailRepository creates a new JailRepository.
+func NewJailRepository(conn *sql.DB) JailRepository {
+	return &jailRepo{BasePostgresRepo{DB: conn}}
+}
+
+var jailCols = `id, name, log_path, log_format, filters, ignore_cidrs, max_failures, find_seconds, ban_seconds, action, enabled, COALESCE(created_by::text, '') AS created_by, created_at, updated_at`
+
+// jailListCols are the JSONB list columns of a jail.
+var jailListCols = []string{"filters", "ignore_cidrs"}
+
+func scanJail(scanner interface{ Scan(...interface{}) error }) (*db.Jail, error) {
+	j := &db.Jail{}
+	var filters, ignore []byte
+	err := scanner.Scan(&j.ID, &j.Name, &j.LogPath, &j.LogFormat, &filters, &ignore, &j.MaxFailures, &j.FindSeconds,
+		&j.BanSeconds, &j.Action, &j.Enabled, &j.CreatedBy, &j.CreatedAt, &j.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(filters, &j.Filters); err != nil {
+		return nil, fmt.Errorf("decode filters: %w", err)
+	}
+	if err := json.Unmarshal(ignore, &j.IgnoreCIDRs); err != nil {
+		return nil, fmt.Errorf("decode ignore_cidrs: %w", err)
+	}
+	return j, nil
+}
+
+func (r *jailRepo) FindByID(ctx context.Context, id string) (*db.Jail, error) {
+	query := fmt.Sprintf(`SELECT %s FROM jails WHERE id = $1`, jailCols)
+	return scanJail(r.QueryRowContext(ctx, query, id))
+}
+
+func (r *jailRepo) FindOne(ctx context.Context, filter map[string]interface{}) (*db.Jail, error) {
+	where, args := BuildWhereClause(filter, 1)
+	query := fmt.Sprintf(`SELECT %s FROM jails %s LIMIT 1`, jailCols, where)
+	return scanJail(r.QueryRowContext(ctx, query, args...))
+}
+
+func (r *jailRepo) FindAll(ctx context.Context, filter map[string]interface{}, limit, offset int) ([]db.Jail, error) {
+	where, args := BuildWhereClause(filter, 1)
+	nextParam := len(args) + 1
+	query := fmt.Sprintf(`SELECT %s FROM jails %s ORDER BY name LIMIT $%d OFFSET $%d`, jailCols, where, nextParam, nextParam+1)
+	args = append(args, limit, offset)
+
+	rows, err := r.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jails []db.Jail
+	for rows.Next() {
+		j, err := scanJail(rows)
+		if err != nil {
+			return nil, err
+		}
+		jails = append(jails, *j)
+	}
+	return jails, rows.Err()
+}
+
+func (r *jailRepo) Create(ctx context.Context, j *db.Jail) error {
+	if j.Filters == nil {
+		j.Filters = []string{}
+	}
+	if j.IgnoreCIDRs == nil {
+		j.IgnoreCIDRs = []string{}
+	}
+	filters, err := json.Marshal(j.Filters)
+	if err != nil {
+		return fmt.Errorf("encode filters: %w", err)
+	}
+	ignore, err := json.Marshal(j.IgnoreCIDRs)
+	if err != nil {
+		return fmt.Errorf("encode ignore_cidrs: %w", err)
+	}
+
+	return r.QueryRowContext(ctx,
+		`INSERT INTO jails (name, log_path, log_format, filters, ignore_cidrs, max_failures, find_seconds, ban_seconds, action, enabled, created_by) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, '')::uuid) RETURNING id, created_at, updated_at`,
+		j.Name, j.LogPath, j.LogFormat, filters, ignore, j.MaxFailures, j.FindSeconds, j.BanSeconds, j.Action, j.Enabled, j.CreatedBy,
+	).Scan(&j.ID, &j.CreatedAt, &j.UpdatedAt)
+}
+
+// FindByIDAndUpdate updates a jail. "filters" and "ignore_cidrs" values given
+// as []string are encoded to JSON.
+func (r *jailRepo) FindByIDAndUpdate(ctx context.Context, id string, updates map[string]interface{}) (*db.Jail, error) {
+	for _, col := range jailListCols {
+		if list, ok := updates[col].([]string); ok {
+			if list == nil {
+				list = []string{}
+			}
+			b, err := json.Marshal(list)
+			if err != nil {
+				return nil, fmt.Errorf("encode %s: %w", col, err)
+			}
+			updates[col] = b
+		}
+	}
+
+	setClause, args := BuildUpdateSet(updates, 1)
+	args = append(args, id)
+	query := fmt.Sprintf(`UPDATE jails %s, updated_at = NOW() WHERE id = $%d RETURNING %s`, setClause, len(args), jailCols)
+	return scanJail(r.QueryRowContext(ctx, query, args...))
+}
+
+func (r *jailRepo) FindAndUpdate(ctx context.Context, filter map[string]interface{}, updates map[string]interface{}) (*db.Jail, error) {
+	setClause, setArgs := BuildUpdateSet(updates, 1)
+	whereClause, whereArgs := BuildWhereClause(filter, len(setArgs)+1)
+	args := append(setArgs, whereArgs...)
+	query := fmt.Sprintf(`UPDATE jails %s %s RETURNING %s`, setClause, whereClause, jailCols)
+	return scanJail(r.QueryRowContext(ctx, query, args...))
+}
+
+func (r *jailRepo) DeleteOne(ctx context.Context, id string) error {
+	_, err := r.ExecContext(ctx, `DELETE FROM jails WHERE id = $1`, id)
+	return err
+}
+
+func (r *jailRepo) DeleteMany(ctx context.Context, filter map[string]interface{}) (int64, error) {
+	where, args := BuildWhereClause(filter, 1)
+	query := fmt.Sprintf(`DELETE FROM jails %s`, where)
+	res, err := r.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
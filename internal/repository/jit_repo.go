@@ -0,0 +1,248 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/enjoys-in/secureflow/internal/db"
+)
+
+// JITPolicyRepository defines the interface for just-in-time access policy
+// data access.
+type JITPolicyRepository interface {
+	Repository[db.JITPolicy]
+	FindByPort(ctx context.Context, port int, protocol string) (*db.JITPolicy, error)
+}
+
+type jitPolicyRepo struct {
+	BasePostgresRepo
+}
+
+// NewJITPolicyRepository creates a new JITPolicyRepository.
+func NewJITPolicyRepository(conn *sql.DB) JITPolicyRepository {
+	return &jitPolicyRepo{BasePostgresRepo{DB: conn}}
+}
+
+var jitPolicyCols = `id, port, protocol, COALESCE(description, '') AS description, max_minutes, requires_approval, COALESCE(created_by::text, '') AS created_by, created_at, updated_at`
+
+func scanJITPolicy(scanner interface{ Scan(...interface{}) error }) (*db.JITPolicy, error) {
+	p := &db.JITPolicy{}
+	var maxMinutes []byte
+	err := scanner.Scan(&p.ID, &p.Port, &p.Protocol, &p.Description, &maxMinutes, &p.RequiresApproval, &p.CreatedBy, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(maxMinutes, &p.MaxMinutes); err != nil {
+		return nil, fmt.Errorf("decode max_minutes: %w", err)
+	}
+	return p, nil
+}
+
+func (r *jitPolicyRepo) FindByID(ctx context.Context, id string) (*db.JITPolicy, error) {
+	query := fmt.Sprintf(`SELECT %s FROM jit_policies WHERE id = $1`, jitPolicyCols)
+	return scanJITPolicy(r.QueryRowContext(ctx, query, id))
+}
+
+func (r *jitPolicyRepo) FindOne(ctx context.Context, filter map[string]interface{}) (*db.JITPolicy, error) {
+	where, args := BuildWhereClause(filter, 1)
+	query := fmt.Sprintf(`SELECT %s FROM jit_policies %s LIMIT 1`, jitPolicyCols, where)
+	return scanJITPolicy(r.QueryRowContext(ctx, query, args...))
+}
+
+func (r *jitPolicyRepo) FindAll(ctx context.Context, filter map[string]interface{}, limit, offset int) ([]db.JITPolicy, error) {
+	where, args := BuildWhereClause(filter, 1)
+	nextParam := len(args) + 1
+	query := fmt.Sprintf(`SELECT %s FROM jit_policies %s ORDER BY port, protocol LIMIT $%d OFFSET $%d`, jitPolicyCols, where, nextParam, nextParam+1)
+	args = append(args, limit, offset)
+
+	rows, err := r.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var policies []db.JITPolicy
+	for rows.Next() {
+		p, err := scanJITPolicy(rows)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, *p)
+	}
+	return policies, rows.Err()
+}
+
+func (r *jitPolicyRepo) Create(ctx context.Context, p *db.JITPolicy) error {
+	if p.MaxMinutes == nil {
+		p.MaxMinutes = map[string]int{}
+	}
+	maxMinutes, err := json.Marshal(p.MaxMinutes)
+	if err != nil {
+		return fmt.Errorf("encode max_minutes: %w", err)
+	}
+
+	return r.QueryRowContext(ctx,
+		`INSERT INTO jit_policies (port, protocol, description, max_minutes, requires_approval, created_by) VALUES ($1, $2, $3, $4, $5, NULLIF($6, '')::uuid) RETURNING id, created_at, updated_at`,
+		p.Port, p.Protocol, p.Description, maxMinutes, p.RequiresApproval, p.CreatedBy,
+	).Scan(&p.ID, &p.CreatedAt, &p.UpdatedAt)
+}
+
+// FindByIDAndUpdate updates a policy. A "max_minutes" value given as
+// map[string]int is encoded to JSON.
+func (r *jitPolicyRepo) FindByIDAndUpdate(ctx context.Context, id string, updates map[string]interface{}) (*db.JITPolicy, error) {
+	if maxMinutes, ok := updates["max_minutes"].(map[string]int); ok {
+		b, err := json.Marshal(maxMinutes)
+		if err != nil {
+			return nil, fmt.Errorf("encode max_minutes: %w", err)
+		}
+		updates["max_minutes"] = b
+	}
+
+	setClause, args := BuildUpdateSet(updates, 1)
+	args = append(args, id)
+	query := fmt.Sprintf(`UPDATE jit_policies %s, updated_at = NOW() WHERE id = $%d RETURNING %s`, setClause, len(args), jitPolicyCols)
+	return scanJITPolicy(r.QueryRowContext(ctx, query, args...))
+}
+
+func (r *jitPolicyRepo) FindAndUpdate(ctx context.Context, filter map[string]interface{}, updates map[string]interface{}) (*db.JITPolicy, error) {
+	setClause, setArgs := BuildUpdateSet(updates, 1)
+	whereClause, whereArgs := BuildWhereClause(filter, len(setArgs)+1)
+	args := append(setArgs, whereArgs...)
+	query := fmt.Sprintf(`UPDATE jit_policies %s %s RETURNING %s`, setClause, whereClause, jitPolicyCols)
+	return scanJITPolicy(r.QueryRowContext(ctx, query, args...))
+}
+
+func (r *jitPolicyRepo) DeleteOne(ctx context.Context, id string) error {
+	_, err := r.ExecContext(ctx, `DELETE FROM jit_policies WHERE id = $1`, id)
+	return err
+}
+
+func (r *jitPolicyRepo) DeleteMany(ctx context.Context, filter map[string]interface{}) (int64, error) {
+	where, args := BuildWhereClause(filter, 1)
+	query := fmt.Sprintf(`DELETE FROM jit_policies %s`, where)
+	res, err := r.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// FindByPort returns the policy covering a port and protocol.
+func (r *jitPolicyRepo) FindByPort(ctx context.Context, port int, protocol string) (*db.JITPolicy, error) {
+	query := fmt.Sprintf(`SELECT %s FROM jit_policies WHERE port = $1 AND protocol = $2`, jitPolicyCols)
+	return scanJITPolicy(r.QueryRowContext(ctx, query, port, protocol))
+}
+
+// JITGrantRepository defines the interface for just-in-time access request
+// data access.
+type JITGrantRepository interface {
+	Repository[db.JITGrant]
+	FindByRule(ctx context.Context, ruleID string) (*db.JITGrant, error)
+}
+
+type jitGrantRepo struct {
+	BasePostgresRepo
+}
+
+// NewJITGrantRepository creates a new JITGrantRepository.
+func NewJITGrantRepository(conn *sql.DB) JITGrantRepository {
+	return &jitGrantRepo{BasePostgresRepo{DB: conn}}
+}
+
+var jitGrantCols = `id, COALESCE(policy_id::text, '') AS policy_id, user_id, source_ip, port, protocol, minutes, justification, status, COALESCE(rule_id::text, '') AS rule_id, COALESCE(decided_by::text, '') AS decided_by, expires_at, created_at, updated_at`
+
+func scanJITGrant(scanner interface{ Scan(...interface{}) error }) (*db.JITGrant, error) {
+	g := &db.JITGrant{}
+	var expiresAt sql.NullTime
+	err := scanner.Scan(&g.ID, &g.PolicyID, &g.UserID, &g.SourceIP, &g.Port, &g.Protocol, &g.Minutes, &g.Justification,
+		&g.Status, &g.RuleID, &g.DecidedBy, &expiresAt, &g.CreatedAt, &g.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		g.ExpiresAt = &expiresAt.Time
+	}
+	return g, nil
+}
+
+func (r *jitGrantRepo) FindByID(ctx context.Context, id string) (*db.JITGrant, error) {
+	query := fmt.Sprintf(`SELECT %s FROM jit_grants WHERE id = $1`, jitGrantCols)
+	return scanJITGrant(r.QueryRowContext(ctx, query, id))
+}
+
+func (r *jitGrantRepo) FindOne(ctx context.Context, filter map[string]interface{}) (*db.JITGrant, error) {
+	where, args := BuildWhereClause(filter, 1)
+	query := fmt.Sprintf(`SELECT %s FROM jit_grants %s LIMIT 1`, jitGrantCols, where)
+	return scanJITGrant(r.QueryRowContext(ctx, query, args...))
+}
+
+func (r *jitGrantRepo) FindAll(ctx context.Context, filter map[string]interface{}, limit, offset int) ([]db.JITGrant, error) {
+	where, args := BuildWhereClause(filter, 1)
+	nextParam := len(args) + 1
+	query := fmt.Sprintf(`SELECT %s FROM jit_grants %s ORDER BY created_at DESC LIMIT $%d OFFSET $%d`, jitGrantCols, where, nextParam, nextParam+1)
+	args = append(args, limit, offset)
+
+	rows, err := r.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var grants []db.JITGrant
+	for rows.Next() {
+		g, err := scanJITGrant(rows)
+		if err != nil {
+			return nil, err
+		}
+		grants = append(grants, *g)
+	}
+	return grants, rows.Err()
+}
+
+func (r *jitGrantRepo) Create(ctx context.Context, g *db.JITGrant) error {
+	return r.QueryRowContext(ctx,
+		`INSERT INTO jit_grants (policy_id, user_id, source_ip, port, protocol, minutes, justification, status) VALUES (NULLIF($1, '')::uuid, $2, $3, $4, $5, $6, $7, $8) RETURNING id, created_at, updated_at`,
+		g.PolicyID, g.UserID, g.SourceIP, g.Port, g.Protocol, g.Minutes, g.Justification, g.Status,
+	).Scan(&g.ID, &g.CreatedAt, &g.UpdatedAt)
+}
+
+func (r *jitGrantRepo) FindByIDAndUpdate(ctx context.Context, id string, updates map[string]interface{}) (*db.JITGrant, error) {
+	setClause, args := BuildUpdateSet(updates, 1)
+	args = append(args, id)
+	query := fmt.Sprintf(`UPDATE jit_grants %s, updated_at = NOW() WHERE id = $%d RETURNING %s`, setClause, len(args), jitGrantCols)
+	return scanJITGrant(r.QueryRowContext(ctx, query, args...))
+}
+
+// FindAndUpdate updates the grant matching filter. Filtering on the current
+// status makes a state transition atomic: a grant that has already moved on
+// matches nothing and sql.ErrNoRows is returned.
+func (r *jitGrantRepo) FindAndUpdate(ctx context.Context, filter map[string]interface{}, updates map[string]interface{}) (*db.JITGrant, error) {
+	setClause, setArgs := BuildUpdateSet(updates, 1)
+	whereClause, whereArgs := BuildWhereClause(filter, len(setArgs)+1)
+	args := append(setArgs, whereArgs...)
+	query := fmt.Sprintf(`UPDATE jit_grants %s, updated_at = NOW() %s RETURNING %s`, setClause, whereClause, jitGrantCols)
+	return scanJITGrant(r.QueryRowContext(ctx, query, args...))
+}
+
+func (r *jitGrantRepo) DeleteOne(ctx context.Context, id string) error {
+	_, err := r.ExecContext(ctx, `DELETE FROM jit_grants WHERE id = $1`, id)
+	return err
+}
+
+func (r *jitGrantRepo) DeleteMany(ctx context.Context, filter map[string]interface{}) (int64, error) {
+	where, args := BuildWhereClause(filter, 1)
+	query := fmt.Sprintf(`DELETE FROM jit_grants %s`, where)
+	res, err := r.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// FindByRule returns the grant served by a firewall rule.
+func (r *jitGrantRepo) FindByRule(ctx context.Context, ruleID string) (*db.JITGrant, error) {
+	query := fmt.Sprintf(`SELECT %s FROM jit_grants WHERE rule_id = $1`, jitGrantCols)
+	return scanJITGrant(r.QueryRowContext(ctx, query, ruleID))
+}
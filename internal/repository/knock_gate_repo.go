@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/enjoys-in/secureflow/internal/db"
+)
+
+// KnockGateRepository defines the interface for port knocking gate data
+// access.
+type KnockGateRepository interface {
+	Repository[db.KnockGate]
+}
+
+type knockGateRepo struct {
+	BasePostgresRepo
+}
+
+// NewKnockGateRepository creates a new KnockGateRepository.
+func NewKnockGateRepository(conn *sql.DB) KnockGateRepository {
+	return &knockGateRepo{BasePostgresRepo{DB: conn}}
+}
+
+var knockGateCols = `id, name, COALESCE(description, '') AS description, port, protocol, sequence_hash, sequence_salt, sequence_length, window_seconds, open_seconds, COALESCE(created_by::text, '') AS created_by, created_at, updated_at`
+
+func scanKnockGate(scanner interface{ Scan(...interface{}) error }) (*db.KnockGate, error) {
+	g := &db.KnockGate{}
+	err := scanner.Scan(&g.ID, &g.Name, &g.Description, &g.Port, &g.Protocol, &g.SequenceHash, &g.SequenceSalt,
+		&g.SequenceLength, &g.WindowSeconds, &g.OpenSeconds, &g.CreatedBy, &g.CreatedAt, &g.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (r *knockGateRepo) FindByID(ctx context.Context, id string) (*db.KnockGate, error) {
+	query := fmt.Sprintf(`SELECT %s FROM knock_gates WHERE id = $1`, knockGateCols)
+	return scanKnockGate(r.QueryRowContext(ctx, query, id))
+}
+
+func (r *knockGateRepo) FindOne(ctx context.Context, filter map[string]interface{}) (*db.KnockGate, error) {
+	where, args := BuildWhereClause(filter, 1)
+	query := fmt.Sprintf(`SELECT %s FROM knock_gates %s LIMIT 1`, knockGateCols, where)
+	return scanKnockGate(r.QueryRowContext(ctx, query, args...))
+}
+
+func (r *knockGateRepo) FindAll(ctx context.Context, filter map[string]interface{}, limit, offset int) ([]db.KnockGate, error) {
+	where, args := BuildWhereClause(filter, 1)
+	nextParam := len(args) + 1
+	query := fmt.Sprintf(`SELECT %s FROM knock_gates %s ORDER BY name LIMIT $%d OFFSET $%d`, knockGateCols, where, nextParam, nextParam+1)
+	args = append(args, limit, offset)
+
+	rows, err := r.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var gates []db.KnockGate
+	for rows.Next() {
+		g, err := scanKnockGate(rows)
+		if err != nil {
+			return nil, err
+		}
+		gates = append(gates, *g)
+	}
+	return gates, rows.Err()
+}
+
+func (r *knockGateRepo) Create(ctx context.Context, g *db.KnockGate) error {
+	return r.QueryRowContext(ctx,
+		`INSERT INTO knock_gates (name, description, port, protocol, sequence_hash, sequence_salt, sequence_length, window_seconds, open_seconds, created_by) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, '')::uuid) RETURNING id, created_at, updated_at`,
+		g.Name, g.Description, g.Port, g.Protocol, g.SequenceHash, g.SequenceSalt, g.SequenceLength, g.WindowSeconds, g.OpenSeconds, g.CreatedBy,
+	).Scan(&g.ID, &g.CreatedAt, &g.UpdatedAt)
+}
+
+func (r *knockGateRepo) FindByIDAndUpdate(ctx context.Context, id string, updates map[string]interface{}) (*db.KnockGate, error) {
+	setClause, args := BuildUpdateSet(updates, 1)
+	args = append(args, id)
+	query := fmt.Sprintf(`UPDATE knock_gates %s, updated_at = NOW() WHERE id = $%d RETURNING %s`, setClause, len(args), knockGateCols)
+	return scanKnockGate(r.QueryRowContext(ctx, query, args...))
+}
+
+func (r *knockGateRepo) FindAndUpdate(ctx context.Context, filter map[string]interface{}, updates map[string]interface{}) (*db.KnockGate, error) {
+	setClause, setArgs := BuildUpdateSet(updates, 1)
+	whereClause, whereArgs := BuildWhereClause(filter, len(setArgs)+1)
+	args := append(setArgs, whereArgs...)
+	query := fmt.Sprintf(`UPDATE knock_gates %s %s RETURNING %s`, setClause, whereClause, knockGateCols)
+	return scanKnockGate(r.QueryRowContext(ctx, query, args...))
+}
+
+func (r *knockGateRepo) DeleteOne(ctx context.Context, id string) error {
+	_, err := r.ExecContext(ctx, `DELETE FROM knock_gates WHERE id = $1`, id)
+	return err
+}
+
+func (r *knockGateRepo) DeleteMany(ctx context.Context, filter map[string]interface{}) (int64, error) {
+	where, args := BuildWhereClause(filter, 1)
+	query := fmt.Sprintf(`DELETE FROM knock_gates %s`, where)
+	res, err := r.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
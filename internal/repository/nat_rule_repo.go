@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/enjoys-in/secureflow/internal/db"
+)
+
+// NATRuleRepository defines the interface for NAT rule data access.
+type NATRuleRepository interface {
+	Repository[db.NATRule]
+	FindByServer(ctx context.Context, serverID string) ([]db.NATRule, error)
+}
+
+type natRuleRepo struct {
+	BasePostgresRepo
+}
+
+// NewNATRuleRepository creates a new NATRuleRepository.
+func NewNATRuleRepository(conn *sql.DB) NATRuleRepository {
+	return &natRuleRepo{BasePostgresRepo{DB: conn}}
+}
+
+var natRuleCols = `id, server_id, type, COALESCE(interface, '') AS interface, protocol, COALESCE(source_cidr, '') AS source_cidr, COALESCE(dest_cidr, '') AS dest_cidr, port, port_range_end, COALESCE(to_address, '') AS to_address, to_port, COALESCE(description, '') AS description, COALESCE(created_by::text, '') AS created_by, created_at, updated_at`
+
+func scanNATRule(scanner interface{ Scan(...interface{}) error }) (*db.NATRule, error) {
+	n := &db.NATRule{}
+	err := scanner.Scan(&n.ID, &n.ServerID, &n.Type, &n.Interface, &n.Protocol, &n.SourceCIDR, &n.DestCIDR,
+		&n.Port, &n.PortRangeEnd, &n.ToAddress, &n.ToPort, &n.Description, &n.CreatedBy, &n.CreatedAt, &n.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func (r *natRuleRepo) queryAll(ctx context.Context, query string, args ...interface{}) ([]db.NATRule, error) {
+	rows, err := r.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []db.NATRule
+	for rows.Next() {
+		n, err := scanNATRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, *n)
+	}
+	return rules, rows.Err()
+}
+
+func (r *natRuleRepo) FindByID(ctx context.Context, id string) (*db.NATRule, error) {
+	query := fmt.Sprintf(`SELECT %s FROM nat_rules WHERE id = $1`, natRuleCols)
+	return scanNATRule(r.QueryRowContext(ctx, query, id))
+}
+
+func (r *natRuleRepo) FindOne(ctx context.Context, filter map[string]interface{}) (*db.NATRule, error) {
+	where, args := BuildWhereClause(filter, 1)
+	query := fmt.Sprintf(`SELECT %s FROM nat_rules %s LIMIT 1`, natRuleCols, where)
+	return scanNATRule(r.QueryRowContext(ctx, query, args...))
+}
+
+func (r *natRuleRepo) FindAll(ctx context.Context, filter map[string]interface{}, limit, offset int) ([]db.NATRule, error) {
+	where, args := BuildWhereClause(filter, 1)
+	nextParam := len(args) + 1
+	query := fmt.Sprintf(`SELECT %s FROM nat_rules %s ORDER BY created_at LIMIT $%d OFFSET $%d`, natRuleCols, where, nextParam, nextParam+1)
+	args = append(args, limit, offset)
+	return r.queryAll(ctx, query, args...)
+}
+
+// FindByServer returns the NAT rules of a server in installation order.
+func (r *natRuleRepo) FindByServer(ctx context.Context, serverID string) ([]db.NATRule, error) {
+	query := fmt.Sprintf(`SELECT %s FROM nat_rules WHERE server_id = $1 ORDER BY created_at`, natRuleCols)
+	return r.queryAll(ctx, query, serverID)
+}
+
+func (r *natRuleRepo) Create(ctx context.Context, n *db.NATRule) error {
+	return r.QueryRowContext(ctx,
+		`INSERT INTO nat_rules (server_id, type, interface, protocol, source_cidr, dest_cidr, port, port_range_end, to_address, to_port, description, created_by)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NULLIF($12, '')::uuid) RETURNING id, created_at, updated_at`,
+		n.ServerID, n.Type, n.Interface, n.Protocol, n.SourceCIDR, n.DestCIDR, n.Port, n.PortRangeEnd, n.ToAddress, n.ToPort, n.Description, n.CreatedBy,
+	).Scan(&n.ID, &n.CreatedAt, &n.UpdatedAt)
+}
+
+func (r *natRuleRepo) FindByIDAndUpdate(ctx context.Context, id string, updates map[string]interface{}) (*db.NATRule, error) {
+	setClause, args := BuildUpdateSet(updates, 1)
+	args = append(args, id)
+	query := fmt.Sprintf(`UPDATE nat_rules %s, updated_at = NOW() WHERE id = $%d RETURNING %s`, setClause, len(args), natRuleCols)
+	return scanNATRule(r.QueryRowContext(ctx, query, args...))
+}
+
+func (r *natRuleRepo) FindAndUpdate(ctx context.Context, filter map[string]interface{}, updates map[string]interface{}) (*db.NATRule, error) {
+	setClause, setArgs := BuildUpdateSet(updates, 1)
+	whereClause, whereArgs := BuildWhereClause(filter, len(setArgs)+1)
+	args := append(setArgs, whereArgs...)
+	query := fmt.Sprintf(`UPDATE nat_rules %s %s RETURNING %s`, setClause, whereClause, natRuleCols)
+	return scanNATRule(r.QueryRowContext(ctx, query, args...))
+}
+
+func (r *natRuleRepo) DeleteOne(ctx context.Context, id string) error {
+	_, err := r.ExecContext(ctx, `DELETE FROM nat_rules WHERE id = $1`, id)
+	return err
+}
+
+func (r *natRuleRepo) DeleteMany(ctx context.Context, filter map[string]interface{}) (int64, error) {
+	where, args := BuildWhereClause(filter, 1)
+	query := fmt.Sprintf(`DELETE FROM nat_rules %s`, where)
+	res, err := r.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/enjoys-in/secureflow/internal/db"
+)
+
+// ScheduleRepository defines the interface for schedule data access.
+type ScheduleRepository interface {
+	Repository[db.Schedule]
+	SetActive(ctx context.Context, id string, active bool) error
+	CountReferences(ctx context.Context, id string) (int, error)
+}
+
+type scheduleRepo struct {
+	BasePostgresRepo
+}
+
+// NewScheduleRepository creates a new ScheduleRepository.
+func NewScheduleRepository(conn *sql.DB) ScheduleRepository {
+	return &scheduleRepo{BasePostgresRepo{DB: conn}}
+}
+
+var scheduleCols = `id, name, COALESCE(description, '') AS description, timezone, windows, active, COALESCE(created_by::text, '') AS created_by, created_at, updated_at`
+
+func scanSchedule(scanner interface{ Scan(...interface{}) error }) (*db.Schedule, error) {
+	s := &db.Schedule{}
+	var windows []byte
+	err := scanner.Scan(&s.ID, &s.Name, &s.Description, &s.Timezone, &windows, &s.Active, &s.CreatedBy, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(windows, &s.Windows); err != nil {
+		return nil, fmt.Errorf("decode windows: %w", err)
+	}
+	return s, nil
+}
+
+func (r *scheduleRepo) FindByID(ctx context.Context, id string) (*db.Schedule, error) {
+	query := fmt.Sprintf(`SELECT %s FROM schedules WHERE id = $1`, scheduleCols)
+	return scanSchedule(r.QueryRowContext(ctx, query, id))
+}
+
+func (r *scheduleRepo) FindOne(ctx context.Context, filter map[string]interface{}) (*db.Schedule, error) {
+	where, args := BuildWhereClause(filter, 1)
+	query := fmt.Sprintf(`SELECT %s FROM schedules %s LIMIT 1`, scheduleCols, where)
+	return scanSchedule(r.QueryRowContext(ctx, query, args...))
+}
+
+func (r *scheduleRepo) FindAll(ctx context.Context, filter map[string]interface{}, limit, offset int) ([]db.Schedule, error) {
+	where, args := BuildWhereClause(filter, 1)
+	nextParam := len(args) + 1
+	query := fmt.Sprintf(`SELECT %s FROM schedules %s ORDER BY name LIMIT $%d OFFSET $%d`, scheduleCols, where, nextParam, nextParam+1)
+	args = append(args, limit, offset)
+
+	rows, err := r.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []db.Schedule
+	for rows.Next() {
+		s, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, *s)
+	}
+	return schedules, rows.Err()
+}
+
+func (r *scheduleRepo) Create(ctx context.Context, s *db.Schedule) error {
+	if s.Windows == nil {
+		s.Windows = []db.ScheduleWindow{}
+	}
+	windows, err := json.Marshal(s.Windows)
+	if err != nil {
+		return fmt.Errorf("encode windows: %w", err)
+	}
+
+	return r.QueryRowContext(ctx,
+		`INSERT INTO schedules (name, description, timezone, windows, created_by) VALUES ($1, $2, $3, $4, NULLIF($5, '')::uuid) RETURNING id, created_at, updated_at`,
+		s.Name, s.Description, s.Timezone, windows, s.CreatedBy,
+	).Scan(&s.ID, &s.CreatedAt, &s.UpdatedAt)
+}
+
+// FindByIDAndUpdate updates a schedule. A "windows" value given as
+// []db.ScheduleWindow is encoded to JSON.
+func (r *scheduleRepo) FindByIDAndUpdate(ctx context.Context, id string, updates map[string]interface{}) (*db.Schedule, error) {
+	if windows, ok := updates["windows"].([]db.ScheduleWindow); ok {
+		b, err := json.Marshal(windows)
+		if err != nil {
+			return nil, fmt.Errorf("encode windows: %w", err)
+		}
+		updates["windows"] = b
+	}
+
+	setClause, args := BuildUpdateSet(updates, 1)
+	args = append(args, id)
+	query := fmt.Sprintf(`UPDATE schedules %s, updated_at = NOW() WHERE id = $%d RETURNING %s`, setClause, len(args), scheduleCols)
+	return scanSchedule(r.QueryRowContext(ctx, query, args...))
+}
+
+func (r *scheduleRepo) FindAndUpdate(ctx context.Context, filter map[string]interface{}, updates map[string]interface{}) (*db.Schedule, error) {
+	setClause, setArgs := BuildUpdateSet(updates, 1)
+	whereClause, whereArgs := BuildWhereClause(filter, len(setArgs)+1)
+	args := append(setArgs, whereArgs...)
+	query := fmt.Sprintf(`UPDATE schedules %s %s RETURNING %s`, setClause, whereClause, scheduleCols)
+	return scanSchedule(r.QueryRowContext(ctx, query, args...))
+}
+
+func (r *scheduleRepo) DeleteOne(ctx context.Context, id string) error {
+	_, err := r.ExecContext(ctx, `DELETE FROM schedules WHERE id = $1`, id)
+	return err
+}
+
+func (r *scheduleRepo) DeleteMany(ctx context.Context, filter map[string]interface{}) (int64, error) {
+	where, args := BuildWhereClause(filter, 1)
+	query := fmt.Sprintf(`DELETE FROM schedules %s`, where)
+	res, err := r.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// SetActive records the state the scheduler last evaluated for a schedule.
+// It does not touch updated_at, which tracks edits to the definition.
+func (r *scheduleRepo) SetActive(ctx context.Context, id string, active bool) error {
+	_, err := r.ExecContext(ctx, `UPDATE schedules SET active = $2 WHERE id = $1`, id, active)
+	return err
+}
+
+// CountReferences returns how many firewall rules and security group
+// applications are limited to the schedule.
+func (r *scheduleRepo) CountReferences(ctx context.Context, id string) (int, error) {
+	var n int
+	err := r.QueryRowContext(ctx,
+		`SELECT (SELECT COUNT(*) FROM firewall_rules WHERE schedule_id = $1) +
+		        (SELECT COUNT(*) FROM server_security_groups WHERE schedule_id = $1)`,
+		id,
+	).Scan(&n)
+	return n, err
+}
@@ -13,8 +13,12 @@ type SecurityGroupRepository interface {
 	Repository[db.SecurityGroup]
 	FindAllWithDetails(ctx context.Context, limit, offset int) ([]db.SecurityGroupWithDetails, error)
 	AttachToServer(ctx context.Context, serverID, sgID, userID string) error
+	SetServerSchedule(ctx context.Context, serverID, sgID, scheduleID string) error
 	DetachFromServer(ctx context.Context, serverID, sgID string) error
 	ListByServer(ctx context.Context, serverID string) ([]db.SecurityGroup, error)
+	ListAppliedByServer(ctx context.Context, serverID string) ([]db.AppliedSecurityGroup, error)
+	IsAttached(ctx context.Context, serverID, sgID string) (bool, error)
+	ListMemberAddresses(ctx context.Context, sgID string) ([]string, error)
 }
 
 type securityGroupRepo struct {
@@ -147,12 +151,23 @@ func (r *securityGroupRepo) DeleteMany(ctx context.Context, filter map[string]in
 
 func (r *securityGroupRepo) AttachToServer(ctx context.Context, serverID, sgID, userID string) error {
 	_, err := r.ExecContext(ctx,
-		`INSERT INTO server_security_groups (server_id, security_group_id, applied_by) VALUES ($1,$2,$3) ON CONFLICT DO NOTHING`,
+		`INSERT INTO server_security_groups (server_id, security_group_id, applied_by) VALUES ($1,$2,NULLIF($3, '')::uuid)
+		 ON CONFLICT (server_id, security_group_id) DO UPDATE SET applied_at = NOW(), applied_by = EXCLUDED.applied_by`,
 		serverID, sgID, userID,
 	)
 	return err
 }
 
+// SetServerSchedule limits a group's application on a server to a schedule;
+// an empty scheduleID lifts the limit.
+func (r *securityGroupRepo) SetServerSchedule(ctx context.Context, serverID, sgID, scheduleID string) error {
+	_, err := r.ExecContext(ctx,
+		`UPDATE server_security_groups SET schedule_id = NULLIF($3, '')::uuid WHERE server_id = $1 AND security_group_id = $2`,
+		serverID, sgID, scheduleID,
+	)
+	return err
+}
+
 func (r *securityGroupRepo) DetachFromServer(ctx context.Context, serverID, sgID string) error {
 	_, err := r.ExecContext(ctx,
 		`DELETE FROM server_security_groups WHERE server_id = $1 AND security_group_id = $2`,
@@ -182,3 +197,68 @@ func (r *securityGroupRepo) ListByServer(ctx context.Context, serverID string) (
 	}
 	return groups, rows.Err()
 }
+
+func (r *securityGroupRepo) ListAppliedByServer(ctx context.Context, serverID string) ([]db.AppliedSecurityGroup, error) {
+	query := `SELECT sg.id, sg.name, COALESCE(sg.description, '') AS description,
+		COALESCE(sg.created_by::text, '') AS created_by, sg.created_at, sg.updated_at,
+		COALESCE(ssg.schedule_id::text, '') AS schedule_id, ssg.applied_at, COALESCE(ssg.applied_by::text, '') AS applied_by,
+		COALESCE(u.name, '') AS applied_by_name
+		FROM server_security_groups ssg
+		JOIN security_groups sg ON sg.id = ssg.security_group_id
+		LEFT JOIN users u ON ssg.applied_by = u.id
+		WHERE ssg.server_id = $1
+		ORDER BY ssg.applied_at`
+
+	rows, err := r.QueryContext(ctx, query, serverID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []db.AppliedSecurityGroup
+	for rows.Next() {
+		var g db.AppliedSecurityGroup
+		if err := rows.Scan(
+			&g.ID, &g.Name, &g.Description, &g.CreatedBy, &g.CreatedAt, &g.UpdatedAt,
+			&g.ScheduleID, &g.AppliedAt, &g.AppliedBy, &g.AppliedByName,
+		); err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+func (r *securityGroupRepo) IsAttached(ctx context.Context, serverID, sgID string) (bool, error) {
+	var exists bool
+	err := r.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM server_security_groups WHERE server_id = $1 AND security_group_id = $2)`,
+		serverID, sgID,
+	).Scan(&exists)
+	return exists, err
+}
+
+// ListMemberAddresses returns the IPs of every server the group is applied to.
+// These are the addresses a rule referencing the group matches.
+func (r *securityGroupRepo) ListMemberAddresses(ctx context.Context, sgID string) ([]string, error) {
+	rows, err := r.QueryContext(ctx,
+		`SELECT DISTINCT s.ip_address FROM servers s
+		 JOIN server_security_groups ssg ON s.id = ssg.server_id
+		 WHERE ssg.security_group_id = $1`,
+		sgID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var addrs []string
+	for rows.Next() {
+		var ip string
+		if err := rows.Scan(&ip); err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, ip)
+	}
+	return addrs, rows.Err()
+}
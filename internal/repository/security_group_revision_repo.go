@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/enjoys-in/secureflow/internal/db"
+)
+
+// SecurityGroupRevisionRepository defines the interface for security group revision data access.
+// Revisions are append-only: there is no update or delete.
+type SecurityGroupRevisionRepository interface {
+	Create(ctx context.Context, rev *db.SecurityGroupRevision) error
+	FindBySecurityGroup(ctx context.Context, sgID string, limit, offset int) ([]db.SecurityGroupRevision, error)
+	FindByRevision(ctx context.Context, sgID string, revision int) (*db.SecurityGroupRevision, error)
+	// RunInTx runs fn in one transaction; see BasePostgresRepo.RunInTx. Group
+	// changes use it to commit together with their revision.
+	RunInTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type securityGroupRevisionRepo struct {
+	BasePostgresRepo
+}
+
+// NewSecurityGroupRevisionRepository creates a new SecurityGroupRevisionRepository.
+func NewSecurityGroupRevisionRepository(conn *sql.DB) SecurityGroupRevisionRepository {
+	return &securityGroupRevisionRepo{BasePostgresRepo{DB: conn}}
+}
+
+var sgRevisionCols = `id, security_group_id, revision, name, COALESCE(description, '') AS description, rules, COALESCE(change_summary, '') AS change_summary, COALESCE(created_by::text, '') AS created_by, created_at`
+
+func scanSecurityGroupRevision(scanner interface{ Scan(...interface{}) error }) (*db.SecurityGroupRevision, error) {
+	rev := &db.SecurityGroupRevision{}
+	var rules []byte
+	err := scanner.Scan(&rev.ID, &rev.SecurityGroupID, &rev.Revision, &rev.Name, &rev.Description,
+		&rules, &rev.ChangeSummary, &rev.CreatedBy, &rev.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(rules, &rev.Rules); err != nil {
+		return nil, fmt.Errorf("decode revision rules: %w", err)
+	}
+	return rev, nil
+}
+
+// Create stores a new revision, assigning the next revision number for the group.
+// The group row is locked for the duration so concurrent edits are numbered in
+// turn instead of colliding on UNIQUE(security_group_id, revision).
+func (r *securityGroupRevisionRepo) Create(ctx context.Context, rev *db.SecurityGroupRevision) error {
+	if rev.Rules == nil {
+		rev.Rules = []db.FirewallRule{}
+	}
+	rules, err := json.Marshal(rev.Rules)
+	if err != nil {
+		return fmt.Errorf("encode revision rules: %w", err)
+	}
+
+	return r.RunInTx(ctx, func(ctx context.Context) error {
+		var locked string
+		if err := r.QueryRowContext(ctx,
+			`SELECT id FROM security_groups WHERE id = $1 FOR UPDATE`, rev.SecurityGroupID,
+		).Scan(&locked); err != nil {
+			return fmt.Errorf("lock security group %s: %w", rev.SecurityGroupID, err)
+		}
+
+		return r.QueryRowContext(ctx,
+			`INSERT INTO security_group_revisions (security_group_id, revision, name, description, rules, change_summary, created_by)
+			 SELECT $1, COALESCE(MAX(revision), 0) + 1, $2, $3, $4, $5, NULLIF($6, '')::uuid
+			 FROM security_group_revisions WHERE security_group_id = $1
+			 RETURNING id, revision, created_at`,
+			rev.SecurityGroupID, rev.Name, rev.Description, rules, rev.ChangeSummary, rev.CreatedBy,
+		).Scan(&rev.ID, &rev.Revision, &rev.CreatedAt)
+	})
+}
+
+func (r *securityGroupRevisionRepo) FindBySecurityGroup(ctx context.Context, sgID string, limit, offset int) ([]db.SecurityGroupRevision, error) {
+	query := fmt.Sprintf(`SELECT %s FROM security_group_revisions WHERE security_group_id = $1 ORDER BY revision DESC LIMIT $2 OFFSET $3`, sgRevisionCols)
+	rows, err := r.QueryContext(ctx, query, sgID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revs []db.SecurityGroupRevision
+	for rows.Next() {
+		rev, err := scanSecurityGroupRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revs = append(revs, *rev)
+	}
+	return revs, rows.Err()
+}
+
+func (r *securityGroupRevisionRepo) FindByRevision(ctx context.Context, sgID string, revision int) (*db.SecurityGroupRevision, error) {
+	query := fmt.Sprintf(`SELECT %s FROM security_group_revisions WHERE security_group_id = $1 AND revision = $2`, sgRevisionCols)
+	return scanSecurityGroupRevision(r.QueryRowContext(ctx, query, sgID, revision))
+}
+
+// RecordRevision snapshots the current state of a security group as a new
+// revision. Every change to a group's name, description or rules should
+// record one, inside RunInTx with the change itself, so its history stays
+// complete.
+func RecordRevision(
+	ctx context.Context,
+	sgRepo SecurityGroupRepository,
+	ruleRepo FirewallRuleRepository,
+	revRepo SecurityGroupRevisionRepository,
+	sgID, userID, summary string,
+) error {
+	sg, err := sgRepo.FindByID(ctx, sgID)
+	if err != nil {
+		return err
+	}
+
+	rules, err := ruleRepo.FindBySecurityGroup(ctx, sgID)
+	if err != nil {
+		return err
+	}
+
+	return revRepo.Create(ctx, &db.SecurityGroupRevision{
+		SecurityGroupID: sgID,
+		Name:            sg.Name,
+		Description:     sg.Description,
+		Rules:           rules,
+		ChangeSummary:   summary,
+		CreatedBy:       userID,
+	})
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/enjoys-in/secureflow/internal/db"
+)
+
+// ServiceObjectRepository defines the interface for service object data access.
+type ServiceObjectRepository interface {
+	Repository[db.ServiceObject]
+	CountReferences(ctx context.Context, id string) (int, error)
+}
+
+type serviceObjectRepo struct {
+	BasePostgresRepo
+}
+
+// NewServiceObjectRepository creates a new ServiceObjectRepository.
+func NewServiceObjectRepository(conn *sql.DB) ServiceObjectRepository {
+	return &serviceObjectRepo{BasePostgresRepo{DB: conn}}
+}
+
+var serviceObjectCols = `id, name, COALESCE(description, '') AS description, protocol, ports, COALESCE(created_by::text, '') AS created_by, created_at, updated_at`
+
+func scanServiceObject(scanner interface{ Scan(...interface{}) error }) (*db.ServiceObject, error) {
+	o := &db.ServiceObject{}
+	var ports []byte
+	err := scanner.Scan(&o.ID, &o.Name, &o.Description, &o.Protocol, &ports, &o.CreatedBy, &o.CreatedAt, &o.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(ports, &o.Ports); err != nil {
+		return nil, fmt.Errorf("decode ports: %w", err)
+	}
+	return o, nil
+}
+
+func (r *serviceObjectRepo) FindByID(ctx context.Context, id string) (*db.ServiceObject, error) {
+	query := fmt.Sprintf(`SELECT %s FROM service_objects WHERE id = $1`, serviceObjectCols)
+	return scanServiceObject(r.QueryRowContext(ctx, query, id))
+}
+
+func (r *serviceObjectRepo) FindOne(ctx context.Context, filter map[string]interface{}) (*db.ServiceObject, error) {
+	where, args := BuildWhereClause(filter, 1)
+	query := fmt.Sprintf(`SELECT %s FROM service_objects %s LIMIT 1`, serviceObjectCols, where)
+	return scanServiceObject(r.QueryRowContext(ctx, query, args...))
+}
+
+func (r *serviceObjectRepo) FindAll(ctx context.Context, filter map[string]interface{}, limit, offset int) ([]db.ServiceObject, error) {
+	where, args := BuildWhereClause(filter, 1)
+	nextParam := len(args) + 1
+	query := fmt.Sprintf(`SELECT %s FROM service_objects %s ORDER BY name LIMIT $%d OFFSET $%d`, serviceObjectCols, where, nextParam, nextParam+1)
+	args = append(args, limit, offset)
+
+	rows, err := r.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var objs []db.ServiceObject
+	for rows.Next() {
+		o, err := scanServiceObject(rows)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, *o)
+	}
+	return objs, rows.Err()
+}
+
+func (r *serviceObjectRepo) Create(ctx context.Context, o *db.ServiceObject) error {
+	if o.Ports == nil {
+		o.Ports = []db.ServicePort{}
+	}
+	ports, err := json.Marshal(o.Ports)
+	if err != nil {
+		return fmt.Errorf("encode ports: %w", err)
+	}
+
+	return r.QueryRowContext(ctx,
+		`INSERT INTO service_objects (name, description, protocol, ports, created_by) VALUES ($1, $2, $3, $4, NULLIF($5, '')::uuid) RETURNING id, created_at, updated_at`,
+		o.Name, o.Description, o.Protocol, ports, o.CreatedBy,
+	).Scan(&o.ID, &o.CreatedAt, &o.UpdatedAt)
+}
+
+// FindByIDAndUpdate updates a service object. A "ports" value given as
+// []db.ServicePort is encoded to JSON.
+func (r *serviceObjectRepo) FindByIDAndUpdate(ctx context.Context, id string, updates map[string]interface{}) (*db.ServiceObject, error) {
+	if ports, ok := updates["ports"].([]db.ServicePort); ok {
+		b, err := json.Marshal(ports)
+		if err != nil {
+			return nil, fmt.Errorf("encode ports: %w", err)
+		}
+		updates["ports"] = b
+	}
+
+	setClause, args := BuildUpdateSet(updates, 1)
+	args = append(args, id)
+	query := fmt.Sprintf(`UPDATE service_objects %s, updated_at = NOW() WHERE id = $%d RETURNING %s`, setClause, len(args), serviceObjectCols)
+	return scanServiceObject(r.QueryRowContext(ctx, query, args...))
+}
+
+func (r *serviceObjectRepo) FindAndUpdate(ctx context.Context, filter map[string]interface{}, updates map[string]interface{}) (*db.ServiceObject, error) {
+	setClause, setArgs := BuildUpdateSet(updates, 1)
+	whereClause, whereArgs := BuildWhereClause(filter, len(setArgs)+1)
+	args := append(setArgs, whereArgs...)
+	query := fmt.Sprintf(`UPDATE service_objects %s %s RETURNING %s`, setClause, whereClause, serviceObjectCols)
+	return scanServiceObject(r.QueryRowContext(ctx, query, args...))
+}
+
+func (r *serviceObjectRepo) DeleteOne(ctx context.Context, id string) error {
+	_, err := r.ExecContext(ctx, `DELETE FROM service_objects WHERE id = $1`, id)
+	return err
+}
+
+func (r *serviceObjectRepo) DeleteMany(ctx context.Context, filter map[string]interface{}) (int64, error) {
+	where, args := BuildWhereClause(filter, 1)
+	query := fmt.Sprintf(`DELETE FROM service_objects %s`, where)
+	res, err := r.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// CountReferences returns how many firewall rules use the service object.
+func (r *serviceObjectRepo) CountReferences(ctx context.Context, id string) (int, error) {
+	var n int
+	err := r.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM firewall_rules WHERE service_id = $1`,
+		id,
+	).Scan(&n)
+	return n, err
+}
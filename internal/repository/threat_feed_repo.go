@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/enjoys-in/secureflow/internal/db"
+)
+
+// ThreatFeedRepository defines the interface for threat feed data access.
+type ThreatFeedRepository interface {
+	Repository[db.ThreatFeed]
+}
+
+type threatFeedRepo struct {
+	BasePostgresRepo
+}
+
+// NewThreatFeedRepository creates a new ThreatFeedRepository.
+func NewThreatFeedRepository(conn *sql.DB) ThreatFeedRepository {
+	return &threatFeedRepo{BasePostgresRepo{DB: conn}}
+}
+
+var threatFeedCols = `id, name, source, format, csv_column, refresh_minutes, action, enabled, entry_count, skipped_count, last_added, last_removed, last_fetched_at, last_success_at, last_error, COALESCE(created_by::text, '') AS created_by, created_at, updated_at`
+
+func scanThreatFeed(scanner interface{ Scan(...interface{}) error }) (*db.ThreatFeed, error) {
+	f := &db.ThreatFeed{}
+	err := scanner.Scan(&f.ID, &f.Name, &f.Source, &f.Format, &f.CSVColumn, &f.RefreshMinutes, &f.Action, &f.Enabled,
+		&f.EntryCount, &f.SkippedCount, &f.LastAdded, &f.LastRemoved, &f.LastFetchedAt, &f.LastSuccessAt, &f.LastError,
+		&f.CreatedBy, &f.CreatedAt, &f.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (r *threatFeedRepo) FindByID(ctx context.Context, id string) (*db.ThreatFeed, error) {
+	query := fmt.Sprintf(`SELECT %s FROM threat_feeds WHERE id = $1`, threatFeedCols)
+	return scanThreatFeed(r.QueryRowContext(ctx, query, id))
+}
+
+func (r *threatFeedRepo) FindOne(ctx context.Context, filter map[string]interface{}) (*db.ThreatFeed, error) {
+	where, args := BuildWhereClause(filter, 1)
+	query := fmt.Sprintf(`SELECT %s FROM threat_feeds %s LIMIT 1`, threatFeedCols, where)
+	return scanThreatFeed(r.QueryRowContext(ctx, query, args...))
+}
+
+func (r *threatFeedRepo) FindAll(ctx context.Context, filter map[string]interface{}, limit, offset int) ([]db.ThreatFeed, error) {
+	where, args := BuildWhereClause(filter, 1)
+	nextParam := len(args) + 1
+	query := fmt.Sprintf(`SELECT %s FROM threat_feeds %s ORDER BY name LIMIT $%d OFFSET $%d`, threatFeedCols, where, nextParam, nextParam+1)
+	args = append(args, limit, offset)
+
+	rows, err := r.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var feeds []db.ThreatFeed
+	for rows.Next() {
+		f, err := scanThreatFeed(rows)
+		if err != nil {
+			return nil, err
+		}
+		feeds = append(feeds, *f)
+	}
+	return feeds, rows.Err()
+}
+
+func (r *threatFeedRepo) Create(ctx context.Context, f *db.ThreatFeed) error {
+	return r.QueryRowContext(ctx,
+		`INSERT INTO threat_feeds (name, source, format, csv_column, refresh_minutes, action, enabled, created_by) VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, '')::uuid) RETURNING id, created_at, updated_at`,
+		f.Name, f.Source, f.Format, f.CSVColumn, f.RefreshMinutes, f.Action, f.Enabled, f.CreatedBy,
+	).Scan(&f.ID, &f.CreatedAt, &f.UpdatedAt)
+}
+
+func (r *threatFeedRepo) FindByIDAndUpdate(ctx context.Context, id string, updates map[string]interface{}) (*db.ThreatFeed, error) {
+	setClause, args := BuildUpdateSet(updates, 1)
+	args = append(args, id)
+	query := fmt.Sprintf(`UPDATE threat_feeds %s, updated_at = NOW() WHERE id = $%d RETURNING %s`, setClause, len(args), threatFeedCols)
+	return scanThreatFeed(r.QueryRowContext(ctx, query, args...))
+}
+
+func (r *threatFeedRepo) FindAndUpdate(ctx context.Context, filter map[string]interface{}, updates map[string]interface{}) (*db.ThreatFeed, error) {
+	setClause, setArgs := BuildUpdateSet(updates, 1)
+	whereClause, whereArgs := BuildWhereClause(filter, len(setArgs)+1)
+	args := append(setArgs, whereArgs...)
+	query := fmt.Sprintf(`UPDATE threat_feeds %s %s RETURNING %s`, setClause, whereClause, threatFeedCols)
+	return scanThreatFeed(r.QueryRowContext(ctx, query, args...))
+}
+
+func (r *threatFeedRepo) DeleteOne(ctx context.Context, id string) error {
+	_, err := r.ExecContext(ctx, `DELETE FROM threat_feeds WHERE id = $1`, id)
+	return err
+}
+
+func (r *threatFeedRepo) DeleteMany(ctx context.Context, filter map[string]interface{}) (int64, error) {
+	where, args := BuildWhereClause(filter, 1)
+	query := fmt.Sprintf(`DELETE FROM threat_feeds %s`, where)
+	res, err := r.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
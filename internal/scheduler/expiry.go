@@ -0,0 +1,157 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/enjoys-in/secureflow/internal/constants"
+	"github.com/enjoys-in/secureflow/internal/db"
+	"github.com/enjoys-in/secureflow/internal/firewall"
+	"github.com/enjoys-in/secureflow/internal/repository"
+	"github.com/enjoys-in/secureflow/internal/websocket"
+	"github.com/enjoys-in/secureflow/pkg/logger"
+)
+
+// Expirer removes rules whose expires_at has passed from the kernel and the
+// database, and warns their owners shortly before. Just-in-time access
+// grants served by an expired rule are closed with it, and an expired group
+// rule leaves a revision in its group's history.
+type Expirer struct {
+	ruleRepo  repository.FirewallRuleRepository
+	sgRepo    repository.SecurityGroupRepository
+	revRepo   repository.SecurityGroupRevisionRepository
+	grantRepo repository.JITGrantRepository
+	auditRepo repository.AuditLogRepository
+	fw        *firewall.Manager
+	hub       *websocket.Hub
+	logger    *logger.Logger
+	warned    map[string]time.Time // rule ID -> expiry its owner was warned about
+}
+
+// NewExpirer creates a rule expiry worker.
+func NewExpirer(ruleRepo repository.FirewallRuleRepository, sgRepo repository.SecurityGroupRepository, revRepo repository.SecurityGroupRevisionRepository, grantRepo repository.JITGrantRepository, auditRepo repository.AuditLogRepository, fw *firewall.Manager, hub *websocket.Hub, log *logger.Logger) *Expirer {
+	return &Expirer{
+		ruleRepo:  ruleRepo,
+		sgRepo:    sgRepo,
+		revRepo:   revRepo,
+		grantRepo: grantRepo,
+		auditRepo: auditRepo,
+		fw:        fw,
+		hub:       hub,
+		logger:    log,
+		warned:    make(map[string]time.Time),
+	}
+}
+
+// Run sweeps for expiring rules immediately, so rules that expired while the
+// server was down go first, and then periodically until ctx is cancelled.
+func (e *Expirer) Run(ctx context.Context) {
+	ticker := time.NewTicker(constants.RuleExpiryCheckSeconds * time.Second)
+	defer ticker.Stop()
+
+	for {
+		if err := e.sweep(ctx); err != nil && ctx.Err() == nil {
+			e.logger.Error("Rule expiry sweep failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sweep expires every rule past its expiry and warns about those inside the
+// warning lead time.
+func (e *Expirer) sweep(ctx context.Context) error {
+	now := time.Now()
+	rules, err := e.ruleRepo.FindExpiring(ctx, now.Add(constants.RuleExpiryWarningMinutes*time.Minute))
+	if err != nil {
+		return fmt.Errorf("load expiring rules: %w", err)
+	}
+
+	pending := make(map[string]bool, len(rules))
+	for i := range rules {
+		r := &rules[i]
+		if !r.ExpiresAt.After(now) {
+			e.expire(ctx, r)
+			continue
+		}
+		pending[r.ID] = true
+		if e.warned[r.ID].Equal(*r.ExpiresAt) {
+			continue
+		}
+		e.warned[r.ID] = *r.ExpiresAt
+		e.hub.EmitRuleExpiring(r.ID, r.CreatedBy, r.Port, *r.ExpiresAt)
+	}
+
+	// Forget warnings for rules that were expired, deleted or extended.
+	for id := range e.warned {
+		if !pending[id] {
+			delete(e.warned, id)
+		}
+	}
+	return nil
+}
+
+// expire removes one rule. A rule the kernel refuses to drop is left in the
+// database so the next sweep retries it.
+func (e *Expirer) expire(ctx context.Context, r *db.FirewallRule) {
+	if e.fw.HasRule(r.ID) {
+		if err := e.fw.DeleteRule(r.ID); err != nil {
+			e.logger.Error("Failed to remove expired rule", "rule_id", r.ID, "error", err)
+			e.hub.EmitError("Failed to remove expired rule "+r.ID+": "+err.Error(), r.CreatedBy)
+			return
+		}
+	}
+	// Look the grant up first: deleting the rule clears its rule_id.
+	grant, _ := e.grantRepo.FindByRule(ctx, r.ID)
+	// A group rule goes together with the revision recording its removal,
+	// so the group's history never misses it.
+	err := e.revRepo.RunInTx(ctx, func(ctx context.Context) error {
+		if err := e.ruleRepo.DeleteNonImmutable(ctx, r.ID); err != nil {
+			return err
+		}
+		if r.SecurityGroupID == "" {
+			return nil
+		}
+		summary := fmt.Sprintf("Rule expired: port=%d protocol=%s action=%s", r.Port, r.Protocol, r.Action)
+		return repository.RecordRevision(ctx, e.sgRepo, e.ruleRepo, e.revRepo, r.SecurityGroupID, "", summary)
+	})
+	if err != nil {
+		e.logger.Error("Failed to delete expired rule", "rule_id", r.ID, "error", err)
+		return
+	}
+
+	_ = e.auditRepo.Create(ctx, &db.AuditLog{
+		Action:   constants.AuditActionExpireRule,
+		Resource: "firewall_rule:" + r.ID,
+		Details: fmt.Sprintf("Rule expired at %s: port=%d protocol=%s action=%s",
+			r.ExpiresAt.UTC().Format(time.RFC3339), r.Port, r.Protocol, r.Action),
+	})
+	e.hub.EmitRuleChange("expired", r.ID, r.CreatedBy, r.Port)
+	if grant != nil {
+		e.expireGrant(ctx, grant)
+	}
+
+	e.logger.Info("Rule expired", "rule_id", r.ID, "port", r.Port)
+}
+
+// expireGrant records that a just-in-time access grant ended with its rule.
+func (e *Expirer) expireGrant(ctx context.Context, g *db.JITGrant) {
+	if _, err := e.grantRepo.FindAndUpdate(ctx,
+		map[string]interface{}{"id": g.ID, "status": constants.JITStatusActive},
+		map[string]interface{}{"status": constants.JITStatusExpired},
+	); err != nil {
+		e.logger.Error("Failed to expire just-in-time access grant", "grant_id", g.ID, "error", err)
+		return
+	}
+
+	_ = e.auditRepo.Create(ctx, &db.AuditLog{
+		Action:   constants.AuditActionRevokeJITAccess,
+		Resource: "jit_grant:" + g.ID,
+		Details: fmt.Sprintf("Just-in-time access for %s to %s/%d expired after %dm: %s",
+			g.SourceIP, g.Protocol, g.Port, g.Minutes, g.Justification),
+	})
+}
@@ -0,0 +1,195 @@
+// Package scheduler runs the time-driven parts of the firewall: it turns
+// schedules (recurring time windows) on and off as their windows open and
+// close, and removes temporary rules once they expire.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+	_ "time/tzdata" // timezones must resolve on hosts without zoneinfo
+
+	"github.com/enjoys-in/secureflow/internal/constants"
+	"github.com/enjoys-in/secureflow/internal/db"
+	"github.com/enjoys-in/secureflow/internal/firewall"
+	"github.com/enjoys-in/secureflow/internal/repository"
+	"github.com/enjoys-in/secureflow/internal/websocket"
+	"github.com/enjoys-in/secureflow/pkg/logger"
+)
+
+// Window durations are bounded so evaluating a window stays cheap and a
+// window can never cover the whole week.
+const (
+	minWindow = time.Minute
+	maxWindow = 7 * 24 * time.Hour
+)
+
+// window is a parsed db.ScheduleWindow.
+type window struct {
+	spec     *cronSpec
+	duration time.Duration
+}
+
+// Validate checks a schedule's timezone and windows.
+func Validate(timezone string, windows []db.ScheduleWindow) error {
+	_, _, err := parse(timezone, windows)
+	return err
+}
+
+// Active reports whether one of a schedule's windows is open at t.
+func Active(s *db.Schedule, t time.Time) (bool, error) {
+	loc, windows, err := parse(s.Timezone, s.Windows)
+	if err != nil {
+		return false, err
+	}
+	t = t.In(loc)
+	for _, w := range windows {
+		if w.openAt(t) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func parse(timezone string, windows []db.ScheduleWindow) (*time.Location, []window, error) {
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid timezone %q", timezone)
+	}
+	if len(windows) == 0 {
+		return nil, nil, fmt.Errorf("at least one window is required")
+	}
+
+	out := make([]window, 0, len(windows))
+	for _, w := range windows {
+		spec, err := parseCron(w.Cron)
+		if err != nil {
+			return nil, nil, err
+		}
+		d, err := time.ParseDuration(w.Duration)
+		if err != nil || d < minWindow || d > maxWindow {
+			return nil, nil, fmt.Errorf("invalid window duration %q (want %s to %s)", w.Duration, minWindow, maxWindow)
+		}
+		out = append(out, window{spec: spec, duration: d})
+	}
+	return loc, out, nil
+}
+
+// openAt reports whether the window opened at some minute within its
+// duration before t.
+func (w window) openAt(t time.Time) bool {
+	for start := t.Truncate(time.Minute); t.Sub(start) < w.duration; start = start.Add(-time.Minute) {
+		if w.spec.matches(start) {
+			return true
+		}
+	}
+	return false
+}
+
+// Scheduler evaluates every schedule once a minute and pushes its state to
+// the firewall manager. Transitions are persisted, audited and broadcast.
+type Scheduler struct {
+	repo      repository.ScheduleRepository
+	auditRepo repository.AuditLogRepository
+	fw        *firewall.Manager
+	hub       *websocket.Hub
+	logger    *logger.Logger
+	mu        sync.Mutex // serialises evaluations from the ticker and the API
+}
+
+// New creates a scheduler.
+func New(repo repository.ScheduleRepository, auditRepo repository.AuditLogRepository, fw *firewall.Manager, hub *websocket.Hub, log *logger.Logger) *Scheduler {
+	return &Scheduler{repo: repo, auditRepo: auditRepo, fw: fw, hub: hub, logger: log}
+}
+
+// Run evaluates all schedules at the start of every minute until ctx is
+// cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		next := time.Now().Truncate(time.Minute).Add(time.Minute)
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if err := s.Sync(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Error("Schedule evaluation failed", "error", err)
+		}
+	}
+}
+
+// Sync evaluates every schedule now.
+func (s *Scheduler) Sync(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedules, err := s.repo.FindAll(ctx, nil, math.MaxInt32, 0)
+	if err != nil {
+		return fmt.Errorf("load schedules: %w", err)
+	}
+	now := time.Now()
+	for i := range schedules {
+		s.evaluate(ctx, &schedules[i], now)
+	}
+	return nil
+}
+
+// Refresh evaluates one schedule now, e.g. after its windows were edited.
+func (s *Scheduler) Refresh(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sched, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("load schedule %s: %w", id, err)
+	}
+	s.evaluate(ctx, sched, time.Now())
+	return nil
+}
+
+// evaluate pushes a schedule's current state to the firewall and records a
+// transition from the last persisted state. The caller must hold s.mu.
+func (s *Scheduler) evaluate(ctx context.Context, sched *db.Schedule, now time.Time) {
+	active, err := Active(sched, now)
+	if err != nil {
+		s.logger.Error("Invalid schedule", "schedule_id", sched.ID, "error", err)
+		return
+	}
+
+	activated, deactivated, err := s.fw.SetScheduleActive(sched.ID, active)
+	if err != nil {
+		s.logger.Error("Failed to apply schedule", "schedule_id", sched.ID, "error", err)
+		s.hub.EmitError(fmt.Sprintf("Failed to apply schedule %s: %v", sched.Name, err), "")
+	}
+
+	if active == sched.Active {
+		return
+	}
+	if err := s.repo.SetActive(ctx, sched.ID, active); err != nil {
+		s.logger.Error("Failed to record schedule state", "schedule_id", sched.ID, "error", err)
+		return
+	}
+	sched.Active = active
+
+	action, event, state := constants.AuditActionScheduleDeactivated, "schedule_deactivated", "closed"
+	if active {
+		action, event, state = constants.AuditActionScheduleActivated, "schedule_activated", "opened"
+	}
+	_ = s.auditRepo.Create(ctx, &db.AuditLog{
+		Action:   action,
+		Resource: "schedule:" + sched.ID,
+		Details: fmt.Sprintf("Schedule %s window %s (%d rules installed, %d rules removed)",
+			sched.Name, state, activated, deactivated),
+	})
+	s.hub.EmitRuleChange(event, sched.ID, "", 0)
+
+	s.logger.Info("Schedule transition", "schedule_id", sched.ID, "active", active,
+		"activated", activated, "deactivated", deactivated)
+}
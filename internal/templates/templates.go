@@ -0,0 +1,283 @@
+// Package templates provides the catalog of security group templates used to
+// bootstrap new servers. Built-in templates are embedded in the binary; more
+// can be loaded from a directory of JSON files, overriding built-ins by name.
+package templates
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	fwPkg "github.com/enjoys-in/secureflow/internal/firewall"
+	"github.com/enjoys-in/secureflow/pkg/logger"
+)
+
+//go:embed builtin/*.json
+var builtinFS embed.FS
+
+// placeholder matches ${param} references inside template rule fields.
+var placeholder = regexp.MustCompile(`\$\{([a-zA-Z0-9_]+)\}`)
+
+// Template describes a security group and its rules. String fields of the
+// rules, and the port fields, may reference parameters as ${name}.
+type Template struct {
+	Name        string         `json:"name"`
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	Parameters  []Parameter    `json:"parameters"`
+	Rules       []RuleTemplate `json:"rules"`
+	Source      string         `json:"source"` // "builtin" or the file it was loaded from
+}
+
+// Parameter is a value substituted into a template at instantiation time.
+type Parameter struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Default     string `json:"default,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// RuleTemplate is a firewall rule whose fields may contain placeholders.
+type RuleTemplate struct {
+	Direction    string `json:"direction"`
+	Protocol     string `json:"protocol"`
+	Port         Value  `json:"port,omitempty"`
+	PortRangeEnd Value  `json:"port_range_end,omitempty"`
+	SourceCIDR   string `json:"source_cidr,omitempty"`
+	DestCIDR     string `json:"dest_cidr,omitempty"`
+	Action       string `json:"action"`
+	Description  string `json:"description,omitempty"`
+}
+
+// Value is a template field written either as a JSON number or as a string,
+// so numeric fields can hold placeholders (e.g. "port": "${db_port}").
+type Value string
+
+// UnmarshalJSON accepts both numbers and strings.
+func (v *Value) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*v = Value(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return fmt.Errorf("expected number or string, got %s", b)
+	}
+	*v = Value(n.String())
+	return nil
+}
+
+// Rule is a rule produced by instantiating a template.
+type Rule struct {
+	Direction    string
+	Protocol     string
+	Port         int
+	PortRangeEnd int
+	SourceCIDR   string
+	DestCIDR     string
+	Action       string
+	Description  string
+}
+
+// Library is a read-only catalog of templates keyed by name.
+type Library struct {
+	templates map[string]*Template
+}
+
+// Load builds a library from the embedded templates plus every *.json file
+// in dir. dir may be empty, in which case only built-ins are available.
+func Load(dir string, log *logger.Logger) (*Library, error) {
+	lib := &Library{templates: make(map[string]*Template)}
+
+	if err := lib.loadFS(builtinFS, "builtin", "builtin"); err != nil {
+		return nil, fmt.Errorf("load builtin templates: %w", err)
+	}
+
+	if dir != "" {
+		if _, err := os.Stat(dir); err != nil {
+			return nil, fmt.Errorf("templates dir %s: %w", dir, err)
+		}
+		if err := lib.loadFS(os.DirFS(dir), ".", dir); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Info("Security group templates loaded", "count", len(lib.templates), "dir", dir)
+	return lib, nil
+}
+
+// loadFS parses every *.json file under root in fsys. Later files replace
+// earlier templates with the same name.
+func (l *Library) loadFS(fsys fs.FS, root, label string) error {
+	files, err := fs.Glob(fsys, filepath.ToSlash(filepath.Join(root, "*.json")))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for _, f := range files {
+		data, err := fs.ReadFile(fsys, f)
+		if err != nil {
+			return fmt.Errorf("read template %s: %w", f, err)
+		}
+
+		var t Template
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&t); err != nil {
+			return fmt.Errorf("parse template %s: %w", f, err)
+		}
+
+		t.Source = label
+		if label != "builtin" {
+			t.Source = filepath.Join(label, filepath.Base(f))
+		}
+		if err := t.check(); err != nil {
+			return fmt.Errorf("template %s: %w", f, err)
+		}
+		l.templates[t.Name] = &t
+	}
+	return nil
+}
+
+// List returns all templates sorted by name.
+func (l *Library) List() []Template {
+	out := make([]Template, 0, len(l.templates))
+	for _, t := range l.templates {
+		out = append(out, *t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Get returns the template with the given name.
+func (l *Library) Get(name string) (*Template, bool) {
+	t, ok := l.templates[name]
+	return t, ok
+}
+
+// check validates a template's structure: it must be named, have rules, and
+// every placeholder it uses must be a declared parameter.
+func (t *Template) check() error {
+	if t.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len(t.Rules) == 0 {
+		return fmt.Errorf("at least one rule is required")
+	}
+
+	declared := make(map[string]bool, len(t.Parameters))
+	for _, p := range t.Parameters {
+		if p.Name == "" {
+			return fmt.Errorf("parameter without a name")
+		}
+		if declared[p.Name] {
+			return fmt.Errorf("duplicate parameter %q", p.Name)
+		}
+		declared[p.Name] = true
+	}
+
+	for i, r := range t.Rules {
+		for _, field := range r.fields() {
+			for _, m := range placeholder.FindAllStringSubmatch(field, -1) {
+				if !declared[m[1]] {
+					return fmt.Errorf("rule %d uses undeclared parameter %q", i+1, m[1])
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// fields returns every substitutable field of the rule template.
+func (r RuleTemplate) fields() []string {
+	return []string{r.Direction, r.Protocol, string(r.Port), string(r.PortRangeEnd),
+		r.SourceCIDR, r.DestCIDR, r.Action, r.Description}
+}
+
+// Instantiate substitutes params into the template and returns validated
+// rules. Parameters not given fall back to their defaults; unknown or
+// missing required parameters are errors.
+func (t *Template) Instantiate(params map[string]string) ([]Rule, error) {
+	values := make(map[string]string, len(t.Parameters))
+	for _, p := range t.Parameters {
+		v, ok := params[p.Name]
+		if !ok || v == "" {
+			v = p.Default
+		}
+		if v == "" && p.Required {
+			return nil, fmt.Errorf("parameter %q is required", p.Name)
+		}
+		values[p.Name] = v
+	}
+	for name := range params {
+		if _, ok := values[name]; !ok {
+			return nil, fmt.Errorf("unknown parameter %q", name)
+		}
+	}
+
+	subst := func(s string) string {
+		return placeholder.ReplaceAllStringFunc(s, func(m string) string {
+			return values[placeholder.FindStringSubmatch(m)[1]]
+		})
+	}
+
+	rules := make([]Rule, 0, len(t.Rules))
+	for i, rt := range t.Rules {
+		port, err := intValue(subst(string(rt.Port)))
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: port: %w", i+1, err)
+		}
+		portEnd, err := intValue(subst(string(rt.PortRangeEnd)))
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: port_range_end: %w", i+1, err)
+		}
+
+		r := Rule{
+			Direction:    strings.ToLower(subst(rt.Direction)),
+			Protocol:     strings.ToLower(subst(rt.Protocol)),
+			Port:         port,
+			PortRangeEnd: portEnd,
+			SourceCIDR:   subst(rt.SourceCIDR),
+			DestCIDR:     subst(rt.DestCIDR),
+			Action:       strings.ToUpper(subst(rt.Action)),
+			Description:  subst(rt.Description),
+		}
+
+		if err := fwPkg.ValidateRule(fwPkg.Rule{
+			Direction:  r.Direction,
+			Protocol:   r.Protocol,
+			Port:       r.Port,
+			PortEnd:    r.PortRangeEnd,
+			SourceCIDR: r.SourceCIDR,
+			DestCIDR:   r.DestCIDR,
+			Action:     r.Action,
+		}); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// intValue parses an optional integer field.
+func intValue(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", s)
+	}
+	return n, nil
+}
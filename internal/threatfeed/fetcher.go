@@ -0,0 +1,259 @@
+// Package threatfeed keeps threat-intelligence blocklists current. Each feed
+// is fetched from a URL or read from a local file on its own interval, and
+// the difference to the previous fetch is applied to the blocked IPs tagged
+// with the feed and to the feed's kernel set.
+package threatfeed
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/enjoys-in/secureflow/internal/constants"
+	"github.com/enjoys-in/secureflow/internal/db"
+	"github.com/enjoys-in/secureflow/internal/firewall"
+	"github.com/enjoys-in/secureflow/internal/repository"
+	"github.com/enjoys-in/secureflow/internal/websocket"
+	"github.com/enjoys-in/secureflow/pkg/logger"
+)
+
+// Fetcher refreshes threat feeds and installs the rule that enforces each
+// enabled one.
+type Fetcher struct {
+	feedRepo    repository.ThreatFeedRepository
+	blockedRepo repository.BlockedIPRepository
+	auditRepo   repository.AuditLogRepository
+	fw          *firewall.Manager
+	hub         *websocket.Hub
+	client      *http.Client
+	logger      *logger.Logger
+
+	mu sync.Mutex // serialises refreshes, so a manual one cannot interleave with the scheduled one
+}
+
+// NewFetcher creates a threat feed fetcher.
+func NewFetcher(feedRepo repository.ThreatFeedRepository, blockedRepo repository.BlockedIPRepository, auditRepo repository.AuditLogRepository, fw *firewall.Manager, hub *websocket.Hub, log *logger.Logger) *Fetcher {
+	return &Fetcher{
+		feedRepo:    feedRepo,
+		blockedRepo: blockedRepo,
+		auditRepo:   auditRepo,
+		fw:          fw,
+		hub:         hub,
+		client:      &http.Client{Timeout: constants.FeedFetchTimeoutSeconds * time.Second},
+		logger:      log,
+	}
+}
+
+// Rule returns the firewall rule that blocks inbound traffic from a feed's
+// addresses. It shares the feed's ID.
+func Rule(feed *db.ThreatFeed) firewall.Rule {
+	return firewall.Rule{
+		ID:           feed.ID,
+		Direction:    "inbound",
+		Protocol:     "all",
+		SourceFeedID: feed.ID,
+		Action:       feed.Action,
+	}
+}
+
+// Restore installs the rules of all enabled feeds from their stored entries,
+// without fetching them (called on startup).
+func (f *Fetcher) Restore(ctx context.Context) error {
+	feeds, err := f.feedRepo.FindAll(ctx, map[string]interface{}{"enabled": true}, constants.MaxPageLimit, 0)
+	if err != nil {
+		return err
+	}
+	for i := range feeds {
+		if err := f.Install(&feeds[i]); err != nil {
+			f.logger.Error("Failed to install threat feed", "feed", feeds[i].Name, "error", err)
+		}
+	}
+	if len(feeds) > 0 {
+		f.logger.Info("Threat feeds restored", "count", len(feeds))
+	}
+	return nil
+}
+
+// Install makes the kernel match a feed's current definition: an enabled
+// feed's rule is added or replaced, a disabled feed's rule is removed.
+func (f *Fetcher) Install(feed *db.ThreatFeed) error {
+	if !feed.Enabled {
+		return f.Uninstall(feed.ID)
+	}
+	if f.fw.HasRule(feed.ID) {
+		return f.fw.ReplaceRule(Rule(feed))
+	}
+	return f.fw.AddRule(Rule(feed))
+}
+
+// Uninstall removes a feed's rule; its kernel set goes with it.
+func (f *Fetcher) Uninstall(feedID string) error {
+	if !f.fw.HasRule(feedID) {
+		return nil
+	}
+	return f.fw.DeleteRule(feedID)
+}
+
+// Run refreshes feeds as they come due, starting with those that went stale
+// while the server was down, until ctx is cancelled.
+func (f *Fetcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(constants.FeedCheckSeconds * time.Second)
+	defer ticker.Stop()
+
+	for {
+		f.check(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check refreshes every enabled feed whose interval has passed since its last
+// fetch attempt. Failed feeds are retried on their next interval.
+func (f *Fetcher) check(ctx context.Context, now time.Time) {
+	feeds, err := f.feedRepo.FindAll(ctx, map[string]interface{}{"enabled": true}, constants.MaxPageLimit, 0)
+	if err != nil {
+		if ctx.Err() == nil {
+			f.logger.Error("Failed to load threat feeds", "error", err)
+		}
+		return
+	}
+	for i := range feeds {
+		feed := &feeds[i]
+		if feed.LastFetchedAt != nil && now.Before(feed.LastFetchedAt.Add(time.Duration(feed.RefreshMinutes)*time.Minute)) {
+			continue
+		}
+		if _, err := f.Refresh(ctx, feed.ID); err != nil {
+			f.logger.Warn("Threat feed refresh failed", "feed", feed.Name, "error", err)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// Refresh fetches a feed now and applies the changes. The outcome, including
+// a failure, is recorded on the feed, which is returned as updated.
+func (f *Fetcher) Refresh(ctx context.Context, feedID string) (*db.ThreatFeed, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	feed, err := f.feedRepo.FindByID(ctx, feedID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	added, removed, res, err := f.apply(ctx, feed)
+	if err != nil {
+		updated, uerr := f.feedRepo.FindByIDAndUpdate(ctx, feed.ID, map[string]interface{}{
+			"last_fetched_at": now,
+			"last_error":      err.Error(),
+		})
+		if uerr != nil {
+			f.logger.Error("Failed to record threat feed error", "feed", feed.Name, "error", uerr)
+			updated = feed
+		}
+		if feed.LastError == "" {
+			// Only the first failure in a row is pushed to users.
+			f.hub.EmitError(fmt.Sprintf("Threat feed %s failed: %s", feed.Name, err), "")
+		}
+		return updated, err
+	}
+
+	updated, err := f.feedRepo.FindByIDAndUpdate(ctx, feed.ID, map[string]interface{}{
+		"entry_count":     len(res.Entries),
+		"skipped_count":   res.Skipped,
+		"last_added":      added,
+		"last_removed":    removed,
+		"last_fetched_at": now,
+		"last_success_at": now,
+		"last_error":      "",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if added > 0 || removed > 0 {
+		_ = f.auditRepo.Create(ctx, &db.AuditLog{
+			Action:   constants.AuditActionThreatFeedRefreshed,
+			Resource: "threat_feed:" + feed.ID,
+			Details:  fmt.Sprintf("Threat feed %s refreshed: %d entries, %d added, %d removed", feed.Name, len(res.Entries), added, removed),
+		})
+	}
+	f.logger.Info("Threat feed refreshed", "feed", feed.Name, "entries", len(res.Entries), "added", added, "removed", removed, "skipped", res.Skipped)
+	return updated, nil
+}
+
+// apply fetches and parses a feed, stores the difference to its current
+// entries and refreshes its kernel set.
+func (f *Fetcher) apply(ctx context.Context, feed *db.ThreatFeed) (added, removed int, res *Result, err error) {
+	body, err := f.open(ctx, feed.Source)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	defer body.Close()
+
+	// Read one byte past the limit to tell a full-size feed from a cut one.
+	limited := &io.LimitedReader{R: body, N: constants.FeedMaxBytes + 1}
+	res, err = Parse(limited, feed.Format, feed.CSVColumn)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if limited.N == 0 {
+		return 0, 0, nil, fmt.Errorf("feed is larger than %d bytes", constants.FeedMaxBytes)
+	}
+
+	prev, err := f.blockedRepo.ListFeedIPs(ctx, feed.ID, "")
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("load current entries: %w", err)
+	}
+	add, remove := diff(prev, res.Entries)
+	if err := f.blockedRepo.SyncFeed(ctx, feed.ID, feed.Name, add, remove); err != nil {
+		return 0, 0, nil, fmt.Errorf("store entries: %w", err)
+	}
+	if err := f.fw.RefreshReference(firewall.RefThreatFeed, feed.ID); err != nil {
+		return 0, 0, nil, fmt.Errorf("refresh kernel set: %w", err)
+	}
+	return len(add), len(remove), res, nil
+}
+
+// open returns the content of a feed source: an http(s) URL or a local path.
+func (f *Fetcher) open(ctx context.Context, source string) (io.ReadCloser, error) {
+	if !IsURL(source) {
+		file, err := os.Open(source)
+		if err != nil {
+			return nil, fmt.Errorf("open feed file: %w", err)
+		}
+		return file, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "secureflow-threatfeed")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("download feed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("download feed: server answered %s", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// IsURL reports whether a feed source is downloaded rather than read from a
+// local file.
+func IsURL(source string) bool {
+	lower := strings.ToLower(source)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
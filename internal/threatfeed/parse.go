@@ -0,0 +1,155 @@
+package threatfeed
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/enjoys-in/secureflow/internal/constants"
+)
+
+// Result is the parsed content of one fetch.
+type Result struct {
+	Entries []string // IPv4 addresses and networks, deduplicated and sorted
+	Skipped int      // lines that held no usable IPv4 address or network
+}
+
+// Parse reads a feed in the given format. Blank lines and comments starting
+// with '#' or ';' are ignored; anything else that does not hold an IPv4
+// address (or, except in plain feeds, network) is counted as skipped, which
+// covers CSV headers and IPv6 entries the kernel sets cannot hold.
+func Parse(r io.Reader, format string, column int) (*Result, error) {
+	seen := make(map[string]bool)
+	res := &Result{}
+	add := func(token string, allowNet bool) error {
+		entry, ok := normalize(token, allowNet)
+		if !ok {
+			res.Skipped++
+			return nil
+		}
+		if seen[entry] {
+			return nil
+		}
+		if len(seen) >= constants.FeedMaxEntries {
+			return fmt.Errorf("feed has more than %d entries", constants.FeedMaxEntries)
+		}
+		seen[entry] = true
+		return nil
+	}
+
+	switch format {
+	case constants.FeedFormatPlain, constants.FeedFormatCIDR:
+		sc := bufio.NewScanner(r)
+		sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for sc.Scan() {
+			line := stripComment(sc.Text())
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+			if err := add(fields[0], format == constants.FeedFormatCIDR); err != nil {
+				return nil, err
+			}
+		}
+		if err := sc.Err(); err != nil {
+			return nil, fmt.Errorf("read feed: %w", err)
+		}
+
+	case constants.FeedFormatCSV:
+		cr := csv.NewReader(r)
+		cr.Comment = '#'
+		cr.FieldsPerRecord = -1
+		cr.LazyQuotes = true
+		cr.ReuseRecord = true
+		for {
+			record, err := cr.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("read feed: %w", err)
+			}
+			if column >= len(record) {
+				res.Skipped++
+				continue
+			}
+			if err := add(strings.TrimSpace(record[column]), true); err != nil {
+				return nil, err
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown feed format %q", format)
+	}
+
+	res.Entries = make([]string, 0, len(seen))
+	for entry := range seen {
+		res.Entries = append(res.Entries, entry)
+	}
+	sort.Strings(res.Entries)
+	return res, nil
+}
+
+// stripComment removes a trailing '#' or ';' comment, as used by e.g. the
+// Spamhaus DROP list ("1.2.3.0/24 ; SBL123").
+func stripComment(line string) string {
+	if i := strings.IndexAny(line, "#;"); i >= 0 {
+		line = line[:i]
+	}
+	return line
+}
+
+// normalize returns the canonical form of an IPv4 address or, when allowNet
+// is set, network: addresses and /32 networks as "a.b.c.d", other networks
+// with their host bits cleared.
+func normalize(token string, allowNet bool) (string, bool) {
+	if !strings.Contains(token, "/") {
+		ip := net.ParseIP(token).To4()
+		if ip == nil {
+			return "", false
+		}
+		return ip.String(), true
+	}
+	if !allowNet {
+		return "", false
+	}
+	ip, ipNet, err := net.ParseCIDR(token)
+	if err != nil || ip.To4() == nil {
+		return "", false
+	}
+	ones, _ := ipNet.Mask.Size()
+	if ones < constants.FeedMinPrefixLength {
+		return "", false
+	}
+	if ones == 32 {
+		return ip.To4().String(), true
+	}
+	return ipNet.String(), true
+}
+
+// diff returns the entries of next missing from prev and those of prev
+// missing from next.
+func diff(prev, next []string) (added, removed []string) {
+	in := make(map[string]bool, len(next))
+	for _, e := range next {
+		in[e] = true
+	}
+	had := make(map[string]bool, len(prev))
+	for _, e := range prev {
+		had[e] = true
+		if !in[e] {
+			removed = append(removed, e)
+		}
+	}
+	for _, e := range next {
+		if !had[e] {
+			added = append(added, e)
+		}
+	}
+	return added, removed
+}
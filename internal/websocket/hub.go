@@ -21,8 +21,14 @@ type Event struct {
 	Protocol  string    `json:"protocol,omitempty"`
 	Port      int       `json:"port,omitempty"`
 	Action    string    `json:"action,omitempty"`
+	Match     string    `json:"match,omitempty"` // limit a traffic event tripped, e.g. "CONNLIMIT", or an alert's kind
 	User      string    `json:"user,omitempty"`
 	Message   string    `json:"message,omitempty"`
+
+	// SrcCountry / DstCountry are the ISO country codes of a traffic event's
+	// addresses, set when a GeoIP database is loaded.
+	SrcCountry string `json:"src_country,omitempty"`
+	DstCountry string `json:"dst_country,omitempty"`
 }
 
 // Client represents a connected WebSocket client.
@@ -133,6 +139,32 @@ func (h *Hub) EmitRuleChange(action, ruleID, user string, port int) {
 	})
 }
 
+// EmitRuleExpiring warns that a temporary rule is about to be removed. user
+// is the rule's owner.
+func (h *Hub) EmitRuleExpiring(ruleID, user string, port int, expiresAt time.Time) {
+	h.Emit(Event{
+		Type:    constants.EventTypeRuleChange,
+		Action:  "expiring",
+		RuleID:  ruleID,
+		User:    user,
+		Port:    port,
+		Message: "rule expires at " + expiresAt.UTC().Format(time.RFC3339),
+	})
+}
+
+// EmitBan reports that a jail or detector banned ("banned") or released
+// ("unbanned") a source address. ruleID is the jail's ID or the detector's
+// name.
+func (h *Hub) EmitBan(action, ruleID, ip, message string) {
+	h.Emit(Event{
+		Type:    constants.EventTypeRuleChange,
+		Action:  action,
+		RuleID:  ruleID,
+		SrcIP:   ip,
+		Message: message,
+	})
+}
+
 // EmitError publishes an error event.
 func (h *Hub) EmitError(message, user string) {
 	h.Emit(Event{
@@ -142,15 +174,49 @@ func (h *Hub) EmitError(message, user string) {
 	})
 }
 
-// EmitTraffic publishes a traffic event.
-func (h *Hub) EmitTraffic(srcIP, dstIP, protocol, action string, port int) {
+// EmitTraffic publishes a traffic event. The country codes may be empty.
+func (h *Hub) EmitTraffic(srcIP, dstIP, protocol, action string, port int, srcCountry, dstCountry string) {
 	h.Emit(Event{
-		Type:     constants.EventTypeTraffic,
+		Type:       constants.EventTypeTraffic,
+		SrcIP:      srcIP,
+		DstIP:      dstIP,
+		Protocol:   protocol,
+		Action:     action,
+		Port:       port,
+		SrcCountry: srcCountry,
+		DstCountry: dstCountry,
+	})
+}
+
+// EmitLimitHit publishes a traffic event for a packet that tripped a rule's
+// limit, naming the rule and the kind of limit.
+func (h *Hub) EmitLimitHit(srcIP, dstIP, protocol, action, match, ruleID string, port int, srcCountry, dstCountry string) {
+	h.Emit(Event{
+		Type:       constants.EventTypeTraffic,
+		RuleID:     ruleID,
+		SrcIP:      srcIP,
+		DstIP:      dstIP,
+		Protocol:   protocol,
+		Action:     action,
+		Match:      match,
+		Port:       port,
+		SrcCountry: srcCountry,
+		DstCountry: dstCountry,
+	})
+}
+
+// EmitAlert publishes a detection, e.g. a port scan. kind is the alert's
+// kind, and action is "detected" or "blocked" if the source was blocked.
+func (h *Hub) EmitAlert(kind, action, srcIP, dstIP, protocol string, port int, message string) {
+	h.Emit(Event{
+		Type:     constants.EventTypeAlert,
+		Match:    kind,
+		Action:   action,
 		SrcIP:    srcIP,
 		DstIP:    dstIP,
 		Protocol: protocol,
-		Action:   action,
 		Port:     port,
+		Message:  message,
 	})
 }
 
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_sg_revisions_sg;
+DROP TABLE IF EXISTS security_group_revisions;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS security_group_revisions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    security_group_id UUID NOT NULL REFERENCES security_groups(id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    description TEXT DEFAULT '',
+    rules JSONB NOT NULL DEFAULT '[]',
+    change_summary TEXT DEFAULT '',
+    created_by UUID REFERENCES users(id),
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    UNIQUE (security_group_id, revision)
+);
+
+CREATE INDEX IF NOT EXISTS idx_sg_revisions_sg ON security_group_revisions(security_group_id);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_servers_local;
+ALTER TABLE servers DROP COLUMN IF EXISTS is_local;
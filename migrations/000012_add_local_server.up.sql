@@ -0,0 +1,4 @@
+ALTER TABLE servers ADD COLUMN IF NOT EXISTS is_local BOOLEAN DEFAULT FALSE;
+
+-- At most one row represents the host this instance runs on.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_servers_local ON servers(is_local) WHERE is_local;
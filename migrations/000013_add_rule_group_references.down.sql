@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_firewall_rules_dest_group;
+DROP INDEX IF EXISTS idx_firewall_rules_source_group;
+ALTER TABLE firewall_rules DROP COLUMN IF EXISTS dest_group_id;
+ALTER TABLE firewall_rules DROP COLUMN IF EXISTS source_group_id;
@@ -0,0 +1,6 @@
+-- A rule may match the members of another security group instead of a literal CIDR.
+ALTER TABLE firewall_rules ADD COLUMN IF NOT EXISTS source_group_id UUID REFERENCES security_groups(id);
+ALTER TABLE firewall_rules ADD COLUMN IF NOT EXISTS dest_group_id UUID REFERENCES security_groups(id);
+
+CREATE INDEX IF NOT EXISTS idx_firewall_rules_source_group ON firewall_rules(source_group_id) WHERE source_group_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_firewall_rules_dest_group ON firewall_rules(dest_group_id) WHERE dest_group_id IS NOT NULL;
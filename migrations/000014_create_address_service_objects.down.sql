@@ -0,0 +1,5 @@
+ALTER TABLE firewall_rules DROP COLUMN IF EXISTS service_id;
+ALTER TABLE firewall_rules DROP COLUMN IF EXISTS dest_address_id;
+ALTER TABLE firewall_rules DROP COLUMN IF EXISTS source_address_id;
+DROP TABLE IF EXISTS service_objects;
+DROP TABLE IF EXISTS address_objects;
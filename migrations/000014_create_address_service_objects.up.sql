@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS address_objects (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(255) NOT NULL UNIQUE,
+    description TEXT DEFAULT '',
+    addresses JSONB NOT NULL DEFAULT '[]',
+    created_by UUID REFERENCES users(id),
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS service_objects (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(255) NOT NULL UNIQUE,
+    description TEXT DEFAULT '',
+    protocol VARCHAR(10) NOT NULL CHECK (protocol IN ('tcp', 'udp')),
+    ports JSONB NOT NULL DEFAULT '[]',
+    created_by UUID REFERENCES users(id),
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Rules may take their addresses and ports from these objects instead of literals.
+ALTER TABLE firewall_rules ADD COLUMN IF NOT EXISTS source_address_id UUID REFERENCES address_objects(id);
+ALTER TABLE firewall_rules ADD COLUMN IF NOT EXISTS dest_address_id UUID REFERENCES address_objects(id);
+ALTER TABLE firewall_rules ADD COLUMN IF NOT EXISTS service_id UUID REFERENCES service_objects(id);
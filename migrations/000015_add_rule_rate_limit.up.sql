@@ -0,0 +1,3 @@
+-- Optional rate limit: the rule only acts on traffic above the rate.
+-- Shape: {"rate": 10, "unit": "minute", "burst": 5, "per_source": true, "mode": "connections"}
+ALTER TABLE firewall_rules ADD COLUMN IF NOT EXISTS rate_limit JSONB;
@@ -0,0 +1,4 @@
+-- Optional concurrent connection cap: the rule only acts on new connections
+-- from a source already holding more than max.
+-- Shape: {"max": 20, "mask": 32}
+ALTER TABLE firewall_rules ADD COLUMN IF NOT EXISTS conn_limit JSONB;
@@ -0,0 +1,3 @@
+-- SYN flood protection: handshakes to the rule's ports are answered by
+-- SYNPROXY before the connection reaches the rule.
+ALTER TABLE firewall_rules ADD COLUMN IF NOT EXISTS synproxy BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,20 @@
+-- Address translation rules, installed on the server that owns them.
+CREATE TABLE IF NOT EXISTS nat_rules (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    server_id UUID NOT NULL REFERENCES servers(id) ON DELETE CASCADE,
+    type VARCHAR(16) NOT NULL CHECK (type IN ('dnat', 'snat', 'masquerade')),
+    interface VARCHAR(15) DEFAULT '',
+    protocol VARCHAR(10) NOT NULL CHECK (protocol IN ('tcp', 'udp', 'all')),
+    source_cidr VARCHAR(50) DEFAULT '',
+    dest_cidr VARCHAR(50) DEFAULT '',
+    port INTEGER DEFAULT 0 CHECK (port >= 0 AND port <= 65535),
+    port_range_end INTEGER DEFAULT 0,
+    to_address VARCHAR(45) DEFAULT '',
+    to_port INTEGER DEFAULT 0 CHECK (to_port >= 0 AND to_port <= 65535),
+    description TEXT DEFAULT '',
+    created_by UUID REFERENCES users(id),
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_nat_rules_server ON nat_rules(server_id);
@@ -0,0 +1,3 @@
+ALTER TABLE nat_rules ALTER COLUMN interface TYPE VARCHAR(15);
+ALTER TABLE firewall_rules DROP COLUMN IF EXISTS out_interface;
+ALTER TABLE firewall_rules DROP COLUMN IF EXISTS in_interface;
@@ -0,0 +1,7 @@
+-- Interface matching: inbound rules may match the incoming interface and
+-- outbound rules the outgoing one; a trailing '*' matches by prefix.
+ALTER TABLE firewall_rules ADD COLUMN IF NOT EXISTS in_interface VARCHAR(16) DEFAULT '';
+ALTER TABLE firewall_rules ADD COLUMN IF NOT EXISTS out_interface VARCHAR(16) DEFAULT '';
+
+-- Room for a full-length name followed by the '*' wildcard.
+ALTER TABLE nat_rules ALTER COLUMN interface TYPE VARCHAR(16);
@@ -0,0 +1,4 @@
+ALTER TABLE firewall_rules DROP COLUMN IF EXISTS icmp_code;
+ALTER TABLE firewall_rules DROP COLUMN IF EXISTS icmp_type;
+ALTER TABLE firewall_rules DROP COLUMN IF EXISTS source_port_end;
+ALTER TABLE firewall_rules DROP COLUMN IF EXISTS source_port;
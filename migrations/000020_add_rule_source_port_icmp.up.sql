@@ -0,0 +1,6 @@
+-- Source port matching for TCP/UDP rules, and ICMP type/code matching for
+-- icmp rules (NULL matches any type or code).
+ALTER TABLE firewall_rules ADD COLUMN IF NOT EXISTS source_port INTEGER NOT NULL DEFAULT 0 CHECK (source_port >= 0 AND source_port <= 65535);
+ALTER TABLE firewall_rules ADD COLUMN IF NOT EXISTS source_port_end INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE firewall_rules ADD COLUMN IF NOT EXISTS icmp_type SMALLINT CHECK (icmp_type >= 0 AND icmp_type <= 255);
+ALTER TABLE firewall_rules ADD COLUMN IF NOT EXISTS icmp_code SMALLINT CHECK (icmp_code >= 0 AND icmp_code <= 255);
@@ -0,0 +1 @@
+ALTER TABLE firewall_rules DROP COLUMN IF EXISTS ports;
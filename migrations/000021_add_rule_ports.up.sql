@@ -0,0 +1,3 @@
+-- Port lists: a rule may match several destination ports and ranges instead
+-- of a single port/port_range_end, e.g. [{"port":80},{"port":443}].
+ALTER TABLE firewall_rules ADD COLUMN IF NOT EXISTS ports JSONB;
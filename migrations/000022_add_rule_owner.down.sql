@@ -0,0 +1,3 @@
+ALTER TABLE firewall_rules DROP COLUMN IF EXISTS cgroup;
+ALTER TABLE firewall_rules DROP COLUMN IF EXISTS owner_group;
+ALTER TABLE firewall_rules DROP COLUMN IF EXISTS owner_user;
@@ -0,0 +1,6 @@
+-- Socket owner matching for outbound rules: a user and/or group (name or
+-- numeric ID) and a cgroup (systemd unit or cgroup v2 path), resolved to
+-- kernel IDs each time the rule is installed.
+ALTER TABLE firewall_rules ADD COLUMN IF NOT EXISTS owner_user VARCHAR(64) DEFAULT '';
+ALTER TABLE firewall_rules ADD COLUMN IF NOT EXISTS owner_group VARCHAR(64) DEFAULT '';
+ALTER TABLE firewall_rules ADD COLUMN IF NOT EXISTS cgroup VARCHAR(255) DEFAULT '';
@@ -0,0 +1,3 @@
+ALTER TABLE server_security_groups DROP COLUMN IF EXISTS schedule_id;
+ALTER TABLE firewall_rules DROP COLUMN IF EXISTS schedule_id;
+DROP TABLE IF EXISTS schedules;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS schedules (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(255) NOT NULL UNIQUE,
+    description TEXT DEFAULT '',
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    windows JSONB NOT NULL DEFAULT '[]',
+    active BOOLEAN NOT NULL DEFAULT FALSE,
+    created_by UUID REFERENCES users(id),
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Rules and security group applications may be limited to a schedule's
+-- windows. "active" persists the last evaluated state so transitions are
+-- audited exactly once across restarts.
+ALTER TABLE firewall_rules ADD COLUMN IF NOT EXISTS schedule_id UUID REFERENCES schedules(id);
+ALTER TABLE server_security_groups ADD COLUMN IF NOT EXISTS schedule_id UUID REFERENCES schedules(id);
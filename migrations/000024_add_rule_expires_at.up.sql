@@ -0,0 +1,3 @@
+-- Temporary rules are removed by the expiry worker once expires_at passes.
+ALTER TABLE firewall_rules ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS idx_firewall_rules_expires_at ON firewall_rules(expires_at) WHERE expires_at IS NOT NULL;
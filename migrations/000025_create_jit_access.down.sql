@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS jit_grants;
+DROP TABLE IF EXISTS jit_policies;
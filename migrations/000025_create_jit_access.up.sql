@@ -0,0 +1,35 @@
+-- Just-in-time access: users open a policy's port to their own IP for a
+-- limited time, optionally after approval by an admin.
+CREATE TABLE IF NOT EXISTS jit_policies (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    port INT NOT NULL CHECK (port BETWEEN 1 AND 65535),
+    protocol VARCHAR(10) NOT NULL DEFAULT 'tcp' CHECK (protocol IN ('tcp', 'udp')),
+    description TEXT DEFAULT '',
+    max_minutes JSONB NOT NULL DEFAULT '{}',
+    requires_approval BOOLEAN NOT NULL DEFAULT FALSE,
+    created_by UUID REFERENCES users(id),
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW(),
+    UNIQUE (port, protocol)
+);
+
+CREATE TABLE IF NOT EXISTS jit_grants (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    policy_id UUID REFERENCES jit_policies(id) ON DELETE SET NULL,
+    user_id UUID NOT NULL REFERENCES users(id),
+    source_ip VARCHAR(45) NOT NULL,
+    port INT NOT NULL,
+    protocol VARCHAR(10) NOT NULL,
+    minutes INT NOT NULL CHECK (minutes > 0),
+    justification TEXT NOT NULL,
+    status VARCHAR(10) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'active', 'denied', 'expired', 'revoked')),
+    rule_id UUID REFERENCES firewall_rules(id) ON DELETE SET NULL,
+    decided_by UUID REFERENCES users(id),
+    expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_jit_grants_status ON jit_grants(status);
+CREATE INDEX IF NOT EXISTS idx_jit_grants_rule_id ON jit_grants(rule_id);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS knock_gates;
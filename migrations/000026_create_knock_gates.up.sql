@@ -0,0 +1,18 @@
+-- Port knocking gates: a source that hits the secret sequence of knock ports
+-- is allowed to reach the protected port for a while. The sequence itself is
+-- only stored as a salted hash.
+CREATE TABLE IF NOT EXISTS knock_gates (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(255) NOT NULL UNIQUE,
+    description TEXT DEFAULT '',
+    port INT NOT NULL CHECK (port BETWEEN 1 AND 65535),
+    protocol VARCHAR(10) NOT NULL DEFAULT 'tcp' CHECK (protocol IN ('tcp', 'udp')),
+    sequence_hash VARCHAR(64) NOT NULL,
+    sequence_salt VARCHAR(32) NOT NULL,
+    sequence_length INT NOT NULL,
+    window_seconds INT NOT NULL DEFAULT 10,
+    open_seconds INT NOT NULL DEFAULT 300,
+    created_by UUID REFERENCES users(id),
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
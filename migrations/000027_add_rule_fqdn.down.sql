@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS fqdn_resolutions;
+ALTER TABLE firewall_rules DROP COLUMN IF EXISTS dest_fqdn;
+ALTER TABLE firewall_rules DROP COLUMN IF EXISTS source_fqdn;
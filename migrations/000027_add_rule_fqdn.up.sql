@@ -0,0 +1,15 @@
+-- Rules may match the addresses a hostname resolves to instead of a CIDR.
+ALTER TABLE firewall_rules ADD COLUMN IF NOT EXISTS source_fqdn VARCHAR(253) NOT NULL DEFAULT '';
+ALTER TABLE firewall_rules ADD COLUMN IF NOT EXISTS dest_fqdn VARCHAR(253) NOT NULL DEFAULT '';
+
+-- Every change in what a rule hostname resolved to, so audits can tell which
+-- addresses a rule matched at a given time.
+CREATE TABLE IF NOT EXISTS fqdn_resolutions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    hostname VARCHAR(253) NOT NULL,
+    addresses JSONB NOT NULL DEFAULT '[]',
+    ttl_seconds INT NOT NULL DEFAULT 0,
+    resolved_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_fqdn_resolutions_hostname ON fqdn_resolutions(hostname, resolved_at DESC);
@@ -0,0 +1,2 @@
+ALTER TABLE firewall_rules DROP COLUMN IF EXISTS dest_countries;
+ALTER TABLE firewall_rules DROP COLUMN IF EXISTS source_countries;
@@ -0,0 +1,3 @@
+-- Rules may match the GeoIP networks of a list of country codes, e.g. ["CN","RU"].
+ALTER TABLE firewall_rules ADD COLUMN IF NOT EXISTS source_countries JSONB;
+ALTER TABLE firewall_rules ADD COLUMN IF NOT EXISTS dest_countries JSONB;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_blocked_ips_feed_id;
+ALTER TABLE blocked_ips DROP COLUMN IF EXISTS feed_id;
+DROP TABLE IF EXISTS threat_feeds;
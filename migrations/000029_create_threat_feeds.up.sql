@@ -0,0 +1,26 @@
+-- Threat-intelligence blocklists fetched from a URL or read from a local
+-- file. Each feed is installed as one kernel set with a single blocking rule.
+CREATE TABLE IF NOT EXISTS threat_feeds (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(255) NOT NULL UNIQUE,
+    source TEXT NOT NULL,
+    format VARCHAR(10) NOT NULL DEFAULT 'cidr' CHECK (format IN ('plain', 'cidr', 'csv')),
+    csv_column INT NOT NULL DEFAULT 0,
+    refresh_minutes INT NOT NULL DEFAULT 60,
+    action VARCHAR(10) NOT NULL DEFAULT 'DROP' CHECK (action IN ('DROP', 'REJECT')),
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    entry_count INT NOT NULL DEFAULT 0,
+    skipped_count INT NOT NULL DEFAULT 0,
+    last_added INT NOT NULL DEFAULT 0,
+    last_removed INT NOT NULL DEFAULT 0,
+    last_fetched_at TIMESTAMPTZ,
+    last_success_at TIMESTAMPTZ,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_by UUID REFERENCES users(id),
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Feed entries live alongside manual blocks, tagged with their feed.
+ALTER TABLE blocked_ips ADD COLUMN IF NOT EXISTS feed_id UUID REFERENCES threat_feeds(id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS idx_blocked_ips_feed_id ON blocked_ips(feed_id);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_blocked_ips_expires_at;
+DROP INDEX IF EXISTS idx_blocked_ips_jail_id;
+ALTER TABLE blocked_ips DROP COLUMN IF EXISTS expires_at;
+ALTER TABLE blocked_ips DROP COLUMN IF EXISTS jail_id;
+DROP TABLE IF EXISTS jails;
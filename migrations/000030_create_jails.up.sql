@@ -0,0 +1,24 @@
+-- Jails ban sources that fail authentication too often, fail2ban-style: log
+-- lines matching a jail's filters count as failures of the address in them.
+CREATE TABLE IF NOT EXISTS jails (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(255) NOT NULL UNIQUE,
+    log_path TEXT NOT NULL,
+    log_format VARCHAR(10) NOT NULL DEFAULT 'plain' CHECK (log_format IN ('plain', 'journal')),
+    filters JSONB NOT NULL DEFAULT '[]',
+    ignore_cidrs JSONB NOT NULL DEFAULT '[]',
+    max_failures INT NOT NULL DEFAULT 5,
+    find_seconds INT NOT NULL DEFAULT 600,
+    ban_seconds INT NOT NULL DEFAULT 3600,
+    action VARCHAR(10) NOT NULL DEFAULT 'DROP' CHECK (action IN ('DROP', 'REJECT')),
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_by UUID REFERENCES users(id),
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Bans are blocked IPs tagged with their jail that lift at expires_at.
+ALTER TABLE blocked_ips ADD COLUMN IF NOT EXISTS jail_id UUID REFERENCES jails(id) ON DELETE CASCADE;
+ALTER TABLE blocked_ips ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS idx_blocked_ips_jail_id ON blocked_ips(jail_id);
+CREATE INDEX IF NOT EXISTS idx_blocked_ips_expires_at ON blocked_ips(expires_at) WHERE expires_at IS NOT NULL;
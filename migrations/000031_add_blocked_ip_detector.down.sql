@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_blocked_ips_detector;
+ALTER TABLE blocked_ips DROP COLUMN IF EXISTS detector;
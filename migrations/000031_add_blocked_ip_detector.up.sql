@@ -0,0 +1,4 @@
+-- Traffic detectors such as the port-scan detector block sources as blocked
+-- IPs tagged with the detector's name, usually with an expires_at.
+ALTER TABLE blocked_ips ADD COLUMN IF NOT EXISTS detector VARCHAR(32);
+CREATE INDEX IF NOT EXISTS idx_blocked_ips_detector ON blocked_ips(detector) WHERE detector IS NOT NULL;
@@ -0,0 +1,15 @@
+-- Honeypots are decoy ports nothing legitimate connects to; any source that
+-- touches one is blocked for block_seconds.
+CREATE TABLE IF NOT EXISTS honeypots (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(255) NOT NULL UNIQUE,
+    protocol VARCHAR(10) NOT NULL DEFAULT 'tcp' CHECK (protocol IN ('tcp', 'udp')),
+    port INT NOT NULL CHECK (port BETWEEN 1 AND 65535),
+    mode VARCHAR(10) NOT NULL DEFAULT 'listener' CHECK (mode IN ('listener', 'nflog')),
+    block_seconds INT NOT NULL DEFAULT 86400,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_by UUID REFERENCES users(id),
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW(),
+    UNIQUE (protocol, port)
+);
@@ -0,0 +1,22 @@
+package utils
+
+import "net"
+
+// PrimaryIPv4 returns the first non-loopback IPv4 address of the host,
+// or "127.0.0.1" if none is configured.
+func PrimaryIPv4() string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return "127.0.0.1"
+	}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() {
+			continue
+		}
+		if ip4 := ipNet.IP.To4(); ip4 != nil {
+			return ip4.String()
+		}
+	}
+	return "127.0.0.1"
+}